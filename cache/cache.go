@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+
+	"github.com/djherbis/times"
 )
 
 // DirCache is an LRU file cache backed by a directory. Callers that write new
@@ -28,8 +30,8 @@ func (c *DirCache) RLock()   { c.mu.RLock() }
 func (c *DirCache) RUnlock() { c.mu.RUnlock() }
 
 // Eject removes the least-recently-used files until the cache is within its
-// size limit. It holds a write lock for its duration, blocking concurrent
-// reads.
+// size limit. Files are used when their access time is touched. It holds a
+// write lock for its duration, blocking concurrent reads.
 func (c *DirCache) Eject() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -61,7 +63,7 @@ func (c *DirCache) Eject() error {
 	}
 
 	sort.Slice(files, func(i, j int) bool {
-		return files[i].info.ModTime().Before(files[j].info.ModTime())
+		return times.Get(files[i].info).AccessTime().Before(times.Get(files[j].info).AccessTime())
 	})
 
 	for total > int64(c.limitMB)*1024*1024 {
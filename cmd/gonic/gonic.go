@@ -8,6 +8,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
 	"net/http/pprof"
 	"net/url"
@@ -16,6 +17,8 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -36,6 +39,8 @@ import (
 	"go.senan.xyz/gonic/cache"
 	"go.senan.xyz/gonic/db"
 	"go.senan.xyz/gonic/deps"
+	"go.senan.xyz/gonic/fileutil"
+	"go.senan.xyz/gonic/genrenorm"
 	"go.senan.xyz/gonic/handlerutil"
 	"go.senan.xyz/gonic/infocache/albuminfocache"
 	"go.senan.xyz/gonic/infocache/artistinfocache"
@@ -45,11 +50,14 @@ import (
 	"go.senan.xyz/gonic/musicbrainz"
 	"go.senan.xyz/gonic/playlist"
 	"go.senan.xyz/gonic/podcast"
+	"go.senan.xyz/gonic/radiorecorder"
+	"go.senan.xyz/gonic/ratingtags"
 	"go.senan.xyz/gonic/scanner"
 	"go.senan.xyz/gonic/scrobble"
 	"go.senan.xyz/gonic/server/ctrladmin"
 	"go.senan.xyz/gonic/server/ctrlsubsonic"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/spec"
+	"go.senan.xyz/gonic/stationlist"
 	"go.senan.xyz/gonic/tags"
 	"go.senan.xyz/gonic/texttree"
 	"go.senan.xyz/gonic/transcode"
@@ -66,6 +74,9 @@ func main() {
 
 	confCachePath := flag.String("cache-path", "", "path to cache")
 
+	confRadioHealthInterval := flag.Uint("radio-health-check-interval", 0, "interval (in minutes) to check internet radio stations are reachable (optional)")
+	confRadioRecordingsPath := flag.String("radio-recordings-path", "", "path to save scheduled internet radio recordings, scanned as a music path if not inside one already (optional)")
+
 	var confMusicPaths pathAliases
 	flag.Var(&confMusicPaths, "music-path", "path to music")
 
@@ -76,7 +87,16 @@ func main() {
 	confScanIntervalMins := flag.Uint("scan-interval", 0, "interval (in minutes) to automatically scan music (optional)")
 	confScanAtStart := flag.Bool("scan-at-start-enabled", false, "whether to perform an initial scan at startup (optional)")
 	confScanWatcher := flag.Bool("scan-watcher-enabled", false, "whether to watch file system for new music and rescan (optional)")
+	confScanPollSecs := flag.Uint("scan-poll-interval", 0, "interval (in seconds) to check folders for changes and rescan them, instead of the watcher on network filesystems (optional)")
+	confScanWorkers := flag.Int("scan-workers", 0, "number of files to read tags from concurrently when scanning (0 = number of CPUs) (optional)")
 	confScanEmbeddedCover := flag.Bool("scan-embedded-cover-enabled", true, "whether to scan for embedded covers in audio files (optional)")
+	confTagReader := flag.String("tag-reader", deps.DefaultTagReader, "library to read tags with. one of "+strings.Join(slices.Sorted(maps.Keys(deps.TagReaders)), ", ")+" (optional)")
+
+	var confRatingTagsUsers ratingTagsUsers
+	flag.Var(&confRatingTagsUsers, "rating-tags-user", "user whose track ratings and stars are kept in file tags, as USERNAME or USERNAME->EMAIL for their ID3 POPM frames. the first also gets the RATING and LOVED tags (optional)")
+	confRatingTagsWrite := flag.Bool("rating-tags-write-enabled", false, "whether to write rating tag users' ratings and stars to their files as they change (optional)")
+	confRatingTagsImport := flag.Bool("rating-tags-import-enabled", false, "whether to import rating tag users' ratings and stars from files when scanning (optional)")
+	confRatingTagsFMPS := flag.Bool("rating-tags-fmps-enabled", false, "whether to write FMPS_RATING tags too (optional)")
 
 	confJukeboxEnabled := flag.Bool("jukebox-enabled", false, "whether the subsonic jukebox api should be enabled (optional)")
 	confJukeboxMPVExtraArgs := flag.String("jukebox-mpv-extra-args", "", "extra command line arguments to pass to the jukebox mpv daemon (optional)")
@@ -89,6 +109,9 @@ func main() {
 
 	confExcludePattern := flag.String("exclude-pattern", "", "regex pattern to exclude files from scan (optional)")
 	confGenreTree := flag.String("genre-tree", "", "path to a tab-separated genre tree file for hierarchical genre browsing (optional)")
+	confGenreAliases := flag.String("genre-aliases", "", "path to a tab-separated file of genre aliases and their canonical names (optional)")
+	confGenreNormalise := flag.Bool("genre-normalise-enabled", false, "whether genres which only differ by case, spaces, or punctuation should be merged (optional)")
+	confGenreNormaliseSplit := flag.String("genre-normalise-split", "", "characters to split genres on after reading them, like \"/\" for \"Rap/Hip Hop\" (optional)")
 
 	var confMultiValueGenre, confMultiValueArtist, confMultiValueAlbumArtist, confMultiValueISRC multiValueSetting
 	flag.Var(&confMultiValueGenre, "multi-value-genre", "setting for multi-valued genre scanning (optional)")
@@ -107,6 +130,9 @@ func main() {
 
 	confCoverCacheSize := flag.Int("cover-cache-size", 0, "size of the cover art cache in MB (0 = no limit) (optional)")
 	confCoverEjectInterval := flag.Int("cover-eject-interval", 0, "interval (in minutes) to eject cover art cache (0 = never) (optional)")
+	confCoverWebP := flag.Bool("cover-webp-enabled", false, "whether cover art can be sent as webp to clients which ask for it, needs ffmpeg (optional)")
+	var confCoverPrewarmSizes coverSizes
+	flag.Var(&confCoverPrewarmSizes, "cover-prewarm-size", "cover art size to make for every album after a scan, so it's ready before clients ask. can be repeated (optional)")
 
 	flag.Parse()
 	flagconf.ParseEnv()
@@ -141,6 +167,14 @@ func main() {
 	if *confPlaylistsPath, err = validatePath(*confPlaylistsPath); err != nil {
 		log.Fatalf("checking playlist directory: %v", err)
 	}
+	if *confRadioRecordingsPath != "" {
+		if *confRadioRecordingsPath, err = validatePath(*confRadioRecordingsPath); err != nil {
+			log.Fatalf("checking radio recordings directory: %v", err)
+		}
+		if !slices.ContainsFunc(confMusicPaths, func(pa pathAlias) bool { return fileutil.HasPrefix(*confRadioRecordingsPath, pa.path) }) {
+			confMusicPaths = append(confMusicPaths, pathAlias{alias: "radio recordings", path: *confRadioRecordingsPath})
+		}
+	}
 
 	cacheDirAudio := path.Join(*confCachePath, "audio")
 	cacheDirCovers := path.Join(*confCachePath, "covers")
@@ -159,6 +193,18 @@ func main() {
 		}
 	}
 
+	var genreNorm *genrenorm.Normaliser
+	if *confGenreAliases != "" || *confGenreNormalise || *confGenreNormaliseSplit != "" {
+		var genreAliases map[string]string
+		if *confGenreAliases != "" {
+			genreAliases, err = genrenorm.ParseAliasesFile(*confGenreAliases)
+			if err != nil {
+				log.Fatalf("error parsing genre aliases: %v\n", err)
+			}
+		}
+		genreNorm = genrenorm.New(genreAliases, *confGenreNormalise, *confGenreNormaliseSplit)
+	}
+
 	dbc, err := db.New(*confDBPath, deps.DBDriverOptions(), *confLogDB)
 	if err != nil {
 		log.Fatalf("error opening database: %v\n", err)
@@ -205,7 +251,16 @@ func main() {
 		log.Printf("    %-30s %s\n", f.Name, value)
 	})
 
-	tagReader := deps.TagReader
+	tagReader, ok := deps.TagReaders[*confTagReader]
+	if !ok {
+		log.Fatalf("unknown tag reader %q", *confTagReader)
+	}
+
+	ratingTags := ratingtags.New(dbc, deps.RatingWriter, confRatingTagsUsers, *confRatingTagsFMPS)
+	var scanRatingTags *ratingtags.RatingTags
+	if *confRatingTagsImport {
+		scanRatingTags = ratingTags
+	}
 
 	scannr := scanner.New(
 		ctrlsubsonic.MusicPaths(musicPaths),
@@ -220,8 +275,50 @@ func main() {
 		*confExcludePattern,
 		*confScanEmbeddedCover,
 		genreTree,
+		genreNorm,
+		*confScanWorkers,
+		scanRatingTags,
 	)
+
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "scan":
+			if err := scanCommand(scannr, args[1:]); err != nil {
+				log.Fatalf("error scanning: %v\n", err)
+			}
+			return
+		case "dry-run":
+			if err := dryRunCommand(scannr, args[1:]); err != nil {
+				log.Fatalf("error dry run scanning: %v\n", err)
+			}
+			return
+		case "ratings-dry-run":
+			if err := ratingsDryRunCommand(ratingTags); err != nil {
+				log.Fatalf("error finding ratings to write: %v\n", err)
+			}
+			return
+		default:
+			log.Fatalf("unknown command %q\n", args[0])
+		}
+	}
+
 	podcast := podcast.New(dbc, *confPodcastPath, tagReader)
+	radioRecorder := radiorecorder.New(dbc, *confRadioRecordingsPath, func(ctx context.Context, dir string) {
+		for {
+			_, err := scannr.ScanAndClean(scanner.ScanOptions{Paths: []string{dir}})
+			if !errors.Is(err, scanner.ErrAlreadyScanning) {
+				if err != nil {
+					log.Printf("error scanning radio recording: %v", err)
+				}
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Second): // try again after
+			}
+		}
+	})
 	transcodeCache := cache.New(cacheDirAudio, *confTranscodeCacheSize)
 	transcoder := transcode.NewCachingTranscoder(transcode.NewFFmpegTranscoder(), transcodeCache)
 
@@ -273,12 +370,17 @@ func main() {
 		return url.String()
 	}
 
-	ctrlAdmin, err := ctrladmin.New(dbc, sessDB, scannr, podcast, lastfmClient, resolveProxyPath)
+	ctrlAdmin, err := ctrladmin.New(dbc, sessDB, scannr, podcast, lastfmClient, resolveProxyPath, ctrladmin.Options{
+		GenreTreePath:   *confGenreTree,
+		RadioRecordings: *confRadioRecordingsPath != "",
+	})
 	if err != nil {
 		log.Panicf("error creating admin controller: %v\n", err)
 	}
 	coverCache := cache.New(cacheDirCovers, *confCoverCacheSize)
-	ctrlSubsonic, err := ctrlsubsonic.New(dbc, scannr, musicPaths, *confPodcastPath, cacheDirAudio, coverCache, jukebx, playlistStore, scrobblers, podcast, transcoder, lastfmClient, artistInfoCache, albumInfoCache, tagReader, resolveProxyPath)
+	ctrlSubsonic, err := ctrlsubsonic.New(dbc, scannr, musicPaths, *confPodcastPath, cacheDirAudio, coverCache, jukebx, playlistStore, scrobblers, podcast, transcoder, lastfmClient, artistInfoCache, albumInfoCache, tagReader, resolveProxyPath, ctrlsubsonic.Options{
+		CoverWebP: *confCoverWebP,
+	})
 	if err != nil {
 		log.Panicf("error creating subsonic controller: %v\n", err)
 	}
@@ -366,6 +468,16 @@ func main() {
 		return scannr.ExecuteWatch(ctx)
 	})
 
+	errgrp.Go(func() error {
+		if *confScanPollSecs == 0 {
+			return nil
+		}
+
+		defer logJob("scan poller")()
+
+		return scannr.ExecutePoll(ctx, time.Duration(*confScanPollSecs)*time.Second)
+	})
+
 	errgrp.Go(func() error {
 		if jukebx == nil {
 			return nil
@@ -436,6 +548,38 @@ func main() {
 		return nil
 	})
 
+	errgrp.Go(func() error {
+		if *confRadioHealthInterval == 0 {
+			return nil
+		}
+
+		defer logJob("radio health check")()
+
+		client := &http.Client{Timeout: 15 * time.Second}
+		ctxTick(ctx, time.Duration(*confRadioHealthInterval)*time.Minute, func() {
+			if err := stationlist.CheckAll(ctx, dbc, client); err != nil {
+				log.Printf("error checking radio stations: %v", err)
+			}
+		})
+		return nil
+	})
+
+	errgrp.Go(func() error {
+		if *confRadioRecordingsPath == "" {
+			return nil
+		}
+
+		defer logJob("radio recordings")()
+		defer radioRecorder.Wait()
+
+		ctxTick(ctx, 1*time.Minute, func() {
+			if err := radioRecorder.Tick(ctx); err != nil {
+				log.Printf("error starting radio recordings: %v", err)
+			}
+		})
+		return nil
+	})
+
 	errgrp.Go(func() error {
 		if *confTranscodeEjectInterval == 0 || *confTranscodeCacheSize == 0 {
 			return nil
@@ -466,6 +610,20 @@ func main() {
 		return nil
 	})
 
+	errgrp.Go(func() error {
+		if len(confCoverPrewarmSizes) == 0 {
+			return nil
+		}
+
+		defer logJob("cover prewarm")()
+
+		warmCoversAfterScans(dbNotify.Listen(ctx, 30*time.Second, 0), scannr.IsScanning,
+			func() (string, error) { return dbc.GetSetting(db.LastScanTime) },
+			func() error { return ctrlSubsonic.WarmCoverCache(ctx, confCoverPrewarmSizes) },
+		)
+		return nil
+	})
+
 	errgrp.Go(func() error {
 		if *confScanIntervalMins == 0 {
 			return nil
@@ -481,6 +639,35 @@ func main() {
 		return nil
 	})
 
+	errgrp.Go(func() error {
+		if !*confRatingTagsWrite || len(confRatingTagsUsers) == 0 {
+			return nil
+		}
+
+		defer logJob("rating tags write")()
+
+		for range dbNotify.Listen(ctx, 10*time.Second, 0) {
+			// a scan could be reading the files we'd rewrite, so wait for it, and hold off any others until we're done.
+			// the scans which come along meanwhile try again after, like they do for each other
+			for !scannr.StartScanning() {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(10 * time.Second):
+				}
+			}
+			n, err := ratingTags.Write()
+			scannr.StopScanning()
+			if n > 0 {
+				log.Printf("wrote %d ratings to tags", n)
+			}
+			if err != nil {
+				log.Printf("error writing ratings to tags: %v", err)
+			}
+		}
+		return nil
+	})
+
 	errgrp.Go(func() error {
 		if _, _, err := lastfmClientKeySecretFunc(); err != nil {
 			return nil
@@ -544,6 +731,61 @@ func (pa *pathAliases) Set(value string) error {
 	return nil
 }
 
+// scanCommand scans the paths, or all music paths if none, then exits. handy after re-tagging an album
+func scanCommand(scannr *scanner.Scanner, args []string) error {
+	paths, err := absPaths(args)
+	if err != nil {
+		return err
+	}
+	st, err := scannr.ScanAndClean(scanner.ScanOptions{Paths: paths})
+	if st != nil {
+		fmt.Printf("%d tracks seen, %d new, %d updated, %d removed\n",
+			st.SeenTracks(), st.SeenTracksNew()-st.SeenTracksUpdated(), st.SeenTracksUpdated(), st.TracksMissing())
+	}
+	return err
+}
+
+// dryRunCommand prints what scanning the paths, or all music paths if none, would change in the database
+func dryRunCommand(scannr *scanner.Scanner, args []string) error {
+	paths, err := absPaths(args)
+	if err != nil {
+		return err
+	}
+	report, err := scannr.DryRun(scanner.ScanOptions{Paths: paths})
+	if err != nil {
+		return err
+	}
+	_, err = report.WriteTo(os.Stdout)
+	return err
+}
+
+// ratingsDryRunCommand prints the ratings and stars that would be written to tags
+func ratingsDryRunCommand(ratingTags *ratingtags.RatingTags) error {
+	changes, err := ratingTags.Pending()
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	fmt.Printf("%d ratings to write\n", len(changes))
+	return nil
+}
+
+func absPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		p, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("make absolute %q: %w", arg, err)
+		}
+		if !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
 func validatePath(p string) (string, error) {
 	if p == "" {
 		return "", errors.New("path can't be empty")
@@ -558,6 +800,48 @@ func validatePath(p string) (string, error) {
 	return p, nil
 }
 
+type ratingTagsUsers []ratingtags.User
+
+func (ru ratingTagsUsers) String() string {
+	var strs []string
+	for _, u := range ru {
+		strs = append(strs, fmt.Sprintf("%s %s %s", u.Name, pathAliasSep, u.Email))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// Set takes USERNAME->EMAIL, or just USERNAME to use it as the email too
+func (ru *ratingTagsUsers) Set(value string) error {
+	name, email, ok := strings.Cut(value, pathAliasSep)
+	if !ok {
+		email = name
+	}
+	if name == "" || email == "" {
+		return fmt.Errorf("no username or email in %q", value)
+	}
+	*ru = append(*ru, ratingtags.User{Name: name, Email: email})
+	return nil
+}
+
+type coverSizes []int
+
+func (cs coverSizes) String() string {
+	var strs []string
+	for _, size := range cs {
+		strs = append(strs, strconv.Itoa(size))
+	}
+	return strings.Join(strs, ", ")
+}
+
+func (cs *coverSizes) Set(value string) error {
+	size, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || size <= 0 {
+		return fmt.Errorf("invalid cover size %q", value)
+	}
+	*cs = append(*cs, size)
+	return nil
+}
+
 type multiValueSetting tags.MultiValueSetting
 
 func (mvs multiValueSetting) String() string {
@@ -589,6 +873,25 @@ func (mvs *multiValueSetting) Set(value string) error {
 	return nil
 }
 
+// warmCoversAfterScans calls warm each time the db changes and the time of the last scan has moved, which only happens
+// when a scan of the whole library finishes
+func warmCoversAfterScans(changes <-chan struct{}, isScanning func() bool, lastScanTime func() (string, error), warm func() error) {
+	var prevScanTime string
+	for range changes {
+		if isScanning() {
+			continue
+		}
+		scanTime, err := lastScanTime()
+		if err != nil || scanTime == prevScanTime {
+			continue
+		}
+		prevScanTime = scanTime
+		if err := warm(); err != nil {
+			log.Printf("error warming cover cache: %v", err)
+		}
+	}
+}
+
 func logJob(jobName string) func() {
 	log.Printf("starting job %q", jobName)
 	return func() { log.Printf("stopped job %q", jobName) }
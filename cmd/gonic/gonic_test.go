@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmCoversAfterScans(t *testing.T) {
+	t.Parallel()
+
+	// what the db looks like each time it changes
+	steps := []struct {
+		scanning bool
+		scanTime string
+		err      error
+	}{
+		{false, "1", nil},
+		{false, "1", nil}, // no scan since
+		{true, "2", nil},  // still scanning
+		{false, "2", errors.New("no")},
+		{false, "2", nil},
+	}
+
+	changes := make(chan struct{}, len(steps))
+	for range steps {
+		changes <- struct{}{}
+	}
+	close(changes)
+
+	var i int
+	var warmed []string
+	warmCoversAfterScans(changes,
+		func() bool { i++; return steps[i-1].scanning },
+		func() (string, error) { return steps[i-1].scanTime, steps[i-1].err },
+		func() error { warmed = append(warmed, steps[i-1].scanTime); return nil },
+	)
+	require.Equal(t, []string{"1", "2"}, warmed)
+}
+
+func TestCoverSizes(t *testing.T) {
+	t.Parallel()
+
+	var sizes coverSizes
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.Var(&sizes, "size", "")
+	require.NoError(t, fs.Parse([]string{"-size", "300", "-size", " 600 "}))
+	require.Equal(t, coverSizes{300, 600}, sizes)
+
+	require.Error(t, sizes.Set("0"))
+	require.Error(t, sizes.Set("big"))
+}
+
+func TestAbsPaths(t *testing.T) {
+	t.Parallel()
+
+	paths, err := absPaths([]string{"/music/a", "/music/b/", "/music/a/", "/music/b/../a"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"/music/a", "/music/b"}, paths)
+}
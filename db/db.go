@@ -20,6 +20,7 @@ import (
 
 type DB struct {
 	*gorm.DB
+	opts url.Values // to open snapshots the same way
 }
 
 func New(path string, opts url.Values, logQueries bool) (*DB, error) {
@@ -41,7 +42,7 @@ func New(path string, opts url.Values, logQueries bool) (*DB, error) {
 
 	db.DB().SetMaxOpenConns(4)
 
-	return &DB{DB: db}, nil
+	return &DB{DB: db, opts: opts}, nil
 }
 
 func NewMock(opts url.Values) (*DB, error) {
@@ -54,6 +55,15 @@ func NewMock(opts url.Values) (*DB, error) {
 	return d, nil
 }
 
+// Snapshot writes a consistent copy of the database to path and opens it. changes to the copy don't affect the
+// original, so it can be used to try things out
+func (db *DB) Snapshot(path string) (*DB, error) {
+	if err := db.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return nil, fmt.Errorf("vacuum into: %w", err)
+	}
+	return New(path, db.opts, false)
+}
+
 func (db *DB) InsertBulkLeftMany(table string, head []string, left int, col []int) error {
 	rows := make([][]any, len(col))
 	for i, c := range col {
@@ -174,6 +184,8 @@ const (
 	LastFMAPIKey SettingKey = "lastfm_api_key" //nolint:gosec
 	LastFMSecret SettingKey = "lastfm_secret"
 	LastScanTime SettingKey = "last_scan_time"
+	// LastAnyScanTime is set after scoped scans too, like the watcher's
+	LastAnyScanTime SettingKey = "last_any_scan_time"
 )
 
 func (db *DB) GetSetting(key SettingKey) (string, error) {
@@ -196,7 +208,9 @@ type Artist struct {
 	ID            int    `gorm:"primary_key"`
 	Name          string `gorm:"not null; index"`
 	NameUDec      string `sql:"default: null"`
+	SortName      string `sql:"default: null"` // from ARTISTSORT and friends, like "Beatles, The"
 	MusicBrainzID string `sql:"default: ''" gorm:"not null"`
+	ImageFolderID *int   `sql:"default: null; type:int REFERENCES albums(id) ON DELETE SET NULL"` // an artist level folder with an image of the artist, preferred over last.fm's
 	ArtistStar    *ArtistStar
 	ArtistRating  *ArtistRating
 	Info          *ArtistInfo `gorm:"foreignkey:id"`
@@ -207,17 +221,43 @@ func (a *Artist) SID() *specid.ID {
 }
 
 func (a *Artist) IndexName() string {
+	if len(a.SortName) > 0 {
+		return a.SortName
+	}
 	if len(a.NameUDec) > 0 {
 		return a.NameUDec
 	}
 	return a.Name
 }
 
+// Work is a composition, like a symphony, that tracks on many albums can be performances of
+type Work struct {
+	ID            int    `gorm:"primary_key"`
+	Name          string `gorm:"not null; index"`
+	NameUDec      string `sql:"default: null"`
+	Composer      string `sql:"default: null"` // display purposes only, and to tell apart works with the same name
+	MusicBrainzID string `sql:"default: ''" gorm:"not null"`
+}
+
+func (w *Work) SID() *specid.ID {
+	return &specid.ID{Type: specid.Work, Value: w.ID}
+}
+
 type Genre struct {
 	ID   int    `gorm:"primary_key"`
 	Name string `gorm:"not null; unique_index"`
 }
 
+func (g *Genre) SID() *specid.ID {
+	return &specid.ID{Type: specid.Genre, Value: g.ID}
+}
+
+// GenreRawName is a genre name from tags which was normalised to another genre's name
+type GenreRawName struct {
+	Name    string `gorm:"not null; unique_index:idx_genre_raw_name"`
+	GenreID int    `gorm:"not null; unique_index:idx_genre_raw_name" sql:"default: null; type:int REFERENCES genres(id) ON DELETE CASCADE"`
+}
+
 // AudioFile is used to avoid some duplication in handlers_raw.go
 // between Track and Podcast
 type AudioFile interface {
@@ -239,11 +279,19 @@ type Track struct {
 	Credits              []*TrackCredit `gorm:"foreignkey:track_id"`
 	Genres               []*Genre       `gorm:"many2many:track_genres"`
 	ISRCs                []*TrackISRC   `gorm:"foreignkey:track_id"`
+	Moods                []*TrackMood   `gorm:"foreignkey:track_id"`
 	Size                 int            `sql:"default: null"`
+	Inode                uint64         `gorm:"index:idx_track_inode" sql:"default: null"`    // to follow the file if it's moved
+	Identity             string         `gorm:"index:idx_track_identity" sql:"default: null"` // to find the file again after it's moved and retagged
 	Length               int            `sql:"default: null"`
 	Bitrate              int            `sql:"default: null"`
+	SampleRate           int            `gorm:"index:idx_track_sample_rate" sql:"default: null"`
+	BitDepth             int            `gorm:"index:idx_track_bit_depth" sql:"default: null"`
+	Channels             int            `sql:"default: null"`
+	Codec                string         `sql:"default: null"`
 	TagTitle             string         `sql:"default: null"`
 	TagTitleUDec         string         `sql:"default: null"`
+	TagTitleSort         string         `sql:"default: null"`
 	TagTrackArtist       string         `sql:"default: null"`
 	TagTrackArtistCredit string         `sql:"default: null"` // set when ARTIST_CREDIT differs from ARTIST
 	TagComposer          string         `sql:"default: null"`
@@ -253,6 +301,14 @@ type Track struct {
 	TagBrainzID          string         `sql:"default: null"`
 	TagLyrics            string         `sql:"default: null"`
 	TagYear              int            `sql:"default: null"`
+	TagBPM               int            `sql:"default: null"`
+	TagComment           string         `sql:"default: null"`
+
+	Work              *Work
+	WorkID            *int   `gorm:"index:idx_track_work_id" sql:"default: null; type:int REFERENCES works(id) ON DELETE SET NULL"`
+	TagMovementName   string `sql:"default: null"`
+	TagMovementNumber int    `sql:"default: null"`
+	TagMovementCount  int    `sql:"default: null"`
 
 	ReplayGainTrackGain float32
 	ReplayGainTrackPeak float32
@@ -273,6 +329,13 @@ func (t *Track) SID() *specid.ID {
 	return &specid.ID{Type: specid.Track, Value: t.ID}
 }
 
+func (t *Track) WorkSID() *specid.ID {
+	if t.WorkID == nil {
+		return nil
+	}
+	return &specid.ID{Type: specid.Work, Value: *t.WorkID}
+}
+
 func (t *Track) AlbumSID() *specid.ID {
 	return &specid.ID{Type: specid.Album, Value: t.AlbumID}
 }
@@ -353,12 +416,17 @@ type Album struct {
 	RootDir              string         `gorm:"unique_index:idx_album_abs_path" sql:"default: null"`
 	Genres               []*Genre       `gorm:"many2many:album_genres"`
 	Cover                string         `sql:"default: null"`
+	Inode                uint64         `gorm:"index:idx_album_inode" sql:"default: null"` // to follow the folder if it's moved
+	DirModTime           time.Time      `sql:"default: null"`                              // the folder's own mod time when last scanned, for polling
+	DirSize              int64          `sql:"default: null"`                              // the folder's own size when last scanned, for polling
 	EmbeddedCoverTrackID *int           `sql:"default: null; type:int REFERENCES tracks(id) ON DELETE SET NULL"`
+	DiscOfID             *int           `gorm:"index:idx_album_disc_of_id" sql:"default: null; type:int REFERENCES albums(id) ON DELETE SET NULL"` // for a disc subfolder like CD2, the album its release is shown as when browsing by tags
 	Credits              []*AlbumCredit `gorm:"foreignkey:album_id"`
 	TagTitle             string         `sql:"default: null"`
 	TagAlbumArtist       string         // display purposes only
 	TagAlbumArtistCredit string         `sql:"default: null"` // set when ALBUMARTIST_CREDIT differs from ALBUMARTIST
 	TagTitleUDec         string         `sql:"default: null"`
+	TagTitleSort         string         `sql:"default: null"`
 	TagBrainzID          string         `sql:"default: null"`
 	TagYear              int            `sql:"default: null"`
 	TagCompilation       bool           `sql:"default: null"`
@@ -371,6 +439,10 @@ type Album struct {
 	DiscTitles           []*AlbumDiscTitle
 }
 
+func (a *Album) AbsPath() string {
+	return filepath.Join(a.RootDir, a.LeftPath, a.RightPath)
+}
+
 func (a *Album) SID() *specid.ID {
 	return &specid.ID{Type: specid.Album, Value: a.ID}
 }
@@ -379,6 +451,10 @@ func (a *Album) ParentSID() *specid.ID {
 	return &specid.ID{Type: specid.Album, Value: a.ParentID}
 }
 
+func (a *Album) DiscOfSID() *specid.ID {
+	return &specid.ID{Type: specid.Album, Value: *a.DiscOfID}
+}
+
 func (a *Album) EmbeddedCoverTrackSID() *specid.ID {
 	return &specid.ID{Type: specid.Track, Value: *a.EmbeddedCoverTrackID}
 }
@@ -465,6 +541,11 @@ type TrackISRC struct {
 	TrackID int    `gorm:"not null unique_index:idx_isrc_track" sql:"default: null; type:int REFERENCES tracks(id) ON DELETE CASCADE"`
 }
 
+type TrackMood struct {
+	TrackID int    `gorm:"not null; unique_index:idx_track_mood" sql:"default: null; type:int REFERENCES tracks(id) ON DELETE CASCADE"`
+	Mood    string `gorm:"not null; unique_index:idx_track_mood" sql:"default: null"`
+}
+
 type AlbumLabel struct {
 	AlbumID int    `gorm:"not null; unique_index:idx_album_label" sql:"default: null; type:int REFERENCES albums(id) ON DELETE CASCADE"`
 	Label   string `gorm:"not null; unique_index:idx_album_label; index:idx_album_labels_label" sql:"default: null"`
@@ -482,6 +563,38 @@ type AlbumDiscTitle struct {
 	Title      string `gorm:"not null"`
 }
 
+type AlbumImageKind string
+
+const (
+	AlbumImageFront   AlbumImageKind = "front"
+	AlbumImageBack    AlbumImageKind = "back"
+	AlbumImageDisc    AlbumImageKind = "disc"
+	AlbumImageBooklet AlbumImageKind = "booklet"
+	AlbumImageArtist  AlbumImageKind = "artist"
+	AlbumImageOther   AlbumImageKind = "other"
+)
+
+// AlbumImage is an image file in an album's folder, including the one picked as its cover
+type AlbumImage struct {
+	ID       int            `gorm:"primary_key"`
+	AlbumID  int            `gorm:"not null; unique_index:idx_album_image" sql:"default: null; type:int REFERENCES albums(id) ON DELETE CASCADE"`
+	Filename string         `gorm:"not null; unique_index:idx_album_image" sql:"default: null"`
+	Kind     AlbumImageKind `gorm:"not null" sql:"default: null"`
+	Position int            `gorm:"not null"` // order among the album's images of the same kind, like booklet pages
+	Album    *Album
+}
+
+func (i *AlbumImage) SID() *specid.ID {
+	return &specid.ID{Type: specid.AlbumImage, Value: i.ID}
+}
+
+func (i *AlbumImage) AbsPath() string {
+	if i.Album == nil {
+		return ""
+	}
+	return filepath.Join(i.Album.AbsPath(), i.Filename)
+}
+
 type AlbumStar struct {
 	UserID   int `gorm:"primary_key; not null" sql:"default: null; type:int REFERENCES users(id) ON DELETE CASCADE"`
 	AlbumID  int `gorm:"primary_key; not null" sql:"default: null; type:int REFERENCES albums(id) ON DELETE CASCADE"`
@@ -518,6 +631,15 @@ type TrackRating struct {
 	Rating  int `gorm:"not null; check:(rating >= 1 AND rating <= 5)"`
 }
 
+// TrackTagRating is a user's rating and star as they are in a track's file tags, as last written or imported. see
+// package ratingtags
+type TrackTagRating struct {
+	UserID  int `gorm:"primary_key; not null" sql:"default: null; type:int REFERENCES users(id) ON DELETE CASCADE"`
+	TrackID int `gorm:"primary_key; not null" sql:"default: null; type:int REFERENCES tracks(id) ON DELETE CASCADE"`
+	Stars   int `gorm:"not null"`
+	Loved   bool
+}
+
 type PodcastAutoDownload string
 
 const (
@@ -607,6 +729,55 @@ func (pe *PodcastEpisode) AbsPath() string {
 	return filepath.Join(pe.Podcast.RootDir, pe.Filename)
 }
 
+// PodcastEpisodePlayed marks an episode as listened to by a user, either from a scrobble or from playing
+// past the end threshold
+type PodcastEpisodePlayed struct {
+	UserID           int `gorm:"primary_key; not null" sql:"default: null; type:int REFERENCES users(id) ON DELETE CASCADE"`
+	PodcastEpisodeID int `gorm:"primary_key; not null" sql:"default: null; type:int REFERENCES podcast_episodes(id) ON DELETE CASCADE"`
+	PlayedAt         time.Time
+}
+
+type ScanProblemLevel string
+
+const (
+	ScanProblemError   ScanProblemLevel = "error"
+	ScanProblemWarning ScanProblemLevel = "warning"
+)
+
+type ScanProblemKind string
+
+const (
+	// checked every time the folder is walked
+	ScanProblemFolder ScanProblemKind = "folder" // couldn't read or write the folder
+	ScanProblemCover  ScanProblemKind = "cover"  // cover file isn't a readable image
+
+	// checked only when a track is read, so they stick around until the file changes or is removed
+	ScanProblemReadTags    ScanProblemKind = "read tags"
+	ScanProblemMissingTags ScanProblemKind = "missing tags"
+	ScanProblemZeroLength  ScanProblemKind = "zero length"
+)
+
+// PerFolder is if the problem is found again on every scan of its folder, rather than only when a track is read
+func (k ScanProblemKind) PerFolder() bool {
+	return k == ScanProblemFolder || k == ScanProblemCover
+}
+
+// ScanProblem is an error or warning found for a path by the scanner
+type ScanProblem struct {
+	ID        int `gorm:"primary_key"`
+	CreatedAt time.Time
+	Level     ScanProblemLevel `sql:"default: null"`
+	Kind      ScanProblemKind  `sql:"default: null"`
+	RootDir   string           `gorm:"index" sql:"default: null"`
+	Dir       string           // relative to RootDir
+	Filename  string           // empty if for the whole folder
+	Message   string
+}
+
+func (p *ScanProblem) AbsPath() string {
+	return filepath.Join(p.RootDir, p.Dir, p.Filename)
+}
+
 type BookmarkEntry string
 
 const (
@@ -631,6 +802,13 @@ type InternetRadioStation struct {
 	StreamURL   string
 	Name        string
 	HomepageURL string
+	Proxy       bool `gorm:"not null; default:false"` // relay the stream through gonic instead of clients connecting directly
+
+	// from the last periodic health check, if enabled
+	HealthCheckedAt   *time.Time `sql:"default: null"`
+	HealthOK          bool       `gorm:"not null; default:false"`
+	HealthContentType string
+	HealthError       string
 }
 
 func (ir *InternetRadioStation) SID() *specid.ID {
@@ -641,6 +819,71 @@ func (ir *InternetRadioStation) AbsPath() string {
 	return ir.StreamURL
 }
 
+type InternetRadioRecurrence string
+
+const (
+	InternetRadioRecurrenceOnce   InternetRadioRecurrence = "once"
+	InternetRadioRecurrenceDaily  InternetRadioRecurrence = "daily"
+	InternetRadioRecurrenceWeekly InternetRadioRecurrence = "weekly"
+)
+
+// InternetRadioRecording is a scheduled capture of an internet radio station into the recordings dir
+type InternetRadioRecording struct {
+	ID             int `gorm:"primary_key"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Station        *InternetRadioStation
+	StationID      int       `gorm:"not null" sql:"default: null; type:int REFERENCES internet_radio_stations(id) ON DELETE CASCADE"`
+	StartAt        time.Time // the first start. later ones are found from the recurrence
+	DurationMins   int
+	Recurrence     InternetRadioRecurrence
+	SplitOnTitle   bool       `gorm:"not null; default:false"` // start a new file when the ICY StreamTitle changes
+	LastRecordedAt *time.Time `sql:"default: null"`
+	LastError      string
+}
+
+// LatestStart is the most recent scheduled start at or before now
+func (irr *InternetRadioRecording) LatestStart(now time.Time) (time.Time, bool) {
+	if now.Before(irr.StartAt) {
+		return time.Time{}, false
+	}
+	var days int
+	switch irr.Recurrence {
+	case InternetRadioRecurrenceDaily:
+		days = 1
+	case InternetRadioRecurrenceWeekly:
+		days = 7
+	default:
+		return irr.StartAt, true
+	}
+	// AddDate rather than adding a duration so the wall clock start time stays put across DST changes
+	periods := int(now.Sub(irr.StartAt) / (time.Duration(days) * 24 * time.Hour))
+	start := irr.StartAt.AddDate(0, 0, periods*days)
+	for start.After(now) {
+		start = start.AddDate(0, 0, -days)
+	}
+	for next := start.AddDate(0, 0, days); !next.After(now); next = next.AddDate(0, 0, days) {
+		start = next
+	}
+	return start, true
+}
+
+// Due is whether a recording should be running now, and if so when the current one started and when it should end
+func (irr *InternetRadioRecording) Due(now time.Time) (start, end time.Time, ok bool) {
+	start, ok = irr.LatestStart(now)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	end = start.Add(time.Duration(irr.DurationMins) * time.Minute)
+	if !now.Before(end) {
+		return time.Time{}, time.Time{}, false
+	}
+	if irr.LastRecordedAt != nil && !irr.LastRecordedAt.Before(end) {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
 type ArtistInfo struct {
 	ID                        int `gorm:"primary_key" sql:"type:int REFERENCES artists(id) ON DELETE CASCADE"`
 	CreatedAt                 time.Time
@@ -102,6 +102,21 @@ func (db *DB) Migrate(ctx MigrationContext) error {
 		construct(ctx, "202607141400", migrateTrackComposer),
 		construct(ctx, "202607141500", migrateAlbumVersion),
 		construct(ctx, "202607171200", migrateAddPodcastEpisodeGUID),
+		construct(ctx, "202610191000", migrateAddInternetRadioStationProxy),
+		construct(ctx, "202610191100", migrateAddInternetRadioRecordings),
+		construct(ctx, "202610191200", migrateAddInternetRadioStationHealth),
+		construct(ctx, "202610191300", migrateAddPodcastEpisodePlayed),
+		construct(ctx, "202610191400", migrateAddScanProblems),
+		construct(ctx, "202610191500", migrateAddInodes),
+		construct(ctx, "202610191600", migrateAddTrackIdentity),
+		construct(ctx, "202610191700", migrateAddAlbumDirStat),
+		construct(ctx, "202610191800", migrateAddAlbumDiscOf),
+		construct(ctx, "202610191900", migrateAddTrackAudioProperties),
+		construct(ctx, "202610192000", migrateAddSortNamesAndMoods),
+		construct(ctx, "202610192100", migrateAddWorks),
+		construct(ctx, "202610192200", migrateAddTrackTagRatings),
+		construct(ctx, "202610192300", migrateAddGenreRawNames),
+		construct(ctx, "202610200000", migrateAddAlbumImages),
 	}
 
 	return gormigrate.
@@ -1087,3 +1102,80 @@ func migrateTrackComposer(tx *gorm.DB, _ MigrationContext) error {
 func migrateAddPodcastEpisodeGUID(tx *gorm.DB, _ MigrationContext) error {
 	return tx.AutoMigrate(PodcastEpisode{}).Error
 }
+
+func migrateAddInternetRadioStationProxy(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(InternetRadioStation{}).Error
+}
+
+func migrateAddInternetRadioRecordings(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(InternetRadioRecording{}).Error
+}
+
+func migrateAddInternetRadioStationHealth(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(InternetRadioStation{}).Error
+}
+
+func migrateAddPodcastEpisodePlayed(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(PodcastEpisodePlayed{}).Error
+}
+
+func migrateAddScanProblems(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(ScanProblem{}).Error
+}
+
+func migrateAddInodes(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(Track{}, Album{}).Error
+}
+
+func migrateAddTrackIdentity(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(Track{}).Error
+}
+
+func migrateAddAlbumDirStat(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(Album{}).Error
+}
+
+func migrateAddAlbumDiscOf(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(Album{}).Error
+}
+
+// the new columns are filled in by the next full scan
+func migrateAddTrackAudioProperties(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(Track{}).Error
+}
+
+func migrateAddSortNamesAndMoods(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		Artist{},
+		Album{},
+		Track{},
+		TrackMood{},
+	).Error
+}
+
+func migrateAddWorks(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		Work{},
+		Track{},
+	).Error
+}
+
+func migrateAddTrackTagRatings(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		TrackTagRating{},
+	).Error
+}
+
+func migrateAddGenreRawNames(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		GenreRawName{},
+	).Error
+}
+
+// filled in by the next scan
+func migrateAddAlbumImages(tx *gorm.DB, _ MigrationContext) error {
+	return tx.AutoMigrate(
+		AlbumImage{},
+		Artist{},
+	).Error
+}
@@ -5,6 +5,10 @@ package deps
 import (
 	"net/url"
 
+	"go.senan.xyz/gonic/tags"
+	"go.senan.xyz/gonic/tags/ffprobe"
+	"go.senan.xyz/gonic/tags/native"
+
 	// Cgo-free Wasm database
 	_ "github.com/ncruces/go-sqlite3/driver"
 
@@ -15,6 +19,22 @@ import (
 //nolint:gochecknoglobals
 var TagReader = taglib.Reader{}
 
+// TagReaders are the tag readers that can be picked by name, with TagReader's as the default
+//
+//nolint:gochecknoglobals
+var TagReaders = map[string]tags.Reader{
+	"taglib":  TagReader,
+	"ffprobe": ffprobe.Reader{},
+	"native":  native.Reader{},
+}
+
+const DefaultTagReader = "taglib"
+
+// RatingWriter writes ratings into tags, see package ratingtags
+//
+//nolint:gochecknoglobals
+var RatingWriter tags.RatingWriter = taglib.Writer{}
+
 // DBDriverOptions returns SQLite DSN options for the ncruces driver
 func DBDriverOptions() url.Values {
 	return url.Values{
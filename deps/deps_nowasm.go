@@ -5,6 +5,9 @@ package deps
 import (
 	"net/url"
 
+	"go.senan.xyz/gonic/tags"
+	"go.senan.xyz/gonic/tags/native"
+
 	// Cgo database
 	_ "github.com/mattn/go-sqlite3"
 
@@ -15,6 +18,21 @@ import (
 //nolint:gochecknoglobals
 var TagReader = ffprobe.Reader{}
 
+// TagReaders are the tag readers that can be picked by name, with TagReader's as the default
+//
+//nolint:gochecknoglobals
+var TagReaders = map[string]tags.Reader{
+	"ffprobe": TagReader,
+	"native":  native.Reader{},
+}
+
+const DefaultTagReader = "ffprobe"
+
+// RatingWriter writes ratings into tags, see package ratingtags. without taglib, only MP3s can be written to
+//
+//nolint:gochecknoglobals
+var RatingWriter tags.RatingWriter = native.Writer{}
+
 // DSNOptions returns SQLite DSN options for the mattn driver
 func DBDriverOptions() url.Values {
 	return url.Values{
@@ -0,0 +1,123 @@
+// Package genrenorm maps the genre names found in tags to canonical ones, so that spellings like "Hip-Hop",
+// "Hip Hop" and "hiphop" become a single genre
+package genrenorm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+type Normaliser struct {
+	aliases map[string]string // key of an alias to its canonical name
+	fold    bool
+	split   string
+}
+
+// New creates a Normaliser. aliases maps names to canonical names, and is matched ignoring case and punctuation.
+// if fold is set, names which only differ by case and punctuation become the same genre. genres are split on any
+// of the characters in split, like "/" for "Rap/Hip Hop"
+func New(aliases map[string]string, fold bool, split string) *Normaliser {
+	keyed := make(map[string]string, len(aliases))
+	for alias, canonical := range aliases {
+		keyed[Key(alias)] = canonical
+	}
+	return &Normaliser{aliases: keyed, fold: fold, split: split}
+}
+
+// Fold is whether names which only differ by case and punctuation should become the same genre
+func (n *Normaliser) Fold() bool { return n.fold }
+
+// Names maps a genre name from tags to one or more canonical names
+func (n *Normaliser) Names(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	if canonical, ok := n.aliases[Key(raw)]; ok {
+		return []string{canonical}
+	}
+	if n.split == "" {
+		return []string{raw}
+	}
+	var names []string
+	for part := range strings.FieldsFuncSeq(raw, func(r rune) bool { return strings.ContainsRune(n.split, r) }) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if canonical, ok := n.aliases[Key(part)]; ok {
+			part = canonical
+		}
+		names = append(names, part)
+	}
+	return names
+}
+
+// Key is a genre name without case, spaces, or punctuation, for matching names
+func Key(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	if b.Len() == 0 {
+		return strings.ToLower(strings.TrimSpace(name)) // only punctuation, keep it
+	}
+	return b.String()
+}
+
+func ParseAliasesFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+	return ParseAliases(f)
+}
+
+// ParseAliases reads lines of an alias and its canonical name, separated by a tab
+func ParseAliases(r io.Reader) (map[string]string, error) {
+	aliases := map[string]string{}
+	keys := map[string]string{} // key of an alias to the alias, to find the same alias spelt differently
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		alias, canonical, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+
+		alias = strings.TrimSpace(alias)
+		canonical = strings.TrimSpace(canonical)
+		if alias == "" || canonical == "" {
+			continue
+		}
+
+		if prev, ok := keys[Key(alias)]; ok && aliases[prev] != canonical {
+			return nil, fmt.Errorf("alias %q has more than one canonical name", alias)
+		}
+		keys[Key(alias)] = alias
+		aliases[alias] = canonical
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading aliases: %w", err)
+	}
+
+	for alias, canonical := range aliases {
+		if prev, ok := keys[Key(canonical)]; ok && Key(aliases[prev]) != Key(canonical) {
+			return nil, fmt.Errorf("canonical name %q of %q is also an alias", canonical, alias)
+		}
+	}
+
+	return aliases, nil
+}
@@ -0,0 +1,63 @@
+package genrenorm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.senan.xyz/gonic/genrenorm"
+)
+
+func TestKey(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "hiphop", genrenorm.Key("Hip-Hop"))
+	assert.Equal(t, "hiphop", genrenorm.Key("Hip Hop"))
+	assert.Equal(t, "hiphop", genrenorm.Key("hiphop"))
+	assert.Equal(t, "rb", genrenorm.Key("R&B"))
+	assert.Equal(t, "électronique", genrenorm.Key("Électronique"))
+	assert.Equal(t, "-", genrenorm.Key(" - "))
+}
+
+func TestNames(t *testing.T) {
+	t.Parallel()
+
+	n := genrenorm.New(map[string]string{"hip hop": "Hip-Hop", "Rap/Hip Hop": "Hip-Hop", "dnb": "Drum & Bass"}, true, "/")
+
+	assert.Equal(t, []string{"Hip-Hop"}, n.Names("HipHop"))
+	assert.Equal(t, []string{"Hip-Hop"}, n.Names("rap / hip-hop")) // aliased before splitting
+	assert.Equal(t, []string{"Rock", "Drum & Bass"}, n.Names("Rock/DnB"))
+	assert.Equal(t, []string{"Jazz"}, n.Names(" Jazz "))
+	assert.Empty(t, n.Names("  "))
+}
+
+func TestNamesNoSplit(t *testing.T) {
+	t.Parallel()
+
+	n := genrenorm.New(nil, false, "")
+	assert.Equal(t, []string{"Rock/Pop"}, n.Names("Rock/Pop"))
+}
+
+func TestParseAliases(t *testing.T) {
+	t.Parallel()
+
+	aliases, err := genrenorm.ParseAliases(strings.NewReader("# comment\nhip hop\tHip-Hop\nhiphop\tHip-Hop\nHip-Hop\tHip-Hop\n\ndnb\tDrum & Bass\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"hip hop": "Hip-Hop", "hiphop": "Hip-Hop", "Hip-Hop": "Hip-Hop", "dnb": "Drum & Bass"}, aliases)
+}
+
+func TestParseAliasesConflict(t *testing.T) {
+	t.Parallel()
+
+	_, err := genrenorm.ParseAliases(strings.NewReader("hip hop\tHip-Hop\nHip Hop\tRap\n"))
+	assert.Error(t, err)
+}
+
+func TestParseAliasesChain(t *testing.T) {
+	t.Parallel()
+
+	_, err := genrenorm.ParseAliases(strings.NewReader("a\tb\nb\tc\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+// Package icy reads the SHOUTcast/Icecast "ICY" metadata that internet radio servers
+// interleave with the audio when a client asks for it with an Icy-MetaData header.
+package icy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestHeader asks the server to interleave metadata with the audio
+const RequestHeader = "Icy-MetaData"
+
+// MetaInt returns how many audio bytes the server sends between each metadata block, or 0 if it won't send any
+func MetaInt(h http.Header) int {
+	i, _ := strconv.Atoi(h.Get("icy-metaint"))
+	return max(i, 0)
+}
+
+// Reader strips metadata blocks from an ICY stream, leaving just the audio. Each time the StreamTitle changes,
+// onTitle is called with the new value.
+type Reader struct {
+	r       io.Reader
+	metaInt int
+	onTitle func(string)
+
+	untilMeta int
+	title     string
+}
+
+func NewReader(r io.Reader, metaInt int, onTitle func(string)) *Reader {
+	return &Reader{r: r, metaInt: metaInt, onTitle: onTitle, untilMeta: metaInt}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.metaInt <= 0 {
+		return r.r.Read(p)
+	}
+	if r.untilMeta == 0 {
+		if err := r.readMeta(); err != nil {
+			return 0, err
+		}
+		r.untilMeta = r.metaInt
+	}
+	if len(p) > r.untilMeta {
+		p = p[:r.untilMeta]
+	}
+	n, err := r.r.Read(p)
+	r.untilMeta -= n
+	return n, err
+}
+
+func (r *Reader) readMeta() error {
+	var size [1]byte
+	if _, err := io.ReadFull(r.r, size[:]); err != nil {
+		return err
+	}
+	if size[0] == 0 {
+		return nil
+	}
+	meta := make([]byte, int(size[0])*16)
+	if _, err := io.ReadFull(r.r, meta); err != nil {
+		return fmt.Errorf("read metadata: %w", err)
+	}
+	title, ok := ParseStreamTitle(string(bytes.TrimRight(meta, "\x00")))
+	if !ok || title == r.title {
+		return nil
+	}
+	r.title = title
+	if r.onTitle != nil {
+		r.onTitle(title)
+	}
+	return nil
+}
+
+// ParseStreamTitle finds the StreamTitle in a metadata block like
+//
+//	StreamTitle='Artist - Title';StreamUrl='';
+func ParseStreamTitle(meta string) (string, bool) {
+	const key = "StreamTitle='"
+	_, rest, ok := strings.Cut(meta, key)
+	if !ok {
+		return "", false
+	}
+	// titles may contain quotes themselves, so the end is the last quote before the next field or the end
+	end := strings.Index(rest, "';")
+	if end < 0 {
+		end = strings.LastIndex(rest, "'")
+	}
+	if end < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(rest[:end]), true
+}
+
+// SplitTitle splits the conventional "Artist - Title" form of a StreamTitle. If there's no separator the whole
+// thing is returned as the title.
+func SplitTitle(streamTitle string) (artist, title string) {
+	if artist, title, ok := strings.Cut(streamTitle, " - "); ok {
+		return strings.TrimSpace(artist), strings.TrimSpace(title)
+	}
+	return "", streamTitle
+}
+
+// NowPlaying is the last StreamTitle seen for a station
+type NowPlaying struct {
+	StreamTitle string
+	Changed     time.Time
+}
+
+// Titles remembers what's currently playing on each station that is being relayed
+type Titles struct {
+	mu sync.RWMutex
+	m  map[int]NowPlaying
+}
+
+func NewTitles() *Titles {
+	return &Titles{m: map[int]NowPlaying{}}
+}
+
+func (t *Titles) Set(stationID int, streamTitle string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.m[stationID] = NowPlaying{StreamTitle: streamTitle, Changed: time.Now()}
+}
+
+func (t *Titles) Get(stationID int) (NowPlaying, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	np, ok := t.m[stationID]
+	return np, ok
+}
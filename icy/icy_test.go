@@ -0,0 +1,81 @@
+package icy_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.senan.xyz/gonic/icy"
+)
+
+func metaBlock(meta string) []byte {
+	size := (len(meta) + 15) / 16
+	block := make([]byte, 1+size*16)
+	block[0] = byte(size)
+	copy(block[1:], meta)
+	return block
+}
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+
+	var stream bytes.Buffer
+	stream.WriteString("abcd")
+	stream.Write(metaBlock("StreamTitle='Artist A - Song A';StreamUrl='';"))
+	stream.WriteString("efgh")
+	stream.WriteByte(0) // no change
+	stream.WriteString("ijkl")
+	stream.Write(metaBlock("StreamTitle='Artist A - Song A';"))
+	stream.WriteString("mnop")
+	stream.Write(metaBlock("StreamTitle='Song B';"))
+	stream.WriteString("qr")
+
+	var titles []string
+	r := icy.NewReader(iotest.OneByteReader(&stream), 4, func(title string) {
+		titles = append(titles, title)
+	})
+	audio, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghijklmnopqr", string(audio))
+	assert.Equal(t, []string{"Artist A - Song A", "Song B"}, titles)
+}
+
+func TestReaderNoMetadata(t *testing.T) {
+	t.Parallel()
+
+	r := icy.NewReader(bytes.NewReader([]byte("audio")), 0, nil)
+	audio, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "audio", string(audio))
+}
+
+func TestParseStreamTitle(t *testing.T) {
+	t.Parallel()
+
+	title, ok := icy.ParseStreamTitle("StreamTitle='Guns N' Roses - Don't Cry';StreamUrl='';")
+	assert.True(t, ok)
+	assert.Equal(t, "Guns N' Roses - Don't Cry", title)
+
+	title, ok = icy.ParseStreamTitle("StreamTitle='Just A Title'")
+	assert.True(t, ok)
+	assert.Equal(t, "Just A Title", title)
+
+	_, ok = icy.ParseStreamTitle("StreamUrl='';")
+	assert.False(t, ok)
+}
+
+func TestSplitTitle(t *testing.T) {
+	t.Parallel()
+
+	artist, title := icy.SplitTitle("Artist A - Song A")
+	assert.Equal(t, "Artist A", artist)
+	assert.Equal(t, "Song A", title)
+
+	artist, title = icy.SplitTitle("Station ID")
+	assert.Empty(t, artist)
+	assert.Equal(t, "Station ID", title)
+}
@@ -12,6 +12,7 @@ import (
 
 	"go.senan.xyz/gonic/db"
 	"go.senan.xyz/gonic/deps"
+	"go.senan.xyz/gonic/genrenorm"
 	"go.senan.xyz/gonic/scanner"
 	"go.senan.xyz/gonic/tags"
 	"go.senan.xyz/wrtag/tags/normtag"
@@ -27,13 +28,16 @@ type MockFS struct {
 	db        *db.DB
 }
 
-func New(tb testing.TB) *MockFS                        { return newMockFS(tb, []string{""}, "") }
-func NewWithDirs(tb testing.TB, dirs []string) *MockFS { return newMockFS(tb, dirs, "") }
+func New(tb testing.TB) *MockFS                        { return newMockFS(tb, []string{""}, "", nil) }
+func NewWithDirs(tb testing.TB, dirs []string) *MockFS { return newMockFS(tb, dirs, "", nil) }
 func NewWithExcludePattern(tb testing.TB, excludePattern string) *MockFS {
-	return newMockFS(tb, []string{""}, excludePattern)
+	return newMockFS(tb, []string{""}, excludePattern, nil)
+}
+func NewWithGenreNormaliser(tb testing.TB, genreNorm *genrenorm.Normaliser) *MockFS {
+	return newMockFS(tb, []string{""}, "", genreNorm)
 }
 
-func newMockFS(tb testing.TB, dirs []string, excludePattern string) *MockFS {
+func newMockFS(tb testing.TB, dirs []string, excludePattern string, genreNorm *genrenorm.Normaliser) *MockFS {
 	tb.Helper()
 
 	dbc, err := db.NewMock(deps.DBDriverOptions())
@@ -71,7 +75,7 @@ func newMockFS(tb testing.TB, dirs []string, excludePattern string) *MockFS {
 	}
 
 	tagReader := &tagReader{paths: map[string]*TagInfo{}}
-	scanner := scanner.New(absDirs, dbc, multiValueSettings, tagReader, excludePattern, true, nil)
+	scanner := scanner.New(absDirs, dbc, multiValueSettings, tagReader, excludePattern, true, nil, genreNorm, 4, nil)
 
 	return &MockFS{
 		t:         tb,
@@ -82,9 +86,10 @@ func newMockFS(tb testing.TB, dirs []string, excludePattern string) *MockFS {
 	}
 }
 
-func (m *MockFS) DB() *db.DB             { return m.db }
-func (m *MockFS) TmpDir() string         { return m.dir }
-func (m *MockFS) TagReader() tags.Reader { return m.tagReader }
+func (m *MockFS) DB() *db.DB                { return m.db }
+func (m *MockFS) TmpDir() string            { return m.dir }
+func (m *MockFS) TagReader() tags.Reader    { return m.tagReader }
+func (m *MockFS) Scanner() *scanner.Scanner { return m.scanner }
 
 func (m *MockFS) ScanAndClean() *scanner.State {
 	m.t.Helper()
@@ -171,9 +176,11 @@ func (m *MockFS) Move(src, dest string) {
 	if err := os.Rename(srcAbs, destAbs); err != nil {
 		m.t.Fatalf("rename: %v", err)
 	}
-	if info, ok := m.tagReader.paths[srcAbs]; ok {
-		m.tagReader.paths[destAbs] = info
-		delete(m.tagReader.paths, srcAbs)
+	for path, info := range m.tagReader.paths {
+		if path == srcAbs || strings.HasPrefix(path, srcAbs+string(filepath.Separator)) {
+			m.tagReader.paths[destAbs+strings.TrimPrefix(path, srcAbs)] = info
+			delete(m.tagReader.paths, path)
+		}
 	}
 }
 
@@ -312,6 +319,10 @@ func newTagInfo() *TagInfo {
 
 	info.Length = 100 * time.Second
 	info.Bitrate = 100
+	info.SampleRate = 44100
+	info.BitDepth = 16
+	info.Channels = 2
+	info.Codec = "flac"
 
 	return &info
 }
@@ -323,8 +334,11 @@ type tagReader struct {
 }
 
 func (m *tagReader) CanRead(absPath string) bool {
-	stat, _ := os.Stat(absPath)
-	return stat.Mode().IsRegular()
+	if _, ok := m.paths[absPath]; ok {
+		return true // even if removed, like a real reader going by extension
+	}
+	stat, err := os.Stat(absPath)
+	return err == nil && stat.Mode().IsRegular()
 }
 
 func (m *tagReader) Read(absPath string) (tags.Properties, map[string][]string, error) {
@@ -337,8 +351,12 @@ func (m *tagReader) Read(absPath string) (tags.Properties, map[string][]string,
 	}
 
 	props := tags.Properties{
-		Length:  p.Length,
-		Bitrate: p.Bitrate,
+		Length:     p.Length,
+		Bitrate:    p.Bitrate,
+		SampleRate: p.SampleRate,
+		BitDepth:   p.BitDepth,
+		Channels:   p.Channels,
+		Codec:      p.Codec,
 	}
 	return props, p.Tags, nil
 }
@@ -348,10 +366,14 @@ func (m *tagReader) ReadCover(absPath string) ([]byte, error) {
 }
 
 type TagInfo struct {
-	Tags    map[string][]string
-	Length  time.Duration
-	Bitrate uint
-	Error   error
+	Tags       map[string][]string
+	Length     time.Duration
+	Bitrate    uint
+	SampleRate uint
+	BitDepth   uint
+	Channels   uint
+	Codec      string
+	Error      error
 }
 
 func match(pattern, name string) bool {
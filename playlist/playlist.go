@@ -208,6 +208,19 @@ func (s *Store) Write(relPath string, playlist *Playlist) error {
 	return nil
 }
 
+// ModTime is when the playlist was last changed, without reading it
+func (s *Store) ModTime(relPath string) (time.Time, error) {
+	absPath, err := fileutil.SafeJoin(s.basePath, relPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	stat, err := os.Stat(absPath)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("stat m3u: %w", err)
+	}
+	return stat.ModTime(), nil
+}
+
 func (s *Store) Delete(relPath string) error {
 	if err := sanityCheck(s.basePath); err != nil {
 		return err
@@ -0,0 +1,57 @@
+package radiorecorder
+
+import (
+	"encoding/binary"
+	"unicode/utf8"
+)
+
+// id3Size is how much room is left at the start of each mp3 for its tag. the tag is only known once the
+// segment is finished, so we reserve the space up front and fill it in on close instead of rewriting the file
+const id3Size = 4096
+
+const id3MaxValueLen = 255
+
+type id3Frame struct {
+	id, value string
+}
+
+// id3Tag encodes a UTF-8 ID3v2.4 tag padded to exactly size bytes. with no frames it's all padding, which is
+// still a valid tag
+func id3Tag(frames []id3Frame, size int) []byte {
+	buf := make([]byte, 10, size)
+	copy(buf, "ID3")
+	buf[3] = 4 // v2.4.0
+	putSynchsafe(buf[6:10], size-10)
+
+	for _, f := range frames {
+		if f.value == "" {
+			continue
+		}
+		value := truncateUTF8(f.value, id3MaxValueLen)
+		dataLen := 1 + len(value)
+		if len(buf)+10+dataLen > size {
+			break
+		}
+		var header [10]byte
+		copy(header[:], f.id)
+		putSynchsafe(header[4:8], dataLen)
+		buf = append(buf, header[:]...)
+		buf = append(buf, 3) // UTF-8
+		buf = append(buf, value...)
+	}
+	return buf[:size]
+}
+
+func putSynchsafe(b []byte, n int) {
+	binary.BigEndian.PutUint32(b, uint32(n&0x7f|(n>>7&0x7f)<<8|(n>>14&0x7f)<<16|(n>>21&0x7f)<<24))
+}
+
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,373 @@
+// Package radiorecorder captures scheduled internet radio recordings into a directory which is then scanned
+// like any other music path.
+package radiorecorder
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/fileutil"
+	"go.senan.xyz/gonic/icy"
+)
+
+const reconnectWait = 5 * time.Second
+
+type Recorder struct {
+	db         *db.DB
+	baseDir    string
+	httpClient *http.Client
+	onRecorded func(ctx context.Context, dir string)
+
+	reconnectWait time.Duration
+
+	mu     sync.Mutex
+	active map[int]struct{}
+	wg     sync.WaitGroup
+}
+
+// New creates a Recorder which writes to baseDir. onRecorded is called with the recording's folder after it has
+// written some files, so the caller can scan them
+func New(dbc *db.DB, baseDir string, onRecorded func(ctx context.Context, dir string)) *Recorder {
+	return &Recorder{
+		db:            dbc,
+		baseDir:       baseDir,
+		httpClient:    &http.Client{},
+		onRecorded:    onRecorded,
+		reconnectWait: reconnectWait,
+		active:        map[int]struct{}{},
+	}
+}
+
+// Tick starts any recordings that are due and aren't already running. they carry on in the background until
+// their scheduled end, or until ctx is done
+func (r *Recorder) Tick(ctx context.Context) error {
+	var recordings []*db.InternetRadioRecording
+	if err := r.db.Preload("Station").Find(&recordings).Error; err != nil {
+		return fmt.Errorf("find recordings: %w", err)
+	}
+	now := time.Now()
+	for _, rec := range recordings {
+		start, end, ok := rec.Due(now)
+		if !ok || rec.Station == nil {
+			continue
+		}
+		if !r.claim(rec.ID) {
+			continue
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer r.release(rec.ID)
+			r.run(ctx, rec, start, end)
+		}()
+	}
+	return nil
+}
+
+// Wait blocks until all running recordings have stopped
+func (r *Recorder) Wait() {
+	r.wg.Wait()
+}
+
+func (r *Recorder) claim(id int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.active[id]; ok {
+		return false
+	}
+	r.active[id] = struct{}{}
+	return true
+}
+
+func (r *Recorder) release(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.active, id)
+}
+
+func (r *Recorder) run(ctx context.Context, rec *db.InternetRadioRecording, start, end time.Time) {
+	recordCtx, cancel := context.WithDeadline(ctx, end)
+	defer cancel()
+
+	log.Printf("starting recording of %q until %s", rec.Station.Name, end.Format(time.Kitchen))
+	files, err := r.Record(recordCtx, rec.Station, start, rec.SplitOnTitle)
+	if err != nil {
+		log.Printf("error recording %q: %v", rec.Station.Name, err)
+	}
+	log.Printf("finished recording of %q with %d files", rec.Station.Name, files)
+
+	update := map[string]any{"last_error": ""}
+	if err != nil {
+		update["last_error"] = err.Error()
+	}
+	// if we were stopped early (gonic is shutting down) leave last_recorded_at alone so the rest of the
+	// recording picks up again on the next start
+	if errors.Is(recordCtx.Err(), context.DeadlineExceeded) {
+		update["last_recorded_at"] = time.Now()
+	}
+	if err := r.db.Model(rec).UpdateColumns(update).Error; err != nil {
+		log.Printf("error saving recording status: %v", err)
+	}
+
+	if files > 0 && r.onRecorded != nil {
+		r.onRecorded(ctx, r.dir(rec.Station, start))
+	}
+}
+
+// dir is the folder for a recording of station started at start
+func (r *Recorder) dir(station *db.InternetRadioStation, start time.Time) string {
+	return filepath.Join(r.baseDir, fileutil.Safe(cmp.Or(station.Name, "Radio")), start.Format("2006-01-02-1504"))
+}
+
+// Record captures station until ctx is done, reconnecting if the stream drops. files are written to a folder for
+// the station and start time, one per ICY title if split is set. if the folder already has files from an earlier
+// run, say gonic was restarted, numbering carries on after them. it returns how many files were written, and the
+// last error seen
+func (r *Recorder) Record(ctx context.Context, station *db.InternetRadioStation, start time.Time, split bool) (int, error) {
+	stationName := cmp.Or(station.Name, "Radio")
+	dir := r.dir(station, start)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return 0, fmt.Errorf("make recording dir: %w", err)
+	}
+	lastNum, err := lastSegmentNum(dir)
+	if err != nil {
+		return 0, fmt.Errorf("find existing segments: %w", err)
+	}
+
+	s := &session{
+		dir:     dir,
+		station: stationName,
+		album:   fmt.Sprintf("%s %s", stationName, start.Format("2006-01-02 15:04")),
+		start:   start,
+		split:   split,
+		lastNum: lastNum,
+	}
+
+	var lastErr error
+	for {
+		if err := r.recordOnce(ctx, station.StreamURL, s); err != nil && ctx.Err() == nil {
+			lastErr = err
+			log.Printf("recording %q: %v, reconnecting", stationName, err)
+		}
+		if err := s.close(); err != nil {
+			lastErr = err
+		}
+		select {
+		case <-ctx.Done():
+			return s.files, lastErr
+		case <-time.After(r.reconnectWait):
+		}
+	}
+}
+
+func (r *Recorder) recordOnce(ctx context.Context, streamURL string, s *session) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set(icy.RequestHeader, "1")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("get stream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("get stream: unexpected status %d", resp.StatusCode)
+	}
+
+	s.ext = extForContentType(resp.Header.Get("Content-Type"))
+
+	body := icy.NewReader(resp.Body, icy.MetaInt(resp.Header), s.setTitle)
+	if _, err := io.Copy(s, body); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("copy stream: %w", err)
+	}
+	if ctx.Err() == nil {
+		return fmt.Errorf("stream ended")
+	}
+	return nil
+}
+
+// session writes the audio of one recording, rotating files on title changes when splitting
+type session struct {
+	dir     string
+	station string
+	album   string
+	start   time.Time
+	split   bool
+
+	ext     string
+	files   int
+	lastNum int
+
+	cur       *segment
+	nextTitle string
+}
+
+type segment struct {
+	f        *os.File
+	num      int
+	ext      string
+	title    string
+	started  time.Time
+	hasAudio bool
+}
+
+func (s *session) setTitle(title string) {
+	s.nextTitle = title
+}
+
+func (s *session) Write(p []byte) (int, error) {
+	if title := s.nextTitle; title != "" {
+		s.nextTitle = ""
+		switch {
+		case s.cur == nil:
+			// no file yet, the new one will use this title
+		case s.cur.title == "":
+			// the audio before the first title block almost certainly belongs to the same song
+			s.cur.title = title
+			title = ""
+		case s.split:
+			if err := s.close(); err != nil {
+				return 0, err
+			}
+		default:
+			title = ""
+		}
+		if s.cur == nil {
+			if err := s.open(title); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if s.cur == nil {
+		if err := s.open(""); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.cur.f.Write(p)
+	if n > 0 {
+		s.cur.hasAudio = true
+	}
+	return n, err
+}
+
+func (s *session) open(title string) error {
+	if !s.split {
+		title = ""
+	}
+	seg := &segment{num: s.lastNum + 1, ext: s.ext, title: title, started: time.Now()}
+	f, err := os.Create(filepath.Join(s.dir, fmt.Sprintf("%02d.part", seg.num)))
+	if err != nil {
+		return fmt.Errorf("create segment: %w", err)
+	}
+	seg.f = f
+	if seg.ext == "mp3" {
+		if _, err := f.Write(id3Tag(nil, id3Size)); err != nil {
+			f.Close()
+			return fmt.Errorf("reserve tag: %w", err)
+		}
+	}
+	s.cur = seg
+	s.files++
+	s.lastNum++
+	return nil
+}
+
+// close finishes the current file, if any. its tag and final name are written now that we know the title
+func (s *session) close() error {
+	seg := s.cur
+	if seg == nil {
+		return nil
+	}
+	s.cur = nil
+
+	if !s.split {
+		seg.title = ""
+	}
+	artist, title := icy.SplitTitle(seg.title)
+	if title == "" {
+		title = fmt.Sprintf("%s %s", s.station, seg.started.Format("2006-01-02 15:04"))
+	}
+	if artist == "" {
+		artist = s.station
+	}
+
+	if seg.ext == "mp3" {
+		tag := id3Tag([]id3Frame{
+			{"TIT2", title},
+			{"TPE1", artist},
+			{"TPE2", s.station},
+			{"TALB", s.album},
+			{"TRCK", strconv.Itoa(seg.num)},
+			{"TDRC", s.start.Format("2006-01-02")},
+		}, id3Size)
+		if _, err := seg.f.WriteAt(tag, 0); err != nil {
+			seg.f.Close()
+			return fmt.Errorf("write tag: %w", err)
+		}
+	}
+	if err := seg.f.Close(); err != nil {
+		return fmt.Errorf("close segment: %w", err)
+	}
+
+	partPath := seg.f.Name()
+	if !seg.hasAudio {
+		s.files--
+		s.lastNum--
+		return os.Remove(partPath)
+	}
+	name := fmt.Sprintf("%02d", seg.num)
+	if seg.title != "" {
+		name += " " + fileutil.Safe(seg.title)
+	}
+	if err := os.Rename(partPath, filepath.Join(s.dir, name+"."+seg.ext)); err != nil {
+		return fmt.Errorf("rename segment: %w", err)
+	}
+	return nil
+}
+
+// lastSegmentNum finds the highest segment number already in dir, including any left over .part files
+func lastSegmentNum(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var last int
+	for _, entry := range entries {
+		name := entry.Name()
+		digits := name[:len(name)-len(strings.TrimLeft(name, "0123456789"))]
+		if num, err := strconv.Atoi(digits); err == nil {
+			last = max(last, num)
+		}
+	}
+	return last, nil
+}
+
+func extForContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch strings.ToLower(mediaType) {
+	case "audio/aac", "audio/aacp", "audio/x-aac":
+		return "aac"
+	case "audio/ogg", "application/ogg", "audio/opus":
+		return "ogg"
+	case "audio/flac", "audio/x-flac":
+		return "flac"
+	default:
+		return "mp3"
+	}
+}
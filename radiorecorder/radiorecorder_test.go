@@ -0,0 +1,171 @@
+package radiorecorder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.senan.xyz/taglib"
+
+	"go.senan.xyz/gonic/db"
+)
+
+// mpegFrame is a silent 128kbps 44.1kHz MPEG-1 layer III frame, so the files are real enough for taglib
+var mpegFrame = func() []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+	return frame
+}()
+
+func icyServer(t *testing.T, titles ...string) *httptest.Server {
+	t.Helper()
+
+	var conns atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// only the first connection works, the rest are reconnects we want to fail
+		if conns.Add(1) > 1 {
+			http.Error(w, "gone", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("icy-metaint", "417")
+		for _, title := range titles {
+			for range 3 {
+				_, _ = w.Write(mpegFrame)
+				_, _ = w.Write([]byte{0})
+			}
+			_, _ = w.Write(mpegFrame)
+			meta := "StreamTitle='" + title + "';"
+			block := make([]byte, 1+(len(meta)+15)/16*16)
+			block[0] = byte((len(meta) + 15) / 16)
+			copy(block[1:], meta)
+			_, _ = w.Write(block)
+		}
+		_, _ = w.Write(mpegFrame)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRecordSplit(t *testing.T) {
+	t.Parallel()
+
+	srv := icyServer(t, "Artist A - Song A", "Artist B - Song B")
+	dir := t.TempDir()
+
+	r := New(nil, dir, nil)
+	r.reconnectWait = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(t.Context(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC)
+	files, err := r.Record(ctx, &db.InternetRadioStation{Name: "My Station", StreamURL: srv.URL}, start, true)
+	require.Error(t, err) // the failed reconnects
+	require.Equal(t, 2, files)
+
+	matches, err := filepath.Glob(filepath.Join(dir, "MyStation", "2026-10-19-2000", "*"))
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, "01 ArtistASongA.mp3", filepath.Base(matches[0]))
+	assert.Equal(t, "02 ArtistBSongB.mp3", filepath.Base(matches[1]))
+
+	tags, err := taglib.ReadTags(matches[1])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Song B"}, tags[taglib.Title])
+	assert.Equal(t, []string{"Artist B"}, tags[taglib.Artist])
+	assert.Equal(t, []string{"My Station"}, tags[taglib.AlbumArtist])
+	assert.Equal(t, []string{"My Station 2026-10-19 20:00"}, tags[taglib.Album])
+	assert.Equal(t, []string{"2"}, tags[taglib.TrackNumber])
+}
+
+func TestRecordNoSplit(t *testing.T) {
+	t.Parallel()
+
+	srv := icyServer(t, "Artist A - Song A", "Artist B - Song B")
+	dir := t.TempDir()
+
+	r := New(nil, dir, nil)
+	r.reconnectWait = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(t.Context(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC)
+	files, _ := r.Record(ctx, &db.InternetRadioStation{Name: "My Station", StreamURL: srv.URL}, start, false)
+	require.Equal(t, 1, files)
+
+	path := filepath.Join(dir, "MyStation", "2026-10-19-2000", "01.mp3")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(id3Size+9*len(mpegFrame)), info.Size())
+
+	tags, err := taglib.ReadTags(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"My Station"}, tags[taglib.Artist])
+	assert.Equal(t, []string{"1"}, tags[taglib.TrackNumber])
+}
+
+func TestRecordResume(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	start := time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC)
+
+	// stopped and started again in the same minute, like a restart of gonic
+	for range 2 {
+		srv := icyServer(t, "Artist A - Song A")
+		r := New(nil, dir, nil)
+		r.reconnectWait = 10 * time.Millisecond
+
+		ctx, cancel := context.WithTimeout(t.Context(), 300*time.Millisecond)
+		files, _ := r.Record(ctx, &db.InternetRadioStation{Name: "My Station", StreamURL: srv.URL}, start, false)
+		cancel()
+		require.Equal(t, 1, files)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "MyStation", "2026-10-19-2000", "*"))
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, "01.mp3", filepath.Base(matches[0]))
+	assert.Equal(t, "02.mp3", filepath.Base(matches[1]))
+
+	tags, err := taglib.ReadTags(matches[1])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, tags[taglib.TrackNumber])
+}
+
+func TestRecordingDue(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 10, 1, 20, 0, 0, 0, time.UTC)
+	rec := db.InternetRadioRecording{StartAt: start, DurationMins: 60, Recurrence: db.InternetRadioRecurrenceWeekly}
+
+	_, _, ok := rec.Due(start.Add(-time.Minute))
+	assert.False(t, ok)
+
+	gotStart, gotEnd, ok := rec.Due(start.AddDate(0, 0, 14).Add(30 * time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, start.AddDate(0, 0, 14), gotStart)
+	assert.Equal(t, start.AddDate(0, 0, 14).Add(time.Hour), gotEnd)
+
+	_, _, ok = rec.Due(start.AddDate(0, 0, 15))
+	assert.False(t, ok)
+
+	recorded := gotEnd
+	rec.LastRecordedAt = &recorded
+	_, _, ok = rec.Due(start.AddDate(0, 0, 14).Add(30 * time.Minute))
+	assert.False(t, ok)
+
+	rec.Recurrence = db.InternetRadioRecurrenceOnce
+	rec.LastRecordedAt = nil
+	_, _, ok = rec.Due(start.AddDate(0, 0, 7).Add(30 * time.Minute))
+	assert.False(t, ok)
+}
@@ -0,0 +1,271 @@
+// Package ratingtags keeps users' track ratings and stars in the tags of the tracks' files, so they outlive the
+// database and other players can see them. changes are written back to files, and ratings already in files can be
+// imported when scanning
+package ratingtags
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.senan.xyz/wrtag/tags/normtag"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/tags"
+)
+
+var ErrUnsupported = errors.New("can't write ratings to this file type")
+
+// User is a gonic user whose ratings are kept in tags. the first one given to New is the primary user, whose ratings
+// also go in the tags that only have room for one
+type User struct {
+	Name  string
+	Email string // the owner of the user's ID3 POPM frames
+}
+
+type RatingTags struct {
+	dbc    *db.DB
+	writer tags.RatingWriter
+	users  []User
+	fmps   bool
+}
+
+// New makes a RatingTags for users. if fmps, FMPS_RATING tags are written too
+func New(dbc *db.DB, writer tags.RatingWriter, users []User, fmps bool) *RatingTags {
+	return &RatingTags{
+		dbc:    dbc,
+		writer: writer,
+		users:  users,
+		fmps:   fmps,
+	}
+}
+
+// Change is a user's rating or star of a track that's different in the database from in the file
+type Change struct {
+	Path      string
+	User      string
+	Stars     int
+	Loved     bool
+	FileStars int
+	FileLoved bool
+	Err       error // if it can't be written, like when the file is read-only
+
+	userID, trackID int
+	email           string
+	primary         bool
+}
+
+func (c *Change) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", c.Path, c.User)
+	if c.Stars != c.FileStars {
+		fmt.Fprintf(&b, " rating %d -> %d", c.FileStars, c.Stars)
+	}
+	if c.primary && c.Loved != c.FileLoved {
+		fmt.Fprintf(&b, " loved %t -> %t", c.FileLoved, c.Loved)
+	}
+	if c.Err != nil {
+		fmt.Fprintf(&b, " (can't write: %v)", c.Err)
+	}
+	return b.String()
+}
+
+// Pending finds the changes to write, and checks each can be
+func (rt *RatingTags) Pending() ([]*Change, error) {
+	users, err := rt.findUsers(rt.dbc)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*Change
+	for _, u := range users {
+		primary := u.primary
+		changed := "coalesce(track_ratings.rating, 0)<>coalesce(track_tag_ratings.stars, 0)"
+		if primary {
+			changed += " OR (track_stars.track_id IS NOT NULL)<>coalesce(track_tag_ratings.loved, 0)"
+		}
+		var rows []struct {
+			TrackID                      int
+			RootDir, LeftPath, RightPath string
+			Filename                     string
+			Stars, FileStars             int
+			Loved, FileLoved             bool
+		}
+		err := rt.dbc.
+			Table("tracks").
+			Select(`tracks.id track_id, albums.root_dir, albums.left_path, albums.right_path, tracks.filename,
+				coalesce(track_ratings.rating, 0) stars, coalesce(track_tag_ratings.stars, 0) file_stars,
+				track_stars.track_id IS NOT NULL loved, coalesce(track_tag_ratings.loved, 0) file_loved`).
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Joins("LEFT JOIN track_ratings ON track_ratings.track_id=tracks.id AND track_ratings.user_id=?", u.ID).
+			Joins("LEFT JOIN track_stars ON track_stars.track_id=tracks.id AND track_stars.user_id=?", u.ID).
+			Joins("LEFT JOIN track_tag_ratings ON track_tag_ratings.track_id=tracks.id AND track_tag_ratings.user_id=?", u.ID).
+			Where(changed).
+			Order("albums.root_dir, albums.left_path, albums.right_path, tracks.filename").
+			Scan(&rows).
+			Error
+		if err != nil {
+			return nil, fmt.Errorf("find changes for %q: %w", u.Name, err)
+		}
+		for _, row := range rows {
+			c := &Change{
+				Path:      filepath.Join(row.RootDir, row.LeftPath, row.RightPath, row.Filename),
+				User:      u.Name,
+				Stars:     row.Stars,
+				Loved:     row.Loved,
+				FileStars: row.FileStars,
+				FileLoved: row.FileLoved,
+				userID:    u.ID,
+				trackID:   row.TrackID,
+				email:     u.Email,
+				primary:   primary,
+			}
+			c.Err = rt.checkWritable(c.Path)
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// Write writes the pending changes to their files, returning how many were written. changes that can't be are skipped
+// and tried again next time
+func (rt *RatingTags) Write() (int, error) {
+	changes, err := rt.Pending()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	var errs []error
+	for _, c := range changes {
+		if c.Err == nil {
+			c.Err = rt.writer.WriteRating(c.Path, tags.Rating{Email: c.email, Stars: c.Stars, Loved: c.Loved, Primary: c.primary, FMPS: rt.fmps})
+		}
+		if c.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Path, c.Err))
+			continue
+		}
+		if err := saveFileRating(rt.dbc, c.userID, c.trackID, c.Stars, c.Loved); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+func (rt *RatingTags) checkWritable(absPath string) error {
+	if !rt.writer.CanWriteRating(absPath) {
+		return ErrUnsupported
+	}
+	f, err := os.OpenFile(absPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Import takes the ratings and stars in a track's tags that were changed outside of gonic, or are being seen for the
+// first time, into the database. a rating or star removed from the file is removed here too. ones that haven't changed
+// in the file since they were last written or imported are left alone, so ratings changed in gonic but not written yet
+// aren't undone
+func (rt *RatingTags) Import(tx *db.DB, trackID int, trags tags.Tags) error {
+	users, err := rt.findUsers(tx)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	for _, u := range users {
+		var loved bool
+		stars := tags.POPMToStars(tags.POPM(trags, u.Email))
+		if u.primary {
+			if stars == 0 {
+				stars = tags.ParseRating(normtag.Get(trags, tags.KeyRating))
+			}
+			if stars == 0 {
+				stars = tags.ParseFMPSRating(normtag.Get(trags, tags.KeyFMPSRating))
+			}
+			loved = tags.ParseBool(normtag.Get(trags, tags.KeyLoved))
+		}
+
+		var prev db.TrackTagRating
+		if err := tx.Where("user_id=? AND track_id=?", u.ID, trackID).Find(&prev).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("find file rating: %w", err)
+		}
+		switch {
+		case stars == prev.Stars:
+		case stars > 0:
+			rating := db.TrackRating{UserID: u.ID, TrackID: trackID, Rating: stars}
+			if err := tx.Save(&rating).Error; err != nil {
+				return fmt.Errorf("save rating: %w", err)
+			}
+		default: // cleared in the file by another player
+			if err := tx.Where("user_id=? AND track_id=?", u.ID, trackID).Delete(db.TrackRating{}).Error; err != nil {
+				return fmt.Errorf("delete rating: %w", err)
+			}
+		}
+		switch {
+		case loved == prev.Loved:
+		case loved:
+			star := db.TrackStar{UserID: u.ID, TrackID: trackID}
+			if err := tx.Where(star).Attrs(db.TrackStar{StarDate: time.Now()}).FirstOrCreate(&star).Error; err != nil {
+				return fmt.Errorf("save star: %w", err)
+			}
+		default:
+			if err := tx.Where("user_id=? AND track_id=?", u.ID, trackID).Delete(db.TrackStar{}).Error; err != nil {
+				return fmt.Errorf("delete star: %w", err)
+			}
+		}
+		if stars != prev.Stars || loved != prev.Loved {
+			if err := saveFileRating(tx, u.ID, trackID, stars, loved); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type user struct {
+	User
+	ID      int
+	primary bool
+}
+
+// findUsers finds the configured users, in the order they were given. ones that don't exist are skipped
+func (rt *RatingTags) findUsers(tx *db.DB) ([]user, error) {
+	if len(rt.users) == 0 {
+		return nil, nil
+	}
+	var names []string
+	for _, u := range rt.users {
+		names = append(names, u.Name)
+	}
+	var found []*db.User
+	if err := tx.Where("name IN (?)", names).Find(&found).Error; err != nil {
+		return nil, fmt.Errorf("find users: %w", err)
+	}
+	ids := map[string]int{}
+	for _, u := range found {
+		ids[u.Name] = u.ID
+	}
+	var ret []user
+	for i, u := range rt.users {
+		if id, ok := ids[u.Name]; ok {
+			ret = append(ret, user{User: u, ID: id, primary: i == 0})
+		}
+	}
+	return ret, nil
+}
+
+func saveFileRating(tx *db.DB, userID, trackID, stars int, loved bool) error {
+	fileRating := db.TrackTagRating{UserID: userID, TrackID: trackID, Stars: stars, Loved: loved}
+	if err := tx.Save(&fileRating).Error; err != nil {
+		return fmt.Errorf("save file rating: %w", err)
+	}
+	return nil
+}
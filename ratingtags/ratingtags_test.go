@@ -0,0 +1,207 @@
+package ratingtags_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/deps"
+	"go.senan.xyz/gonic/mockfs"
+	"go.senan.xyz/gonic/ratingtags"
+	"go.senan.xyz/gonic/scanner"
+	"go.senan.xyz/gonic/tags"
+	"go.senan.xyz/gonic/tags/ffprobe"
+	"go.senan.xyz/gonic/tags/native"
+)
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+	m.AddItemsGlob("artist-0/album-0/track-[01].flac")
+	m.ScanAndClean()
+	dbc := m.DB()
+
+	alice := &db.User{Name: "alice", Password: "x"}
+	bob := &db.User{Name: "bob", Password: "x"}
+	require.NoError(t, dbc.Save(alice).Error)
+	require.NoError(t, dbc.Save(bob).Error)
+
+	var tracks []*db.Track
+	require.NoError(t, dbc.Preload("Album").Order("filename").Find(&tracks).Error)
+	require.Len(t, tracks, 2)
+
+	require.NoError(t, dbc.Save(&db.TrackRating{UserID: alice.ID, TrackID: tracks[0].ID, Rating: 4}).Error)
+	require.NoError(t, dbc.Save(&db.TrackStar{UserID: alice.ID, TrackID: tracks[1].ID}).Error)
+	require.NoError(t, dbc.Save(&db.TrackStar{UserID: bob.ID, TrackID: tracks[1].ID}).Error) // not written, bob isn't primary
+
+	w := &writer{written: map[string]tags.Rating{}}
+	rt := ratingtags.New(dbc, w, []ratingtags.User{{Name: "alice", Email: "a@example.com"}, {Name: "bob", Email: "bob"}}, false)
+
+	changes, err := rt.Pending()
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, tracks[0].AbsPath(), changes[0].Path)
+	assert.Equal(t, 4, changes[0].Stars)
+	assert.True(t, changes[1].Loved)
+
+	n, err := rt.Write()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, tags.Rating{Email: "a@example.com", Stars: 4, Primary: true}, w.written[tracks[0].AbsPath()])
+	assert.Equal(t, tags.Rating{Email: "a@example.com", Loved: true, Primary: true}, w.written[tracks[1].AbsPath()])
+
+	// nothing left to write
+	changes, err = rt.Pending()
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// unrating is written too
+	require.NoError(t, dbc.Where("user_id=? AND track_id=?", alice.ID, tracks[0].ID).Delete(db.TrackRating{}).Error)
+	require.NoError(t, dbc.Save(&db.TrackRating{UserID: bob.ID, TrackID: tracks[0].ID, Rating: 2}).Error)
+	n, err = rt.Write()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// files that can't be written to are reported, and tried again next time
+	w.unsupported = true
+	require.NoError(t, dbc.Save(&db.TrackRating{UserID: alice.ID, TrackID: tracks[1].ID, Rating: 5}).Error)
+	changes, err = rt.Pending()
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.ErrorIs(t, changes[0].Err, ratingtags.ErrUnsupported)
+	assert.True(t, strings.HasSuffix(changes[0].String(), "rating 0 -> 5 (can't write: can't write ratings to this file type)"))
+	_, err = rt.Write()
+	assert.ErrorIs(t, err, ratingtags.ErrUnsupported)
+	changes, err = rt.Pending()
+	require.NoError(t, err)
+	assert.Len(t, changes, 1)
+}
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+	m.AddItemsGlob("artist-0/album-0/track-0.flac")
+	m.ScanAndClean()
+	dbc := m.DB()
+
+	alice := &db.User{Name: "alice", Password: "x"}
+	require.NoError(t, dbc.Save(alice).Error)
+
+	var track db.Track
+	require.NoError(t, dbc.Find(&track).Error)
+
+	rt := ratingtags.New(dbc, &writer{}, []ratingtags.User{{Name: "alice", Email: "alice"}}, false)
+	rating := func() int {
+		var r db.TrackRating
+		dbc.Where("user_id=? AND track_id=?", alice.ID, track.ID).Find(&r)
+		return r.Rating
+	}
+
+	starred := func() int {
+		var n int
+		dbc.Model(db.TrackStar{}).Where("user_id=? AND track_id=?", alice.ID, track.ID).Count(&n)
+		return n
+	}
+
+	require.NoError(t, rt.Import(dbc, track.ID, tags.Tags{"RATING": {"60"}, "LOVED": {"1"}}))
+	assert.Equal(t, 3, rating())
+	assert.Equal(t, 1, starred())
+
+	// rated in gonic since, but the file hasn't changed. so the new rating is kept, to be written
+	require.NoError(t, dbc.Save(&db.TrackRating{UserID: alice.ID, TrackID: track.ID, Rating: 5}).Error)
+	require.NoError(t, rt.Import(dbc, track.ID, tags.Tags{"RATING": {"60"}, "LOVED": {"1"}}))
+	assert.Equal(t, 5, rating())
+
+	// changed in the file by another player
+	require.NoError(t, rt.Import(dbc, track.ID, tags.Tags{"FMPS_RATING": {"0.4"}}))
+	assert.Equal(t, 2, rating())
+	assert.Equal(t, 0, starred()) // and no longer loved
+
+	// an ID3 POPM frame for the user, as the readers give them
+	require.NoError(t, rt.Import(dbc, track.ID, tags.Tags{tags.KeyPOPMPrefix + "alice": {"196"}}))
+	assert.Equal(t, 4, rating())
+
+	// cleared in the file by another player, so not written back
+	require.NoError(t, rt.Import(dbc, track.ID, tags.Tags{}))
+	assert.Equal(t, 0, rating())
+	changes, err := rt.Pending()
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+// ratings written to an MP3 by the native writer, which is the only one in nowasm builds, are read back by the next
+// scan as they were written, so they aren't undone
+func TestWriteThenScan(t *testing.T) {
+	t.Parallel()
+
+	readers := map[string]tags.Reader{"native": native.Reader{}}
+	if _, err := exec.LookPath("ffprobe"); err == nil {
+		readers["ffprobe"] = ffprobe.Reader{}
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dbc, err := db.NewMock(deps.DBDriverOptions())
+			require.NoError(t, err)
+			t.Cleanup(func() { require.NoError(t, dbc.Close()) })
+			require.NoError(t, dbc.Migrate(db.MigrationContext{}))
+
+			dir := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "artist", "album"), os.ModePerm))
+			data, err := os.ReadFile(filepath.Join("..", "tags", "testdata", "eg.mp3"))
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "artist", "album", "track.mp3"), data, 0o644))
+
+			alice := &db.User{Name: "alice", Password: "x"}
+			require.NoError(t, dbc.Save(alice).Error)
+
+			rt := ratingtags.New(dbc, native.Writer{}, []ratingtags.User{{Name: "alice", Email: "alice@example.com"}}, true)
+			scannr := scanner.New([]string{dir}, dbc, nil, reader, "", false, nil, nil, 1, rt)
+			_, err = scannr.ScanAndClean(scanner.ScanOptions{})
+			require.NoError(t, err)
+
+			var track db.Track
+			require.NoError(t, dbc.Find(&track).Error)
+			require.NoError(t, dbc.Save(&db.TrackRating{UserID: alice.ID, TrackID: track.ID, Rating: 4}).Error)
+			require.NoError(t, dbc.Save(&db.TrackStar{UserID: alice.ID, TrackID: track.ID}).Error)
+
+			n, err := rt.Write()
+			require.NoError(t, err)
+			require.Equal(t, 1, n)
+
+			// a full scan, so the file is read again however soon after the write it is
+			_, err = scannr.ScanAndClean(scanner.ScanOptions{IsFull: true})
+			require.NoError(t, err)
+
+			var rating db.TrackRating
+			require.NoError(t, dbc.Where("user_id=? AND track_id=?", alice.ID, track.ID).Find(&rating).Error)
+			assert.Equal(t, 4, rating.Rating)
+			var starred int
+			require.NoError(t, dbc.Model(db.TrackStar{}).Where("user_id=? AND track_id=?", alice.ID, track.ID).Count(&starred).Error)
+			assert.Equal(t, 1, starred)
+
+			changes, err := rt.Pending()
+			require.NoError(t, err)
+			assert.Empty(t, changes)
+		})
+	}
+}
+
+type writer struct {
+	written     map[string]tags.Rating
+	unsupported bool
+}
+
+func (w *writer) CanWriteRating(string) bool { return !w.unsupported }
+
+func (w *writer) WriteRating(absPath string, r tags.Rating) error {
+	w.written[absPath] = r
+	return nil
+}
@@ -0,0 +1,173 @@
+package scanner
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.senan.xyz/gonic/db"
+)
+
+// discFolderExpr matches folders like "CD1", "Disc 2 - Bonus", or "Album (Disk 03)", with the disc number and an
+// optional disc title
+var discFolderExpr = regexp.MustCompile(`(?i)^(?:.*?[\s_\-(\[])?(?:cd|dis[ck])[\s_\-.]*(\d{1,3})[)\]]?(?:\s*[-:._]\s*(.+?)|\s*\((.+)\))?\s*$`)
+
+// parseDiscFolder returns the disc number and title from a disc folder's name, or 0 if it isn't one
+func parseDiscFolder(name string) (int, string) {
+	m := discFolderExpr.FindStringSubmatch(name)
+	if m == nil {
+		return 0, ""
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n, cmp.Or(m[2], m[3])
+}
+
+type discAlbum struct {
+	ID             int
+	ParentID       int
+	RightPath      string
+	TagTitle       string
+	TagAlbumArtist string
+	TagBrainzID    string
+	DiscOfID       int
+
+	disc      int
+	discTitle string
+}
+
+// mergeDiscs finds releases split over disc subfolders of the same folder, like Album/CD1 and Album/CD2, so they can
+// be shown as one album by tags. the discs must have the same release MBID, or the same album and album artist tags.
+// the first disc stands for the rest, which point to it with disc_of_id. the folders themselves are left alone
+func (s *Scanner) mergeDiscs() error {
+	var numMerged int
+
+	start := time.Now()
+	defer func() { log.Printf("finished merge discs in %s, %d merged", durSince(start), numMerged) }()
+
+	var albums []*discAlbum
+	if err := s.db.
+		Model(db.Album{}).
+		Select("id, parent_id, right_path, tag_title, tag_album_artist, tag_brainz_id, coalesce(disc_of_id, 0) disc_of_id").
+		Where("(parent_id IS NOT NULL AND tag_title != '' AND (right_path LIKE '%cd%' OR right_path LIKE '%dis%')) OR disc_of_id IS NOT NULL").
+		Scan(&albums).
+		Error; err != nil {
+		return fmt.Errorf("find disc folders: %w", err)
+	}
+
+	groups := map[string][]*discAlbum{}
+	for _, a := range albums {
+		if a.TagTitle == "" {
+			continue
+		}
+		if a.disc, a.discTitle = parseDiscFolder(a.RightPath); a.disc == 0 {
+			continue
+		}
+		key := "tags\x00" + strings.ToLower(a.TagTitle) + "\x00" + strings.ToLower(a.TagAlbumArtist)
+		if a.TagBrainzID != "" {
+			key = "mbid\x00" + a.TagBrainzID
+		}
+		key = strconv.Itoa(a.ParentID) + "\x00" + key
+		groups[key] = append(groups[key], a)
+	}
+
+	discOf := map[int]int{} // album id to the first disc's
+	for _, discs := range groups {
+		if len(discs) < 2 {
+			continue
+		}
+		slices.SortFunc(discs, func(a, b *discAlbum) int { return cmp.Or(cmp.Compare(a.disc, b.disc), cmp.Compare(a.ID, b.ID)) })
+		if len(slices.CompactFunc(slices.Clone(discs), func(a, b *discAlbum) bool { return a.disc == b.disc })) != len(discs) {
+			continue // two folders for the same disc, so they're likely something else
+		}
+		for _, a := range discs[1:] {
+			discOf[a.ID] = discs[0].ID
+		}
+		if err := s.fixDiscNumbers(discs); err != nil {
+			return fmt.Errorf("fix disc numbers: %w", err)
+		}
+		numMerged++
+	}
+
+	return s.db.Transaction(func(tx *db.DB) error {
+		for _, a := range albums {
+			if a.DiscOfID == discOf[a.ID] {
+				continue
+			}
+			var v any
+			if discOf[a.ID] != 0 {
+				v = discOf[a.ID]
+			}
+			if err := tx.Model(db.Album{}).Where("id=?", a.ID).UpdateColumn("disc_of_id", v).Error; err != nil {
+				return fmt.Errorf("update disc of: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// fixDiscNumbers numbers the tracks of each disc by their folder, if their tags don't already tell the discs apart.
+// titles from the folder names are used for discs with no DISCSUBTITLE tag
+func (s *Scanner) fixDiscNumbers(discs []*discAlbum) error {
+	ids := make([]int, 0, len(discs))
+	for _, a := range discs {
+		ids = append(ids, a.ID)
+	}
+	var rows []struct {
+		AlbumID       int
+		TagDiscNumber int
+	}
+	if err := s.db.
+		Model(db.Track{}).
+		Select("DISTINCT album_id, coalesce(tag_disc_number, 0) tag_disc_number").
+		Where("album_id IN (?)", ids).
+		Scan(&rows).
+		Error; err != nil {
+		return fmt.Errorf("find disc numbers: %w", err)
+	}
+
+	tagged := map[int][]int{} // album id to its tracks' disc numbers
+	seen := map[int]int{}     // disc number to how many albums have it
+	for _, r := range rows {
+		tagged[r.AlbumID] = append(tagged[r.AlbumID], r.TagDiscNumber)
+		seen[r.TagDiscNumber]++
+	}
+	var clash bool
+	for n, count := range seen {
+		if count > 1 || n == 0 {
+			clash = true
+		}
+	}
+
+	return s.db.Transaction(func(tx *db.DB) error {
+		for _, a := range discs {
+			disc := a.disc
+			if !clash {
+				if len(tagged[a.ID]) != 1 {
+					continue // spread over many discs already, so no one title for the folder
+				}
+				disc = tagged[a.ID][0]
+			} else {
+				if err := tx.Exec(`UPDATE tracks SET tag_disc_number=? WHERE album_id=? AND (tag_disc_number IS NULL OR tag_disc_number!=?)`, disc, a.ID, disc).Error; err != nil {
+					return fmt.Errorf("update track disc numbers: %w", err)
+				}
+				if err := tx.Exec(`UPDATE OR IGNORE album_disc_titles SET disc_number=? WHERE album_id=?`, disc, a.ID).Error; err != nil {
+					return fmt.Errorf("update disc titles: %w", err)
+				}
+				if err := tx.Exec(`DELETE FROM album_disc_titles WHERE album_id=? AND disc_number!=?`, a.ID, disc).Error; err != nil {
+					return fmt.Errorf("delete disc titles: %w", err)
+				}
+			}
+			if a.discTitle != "" {
+				if err := tx.Exec(`INSERT OR IGNORE INTO album_disc_titles (album_id, disc_number, title) VALUES (?, ?, ?)`, a.ID, disc, a.discTitle).Error; err != nil {
+					return fmt.Errorf("insert disc title: %w", err)
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,366 @@
+package scanner
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"go.senan.xyz/gonic/db"
+)
+
+// DryRun runs a scan against a throwaway copy of the database and reports what it would change. the real
+// database isn't touched, so this can be used to try a new music path or different multi value settings
+func (s *Scanner) DryRun(opts ScanOptions) (*Report, error) {
+	tmpDir, err := os.MkdirTemp("", "gonic-dry-run-")
+	if err != nil {
+		return nil, fmt.Errorf("make temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot, err := s.db.Snapshot(filepath.Join(tmpDir, "gonic.db"))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot db: %w", err)
+	}
+	defer snapshot.Close()
+
+	dry := New(s.musicDirs, snapshot, s.multiValueSettings, s.tagReader, "", s.scanEmbeddedCover, s.GenreTree(), s.genreNorm, s.workers, s.ratingTags)
+	dry.excludePattern = s.excludePattern
+
+	st, err := dry.ScanAndClean(opts)
+	if st == nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	before, err := loadLibrary(s.db)
+	if err != nil {
+		return nil, fmt.Errorf("load library before: %w", err)
+	}
+	after, err := loadLibrary(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("load library after: %w", err)
+	}
+
+	report := diffLibraries(before, after)
+	for _, err := range st.errs {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	return report, nil
+}
+
+type Change string
+
+const (
+	ChangeAdded   Change = "added"
+	ChangeUpdated Change = "updated"
+	ChangeMerged  Change = "merged"
+	ChangeRemoved Change = "removed"
+)
+
+type ReportItemType string
+
+const (
+	ReportAlbum  ReportItemType = "album"
+	ReportTrack  ReportItemType = "track"
+	ReportArtist ReportItemType = "artist"
+	ReportGenre  ReportItemType = "genre"
+)
+
+//nolint:gochecknoglobals
+var (
+	reportTypes   = []ReportItemType{ReportAlbum, ReportTrack, ReportArtist, ReportGenre}
+	reportChanges = []Change{ChangeAdded, ChangeUpdated, ChangeMerged, ChangeRemoved}
+)
+
+type ReportItem struct {
+	Type   ReportItemType
+	Change Change
+	Name   string
+	Detail string // what changed for updates, or what it was merged into
+}
+
+// Report is what a dry run scan would change
+type Report struct {
+	Items  []ReportItem
+	Errors []string
+}
+
+func (r *Report) Count(typ ReportItemType, change Change) int {
+	var n int
+	for _, item := range r.Items {
+		if item.Type == typ && item.Change == change {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteTo writes the report as text, a summary table followed by each change
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	sb.WriteString("dry run scan, nothing has been changed\n\n")
+
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "\t")
+	for _, change := range reportChanges {
+		fmt.Fprintf(tw, "%s\t", change)
+	}
+	fmt.Fprintln(tw)
+	for _, typ := range reportTypes {
+		fmt.Fprintf(tw, "%ss\t", typ)
+		for _, change := range reportChanges {
+			fmt.Fprintf(tw, "%d\t", r.Count(typ, change))
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	if len(r.Items) > 0 {
+		sb.WriteString("\n")
+	}
+	for _, item := range r.Items {
+		fmt.Fprintf(&sb, "%s %s %q", item.Change, item.Type, item.Name)
+		if item.Detail != "" {
+			fmt.Fprintf(&sb, ": %s", item.Detail)
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(r.Errors) > 0 {
+		sb.WriteString("\nerrors\n")
+	}
+	for _, err := range r.Errors {
+		fmt.Fprintf(&sb, "%s\n", err)
+	}
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// library is the parts of the database a scan changes, flattened for comparing
+type library struct {
+	albums, tracks, artists, genres map[int]libraryItem
+
+	// for telling where removed artists and genres went
+	trackArtists, trackGenres map[int][]int
+}
+
+type libraryItem struct {
+	name   string
+	fields []libraryField
+}
+
+type libraryField struct {
+	name, value string
+}
+
+func loadLibrary(dbc *db.DB) (*library, error) {
+	lib := &library{
+		albums:       map[int]libraryItem{},
+		tracks:       map[int]libraryItem{},
+		artists:      map[int]libraryItem{},
+		genres:       map[int]libraryItem{},
+		trackArtists: map[int][]int{},
+		trackGenres:  map[int][]int{},
+	}
+
+	var artists []*db.Artist
+	if err := dbc.Find(&artists).Error; err != nil {
+		return nil, fmt.Errorf("find artists: %w", err)
+	}
+	for _, a := range artists {
+		lib.artists[a.ID] = libraryItem{name: a.Name, fields: []libraryField{{"musicbrainz id", a.MusicBrainzID}}}
+	}
+
+	var genres []*db.Genre
+	if err := dbc.Find(&genres).Error; err != nil {
+		return nil, fmt.Errorf("find genres: %w", err)
+	}
+	for _, g := range genres {
+		lib.genres[g.ID] = libraryItem{name: g.Name}
+	}
+
+	var trackCredits []*db.TrackCredit
+	if err := dbc.Find(&trackCredits).Error; err != nil {
+		return nil, fmt.Errorf("find track credits: %w", err)
+	}
+	trackCreditNames := map[int][]string{}
+	for _, c := range trackCredits {
+		lib.trackArtists[c.TrackID] = append(lib.trackArtists[c.TrackID], c.ArtistID)
+		trackCreditNames[c.TrackID] = append(trackCreditNames[c.TrackID], c.Role+" "+lib.artists[c.ArtistID].name)
+	}
+
+	var trackGenres []*db.TrackGenre
+	if err := dbc.Find(&trackGenres).Error; err != nil {
+		return nil, fmt.Errorf("find track genres: %w", err)
+	}
+	trackGenreNames := map[int][]string{}
+	for _, tg := range trackGenres {
+		lib.trackGenres[tg.TrackID] = append(lib.trackGenres[tg.TrackID], tg.GenreID)
+		trackGenreNames[tg.TrackID] = append(trackGenreNames[tg.TrackID], lib.genres[tg.GenreID].name)
+	}
+
+	var albumCredits []*db.AlbumCredit
+	if err := dbc.Find(&albumCredits).Error; err != nil {
+		return nil, fmt.Errorf("find album credits: %w", err)
+	}
+	albumCreditNames := map[int][]string{}
+	for _, c := range albumCredits {
+		albumCreditNames[c.AlbumID] = append(albumCreditNames[c.AlbumID], c.Role+" "+lib.artists[c.ArtistID].name)
+	}
+
+	var albumGenres []*db.AlbumGenre
+	if err := dbc.Find(&albumGenres).Error; err != nil {
+		return nil, fmt.Errorf("find album genres: %w", err)
+	}
+	albumGenreNames := map[int][]string{}
+	for _, ag := range albumGenres {
+		albumGenreNames[ag.AlbumID] = append(albumGenreNames[ag.AlbumID], lib.genres[ag.GenreID].name)
+	}
+
+	// folders without tracks aren't albums as far as anyone browsing is concerned
+	var albums []*db.Album
+	if err := dbc.Where("id IN (SELECT DISTINCT album_id FROM tracks)").Find(&albums).Error; err != nil {
+		return nil, fmt.Errorf("find albums: %w", err)
+	}
+	albumPaths := map[int]string{}
+	for _, a := range albums {
+		albumPaths[a.ID] = filepath.Join(a.LeftPath, a.RightPath)
+		lib.albums[a.ID] = libraryItem{name: albumPaths[a.ID], fields: []libraryField{
+			{"title", a.TagTitle},
+			{"sort title", a.TagTitleSort},
+			{"album artist", a.TagAlbumArtist},
+			{"year", fmt.Sprint(a.TagYear)},
+			{"release type", a.TagReleaseType},
+			{"compilation", fmt.Sprint(a.TagCompilation)},
+			{"musicbrainz id", a.TagBrainzID},
+			{"credits", joinSorted(albumCreditNames[a.ID])},
+			{"genres", joinSorted(albumGenreNames[a.ID])},
+		}}
+	}
+
+	var tracks []*db.Track
+	if err := dbc.Find(&tracks).Error; err != nil {
+		return nil, fmt.Errorf("find tracks: %w", err)
+	}
+	for _, t := range tracks {
+		lib.tracks[t.ID] = libraryItem{name: filepath.Join(albumPaths[t.AlbumID], t.Filename), fields: []libraryField{
+			{"title", t.TagTitle},
+			{"artist", t.TagTrackArtist},
+			{"track number", fmt.Sprint(t.TagTrackNumber)},
+			{"disc number", fmt.Sprint(t.TagDiscNumber)},
+			{"year", fmt.Sprint(t.TagYear)},
+			{"bpm", fmt.Sprint(t.TagBPM)},
+			{"comment", t.TagComment},
+			{"movement", t.TagMovementName},
+			{"length", fmt.Sprint(t.Length)},
+			{"bitrate", fmt.Sprint(t.Bitrate)},
+			{"sample rate", fmt.Sprint(t.SampleRate)},
+			{"bit depth", fmt.Sprint(t.BitDepth)},
+			{"channels", fmt.Sprint(t.Channels)},
+			{"codec", t.Codec},
+			{"musicbrainz id", t.TagBrainzID},
+			{"credits", joinSorted(trackCreditNames[t.ID])},
+			{"genres", joinSorted(trackGenreNames[t.ID])},
+		}}
+	}
+
+	return lib, nil
+}
+
+func diffLibraries(before, after *library) *Report {
+	var report Report
+	diffItems(&report, ReportAlbum, before.albums, after.albums, nil)
+	diffItems(&report, ReportTrack, before.tracks, after.tracks, nil)
+	diffItems(&report, ReportArtist, before.artists, after.artists, func(id int) []int {
+		return mergedInto(before.trackArtists, after.trackArtists, before.artists, id)
+	})
+	diffItems(&report, ReportGenre, before.genres, after.genres, func(id int) []int {
+		return mergedInto(before.trackGenres, after.trackGenres, before.genres, id)
+	})
+	return &report
+}
+
+// diffItems compares by id. ids of rows which are kept don't change since the scan ran on a copy of the same
+// database. merged is optional, and gives the existing items a removed one's tracks moved to
+func diffItems(report *Report, typ ReportItemType, before, after map[int]libraryItem, merged func(id int) []int) {
+	var items []ReportItem
+	for id, b := range before {
+		a, ok := after[id]
+		if !ok {
+			if merged != nil {
+				if into := merged(id); len(into) > 0 {
+					var names []string
+					for _, intoID := range into {
+						names = append(names, fmt.Sprintf("%q", after[intoID].name))
+					}
+					slices.Sort(names)
+					items = append(items, ReportItem{Type: typ, Change: ChangeMerged, Name: b.name, Detail: "into " + strings.Join(names, ", ")})
+					continue
+				}
+			}
+			items = append(items, ReportItem{Type: typ, Change: ChangeRemoved, Name: b.name})
+			continue
+		}
+		var changes []string
+		if a.name != b.name {
+			changes = append(changes, fmt.Sprintf("name %q -> %q", b.name, a.name))
+		}
+		for i := range min(len(a.fields), len(b.fields)) {
+			if a.fields[i].value != b.fields[i].value {
+				changes = append(changes, fmt.Sprintf("%s %q -> %q", a.fields[i].name, b.fields[i].value, a.fields[i].value))
+			}
+		}
+		if len(changes) > 0 {
+			items = append(items, ReportItem{Type: typ, Change: ChangeUpdated, Name: a.name, Detail: strings.Join(changes, ", ")})
+		}
+	}
+	for id, a := range after {
+		if _, ok := before[id]; !ok {
+			items = append(items, ReportItem{Type: typ, Change: ChangeAdded, Name: a.name})
+		}
+	}
+	slices.SortFunc(items, func(a, b ReportItem) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(reportChanges, a.Change), slices.Index(reportChanges, b.Change)),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+	report.Items = append(report.Items, items...)
+}
+
+// mergedInto finds the items which took over the tracks of removed item id, if they all existed before. like
+// an artist "A & B" folding into existing artists "A" and "B" after changing multi value settings
+func mergedInto(beforeTracks, afterTracks map[int][]int, beforeItems map[int]libraryItem, id int) []int {
+	into := map[int]struct{}{}
+	for trackID, ids := range beforeTracks {
+		if !slices.Contains(ids, id) {
+			continue
+		}
+		for _, afterID := range afterTracks[trackID] {
+			if slices.Contains(ids, afterID) {
+				continue // credited before too, so not where this one went
+			}
+			if _, ok := beforeItems[afterID]; !ok {
+				return nil // went somewhere new, that's a rename or a split more than a merge
+			}
+			into[afterID] = struct{}{}
+		}
+	}
+	var r []int
+	for intoID := range into {
+		r = append(r, intoID)
+	}
+	slices.Sort(r)
+	return r
+}
+
+func joinSorted(values []string) string {
+	values = slices.Clone(values)
+	slices.Sort(values)
+	return strings.Join(values, "; ")
+}
@@ -0,0 +1,271 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"go.senan.xyz/wrtag/tags/normtag"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/specid"
+	"go.senan.xyz/gonic/tags"
+)
+
+// a track's identity is what stays the same when it's moved, renamed, or retagged. it's used to move plays, stars,
+// ratings, bookmarks, and play queue entries over to the new track when the old one is cleaned
+
+// trackIdentity is the track's MusicBrainz release track ID, else its recording and release IDs, else a hash of its
+// audio with its length, or empty if there's nothing to go by
+func trackIdentity(trags tags.Tags, length time.Duration, contentHash string) string {
+	if id := normtag.Get(trags, "MUSICBRAINZ_RELEASETRACKID"); id != "" {
+		return "mbt:" + id
+	}
+	recordingID := normtag.Get(trags, normtag.MusicBrainzRecordingID)
+	releaseID := normtag.Get(trags, normtag.MusicBrainzReleaseID)
+	if recordingID != "" && releaseID != "" {
+		return "mbr:" + releaseID + "/" + recordingID
+	}
+	if contentHash != "" {
+		return fmt.Sprintf("sha:%s/%d", contentHash, length.Round(time.Second)/time.Second)
+	}
+	return ""
+}
+
+const contentHashSize = 64 * 1024
+
+// contentHash hashes the last bit of audio in the file, along with the size of all of it. tags at either end of the
+// file are skipped where we know how to find them, so retagging doesn't change it. the size keeps tracks which only
+// share an ending, like a run of silence, apart
+func contentHash(absPath string) (string, error) {
+	f, err := os.Open(absPath)
+	if err != nil {
+		return "", fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("stat: %w", err)
+	}
+	audioStart, err := audioStart(f)
+	if err != nil {
+		return "", fmt.Errorf("find start of audio: %w", err)
+	}
+	end, err := audioEnd(f, info.Size())
+	if err != nil {
+		return "", fmt.Errorf("find end of audio: %w", err)
+	}
+	if end <= audioStart {
+		return "", nil
+	}
+	start := max(audioStart, end-contentHashSize)
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, start, end-start)); err != nil {
+		return "", fmt.Errorf("read: %w", err)
+	}
+	return fmt.Sprintf("%s/%d", hex.EncodeToString(h.Sum(nil)[:16]), end-audioStart), nil
+}
+
+// audioStart is the offset after any ID3v2 tags and FLAC metadata blocks at the start of the file. other formats keep
+// their tags elsewhere, and count from the start of the file
+func audioStart(r io.ReaderAt) (int64, error) {
+	const id3v2HeaderSize = 10
+	const flacBlockHeaderSize = 4
+
+	var start int64
+	for hasMagic(r, start, "ID3") {
+		var header [id3v2HeaderSize]byte
+		if _, err := r.ReadAt(header[:], start); err != nil {
+			return 0, err
+		}
+		size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+		if header[5]&0x10 != 0 {
+			size += id3v2HeaderSize // and a footer
+		}
+		start += id3v2HeaderSize + size
+	}
+	if !hasMagic(r, start, "fLaC") {
+		return start, nil
+	}
+	start += 4
+	for {
+		var header [flacBlockHeaderSize]byte
+		if _, err := r.ReadAt(header[:], start); err != nil {
+			return 0, err
+		}
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		start += flacBlockHeaderSize + size
+		if header[0]&0x80 != 0 { // last block
+			return start, nil
+		}
+	}
+}
+
+// audioEnd is the offset where any ID3v1 and APEv2 tags at the end of the file start
+func audioEnd(r io.ReaderAt, end int64) (int64, error) {
+	const id3v1Size = 128
+	const apeFooterSize = 32
+
+	for {
+		switch {
+		case end >= id3v1Size && hasMagic(r, end-id3v1Size, "TAG"):
+			end -= id3v1Size
+		case end >= apeFooterSize && hasMagic(r, end-apeFooterSize, "APETAGEX"):
+			var footer [apeFooterSize]byte
+			if _, err := r.ReadAt(footer[:], end-apeFooterSize); err != nil {
+				return 0, err
+			}
+			size := int64(binary.LittleEndian.Uint32(footer[12:16])) // items and footer
+			if flags := binary.LittleEndian.Uint32(footer[20:24]); flags&(1<<31) != 0 {
+				size += apeFooterSize // and a header
+			}
+			if size > end {
+				return end, nil
+			}
+			end -= size
+		default:
+			return end, nil
+		}
+	}
+}
+
+func hasMagic(r io.ReaderAt, off int64, magic string) bool {
+	buf := make([]byte, len(magic))
+	if _, err := r.ReadAt(buf, off); err != nil {
+		return false
+	}
+	return bytes.Equal(buf, []byte(magic))
+}
+
+// relinkTracks moves user data from missing tracks to tracks with the same identity that are still here, before the
+// missing ones are deleted
+func (s *Scanner) relinkTracks(st *State) error {
+	if len(st.tracksMissing) == 0 {
+		return nil
+	}
+	missing := make(map[int]struct{}, len(st.tracksMissing))
+	for _, id := range st.tracksMissing {
+		missing[int(id)] = struct{}{}
+	}
+
+	relinks := map[int]int{}
+	for chunk := range slices.Chunk(st.tracksMissing, 999) {
+		var olds []*db.Track
+		if err := s.db.Select("id, identity").Where("id IN (?) AND identity IS NOT NULL AND identity != ''", chunk).Find(&olds).Error; err != nil {
+			return fmt.Errorf("find missing track identities: %w", err)
+		}
+		for _, old := range olds {
+			var candidates []int
+			if err := s.db.Model(db.Track{}).Where("identity=?", old.Identity).Order("id DESC").Pluck("id", &candidates).Error; err != nil {
+				return fmt.Errorf("find tracks by identity: %w", err)
+			}
+			for _, id := range candidates {
+				if _, ok := missing[id]; !ok {
+					relinks[old.ID] = id
+					break
+				}
+			}
+		}
+	}
+	if len(relinks) == 0 {
+		return nil
+	}
+
+	err := s.db.Transaction(func(tx *db.DB) error {
+		for oldID, newID := range relinks {
+			if err := relinkTrackData(tx, oldID, newID); err != nil {
+				return fmt.Errorf("relink %d to %d: %w", oldID, newID, err)
+			}
+		}
+		return relinkPlayQueues(tx, relinks)
+	})
+	if err != nil {
+		return err
+	}
+	st.tracksRelinked += len(relinks)
+	log.Printf("relinked user data for %d moved tracks", len(relinks))
+	return nil
+}
+
+func relinkTrackData(tx *db.DB, oldID, newID int) error {
+	// plays of the same user are added together. stars and ratings already on the new track win
+	err := tx.Exec(`
+		UPDATE track_plays
+		SET count=track_plays.count+o.count, time=max(track_plays.time, o.time), length=max(track_plays.length, o.length)
+		FROM (SELECT user_id, count, time, length FROM track_plays WHERE track_id=?) AS o
+		WHERE track_plays.track_id=? AND track_plays.user_id=o.user_id`,
+		oldID, newID).Error
+	if err != nil {
+		return fmt.Errorf("merge plays: %w", err)
+	}
+	for _, table := range []string{"track_plays", "track_stars", "track_ratings"} {
+		if err := tx.Exec("UPDATE OR IGNORE "+table+" SET track_id=? WHERE track_id=?", newID, oldID).Error; err != nil {
+			return fmt.Errorf("update %s: %w", table, err)
+		}
+	}
+	// a user has one bookmark per track, so if they have one on both keep whichever they made last
+	err = tx.Exec(`
+		DELETE FROM bookmarks
+		WHERE entry_id_type=? AND entry_id IN (?, ?) AND EXISTS (
+			SELECT 1 FROM bookmarks other
+			WHERE other.user_id=bookmarks.user_id AND other.entry_id_type=bookmarks.entry_id_type
+				AND other.entry_id IN (?, ?) AND other.entry_id!=bookmarks.entry_id
+				AND (other.updated_at>bookmarks.updated_at OR (other.updated_at=bookmarks.updated_at AND other.id>bookmarks.id))
+		)`,
+		db.BookmarkEntryTrack, oldID, newID, oldID, newID).Error
+	if err != nil {
+		return fmt.Errorf("delete older bookmarks: %w", err)
+	}
+	err = tx.Model(db.Bookmark{}).
+		Where("entry_id_type=? AND entry_id=?", db.BookmarkEntryTrack, oldID).
+		UpdateColumn("entry_id", newID).
+		Error
+	if err != nil {
+		return fmt.Errorf("update bookmarks: %w", err)
+	}
+	return nil
+}
+
+func relinkPlayQueues(tx *db.DB, relinks map[int]int) error {
+	var queues []*db.PlayQueue
+	if err := tx.Find(&queues).Error; err != nil {
+		return fmt.Errorf("find play queues: %w", err)
+	}
+	relink := func(id specid.ID) (specid.ID, bool) {
+		if newID, ok := relinks[id.Value]; ok && id.Type == specid.Track {
+			return specid.ID{Type: specid.Track, Value: newID}, true
+		}
+		return id, false
+	}
+	for _, queue := range queues {
+		var changed bool
+		items := queue.GetItems()
+		for i := range items {
+			var ok bool
+			if items[i], ok = relink(items[i]); ok {
+				changed = true
+			}
+		}
+		if current, ok := relink(*queue.CurrentSID()); ok {
+			queue.Current = current.String()
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		queue.SetItems(items)
+		if err := tx.Model(queue).UpdateColumns(map[string]any{"items": queue.Items, "current": queue.Current}).Error; err != nil {
+			return fmt.Errorf("update play queue: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package scanner
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"go.senan.xyz/gonic/db"
+)
+
+// imageKindWords maps words in an image's filename to its kind, checked in order so that "cd back.jpg" is a back
+// and "booklet front.jpg" is a booklet page
+var imageKindWords = []struct {
+	kind  db.AlbumImageKind
+	words []string
+}{
+	{db.AlbumImageBack, []string{"back", "rear", "inlay", "tray"}},
+	{db.AlbumImageDisc, []string{"disc", "disk", "cd", "media", "vinyl"}},
+	{db.AlbumImageBooklet, []string{"booklet", "book", "page", "scan", "insert", "inside"}},
+	{db.AlbumImageArtist, []string{"artist"}},
+	{db.AlbumImageFront, []string{"cover", "front", "folder", "album"}},
+}
+
+var imageKindOrder = []db.AlbumImageKind{
+	db.AlbumImageFront, db.AlbumImageBack, db.AlbumImageDisc, db.AlbumImageBooklet, db.AlbumImageArtist, db.AlbumImageOther,
+}
+
+// imageKind guesses what an image in an album folder shows from its filename, like "Back.jpg" or "booklet-03.png"
+func imageKind(filename string) db.AlbumImageKind {
+	base := strings.ToLower(strings.TrimSuffix(filename, filepath.Ext(filename)))
+	words := strings.FieldsFunc(base, func(r rune) bool { return !unicode.IsLetter(r) })
+	for _, k := range imageKindWords {
+		for _, w := range words {
+			if slices.Contains(k.words, w) {
+				return k.kind
+			}
+		}
+	}
+	return db.AlbumImageOther
+}
+
+// albumImages classifies the image filenames of an album folder, numbering those of the same kind in filename order
+func albumImages(filenames []string) []*db.AlbumImage {
+	filenames = slices.Clone(filenames)
+	slices.SortFunc(filenames, func(a, b string) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(a), strings.ToLower(b)), cmp.Compare(a, b))
+	})
+
+	positions := map[db.AlbumImageKind]int{}
+	images := make([]*db.AlbumImage, 0, len(filenames))
+	for _, f := range filenames {
+		kind := imageKind(f)
+		images = append(images, &db.AlbumImage{Filename: f, Kind: kind, Position: positions[kind]})
+		positions[kind]++
+	}
+	slices.SortStableFunc(images, func(a, b *db.AlbumImage) int {
+		return cmp.Compare(slices.Index(imageKindOrder, a.Kind), slices.Index(imageKindOrder, b.Kind))
+	})
+	return images
+}
+
+// populateAlbumImages stores the images found in the album's folder, leaving the rows alone if nothing changed
+// so their ids stay stable for clients
+func populateAlbumImages(tx *db.DB, album *db.Album, filenames []string) error {
+	images := albumImages(filenames)
+
+	var existing []*db.AlbumImage
+	if err := tx.Where("album_id=?", album.ID).Order("id").Find(&existing).Error; err != nil {
+		return fmt.Errorf("find album images: %w", err)
+	}
+	if slices.EqualFunc(images, existing, func(a, b *db.AlbumImage) bool {
+		return a.Filename == b.Filename && a.Kind == b.Kind && a.Position == b.Position
+	}) {
+		return nil
+	}
+
+	if err := tx.Where("album_id=?", album.ID).Delete(db.AlbumImage{}).Error; err != nil {
+		return fmt.Errorf("delete old album images: %w", err)
+	}
+	rows := make([][]any, 0, len(images))
+	for _, im := range images {
+		rows = append(rows, []any{im.Filename, string(im.Kind), im.Position})
+	}
+	if err := tx.InsertBulkLeftManyRows("album_images", []string{"album_id", "filename", "kind", "position"}, album.ID, rows); err != nil {
+		return fmt.Errorf("insert album images: %w", err)
+	}
+	return nil
+}
+
+// populateArtistImages points artists at the folder above their albums when it has an image of its own, like
+// "Artist/artist.jpg" next to "Artist/Album/". the folder must hold no tracks or discs, and only albums by that one
+// album artist, so a compilation folder or a multi disc release's folder isn't taken for an artist's
+func (s *Scanner) populateArtistImages() error {
+	return s.db.Exec(`
+		UPDATE artists SET image_folder_id=(
+			SELECT parent.id
+			FROM albums parent
+			JOIN albums child ON child.parent_id=parent.id AND child.disc_of_id IS NULL
+			JOIN album_credits ac ON ac.album_id=child.id AND ac.role=? AND ac.artist_id=artists.id
+			WHERE parent.cover != ''
+				AND NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.album_id=parent.id)
+				AND NOT EXISTS (SELECT 1 FROM albums disc WHERE disc.parent_id=parent.id AND disc.disc_of_id IS NOT NULL)
+				AND NOT EXISTS (
+					SELECT 1 FROM albums other
+					JOIN album_credits oac ON oac.album_id=other.id AND oac.role=? AND oac.artist_id!=artists.id
+					WHERE other.parent_id=parent.id
+				)
+			ORDER BY parent.id
+			LIMIT 1
+		)
+	`, db.RoleAlbumArtist, db.RoleAlbumArtist).Error
+}
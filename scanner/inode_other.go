@@ -0,0 +1,10 @@
+//go:build !unix
+
+package scanner
+
+import "io/fs"
+
+// fileInode is always 0 where there's no inode, so moves are never followed
+func fileInode(fs.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package scanner
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileInode is the inode of the file, which stays the same when it's renamed or moved within a filesystem
+func fileInode(info fs.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino) //nolint:unconvert // not uint64 everywhere
+	}
+	return 0
+}
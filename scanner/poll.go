@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/fileutil"
+)
+
+// ExecutePoll is an alternative to ExecuteWatch for network filesystems, where there are no events to watch. every
+// interval it compares each folder's own mod time and size with the ones stored when it was last scanned, then scans
+// and cleans only the folders that changed, appeared, or are gone. those change when files are added, removed, or
+// renamed, which is how most taggers save, but not when a file is rewritten in place
+func (s *Scanner) ExecutePoll(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+		if s.IsScanning() {
+			continue
+		}
+
+		start := time.Now()
+		paths, err := s.changedDirs()
+		if err != nil {
+			log.Printf("error polling: %v", err)
+			continue
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		log.Printf("found %d changed folders in %s", len(paths), durSince(start))
+
+		if _, err := s.ScanAndClean(ScanOptions{Paths: paths}); err != nil && !errors.Is(err, ErrAlreadyScanning) {
+			log.Printf("error scanning: %v", err)
+		}
+	}
+}
+
+func (s *Scanner) changedDirs() ([]string, error) {
+	var albums []*db.Album
+	if err := s.db.Select("root_dir, left_path, right_path, dir_mod_time, dir_size").Find(&albums).Error; err != nil {
+		return nil, fmt.Errorf("find albums: %w", err)
+	}
+	known := make(map[string]*db.Album, len(albums))
+	for _, album := range albums {
+		absPath := album.AbsPath()
+		if musicDir, _ := musicDirRelative(s.musicDirs, absPath); musicDir == "" || musicDir == absPath {
+			continue
+		}
+		known[absPath] = album
+	}
+
+	var changed []string
+	seen := map[string]struct{}{}
+
+	var walk fs.WalkDirFunc
+	walk = func(absPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch d.Type() {
+		case os.ModeDir:
+		case os.ModeSymlink:
+			return symWalk(absPath, walk)
+		default:
+			return nil
+		}
+		if s.excludePattern != nil && s.excludePattern.MatchString(absPath) {
+			return fs.SkipDir
+		}
+		if slices.Contains(s.musicDirs, absPath) {
+			return nil
+		}
+
+		seen[absPath] = struct{}{}
+
+		dirInfo, err := os.Stat(absPath)
+		if err != nil {
+			return err
+		}
+		if album, ok := known[absPath]; !ok || !album.DirModTime.Equal(dirInfo.ModTime()) || album.DirSize != dirInfo.Size() {
+			changed = append(changed, absPath)
+			return fs.SkipDir // the scan will walk everything under it anyway
+		}
+		return nil
+	}
+	for _, dir := range s.musicDirs {
+		if err := filepath.WalkDir(dir, walk); err != nil {
+			return nil, fmt.Errorf("walk %q: %w", dir, err)
+		}
+	}
+
+	for absPath := range known {
+		if _, ok := seen[absPath]; !ok && !slices.ContainsFunc(changed, func(c string) bool { return fileutil.HasPrefix(absPath, c) }) {
+			changed = append(changed, absPath) // gone
+		}
+	}
+	return changed, nil
+}
+
+// saveDirStat stores the folder's mod time and size for the poller to compare with
+func saveDirStat(tx *db.DB, album *db.Album, dirInfo fs.FileInfo) error {
+	err := tx.Model(album).UpdateColumns(map[string]any{"dir_mod_time": dirInfo.ModTime(), "dir_size": dirInfo.Size()}).Error
+	if err != nil {
+		return fmt.Errorf("update dir stat: %w", err)
+	}
+	return nil
+}
@@ -6,14 +6,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"image"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -24,6 +28,8 @@ import (
 
 	"go.senan.xyz/gonic/db"
 	"go.senan.xyz/gonic/fileutil"
+	"go.senan.xyz/gonic/genrenorm"
+	"go.senan.xyz/gonic/ratingtags"
 	"go.senan.xyz/gonic/tags"
 	"go.senan.xyz/wrtag/coverparse"
 	"go.senan.xyz/wrtag/tags/normtag"
@@ -32,6 +38,7 @@ import (
 var (
 	ErrAlreadyScanning = errors.New("already scanning")
 	ErrReadingTags     = errors.New("could not read tags")
+	ErrNotInMusicPath  = errors.New("path is not inside a music path")
 )
 
 type Scanner struct {
@@ -41,15 +48,33 @@ type Scanner struct {
 	tagReader          tags.Reader
 	excludePattern     *regexp.Regexp
 	scanEmbeddedCover  bool
-	genreTree          map[string][]string
+	genreNorm          *genrenorm.Normaliser  // maps genre names to canonical ones if set
+	ratingTags         *ratingtags.RatingTags // imports ratings from tags if set
 	scanning           *int32
+
+	// tags are read by a pool of workers goroutines, and up to workers dirs can be read ahead of the one being
+	// written to the db
+	workers int
+
+	progressMu    sync.Mutex
+	progress      *Progress
+	progressState *State // the state of the full scan which owns progress
+
+	genreTreeMu sync.RWMutex
+	genreTree   map[string][]string
 }
 
-func New(musicDirs []string, db *db.DB, multiValueSettings map[*tags.Spec]tags.MultiValueSetting, tagReader tags.Reader, excludePattern string, scanEmbeddedCover bool, genreTree map[string][]string) *Scanner {
+// New creates a Scanner. workers is how many files to read tags from concurrently, or 0 for the number of CPUs. if
+// genreNorm isn't nil, genre names are normalised before they're stored. if ratingTags isn't nil, ratings in tags are
+// imported as tracks are scanned
+func New(musicDirs []string, db *db.DB, multiValueSettings map[*tags.Spec]tags.MultiValueSetting, tagReader tags.Reader, excludePattern string, scanEmbeddedCover bool, genreTree map[string][]string, genreNorm *genrenorm.Normaliser, workers int, ratingTags *ratingtags.RatingTags) *Scanner {
 	var excludePatternRegExp *regexp.Regexp
 	if excludePattern != "" {
 		excludePatternRegExp = regexp.MustCompile(excludePattern)
 	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
 
 	return &Scanner{
 		db:                 db,
@@ -59,16 +84,38 @@ func New(musicDirs []string, db *db.DB, multiValueSettings map[*tags.Spec]tags.M
 		excludePattern:     excludePatternRegExp,
 		scanEmbeddedCover:  scanEmbeddedCover,
 		genreTree:          genreTree,
+		genreNorm:          genreNorm,
+		ratingTags:         ratingTags,
 		scanning:           new(int32),
+		workers:            workers,
 	}
 }
 
+// GenreTree returns the genre hierarchy from texttree.ParseReader, each genre mapped to itself and its descendants
+func (s *Scanner) GenreTree() map[string][]string {
+	s.genreTreeMu.RLock()
+	defer s.genreTreeMu.RUnlock()
+	return s.genreTree
+}
+
+// SetGenreTree replaces the genre hierarchy. tracks only get their inherited genres from the new tree once they're
+// scanned again, so a full scan is needed to apply it to the whole library
+func (s *Scanner) SetGenreTree(tree map[string][]string) {
+	s.genreTreeMu.Lock()
+	defer s.genreTreeMu.Unlock()
+	s.genreTree = tree
+}
+
 func (s *Scanner) IsScanning() bool    { return atomic.LoadInt32(s.scanning) == 1 }
 func (s *Scanner) StartScanning() bool { return atomic.CompareAndSwapInt32(s.scanning, 0, 1) }
 func (s *Scanner) StopScanning()       { atomic.StoreInt32(s.scanning, 0) }
 
 type ScanOptions struct {
 	IsFull bool
+
+	// Paths limits the scan to these folders, or the folders of these files. only tracks and folders under them are
+	// cleaned if they're gone. empty means all music paths
+	Paths []string
 }
 
 func (s *Scanner) ScanAndClean(opts ScanOptions) (*State, error) {
@@ -77,20 +124,70 @@ func (s *Scanner) ScanAndClean(opts ScanOptions) (*State, error) {
 	}
 	defer s.StopScanning()
 
+	scopes, err := s.scanScopes(opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
-	st := &State{
-		seenTracks: map[int]struct{}{},
-		seenAlbums: map[int]struct{}{},
-		isFull:     opts.IsFull,
+	st := newState(opts.IsFull)
+	st.scopes = scopes
+
+	var readers sync.WaitGroup
+	for range s.workers {
+		readers.Go(func() {
+			for j := range st.reads {
+				s.readTags(j.ds, j.i)
+			}
+		})
 	}
+	defer readers.Wait()
+	defer close(st.reads)
 
-	log.Println("starting scan")
+	// the previous scan's folder count is the best guess we have for how many we'll see this time
+	var dirsTotal int
+	if err := albumsInScope(s.db.Model(db.Album{}), st.scopes).Count(&dirsTotal).Error; err != nil {
+		return nil, fmt.Errorf("count albums: %w", err)
+	}
+	s.progressMu.Lock()
+	s.progress = &Progress{Scanning: true, Started: start, DirsTotal: dirsTotal}
+	s.progressState = st
+	s.progressMu.Unlock()
+
+	if len(st.scopes) > 0 {
+		log.Printf("starting scan of %q", opts.Paths)
+	} else {
+		log.Println("starting scan")
+	}
 	defer func() {
 		log.Printf("finished scan in %s, +%d/%d tracks (%d err)\n",
 			durSince(start), st.SeenTracksNew(), st.SeenTracks(), len(st.errs))
 	}()
+	defer s.updateProgress(st, func(p *Progress) {
+		p.Scanning = false
+		p.CurrentPath = ""
+		p.Finished = time.Now()
+	})
 
-	for _, dir := range s.musicDirs {
+	if st.isFull && len(st.scopes) == 0 {
+		// every track is read again, so raw genre names which don't appear any more can go
+		if err := s.db.Exec("DELETE FROM genre_raw_names").Error; err != nil {
+			return nil, fmt.Errorf("delete genre raw names: %w", err)
+		}
+	}
+
+	walkDirs := s.musicDirs
+	if len(st.scopes) > 0 {
+		walkDirs = nil
+		for _, sc := range st.scopes {
+			absPath := filepath.Join(sc.musicDir, sc.relPath)
+			if _, err := os.Stat(absPath); errors.Is(err, os.ErrNotExist) {
+				continue // gone, so there's only cleaning to do
+			}
+			walkDirs = append(walkDirs, absPath)
+		}
+	}
+	for _, dir := range walkDirs {
 		err := filepath.WalkDir(dir, func(absPath string, d fs.DirEntry, err error) error {
 			return s.scanCallback(st, absPath, d, err)
 		})
@@ -98,28 +195,49 @@ func (s *Scanner) ScanAndClean(opts ScanOptions) (*State, error) {
 			return nil, fmt.Errorf("walk: %w", err)
 		}
 	}
+	s.writePending(st, 0)
 
 	if err := s.cleanTracks(st); err != nil {
 		return nil, fmt.Errorf("clean tracks: %w", err)
 	}
+	s.updateProgress(st, nil)
 	if err := s.cleanAlbums(st); err != nil {
 		return nil, fmt.Errorf("clean albums: %w", err)
 	}
 	if err := s.cleanAlbumMetadata(); err != nil {
 		return nil, fmt.Errorf("clean album metadata: %w", err)
 	}
+	if err := s.mergeDiscs(); err != nil {
+		return nil, fmt.Errorf("merge discs: %w", err)
+	}
 	if err := s.cleanArtists(st); err != nil {
 		return nil, fmt.Errorf("clean artists: %w", err)
 	}
+	if err := s.populateArtistImages(); err != nil {
+		return nil, fmt.Errorf("populate artist images: %w", err)
+	}
 	if err := s.cleanGenres(st); err != nil {
 		return nil, fmt.Errorf("clean genres: %w", err)
 	}
+	if err := s.cleanWorks(); err != nil {
+		return nil, fmt.Errorf("clean works: %w", err)
+	}
 	if err := s.cleanBookmarks(st); err != nil {
 		return nil, fmt.Errorf("clean bookmarks: %w", err)
 	}
 
-	if err := s.db.SetSetting(db.LastScanTime, strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
-		return nil, fmt.Errorf("set scan time: %w", err)
+	if err := s.saveProblems(st); err != nil {
+		return nil, fmt.Errorf("save problems: %w", err)
+	}
+
+	scanTime := strconv.FormatInt(time.Now().Unix(), 10)
+	if len(st.scopes) == 0 {
+		if err := s.db.SetSetting(db.LastScanTime, scanTime); err != nil {
+			return nil, fmt.Errorf("set scan time: %w", err)
+		}
+	}
+	if err := s.db.SetSetting(db.LastAnyScanTime, scanTime); err != nil {
+		return nil, fmt.Errorf("set any scan time: %w", err)
 	}
 
 	return st, errors.Join(st.errs...)
@@ -146,62 +264,55 @@ func (s *Scanner) ExecuteWatch(ctx context.Context) error {
 		}
 	}
 
+	// folders that had something created, changed, removed, or moved in or out of them. they're scanned and cleaned
+	// together in one scoped scan, so that a move shows up as both ends at once and the rows can be moved too
 	batchSeen := map[string]struct{}{}
-	batchClean := false
+	addSeen := func(absPath string) {
+		if musicDir, _ := musicDirRelative(s.musicDirs, absPath); musicDir != "" {
+			batchSeen[absPath] = struct{}{}
+		}
+	}
 	for {
 		select {
 		case <-batchT.C:
-			if batchClean {
-				if _, err := s.ScanAndClean(ScanOptions{}); err != nil {
-					log.Printf("error scanning: %v", err)
-				}
-				clear(batchSeen)
-				batchClean = false
-				break
-			}
-			if !s.StartScanning() {
-				break
-			}
+			var paths []string
 			for absPath := range batchSeen {
-				st := &State{
-					seenTracks: map[int]struct{}{},
-					seenAlbums: map[int]struct{}{},
+				if _, err := os.Stat(absPath); err == nil {
+					err := filepath.WalkDir(absPath, func(absPath string, d fs.DirEntry, err error) error {
+						return watchCallback(watcher, absPath, d, err)
+					})
+					if err != nil {
+						log.Printf("error watching directory tree: %v\n", err)
+					}
 				}
-				err := filepath.WalkDir(absPath, func(absPath string, d fs.DirEntry, err error) error {
-					return watchCallback(watcher, absPath, d, err)
-				})
-				if err != nil {
-					log.Printf("error watching directory tree: %v\n", err)
-					continue
-				}
-				err = filepath.WalkDir(absPath, func(absPath string, d fs.DirEntry, err error) error {
-					return s.scanCallback(st, absPath, d, err)
-				})
-				if err != nil {
-					log.Printf("error walking: %v", err)
-					continue
+				paths = append(paths, absPath)
+			}
+			if _, err := s.ScanAndClean(ScanOptions{Paths: paths}); err != nil {
+				if errors.Is(err, ErrAlreadyScanning) {
+					batchT.Reset(batchInterval) // try again after
+					break
 				}
+				log.Printf("error scanning: %v", err)
 			}
-			s.StopScanning()
 			clear(batchSeen)
 
 		case event := <-watcher.Events:
-			if event.Op&(fsnotify.Remove) == fsnotify.Remove {
-				batchClean = true
-				batchT.Reset(batchInterval)
-				break
-			}
-			if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
-				break
-			}
-			fileInfo, err := os.Stat(event.Name)
-			if err != nil {
-				break
-			}
-			if fileInfo.IsDir() {
-				batchSeen[event.Name] = struct{}{}
-			} else {
-				batchSeen[filepath.Dir(event.Name)] = struct{}{}
+			switch {
+			case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				// gone from here, the other end of a move comes as a create
+				addSeen(filepath.Dir(event.Name))
+			case event.Op&(fsnotify.Create|fsnotify.Write) != 0:
+				fileInfo, err := os.Stat(event.Name)
+				if err != nil {
+					break
+				}
+				if fileInfo.IsDir() {
+					addSeen(event.Name)
+				} else {
+					addSeen(filepath.Dir(event.Name))
+				}
+			default:
+				continue
 			}
 			batchT.Reset(batchInterval)
 
@@ -238,6 +349,7 @@ func watchCallback(watcher *fsnotify.Watcher, absPath string, d fs.DirEntry, err
 func (s *Scanner) scanCallback(st *State, absPath string, d fs.DirEntry, err error) error {
 	if err != nil {
 		st.errs = append(st.errs, err)
+		s.addProblem(st, db.ScanProblemError, db.ScanProblemFolder, absPath, "", err.Error())
 		return nil
 	}
 
@@ -258,8 +370,13 @@ func (s *Scanner) scanCallback(st *State, absPath string, d fs.DirEntry, err err
 
 	log.Printf("processing folder %q", absPath)
 
+	st.dirsVisited++
+	_, relPath := musicDirRelative(s.musicDirs, absPath)
+	s.updateProgress(st, func(p *Progress) { p.CurrentPath = relPath })
+
 	if err := s.scanDir(st, absPath); err != nil {
 		st.errs = append(st.errs, fmt.Errorf("%q: %w", absPath, err))
+		s.addProblem(st, db.ScanProblemError, db.ScanProblemFolder, absPath, "", err.Error())
 		return nil
 	}
 
@@ -276,9 +393,14 @@ func (s *Scanner) scanDir(st *State, absPath string) error {
 	if err != nil {
 		return err
 	}
+	dirInfo, err := os.Stat(absPath)
+	if err != nil {
+		return err
+	}
 
 	var trackPaths []string
 	var cover string
+	var images []string
 	for _, item := range items {
 		absPath := filepath.Join(absPath, item.Name())
 		if s.excludePattern != nil && s.excludePattern.MatchString(absPath) {
@@ -296,6 +418,7 @@ func (s *Scanner) scanDir(st *State, absPath string) error {
 
 		if coverparse.IsCover(item.Name()) {
 			cover = coverparse.BestBetween(cover, item.Name())
+			images = append(images, item.Name())
 			continue
 		}
 		if s.tagReader.CanRead(absPath) {
@@ -312,15 +435,33 @@ func (s *Scanner) scanDir(st *State, absPath string) error {
 
 	st.seenAlbums[parent.ID] = struct{}{}
 
+	if cover != "" {
+		if err := checkCover(filepath.Join(absPath, cover)); err != nil {
+			s.addProblem(st, db.ScanProblemWarning, db.ScanProblemCover, absPath, cover, err.Error())
+		}
+	}
+
 	dir, basename := filepath.Split(relPath)
 	var album db.Album
-	if err := populateAlbumBasics(s.db, musicDir, &parent, &album, dir, basename, cover); err != nil {
+	if err := s.findMovedAlbum(st, &album, musicDir, dir, basename, fileInode(dirInfo)); err != nil {
+		return fmt.Errorf("find moved album: %w", err)
+	}
+	if err := populateAlbumBasics(s.db, musicDir, &parent, &album, dir, basename, cover, fileInode(dirInfo)); err != nil {
 		return fmt.Errorf("populate album basics: %w", err)
 	}
+	if err := populateAlbumImages(s.db, &album, images); err != nil {
+		return fmt.Errorf("populate album images: %w", err)
+	}
 
 	st.seenAlbums[album.ID] = struct{}{}
 
+	// the folder's stat is only saved once its tracks are, so a folder that fails is polled again
+	dirChanged := !album.DirModTime.Equal(dirInfo.ModTime()) || album.DirSize != dirInfo.Size()
+
 	if len(trackPaths) == 0 {
+		if dirChanged {
+			return saveDirStat(s.db, &album, dirInfo)
+		}
 		return nil
 	}
 
@@ -335,13 +476,6 @@ func (s *Scanner) scanDir(st *State, absPath string) error {
 		st.seenTracks[t.ID] = struct{}{}
 	}
 
-	type trackUpdate struct {
-		i        int
-		basename string
-		absPath  string
-		track    *db.Track
-		timeSpec times.Timespec
-	}
 	trackUpdates := make([]trackUpdate, 0, len(trackPaths))
 
 	sort.Strings(trackPaths)
@@ -357,7 +491,20 @@ func (s *Scanner) scanDir(st *State, absPath string) error {
 		// might be nil if new track
 		track := trackMap[basename]
 
-		if st.isFull || track == nil || timeSpec.ModTime().After(track.UpdatedAt) {
+		var moved bool
+		if track == nil {
+			if track, err = s.findMovedTrack(st, absPath); err != nil {
+				return fmt.Errorf("find moved track %q: %w", basename, err)
+			}
+			moved = track != nil
+		} else if track.Inode == 0 {
+			// from before inodes were stored. fill it in without reading the tags again so that it can be followed later
+			if err := s.fillTrackInode(track, absPath); err != nil {
+				return fmt.Errorf("fill inode %q: %w", basename, err)
+			}
+		}
+
+		if st.isFull || track == nil || moved || timeSpec.ModTime().After(track.UpdatedAt) {
 			trackUpdates = append(trackUpdates, trackUpdate{
 				i:        i,
 				basename: basename,
@@ -369,28 +516,116 @@ func (s *Scanner) scanDir(st *State, absPath string) error {
 	}
 
 	if len(trackUpdates) == 0 {
+		if dirChanged {
+			return saveDirStat(s.db, &album, dirInfo)
+		}
 		return nil
 	}
 
-	// read tags outside the transaction to avoid holding db locks during disk i/o
-	type trackTagData struct {
-		trackUpdate
-		trprops tags.Properties
-		trags   tags.Tags
+	// read tags outside the transaction to avoid holding db locks during disk i/o. the reads happen in the
+	// background so that the walk can carry on preparing the next dirs, while the db is only ever written from
+	// here, in walk order. that keeps ids and results the same as a serial scan
+	ds := &dirScan{
+		absPath: absPath,
+		album:   album,
+		dirInfo: dirInfo,
+		tagData: make([]trackTagData, len(trackUpdates)),
+		done:    make(chan struct{}),
 	}
-	tagData := make([]trackTagData, 0, len(trackUpdates))
-	for _, t := range trackUpdates {
-		trprops, trags, err := s.tagReader.Read(t.absPath)
-		if err != nil {
-			return fmt.Errorf("read %q: %w: %w", t.basename, err, ErrReadingTags)
+	for i, t := range trackUpdates {
+		ds.tagData[i].trackUpdate = t
+	}
+	ds.remaining.Store(int32(len(trackUpdates)))
+	for i := range trackUpdates {
+		st.reads <- readJob{ds: ds, i: i}
+	}
+
+	st.pending = append(st.pending, ds)
+	s.writePending(st, s.workers)
+	return nil
+}
+
+type trackUpdate struct {
+	i        int
+	basename string
+	absPath  string
+	track    *db.Track
+	timeSpec times.Timespec
+}
+
+type trackTagData struct {
+	trackUpdate
+	trprops     tags.Properties
+	trags       tags.Tags
+	contentHash string
+	err         error
+}
+
+// dirScan is a dir whose tags are being read, waiting its turn to be written
+type dirScan struct {
+	absPath   string
+	album     db.Album
+	dirInfo   fs.FileInfo
+	tagData   []trackTagData
+	remaining atomic.Int32 // reads left before done is closed
+	done      chan struct{}
+}
+
+// readJob is a file in a dirScan for the read workers to read tags from
+type readJob struct {
+	ds *dirScan
+	i  int
+}
+
+// readTags reads the tags of a dirScan's file i, and closes its done if it was the last to be read
+func (s *Scanner) readTags(ds *dirScan, i int) {
+	t := &ds.tagData[i]
+	t.trprops, t.trags, t.err = s.tagReader.Read(t.absPath)
+	if t.err == nil {
+		var err error
+		if t.contentHash, err = contentHash(t.absPath); err != nil {
+			// only costs us following the track if it's moved
+			log.Printf("error hashing %q: %v", t.absPath, err)
 		}
-		tagData = append(tagData, trackTagData{trackUpdate: t, trprops: trprops, trags: trags})
 	}
+	if ds.remaining.Add(-1) == 0 {
+		close(ds.done)
+	}
+}
 
-	return s.db.Transaction(func(tx *db.DB) error {
+// writePending writes read dirs to the db in the order they were walked, until there are at most keep left
+func (s *Scanner) writePending(st *State, keep int) {
+	for len(st.pending) > keep {
+		ds := st.pending[0]
+		st.pending = st.pending[1:]
+
+		<-ds.done
+		for _, t := range ds.tagData {
+			st.tracksRead[t.absPath] = struct{}{}
+		}
+		if err := s.writeDir(st, ds); err != nil {
+			st.errs = append(st.errs, fmt.Errorf("%q: %w", ds.absPath, err))
+		}
+		s.updateProgress(st, nil)
+	}
+}
+
+func (s *Scanner) writeDir(st *State, ds *dirScan) error {
+	var readErr error
+	for _, t := range ds.tagData {
+		if t.err != nil {
+			s.addProblem(st, db.ScanProblemError, db.ScanProblemReadTags, ds.absPath, t.basename, t.err.Error())
+			readErr = cmp.Or(readErr, fmt.Errorf("read %q: %w: %w", t.basename, t.err, ErrReadingTags))
+		}
+	}
+	if readErr != nil {
+		return readErr
+	}
+
+	err := s.db.Transaction(func(tx *db.DB) error {
 		var discTitles = map[int]string{}
-		for _, t := range tagData {
-			if err := s.populateTrackAndArtists(tx, st, t.i, &album, t.track, t.timeSpec, t.trprops, t.trags, t.basename, t.absPath); err != nil {
+		for _, t := range ds.tagData {
+			if err := s.populateTrackAndArtists(tx, st, t.i, &ds.album, t.track, t.timeSpec, t.trprops, t.trags, t.contentHash, t.basename, t.absPath); err != nil {
 				return fmt.Errorf("populate track %q: %w", t.basename, err)
 			}
 
@@ -402,29 +637,41 @@ func (s *Scanner) scanDir(st *State, absPath string) error {
 			}
 		}
 
-		if err := populateAlbumDiscTitles(tx, &album, discTitles); err != nil {
+		if err := populateAlbumDiscTitles(tx, &ds.album, discTitles); err != nil {
 			return fmt.Errorf("populate disc titles: %w", err)
 		}
-		return nil
+		return saveDirStat(tx, &ds.album, ds.dirInfo)
 	})
+	if err != nil {
+		s.addProblem(st, db.ScanProblemError, db.ScanProblemFolder, ds.absPath, "", err.Error())
+		return err
+	}
+	return nil
 }
 
 //nolint:gocyclo
-func (s *Scanner) populateTrackAndArtists(tx *db.DB, st *State, i int, album *db.Album, track *db.Track, timeSpec times.Timespec, trprops tags.Properties, trags tags.Tags, basename, absPath string) error {
-	genreNames := tags.ReadValues(trags, tags.Genre, s.multiValueSettings)
+func (s *Scanner) populateTrackAndArtists(tx *db.DB, st *State, i int, album *db.Album, track *db.Track, timeSpec times.Timespec, trprops tags.Properties, trags tags.Tags, contentHash, basename, absPath string) error {
+	rawGenreNames := tags.ReadValues(trags, tags.Genre, s.multiValueSettings)
+	genreNames, rawGenres, err := s.normaliseGenres(tx, st, rawGenreNames)
+	if err != nil {
+		return fmt.Errorf("normalise genres: %w", err)
+	}
 	genreIDs, err := populateGenres(tx, genreNames)
 	if err != nil {
 		return fmt.Errorf("populate genres: %w", err)
 	}
+	if err := populateGenreRawNames(tx, rawGenres); err != nil {
+		return fmt.Errorf("populate genre raw names: %w", err)
+	}
 
 	var inheritedGenreIDs []int
-	if len(s.genreTree) > 0 {
+	if genreTree := s.GenreTree(); len(genreTree) > 0 {
 		direct := map[string]struct{}{}
 		for _, name := range genreNames {
 			direct[name] = struct{}{}
 		}
 		var inheritedNames []string
-		for parent, descendants := range s.genreTree {
+		for parent, descendants := range genreTree {
 			if _, ok := direct[parent]; ok {
 				continue
 			}
@@ -473,7 +720,7 @@ func (s *Scanner) populateTrackAndArtists(tx *db.DB, st *State, i int, album *db
 
 		var albumArtists []artistRef
 		for _, e := range albumArtistEntries {
-			artist, err := populateArtist(tx, e.Value, cmp.Or(e.MusicBrainzID, artistMusicBrainzID[e.Value]))
+			artist, err := populateArtist(tx, e.Value, cmp.Or(e.MusicBrainzID, artistMusicBrainzID[e.Value]), e.Sort)
 			if err != nil {
 				return fmt.Errorf("populate album artist: %w", err)
 			}
@@ -503,27 +750,65 @@ func (s *Scanner) populateTrackAndArtists(tx *db.DB, st *State, i int, album *db
 
 	if track == nil {
 		track = &db.Track{}
+	} else {
+		st.seenTracksUpdated++
+	}
+
+	absDir := filepath.Dir(absPath)
+	if normtag.Get(trags, normtag.Artists) == "" && normtag.Get(trags, normtag.Artist) == "" {
+		s.addProblem(st, db.ScanProblemWarning, db.ScanProblemMissingTags, absDir, basename, fmt.Sprintf("no artist tag, using %q", tags.Artist.Fallback))
+	}
+	if normtag.Get(trags, normtag.Album) == "" {
+		s.addProblem(st, db.ScanProblemWarning, db.ScanProblemMissingTags, absDir, basename, fmt.Sprintf("no album tag, using %q", tags.AlbumTitle.Fallback))
+	}
+	if trprops.Length == 0 {
+		s.addProblem(st, db.ScanProblemWarning, db.ScanProblemZeroLength, absDir, basename, "track has no length")
 	}
 
-	if err := populateTrack(tx, s.scanEmbeddedCover, album, track, trprops, trags, basename, int(stat.Size()), createTime); err != nil {
+	track.WorkID = nil
+	if works := tags.ReadCredits(trags, tags.Work, nil); len(works) > 0 {
+		var composer string
+		if composers := tags.ReadCredits(trags, tags.Composer, nil); len(composers) > 0 {
+			composer = composers[0].Value
+		}
+		work, err := populateWork(tx, works[0].Value, composer, works[0].MusicBrainzID)
+		if err != nil {
+			return fmt.Errorf("populate work: %w", err)
+		}
+		track.WorkID = &work.ID
+	}
+
+	track.Identity = trackIdentity(trags, trprops.Length, contentHash)
+	if err := populateTrack(tx, s.scanEmbeddedCover, album, track, trprops, trags, basename, int(stat.Size()), fileInode(stat), createTime); err != nil {
 		return fmt.Errorf("process %q: %w", basename, err)
 	}
 	if err := populateTrackGenres(tx, track, genreIDs, inheritedGenreIDs); err != nil {
 		return fmt.Errorf("populate track genres: %w", err)
 	}
 
+	if s.ratingTags != nil {
+		if err := s.ratingTags.Import(tx, track.ID, trags); err != nil {
+			return fmt.Errorf("import rating tags: %w", err)
+		}
+	}
+
 	isrcs := tags.ReadValues(trags, tags.ISRC, s.multiValueSettings)
 	if err := populateTrackISRCs(tx, track, isrcs); err != nil {
 		return fmt.Errorf("populate track ISRCs: %w", err)
 	}
 
+	moods := tags.ReadValues(trags, tags.Mood, s.multiValueSettings)
+	if err := populateTrackMoods(tx, track, moods); err != nil {
+		return fmt.Errorf("populate track moods: %w", err)
+	}
+
 	if err := tx.Where("track_id=?", track.ID).Delete(db.TrackCredit{}).Error; err != nil {
 		return fmt.Errorf("delete track credits: %w", err)
 	}
 
 	var trackArtists []artistRef
 	for _, e := range trackArtistEntries {
-		artist, err := populateArtist(tx, e.Value, cmp.Or(e.MusicBrainzID, artistMusicBrainzID[e.Value]))
+		artist, err := populateArtist(tx, e.Value, cmp.Or(e.MusicBrainzID, artistMusicBrainzID[e.Value]), e.Sort)
 		if err != nil {
 			return fmt.Errorf("populate track artist: %w", err)
 		}
@@ -536,7 +821,7 @@ func (s *Scanner) populateTrackAndArtists(tx *db.DB, st *State, i int, album *db
 	var contributorRows [][]any
 	for ci, r := range trackContributorRoles {
 		for _, e := range contributorEntries[ci] {
-			artist, err := populateArtist(tx, e.Value, cmp.Or(e.MusicBrainzID, artistMusicBrainzID[e.Value]))
+			artist, err := populateArtist(tx, e.Value, cmp.Or(e.MusicBrainzID, artistMusicBrainzID[e.Value]), e.Sort)
 			if err != nil {
 				return fmt.Errorf("populate contributor artist: %w", err)
 			}
@@ -586,6 +871,7 @@ func populateAlbumEmbeddedCover(tx *db.DB, scanEmbeddedCover bool, album *db.Alb
 func populateAlbum(tx *db.DB, album *db.Album, trags map[string][]string, modTime, createTime time.Time) error {
 	album.TagTitle, _ = tags.Read(trags, tags.AlbumTitle)
 	album.TagTitleUDec = decoded(album.TagTitle)
+	album.TagTitleSort, _ = tags.Read(trags, tags.AlbumSort)
 	album.TagAlbumArtist, album.TagAlbumArtistCredit = tags.Read(trags, tags.AlbumArtist)
 	album.TagBrainzID = normtag.Get(trags, normtag.MusicBrainzReleaseID)
 	album.TagYear = 0
@@ -607,13 +893,17 @@ func populateAlbum(tx *db.DB, album *db.Album, trags map[string][]string, modTim
 	return nil
 }
 
-func populateAlbumBasics(tx *db.DB, musicDir string, parent, album *db.Album, dir, basename string, cover string) error {
-	if err := tx.Where("root_dir=? AND left_path=? AND right_path=?", musicDir, dir, basename).First(album).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("find album: %w", err)
+// populateAlbumBasics finds or creates the album at the path, or moves the album already in album there
+func populateAlbumBasics(tx *db.DB, musicDir string, parent, album *db.Album, dir, basename string, cover string, inode uint64) error {
+	if album.ID == 0 {
+		if err := tx.Where("root_dir=? AND left_path=? AND right_path=?", musicDir, dir, basename).First(album).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("find album: %w", err)
+		}
 	}
 
 	// see if we can save ourselves from an extra write if it's found and nothing has changed
-	if album.ID != 0 && album.Cover == cover && album.ParentID == parent.ID {
+	if album.ID != 0 && album.RootDir == musicDir && album.LeftPath == dir && album.RightPath == basename &&
+		album.Cover == cover && album.ParentID == parent.ID && album.Inode == inode {
 		return nil
 	}
 
@@ -621,6 +911,7 @@ func populateAlbumBasics(tx *db.DB, musicDir string, parent, album *db.Album, di
 	album.LeftPath = dir
 	album.RightPath = basename
 	album.Cover = cover
+	album.Inode = inode
 	album.RightPathUDec = decoded(basename)
 	album.ParentID = parent.ID
 
@@ -631,10 +922,11 @@ func populateAlbumBasics(tx *db.DB, musicDir string, parent, album *db.Album, di
 	return nil
 }
 
-func populateTrack(tx *db.DB, scanEmbeddedCover bool, album *db.Album, track *db.Track, trprops tags.Properties, trags map[string][]string, basename string, size int, createTime time.Time) error {
+func populateTrack(tx *db.DB, scanEmbeddedCover bool, album *db.Album, track *db.Track, trprops tags.Properties, trags map[string][]string, basename string, size int, inode uint64, createTime time.Time) error {
 	track.Filename = basename
 	track.FilenameUDec = decoded(basename)
 	track.Size = size
+	track.Inode = inode
 	track.AlbumID = album.ID
 	track.TagLyrics = normtag.Get(trags, normtag.Lyrics)
 
@@ -644,6 +936,7 @@ func populateTrack(tx *db.DB, scanEmbeddedCover bool, album *db.Album, track *db
 
 	track.TagTitle, _ = tags.Read(trags, tags.TrackTitle)
 	track.TagTitleUDec = decoded(track.TagTitle)
+	track.TagTitleSort, _ = tags.Read(trags, tags.TrackSort)
 	track.TagTrackArtist, track.TagTrackArtistCredit = tags.Read(trags, tags.Artist)
 	track.TagComposer, track.TagComposerCredit = tags.Read(trags, tags.Composer)
 	track.TagTrackNumber = tags.ParseInt(normtag.Get(trags, normtag.TrackNumber))
@@ -653,6 +946,15 @@ func populateTrack(tx *db.DB, scanEmbeddedCover bool, album *db.Album, track *db
 	if v, _ := tags.Read(trags, tags.Year); v != "" {
 		track.TagYear = tags.ParseDate(v).Year()
 	}
+	track.TagMovementName, _ = tags.Read(trags, tags.MovementName)
+	track.TagMovementNumber = tags.ParseInt(normtag.Get(trags, "MOVEMENTNUMBER"))
+	track.TagMovementCount = tags.ParseInt(normtag.Get(trags, "MOVEMENTCOUNT"))
+	if _, total, ok := strings.Cut(normtag.Get(trags, "MOVEMENTNUMBER"), "/"); ok && track.TagMovementCount == 0 {
+		track.TagMovementCount = tags.ParseInt(total) // like "2/4"
+	}
+	bpm, _ := tags.Read(trags, tags.BPM)
+	track.TagBPM = tags.ParseInt(bpm)
+	track.TagComment, _ = tags.Read(trags, tags.Comment)
 
 	track.ReplayGainTrackGain = tags.ParseDB(normtag.Get(trags, normtag.ReplayGainTrackGain))
 	track.ReplayGainTrackPeak = tags.ParseFloat(normtag.Get(trags, normtag.ReplayGainTrackPeak))
@@ -664,9 +966,13 @@ func populateTrack(tx *db.DB, scanEmbeddedCover bool, album *db.Album, track *db
 		track.HasEmbeddedCover = trprops.HasCover
 	}
 
-	// these two are calculated from the file instead of tags
+	// these are calculated from the file instead of tags
 	track.Length = int(trprops.Length.Seconds())
 	track.Bitrate = int(trprops.Bitrate)
+	track.SampleRate = int(trprops.SampleRate)
+	track.BitDepth = int(trprops.BitDepth)
+	track.Channels = int(trprops.Channels)
+	track.Codec = trprops.Codec
 
 	if err := tx.Save(track).Error; err != nil {
 		return fmt.Errorf("saving track: %w", err)
@@ -675,7 +981,96 @@ func populateTrack(tx *db.DB, scanEmbeddedCover bool, album *db.Album, track *db
 	return nil
 }
 
-func populateArtist(tx *db.DB, artistName, musicBrainzID string) (*db.Artist, error) {
+// findMovedAlbum loads an album into album if its folder was moved or renamed to this path, found by the folder's
+// inode. that way it keeps its id, and with it the stars, ratings, and tracks it had
+func (s *Scanner) findMovedAlbum(st *State, album *db.Album, musicDir, dir, basename string, inode uint64) error {
+	if inode == 0 {
+		return nil
+	}
+	var count int
+	if err := s.db.Model(db.Album{}).Where("root_dir=? AND left_path=? AND right_path=?", musicDir, dir, basename).Count(&count).Error; err != nil {
+		return fmt.Errorf("count albums at path: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var candidates []*db.Album
+	if err := s.db.Where("inode=?", inode).Find(&candidates).Error; err != nil {
+		return fmt.Errorf("find albums by inode: %w", err)
+	}
+	for _, c := range candidates {
+		if _, ok := st.seenAlbums[c.ID]; ok {
+			continue
+		}
+		if _, err := os.Stat(c.AbsPath()); !errors.Is(err, os.ErrNotExist) {
+			continue // still there, so a different folder on another filesystem
+		}
+		log.Printf("found moved folder %q -> %q", c.AbsPath(), filepath.Join(musicDir, dir, basename))
+		*album = *c
+		return nil
+	}
+	return nil
+}
+
+// findMovedTrack returns the track whose file was moved or renamed to absPath, found by its inode and size, or nil.
+// the track is then updated in place, keeping plays, stars, ratings, bookmarks, and play queues pointing at it
+func (s *Scanner) findMovedTrack(st *State, absPath string) (*db.Track, error) {
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat: %w", err)
+	}
+	inode := fileInode(info)
+	if inode == 0 {
+		return nil, nil
+	}
+
+	var candidates []*db.Track
+	if err := s.db.Preload("Album").Where("inode=?", inode).Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("find tracks by inode: %w", err)
+	}
+	for _, c := range candidates {
+		if _, ok := st.seenTracks[c.ID]; ok || c.Size != int(info.Size()) {
+			continue
+		}
+		oldPath := filepath.Join(c.Album.AbsPath(), c.Filename)
+		if _, err := os.Stat(oldPath); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		st.seenTracks[c.ID] = struct{}{}
+		c.Album = nil // so it's not saved along with the track
+		return c, nil
+	}
+	return nil, nil
+}
+
+func (s *Scanner) fillTrackInode(track *db.Track, absPath string) error {
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+	if track.Inode = fileInode(info); track.Inode == 0 {
+		return nil
+	}
+	return s.db.Model(track).UpdateColumn("inode", track.Inode).Error
+}
+
+// populateArtist finds or creates the artist, updating its sort name if the tags have one
+func populateArtist(tx *db.DB, artistName, musicBrainzID, sortName string) (*db.Artist, error) {
+	artist, err := findOrCreateArtist(tx, artistName, musicBrainzID)
+	if err != nil {
+		return nil, err
+	}
+	if sortName != "" && sortName != artist.SortName {
+		artist.SortName = sortName
+		if err := tx.Model(artist).UpdateColumn("sort_name", sortName).Error; err != nil {
+			return nil, fmt.Errorf("update sort name: %w", err)
+		}
+	}
+	return artist, nil
+}
+
+func findOrCreateArtist(tx *db.DB, artistName, musicBrainzID string) (*db.Artist, error) {
 	nameUDec := decoded(artistName)
 
 	if musicBrainzID == "" {
@@ -712,6 +1107,31 @@ func populateArtist(tx *db.DB, artistName, musicBrainzID string) (*db.Artist, er
 		FirstOrCreate(&artist).Error
 }
 
+// populateWork finds or creates the work by its MBID, or by its name and composer if it has none
+func populateWork(tx *db.DB, name, composer, musicBrainzID string) (*db.Work, error) {
+	var work db.Work
+	if musicBrainzID != "" {
+		err := tx.
+			Where(db.Work{MusicBrainzID: musicBrainzID}).
+			First(&work).
+			Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if work.ID != 0 {
+			return &work, nil
+		}
+	}
+
+	// adopt the row with no MBID if one exists, else create
+	return &work, tx.
+		Where("name=? AND coalesce(composer, '')=? AND music_brainz_id=''", name, composer).
+		Attrs(db.Work{Name: name, NameUDec: decoded(name), Composer: composer}).
+		Assign(db.Work{MusicBrainzID: musicBrainzID}).
+		FirstOrCreate(&work).
+		Error
+}
+
 func populateGenres(tx *db.DB, names []string) ([]int, error) {
 	var filteredNames []string
 	for _, name := range names {
@@ -733,6 +1153,64 @@ func populateGenres(tx *db.DB, names []string) ([]int, error) {
 	return ids, nil
 }
 
+// normaliseGenres maps genre names from tags to their canonical names, and which of the raw names were changed
+func (s *Scanner) normaliseGenres(tx *db.DB, st *State, rawNames []string) ([]string, map[string][]string, error) {
+	if s.genreNorm == nil {
+		return rawNames, nil, nil
+	}
+	if s.genreNorm.Fold() && st.genreKeys == nil {
+		// the oldest spelling of a genre already in the db wins, so names stay the same from scan to scan
+		var existing []string
+		if err := tx.Model(db.Genre{}).Order("id").Pluck("name", &existing).Error; err != nil {
+			return nil, nil, fmt.Errorf("find existing genres: %w", err)
+		}
+		st.genreKeys = map[string]string{}
+		for _, name := range existing {
+			if _, ok := st.genreKeys[genrenorm.Key(name)]; !ok {
+				st.genreKeys[genrenorm.Key(name)] = name
+			}
+		}
+	}
+
+	var names []string
+	seen := map[string]struct{}{}
+	changed := map[string][]string{}
+	for _, raw := range rawNames {
+		raw = strings.TrimSpace(raw)
+		for _, name := range s.genreNorm.Names(raw) {
+			if s.genreNorm.Fold() {
+				if prev, ok := st.genreKeys[genrenorm.Key(name)]; ok {
+					name = prev
+				} else {
+					st.genreKeys[genrenorm.Key(name)] = name
+				}
+			}
+			if name != raw {
+				changed[raw] = append(changed[raw], name)
+			}
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	return names, changed, nil
+}
+
+// populateGenreRawNames records raw genre names from tags and the genres they were normalised to, for the admin
+// report. old mappings are only removed with their genre
+func populateGenreRawNames(tx *db.DB, rawGenres map[string][]string) error {
+	for raw, names := range rawGenres {
+		for _, name := range names {
+			if err := tx.Exec(`INSERT OR IGNORE INTO genre_raw_names (name, genre_id) SELECT ?, id FROM genres WHERE name=?`, raw, name).Error; err != nil {
+				return fmt.Errorf("insert genre raw name: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
 func populateTrackGenres(tx *db.DB, track *db.Track, directIDs, inheritedIDs []int) error {
 	if err := tx.Where("track_id=?", track.ID).Delete(db.TrackGenre{}).Error; err != nil {
 		return fmt.Errorf("delete old track genre records: %w", err)
@@ -762,6 +1240,24 @@ func populateTrackISRCs(tx *db.DB, track *db.Track, isrcs []string) error {
 	return nil
 }
 
+func populateTrackMoods(tx *db.DB, track *db.Track, moods []string) error {
+	if err := tx.Where("track_id=?", track.ID).Delete(db.TrackMood{}).Error; err != nil {
+		return fmt.Errorf("delete old track moods: %w", err)
+	}
+
+	var col [][]any
+	for _, mood := range moods {
+		if mood == "" {
+			continue
+		}
+		col = append(col, []any{mood})
+	}
+	if err := tx.InsertBulkLeftManyRows("track_moods", []string{"track_id", "mood"}, track.ID, col); err != nil {
+		return fmt.Errorf("insert bulk track moods: %w", err)
+	}
+	return nil
+}
+
 func populateAlbumLabels(tx *db.DB, album *db.Album, labels []string) error {
 	if err := tx.Where("album_id=?", album.ID).Delete(db.AlbumLabel{}).Error; err != nil {
 		return fmt.Errorf("delete old album labels: %w", err)
@@ -877,11 +1373,17 @@ var trackContributorRoles = []struct {
 
 func (s *Scanner) cleanTracks(st *State) error {
 	start := time.Now()
-	defer func() { log.Printf("finished clean tracks in %s, %d removed", durSince(start), st.TracksMissing()) }()
+	defer func() {
+		log.Printf("finished clean tracks in %s, %d removed, %d relinked", durSince(start), st.TracksMissing(), st.TracksRelinked())
+	}()
+
+	q := s.db.Model(&db.Track{})
+	if len(st.scopes) > 0 {
+		q = q.Where("album_id IN ?", albumsInScope(s.db.Model(db.Album{}).Select("albums.id"), st.scopes).SubQuery())
+	}
 
 	var all []int
-	err := s.db.
-		Model(&db.Track{}).
+	err := q.
 		Pluck("id", &all).
 		Error
 	if err != nil {
@@ -892,6 +1394,9 @@ func (s *Scanner) cleanTracks(st *State) error {
 			st.tracksMissing = append(st.tracksMissing, int64(a))
 		}
 	}
+	if err := s.relinkTracks(st); err != nil {
+		return fmt.Errorf("relink tracks: %w", err)
+	}
 	return s.db.TransactionChunked(st.tracksMissing, func(tx *db.DB, chunk []int64) error {
 		return tx.Where(chunk).Delete(&db.Track{}).Error
 	})
@@ -902,8 +1407,7 @@ func (s *Scanner) cleanAlbums(st *State) error {
 	defer func() { log.Printf("finished clean albums in %s, %d removed", durSince(start), st.AlbumsMissing()) }()
 
 	var all []int
-	err := s.db.
-		Model(&db.Album{}).
+	err := albumsInScope(s.db.Model(&db.Album{}), st.scopes).
 		Pluck("id", &all).
 		Error
 	if err != nil {
@@ -1041,6 +1545,19 @@ func (s *Scanner) cleanGenres(st *State) error {
 	return nil
 }
 
+func (s *Scanner) cleanWorks() error {
+	start := time.Now()
+	var numRemoved int64
+	defer func() { log.Printf("finished clean works in %s, %d removed", durSince(start), numRemoved) }()
+
+	q := s.db.Exec(`DELETE FROM works WHERE id NOT IN (SELECT work_id FROM tracks WHERE work_id IS NOT NULL)`)
+	if err := q.Error; err != nil {
+		return err
+	}
+	numRemoved = q.RowsAffected
+	return nil
+}
+
 func (s *Scanner) cleanBookmarks(st *State) error {
 	start := time.Now()
 	defer func() {
@@ -1095,28 +1612,282 @@ func durSince(t time.Time) time.Duration {
 type State struct {
 	errs   []error
 	isFull bool
+	scopes []scanScope
+
+	seenTracks        map[int]struct{}
+	seenAlbums        map[int]struct{}
+	seenTracksNew     int // includes updated
+	seenTracksUpdated int
+	dirsVisited       int
+
+	pending        []*dirScan
+	reads          chan readJob // files for the read workers
+	progressLogged time.Time
 
-	seenTracks    map[int]struct{}
-	seenAlbums    map[int]struct{}
-	seenTracksNew int
+	problems   []*db.ScanProblem
+	tracksRead map[string]struct{} // abs paths, to know which old track problems to replace
 
 	tracksMissing    []int64
+	tracksRelinked   int
 	albumsMissing    []int64
 	artistsMissing   int
 	genresMissing    int
 	bookmarksRemoved int
+
+	genreKeys map[string]string // genrenorm keys to genre names, when folding genre names
 }
 
-func (s *State) SeenTracks() int    { return len(s.seenTracks) }
-func (s *State) SeenAlbums() int    { return len(s.seenAlbums) }
-func (s *State) SeenTracksNew() int { return s.seenTracksNew }
+func newState(isFull bool) *State {
+	return &State{
+		seenTracks:     map[int]struct{}{},
+		seenAlbums:     map[int]struct{}{},
+		tracksRead:     map[string]struct{}{},
+		reads:          make(chan readJob),
+		isFull:         isFull,
+		progressLogged: time.Now(),
+	}
+}
+
+func (s *State) SeenTracks() int        { return len(s.seenTracks) }
+func (s *State) SeenAlbums() int        { return len(s.seenAlbums) }
+func (s *State) SeenTracksNew() int     { return s.seenTracksNew }
+func (s *State) SeenTracksUpdated() int { return s.seenTracksUpdated }
+
+func (s *State) Problems() []*db.ScanProblem { return s.problems }
 
 func (s *State) TracksMissing() int    { return len(s.tracksMissing) }
+func (s *State) TracksRelinked() int   { return s.tracksRelinked }
 func (s *State) AlbumsMissing() int    { return len(s.albumsMissing) }
 func (s *State) ArtistsMissing() int   { return s.artistsMissing }
 func (s *State) GenresMissing() int    { return s.genresMissing }
 func (s *State) BookmarksRemoved() int { return s.bookmarksRemoved }
 
+// Progress is a snapshot of how far along a scan is
+type Progress struct {
+	Scanning bool
+	Started  time.Time
+	Finished time.Time
+
+	DirsVisited int
+	DirsTotal   int // an estimate, from the folder count before the scan. grows if we see more than that
+
+	TracksNew     int
+	TracksUpdated int
+	TracksRemoved int
+	Errors        int
+
+	CurrentPath string // relative to its music dir
+}
+
+func (p Progress) Elapsed() time.Duration {
+	if !p.Finished.IsZero() {
+		return p.Finished.Sub(p.Started)
+	}
+	return time.Since(p.Started)
+}
+
+// Percent is how many of the expected folders have been visited, 0-100
+func (p Progress) Percent() int {
+	if !p.Scanning {
+		return 100
+	}
+	if p.DirsTotal == 0 {
+		return 0
+	}
+	return min(100, p.DirsVisited*100/p.DirsTotal)
+}
+
+// ETA is a guess at the time left, assuming the remaining folders take as long as the visited ones. zero if
+// unknown or finished
+func (p Progress) ETA() time.Duration {
+	if !p.Scanning || p.DirsVisited == 0 || p.DirsTotal <= p.DirsVisited {
+		return 0
+	}
+	perDir := p.Elapsed() / time.Duration(p.DirsVisited)
+	return perDir * time.Duration(p.DirsTotal-p.DirsVisited)
+}
+
+func (p Progress) String() string {
+	return fmt.Sprintf("%d%% (%d/%d folders), +%d new, %d updated, %d removed, %d err, %s elapsed, eta %s",
+		p.Percent(), p.DirsVisited, p.DirsTotal, p.TracksNew, p.TracksUpdated, p.TracksRemoved, p.Errors,
+		p.Elapsed().Truncate(time.Second), p.ETA().Truncate(time.Second))
+}
+
+// Progress returns the progress of the running scan, or the last one if none is running. ok is false if there
+// hasn't been a scan since startup
+func (s *Scanner) Progress() (Progress, bool) {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	if s.progress == nil {
+		return Progress{}, false
+	}
+	return *s.progress, true
+}
+
+// how often to log progress during a scan
+const progressLogInterval = 10 * time.Second
+
+// updateProgress copies counts from the scan state into the shared progress, then applies f if any
+func (s *Scanner) updateProgress(st *State, f func(p *Progress)) {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	p := s.progress
+	if p == nil || st != s.progressState {
+		return
+	}
+	p.DirsVisited = st.dirsVisited
+	p.DirsTotal = max(p.DirsTotal, st.dirsVisited)
+	p.TracksNew = st.seenTracksNew - st.seenTracksUpdated
+	p.TracksUpdated = st.seenTracksUpdated
+	p.TracksRemoved = len(st.tracksMissing)
+	p.Errors = len(st.errs)
+	if f != nil {
+		f(p)
+	}
+	if p.Scanning && time.Since(st.progressLogged) > progressLogInterval {
+		log.Printf("scan progress: %s", p)
+		st.progressLogged = time.Now()
+	}
+}
+
+func (s *Scanner) addProblem(st *State, level db.ScanProblemLevel, kind db.ScanProblemKind, absDir, filename string, msg string) {
+	musicDir, relDir := musicDirRelative(s.musicDirs, absDir)
+	st.problems = append(st.problems, &db.ScanProblem{
+		Level:    level,
+		Kind:     kind,
+		RootDir:  musicDir,
+		Dir:      relDir,
+		Filename: filename,
+		Message:  msg,
+	})
+}
+
+// saveProblems replaces the problems from older scans with what this one found. folder problems are found on
+// every walk so all are replaced, but track problems are only replaced if we read the track again or it's gone
+func (s *Scanner) saveProblems(st *State) error {
+	return s.db.Transaction(func(tx *db.DB) error {
+		var prev []*db.ScanProblem
+		if err := tx.Find(&prev).Error; err != nil {
+			return fmt.Errorf("find previous: %w", err)
+		}
+		var staleIDs []int
+		for _, p := range prev {
+			if p.Kind.PerFolder() && st.inScope(p.RootDir, p.Dir) {
+				staleIDs = append(staleIDs, p.ID)
+				continue
+			}
+			if _, ok := st.tracksRead[p.AbsPath()]; ok {
+				staleIDs = append(staleIDs, p.ID)
+				continue
+			}
+			if _, err := os.Stat(p.AbsPath()); err != nil {
+				staleIDs = append(staleIDs, p.ID)
+				continue
+			}
+		}
+		for chunk := range slices.Chunk(staleIDs, 500) {
+			if err := tx.Where("id IN (?)", chunk).Delete(db.ScanProblem{}).Error; err != nil {
+				return fmt.Errorf("delete stale: %w", err)
+			}
+		}
+		for _, p := range st.problems {
+			if err := tx.Create(p).Error; err != nil {
+				return fmt.Errorf("create: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// checkCover makes sure a cover file can be opened and looks like an image we can decode. formats which
+// aren't registered aren't counted, we can't say either way
+func checkCover(absPath string) error {
+	f, err := os.Open(absPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return errors.New("empty file")
+	}
+	if _, _, err := image.DecodeConfig(f); err != nil && !errors.Is(err, image.ErrFormat) {
+		return fmt.Errorf("decode: %w", err)
+	}
+	return nil
+}
+
+// scanScope is a folder a scan is limited to
+type scanScope struct {
+	musicDir string
+	relPath  string // "." for the whole music dir
+}
+
+// CheckPaths returns an error if any of the paths couldn't be used for ScanOptions.Paths
+func (s *Scanner) CheckPaths(paths []string) error {
+	_, err := s.scanScopes(paths)
+	return err
+}
+
+func (s *Scanner) scanScopes(paths []string) ([]scanScope, error) {
+	var scopes []scanScope
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		info, err := os.Stat(path)
+		if (err == nil && !info.IsDir()) || (err != nil && s.tagReader.CanRead(path)) {
+			path = filepath.Dir(path) // a track, even a deleted one, means its folder
+		}
+		musicDir, relPath := musicDirRelative(s.musicDirs, path)
+		if musicDir == "" {
+			return nil, fmt.Errorf("%q: %w", path, ErrNotInMusicPath)
+		}
+		if sc := (scanScope{musicDir: musicDir, relPath: relPath}); !slices.Contains(scopes, sc) {
+			scopes = append(scopes, sc)
+		}
+	}
+	// a folder inside another scope, or given twice, would only be walked twice
+	scopes = slices.DeleteFunc(slices.Clone(scopes), func(sc scanScope) bool {
+		return slices.ContainsFunc(scopes, func(o scanScope) bool {
+			return o != sc && o.musicDir == sc.musicDir && (o.relPath == "." || fileutil.HasPrefix(sc.relPath, o.relPath))
+		})
+	})
+	return scopes, nil
+}
+
+// albumsInScope limits an albums query to the folders under the scopes, or doesn't if there are none
+func albumsInScope(q *gorm.DB, scopes []scanScope) *gorm.DB {
+	if len(scopes) == 0 {
+		return q
+	}
+	var conds []string
+	var args []any
+	for _, sc := range scopes {
+		if sc.relPath == "." {
+			conds = append(conds, "albums.root_dir=?")
+			args = append(args, sc.musicDir)
+			continue
+		}
+		conds = append(conds, "(albums.root_dir=? AND (albums.left_path || albums.right_path=? OR instr(albums.left_path, ?)=1))")
+		args = append(args, sc.musicDir, sc.relPath, sc.relPath+string(filepath.Separator))
+	}
+	return q.Where(strings.Join(conds, " OR "), args...)
+}
+
+func (s *State) inScope(musicDir, relPath string) bool {
+	if len(s.scopes) == 0 {
+		return true
+	}
+	for _, sc := range s.scopes {
+		if sc.musicDir == musicDir && (sc.relPath == "." || fileutil.HasPrefix(relPath, sc.relPath)) {
+			return true
+		}
+	}
+	return false
+}
+
 func musicDirRelative(musicDirs []string, absPath string) (musicDir, relPath string) {
 	for _, musicDir := range musicDirs {
 		if fileutil.HasPrefix(absPath, musicDir) {
@@ -2,11 +2,14 @@
 package scanner_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,8 +20,10 @@ import (
 	_ "go.senan.xyz/gonic/deps"
 
 	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/genrenorm"
 	"go.senan.xyz/gonic/mockfs"
 	"go.senan.xyz/gonic/scanner"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/specid"
 	"go.senan.xyz/gonic/tags"
 	"go.senan.xyz/wrtag/tags/normtag"
 )
@@ -895,6 +900,455 @@ func TestTagErrors(t *testing.T) {
 	assert.Equal(t, 0, st.SeenTracksNew())                // we have no new tracks
 }
 
+func TestScanProgress(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	_, ok := m.Scanner().Progress()
+	assert.False(t, ok) // no scan yet
+
+	m.AddItems()
+	m.ScanAndClean()
+
+	progress, ok := m.Scanner().Progress()
+	require.True(t, ok)
+	assert.False(t, progress.Scanning)
+	assert.Equal(t, 100, progress.Percent())
+	assert.Equal(t, time.Duration(0), progress.ETA())
+	assert.Equal(t, m.NumTracks(), progress.TracksNew)
+	assert.Equal(t, 0, progress.TracksUpdated)
+	assert.Equal(t, 0, progress.TracksRemoved)
+	assert.Equal(t, 0, progress.Errors)
+	assert.Empty(t, progress.CurrentPath)
+	assert.False(t, progress.Finished.IsZero())
+	dirsVisited := progress.DirsVisited
+
+	m.SetTrack("artist-0/album-0/track-0.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Title, "updated")
+	})
+	m.RemoveAll("artist-1/album-0")
+	m.ScanAndClean()
+
+	progress, ok = m.Scanner().Progress()
+	require.True(t, ok)
+	assert.Equal(t, 0, progress.TracksNew)
+	assert.Equal(t, 1, progress.TracksUpdated)
+	assert.Equal(t, 3, progress.TracksRemoved)
+	assert.Equal(t, dirsVisited-1, progress.DirsVisited)
+	assert.Equal(t, dirsVisited, progress.DirsTotal) // estimated from the last scan's folders
+}
+
+func TestScanProblems(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.SetTrack("artist-0/album-0/track-0.flac", func(tags *mockfs.TagInfo) {
+		tags.Error = scanner.ErrReadingTags
+	})
+	m.SetTrack("artist-1/album-0/track-0.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Artist, "")
+	})
+	m.SetTrack("artist-1/album-1/track-0.flac", func(tags *mockfs.TagInfo) {
+		tags.Length = 0
+	})
+	m.AddCover("artist-2/album-0/cover.jpg") // empty
+
+	_, err := m.ScanAndCleanErr()
+	require.ErrorIs(t, err, scanner.ErrReadingTags)
+
+	type problem struct {
+		level db.ScanProblemLevel
+		kind  db.ScanProblemKind
+		path  string
+	}
+	problems := func() []problem {
+		var rows []*db.ScanProblem
+		require.NoError(t, m.DB().Order("dir, filename, kind").Find(&rows).Error)
+		var r []problem
+		for _, p := range rows {
+			r = append(r, problem{p.Level, p.Kind, filepath.Join(p.Dir, p.Filename)})
+		}
+		return r
+	}
+
+	assert.Equal(t, []problem{
+		{db.ScanProblemError, db.ScanProblemReadTags, "artist-0/album-0/track-0.flac"},
+		{db.ScanProblemWarning, db.ScanProblemMissingTags, "artist-1/album-0/track-0.flac"},
+		{db.ScanProblemWarning, db.ScanProblemZeroLength, "artist-1/album-1/track-0.flac"},
+		{db.ScanProblemWarning, db.ScanProblemCover, "artist-2/album-0/cover.jpg"},
+	}, problems())
+
+	// fixed and removed files lose their problems, untouched ones keep them even though they weren't read again
+	m.SetTrack("artist-0/album-0/track-0.flac", func(tags *mockfs.TagInfo) {
+		tags.Error = nil
+	})
+	m.RemoveAll("artist-1/album-1")
+	m.RemoveAll("artist-2/album-0/cover.jpg")
+	m.ScanAndClean()
+
+	assert.Equal(t, []problem{
+		{db.ScanProblemWarning, db.ScanProblemMissingTags, "artist-1/album-0/track-0.flac"},
+	}, problems())
+}
+
+func TestScanPaths(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.ScanAndClean()
+
+	trackTitle := func(path string) string {
+		var track db.Track
+		err := m.DB().
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Where("albums.left_path || albums.right_path=? AND tracks.filename=?", filepath.Dir(path), filepath.Base(path)).
+			First(&track).
+			Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ""
+		}
+		require.NoError(t, err)
+		return track.TagTitle
+	}
+	scanPaths := func(paths ...string) *scanner.State {
+		for i := range paths {
+			paths[i] = filepath.Join(m.TmpDir(), paths[i])
+		}
+		st, err := m.Scanner().ScanAndClean(scanner.ScanOptions{Paths: paths})
+		require.NoError(t, err)
+		return st
+	}
+
+	m.SetTrack("artist-0/album-0/track-0.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Title, "updated")
+	})
+	m.SetTrack("artist-0/album-0/track-3.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Title, "new")
+	})
+	m.SetTrack("artist-0/album-1/track-0.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Title, "updated out of scope")
+	})
+	m.RemoveAll("artist-1/album-0")
+	m.RemoveAll("artist-2/album-0/track-1.flac")
+
+	scanPaths("artist-0/album-0")
+	assert.Equal(t, "updated", trackTitle("artist-0/album-0/track-0.flac"))
+	assert.Equal(t, "new", trackTitle("artist-0/album-0/track-3.flac"))
+	assert.Equal(t, "title-0", trackTitle("artist-0/album-1/track-0.flac")) // not scanned
+	assert.Equal(t, "title-0", trackTitle("artist-1/album-0/track-0.flac")) // not cleaned
+	assert.Equal(t, "title-1", trackTitle("artist-2/album-0/track-1.flac")) // not cleaned
+
+	// scanning a gone folder or track cleans them up
+	scanPaths("artist-1/album-0", "artist-2/album-0/track-1.flac")
+	assert.Equal(t, "", trackTitle("artist-1/album-0/track-0.flac"))
+	assert.Equal(t, "", trackTitle("artist-2/album-0/track-1.flac"))
+	assert.Equal(t, "title-0", trackTitle("artist-2/album-0/track-0.flac"))
+
+	var albums int
+	require.NoError(t, m.DB().Model(db.Album{}).Where("left_path=? AND right_path=?", "artist-1/", "album-0").Count(&albums).Error)
+	assert.Equal(t, 0, albums)
+
+	// the same folder given twice, or by one of its tracks, is only scanned once
+	m.SetTrack("artist-0/album-0/track-4.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Title, "new twice")
+	})
+	st := scanPaths("artist-0/album-0", "artist-0/album-0/", "artist-0/album-0/track-4.flac")
+	assert.Equal(t, 1, st.SeenTracksNew())
+	assert.Equal(t, "new twice", trackTitle("artist-0/album-0/track-4.flac"))
+
+	_, err := m.Scanner().ScanAndClean(scanner.ScanOptions{Paths: []string{t.TempDir()}})
+	assert.ErrorIs(t, err, scanner.ErrNotInMusicPath)
+}
+
+func TestScanMoves(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.ScanAndClean()
+
+	find := func(path string) (albumID, trackID int) {
+		var track db.Track
+		err := m.DB().
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Where("albums.left_path || albums.right_path=? AND tracks.filename=?", filepath.Dir(path), filepath.Base(path)).
+			First(&track).
+			Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, 0
+		}
+		require.NoError(t, err)
+		return track.AlbumID, track.ID
+	}
+	// scan both ends of the moves, like the watcher would
+	scanPaths := func(paths ...string) *scanner.State {
+		for i := range paths {
+			paths[i] = filepath.Join(m.TmpDir(), paths[i])
+		}
+		st, err := m.Scanner().ScanAndClean(scanner.ScanOptions{Paths: paths})
+		require.NoError(t, err)
+		return st
+	}
+
+	albumID, trackID := find("artist-0/album-0/track-0.flac")
+	require.NoError(t, m.DB().Create(&db.AlbumStar{UserID: 1, AlbumID: albumID, StarDate: time.Now()}).Error)
+	require.NoError(t, m.DB().Create(&db.TrackPlay{UserID: 1, TrackID: trackID, Time: time.Now(), Count: 3}).Error)
+
+	// a folder moved to another artist
+	m.Move("artist-0/album-0", "artist-1/album-moved")
+	scanPaths("artist-0", "artist-1/album-moved")
+
+	movedAlbumID, movedTrackID := find("artist-1/album-moved/track-0.flac")
+	assert.Equal(t, albumID, movedAlbumID)
+	assert.Equal(t, trackID, movedTrackID)
+	oldAlbumID, _ := find("artist-0/album-0/track-0.flac")
+	assert.Zero(t, oldAlbumID)
+
+	var stars, plays int
+	require.NoError(t, m.DB().Model(db.AlbumStar{}).Where("album_id=?", albumID).Count(&stars).Error)
+	require.NoError(t, m.DB().Model(db.TrackPlay{}).Where("track_id=?", trackID).Count(&plays).Error)
+	assert.Equal(t, 1, stars)
+	assert.Equal(t, 1, plays)
+
+	var parent db.Album
+	require.NoError(t, m.DB().Where("left_path=? AND right_path=?", "", "artist-1").First(&parent).Error)
+	var album db.Album
+	require.NoError(t, m.DB().First(&album, albumID).Error)
+	assert.Equal(t, parent.ID, album.ParentID)
+
+	// a track moved to another folder
+	_, trackID = find("artist-2/album-0/track-1.flac")
+	m.Move("artist-2/album-0/track-1.flac", "artist-2/album-1/track-moved.flac")
+	scanPaths("artist-2/album-0", "artist-2/album-1")
+
+	_, movedTrackID = find("artist-2/album-1/track-moved.flac")
+	assert.Equal(t, trackID, movedTrackID)
+	_, oldTrackID := find("artist-2/album-0/track-1.flac")
+	assert.Zero(t, oldTrackID)
+
+	var tracks int
+	require.NoError(t, m.DB().Model(db.Track{}).Count(&tracks).Error)
+	assert.Equal(t, m.NumTracks(), tracks)
+
+	// a full scan still finds the moves
+	m.Move("artist-1/album-moved", "artist-2/album-moved-again")
+	m.ScanAndClean()
+
+	movedAlbumID, _ = find("artist-2/album-moved-again/track-0.flac")
+	assert.Equal(t, albumID, movedAlbumID)
+}
+
+func TestRelinkMovedTracks(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.AddItems()
+
+	findID := func(path string) int {
+		var track db.Track
+		err := m.DB().
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Where("albums.left_path || albums.right_path=? AND tracks.filename=?", filepath.Dir(path), filepath.Base(path)).
+			First(&track).
+			Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0
+		}
+		require.NoError(t, err)
+		return track.ID
+	}
+	writeAudio := func(path string, tags, audio string) {
+		require.NoError(t, os.WriteFile(filepath.Join(m.TmpDir(), path), []byte(tags+strings.Repeat(audio, 10_000)), 0o600))
+	}
+
+	writeAudio("artist-0/album-0/track-0.flac", id3v2Tag(3), "some audio")
+	m.SetTrack("artist-0/album-0/track-1.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, "MUSICBRAINZ_RELEASETRACKID", "release-track-1")
+	})
+	m.ScanAndClean()
+
+	hashedID := findID("artist-0/album-0/track-0.flac")
+	brainzID := findID("artist-0/album-0/track-1.flac")
+	for _, id := range []int{hashedID, brainzID} {
+		require.NoError(t, m.DB().Create(&db.TrackStar{UserID: 1, TrackID: id, StarDate: time.Now()}).Error)
+		require.NoError(t, m.DB().Create(&db.TrackRating{UserID: 1, TrackID: id, Rating: 4}).Error)
+		require.NoError(t, m.DB().Create(&db.TrackPlay{UserID: 1, TrackID: id, Time: time.Now(), Count: 2}).Error)
+		require.NoError(t, m.DB().Create(&db.Bookmark{UserID: 1, EntryIDType: db.BookmarkEntryTrack, EntryID: id, Position: 10}).Error)
+	}
+	queue := db.PlayQueue{UserID: 1, Current: fmt.Sprintf("tr-%d", hashedID)}
+	queue.SetItems([]specid.ID{{Type: specid.Track, Value: hashedID}, {Type: specid.Track, Value: brainzID}})
+	require.NoError(t, m.DB().Create(&queue).Error)
+
+	// reorganised and retagged, with a bigger tag at the start. copied rather than moved, so there's no inode to follow
+	m.SetTrack("artist-0/album-new/01 track.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Title, "retagged")
+	})
+	writeAudio("artist-0/album-new/01 track.flac", id3v2Tag(40), "some audio")
+	m.SetTrack("artist-0/album-new/02 track.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, "MUSICBRAINZ_RELEASETRACKID", "release-track-1")
+	})
+	writeAudio("artist-0/album-new/02 track.flac", "", "different audio")
+	m.RemoveAll("artist-0/album-0/track-0.flac")
+	m.RemoveAll("artist-0/album-0/track-1.flac")
+
+	st := m.ScanAndClean()
+	assert.Equal(t, 2, st.TracksRelinked())
+	assert.Zero(t, findID("artist-0/album-0/track-0.flac"))
+
+	newHashedID := findID("artist-0/album-new/01 track.flac")
+	newBrainzID := findID("artist-0/album-new/02 track.flac")
+	for _, id := range []int{newHashedID, newBrainzID} {
+		var stars, ratings, bookmarks int
+		var play db.TrackPlay
+		require.NoError(t, m.DB().Model(db.TrackStar{}).Where("track_id=?", id).Count(&stars).Error)
+		require.NoError(t, m.DB().Model(db.TrackRating{}).Where("track_id=?", id).Count(&ratings).Error)
+		require.NoError(t, m.DB().Model(db.Bookmark{}).Where("entry_id=?", id).Count(&bookmarks).Error)
+		require.NoError(t, m.DB().Where("track_id=?", id).First(&play).Error)
+		assert.Equal(t, 1, stars)
+		assert.Equal(t, 1, ratings)
+		assert.Equal(t, 1, bookmarks)
+		assert.Equal(t, 2.0, play.Count)
+	}
+
+	require.NoError(t, m.DB().First(&queue, queue.ID).Error)
+	assert.Equal(t, []specid.ID{{Type: specid.Track, Value: newHashedID}, {Type: specid.Track, Value: newBrainzID}}, queue.GetItems())
+	assert.Equal(t, newHashedID, queue.CurrentSID().Value)
+}
+
+func TestRelinkMovedTrackBookmarks(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.AddItemsGlob("artist-0/album-0/track-0.flac")
+	writeAudio := func(path string, audio string, n int) {
+		require.NoError(t, os.WriteFile(filepath.Join(m.TmpDir(), path), []byte(id3v2Tag(3)+strings.Repeat(audio, n)), 0o600))
+	}
+	writeAudio("artist-0/album-0/track-0.flac", "some audio", 10_000)
+	m.ScanAndClean()
+
+	// a copy, and a longer track which ends the same way
+	m.SetTrack("artist-0/album-new/01 track.flac", func(*mockfs.TagInfo) {})
+	writeAudio("artist-0/album-new/01 track.flac", "some audio", 10_000)
+	m.SetTrack("artist-0/album-new/02 track.flac", func(*mockfs.TagInfo) {})
+	writeAudio("artist-0/album-new/02 track.flac", "some audio", 20_000)
+	m.ScanAndClean()
+
+	var tracks []*db.Track
+	require.NoError(t, m.DB().Order("id").Find(&tracks).Error)
+	require.Len(t, tracks, 3)
+	oldID, copyID, longerID := tracks[0].ID, tracks[1].ID, tracks[2].ID
+	assert.Equal(t, tracks[0].Identity, tracks[1].Identity)
+
+	// bookmarked on both, the one on the copy is newer
+	old := db.Bookmark{UserID: 1, EntryIDType: db.BookmarkEntryTrack, EntryID: oldID, Position: 10}
+	require.NoError(t, m.DB().Create(&old).Error)
+	require.NoError(t, m.DB().Model(&old).UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error)
+	require.NoError(t, m.DB().Create(&db.Bookmark{UserID: 1, EntryIDType: db.BookmarkEntryTrack, EntryID: copyID, Position: 20}).Error)
+
+	m.RemoveAll("artist-0/album-0/track-0.flac")
+	st := m.ScanAndClean()
+	assert.Equal(t, 1, st.TracksRelinked())
+
+	var bookmarks []*db.Bookmark
+	require.NoError(t, m.DB().Find(&bookmarks).Error)
+	require.Len(t, bookmarks, 1)
+	assert.Equal(t, copyID, bookmarks[0].EntryID)
+	assert.Equal(t, 20, bookmarks[0].Position)
+
+	var longer db.Track
+	require.NoError(t, m.DB().First(&longer, longerID).Error)
+	assert.NotEqual(t, tracks[1].Identity, longer.Identity)
+}
+
+// id3v2Tag is an empty ID3v2 tag with size bytes of padding
+func id3v2Tag(size int) string {
+	return "ID3\x04\x00\x00\x00\x00\x00" + string([]byte{byte(size)}) + strings.Repeat("\x00", size)
+}
+
+func TestPoll(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.ScanAndClean()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = m.Scanner().ExecutePoll(ctx, 10*time.Millisecond) }()
+
+	m.SetTrack("artist-0/album-0/track-9.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Title, "added")
+	})
+	m.RemoveAll("artist-1/album-0")
+
+	require.Eventually(t, func() bool {
+		var added, albums int
+		require.NoError(t, m.DB().Model(db.Track{}).Where("filename=? AND tag_title=?", "track-9.flac", "added").Count(&added).Error)
+		require.NoError(t, m.DB().Model(db.Album{}).Where("left_path=? AND right_path=?", "artist-1/", "album-0").Count(&albums).Error)
+		progress, _ := m.Scanner().Progress()
+		return added == 1 && albums == 0 && !progress.Scanning
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// only the changed folders and their parents were walked
+	progress, _ := m.Scanner().Progress()
+	assert.Less(t, progress.DirsVisited, 12)
+}
+
+func TestDryRun(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.ScanAndClean()
+
+	m.SetTrack("artist-0/album-0/track-0.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Title, "updated")
+	})
+	m.SetTrack("artist-0/album-3/track-0.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Artist, "artist-0")
+		normtag.Set(tags.Tags, normtag.AlbumArtist, "artist-0")
+		normtag.Set(tags.Tags, normtag.Album, "album-3")
+		normtag.Set(tags.Tags, normtag.Title, "new")
+	})
+	m.RemoveAll("artist-1/album-0")
+	for al := range 3 {
+		for tr := range 3 {
+			m.SetTrack(fmt.Sprintf("artist-2/album-%d/track-%d.flac", al, tr), func(tags *mockfs.TagInfo) {
+				normtag.Set(tags.Tags, normtag.Artist, "artist-1")
+				normtag.Set(tags.Tags, normtag.AlbumArtist, "artist-1")
+			})
+		}
+	}
+
+	report, err := m.Scanner().DryRun(scanner.ScanOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Count(scanner.ReportAlbum, scanner.ChangeAdded))
+	assert.Equal(t, 3, report.Count(scanner.ReportAlbum, scanner.ChangeUpdated)) // artist-2's albums
+	assert.Equal(t, 1, report.Count(scanner.ReportAlbum, scanner.ChangeRemoved))
+	assert.Equal(t, 1, report.Count(scanner.ReportTrack, scanner.ChangeAdded))
+	assert.Equal(t, 1+9, report.Count(scanner.ReportTrack, scanner.ChangeUpdated))
+	assert.Equal(t, 3, report.Count(scanner.ReportTrack, scanner.ChangeRemoved))
+	assert.Equal(t, 1, report.Count(scanner.ReportArtist, scanner.ChangeMerged))
+	assert.Equal(t, 0, report.Count(scanner.ReportArtist, scanner.ChangeRemoved))
+
+	var buff strings.Builder
+	_, err = report.WriteTo(&buff)
+	require.NoError(t, err)
+	assert.Contains(t, buff.String(), `merged artist "artist-2": into "artist-1"`)
+	assert.Contains(t, buff.String(), `updated track "artist-0/album-0/track-0.flac": title "title-0" -> "updated"`)
+	assert.Contains(t, buff.String(), `removed album "artist-1/album-0"`)
+
+	// nothing really changed
+	var track db.Track
+	require.NoError(t, m.DB().Where("filename=? AND tag_title=?", "track-0.flac", "title-0").First(&track).Error)
+	var artists int
+	require.NoError(t, m.DB().Model(db.Artist{}).Where("name=?", "artist-2").Count(&artists).Error)
+	assert.Equal(t, 1, artists)
+}
+
 // https://github.com/sentriz/gonic/issues/185#issuecomment-1050092128
 func TestCompilationAlbumWithoutAlbumArtist(t *testing.T) {
 	t.Parallel()
@@ -994,6 +1448,51 @@ func TestNoOrphanedGenres(t *testing.T) {
 	assert.Equal(t, 0, genreCount)
 }
 
+func TestGenreNormalise(t *testing.T) {
+	t.Parallel()
+	m := mockfs.NewWithGenreNormaliser(t, genrenorm.New(map[string]string{"rap": "Hip-Hop"}, true, "/"))
+
+	m.AddItems()
+	m.SetTrack("artist-0/album-0/track-0.flac", func(tags *mockfs.TagInfo) { normtag.Set(tags.Tags, normtag.Genre, "Hip-Hop") })
+	m.SetTrack("artist-0/album-0/track-1.flac", func(tags *mockfs.TagInfo) { normtag.Set(tags.Tags, normtag.Genre, "hip hop;hiphop") })
+	m.SetTrack("artist-0/album-1/track-0.flac", func(tags *mockfs.TagInfo) { normtag.Set(tags.Tags, normtag.Genre, "Rap/Jazz") })
+	m.ScanAndClean()
+
+	var genres []string
+	require.NoError(t, m.DB().Model(db.Genre{}).Order("name").Pluck("name", &genres).Error)
+	assert.Equal(t, []string{"Hip-Hop", "Jazz"}, genres)
+
+	var rawNames []string
+	require.NoError(t, m.DB().Model(db.GenreRawName{}).Order("name").Pluck("name", &rawNames).Error)
+	assert.Equal(t, []string{"Rap/Jazz", "Rap/Jazz", "hip hop", "hiphop"}, rawNames)
+}
+
+func TestSetGenreTree(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.SetTrack("artist-0/album-0/track-0.flac", func(tags *mockfs.TagInfo) { normtag.Set(tags.Tags, normtag.Genre, "techno") })
+	m.ScanAndClean()
+
+	inheritedCount := func() int {
+		var count int
+		assert.NoError(t, m.DB().
+			Model(&db.TrackGenre{}).
+			Joins("JOIN genres ON genres.id=track_genres.genre_id").
+			Where("genres.name=? AND track_genres.inherited", "electronic").
+			Count(&count).
+			Error)
+		return count
+	}
+	assert.Equal(t, 0, inheritedCount())
+
+	m.Scanner().SetGenreTree(map[string][]string{"electronic": {"electronic", "techno"}, "techno": {"techno"}})
+	_, err := m.Scanner().ScanAndClean(scanner.ScanOptions{IsFull: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, inheritedCount()) // full scan applies the new tree
+}
+
 // https://github.com/sentriz/gonic/issues/466
 func TestNoOrphanedGenresButOnlyDeleteTracks(t *testing.T) {
 	t.Parallel()
@@ -1164,6 +1663,47 @@ func TestMultiArtistPreload(t *testing.T) {
 	}
 }
 
+func TestReadWorkersWriteInWalkOrder(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	// more folders and tracks than workers, so that reads of later files finish first
+	for al := range 8 {
+		for tr := range 12 {
+			m.SetTrack(fmt.Sprintf("artist-0/album-%d/track-%02d.flac", al, tr), func(tags *mockfs.TagInfo) {
+				normtag.Set(tags.Tags, normtag.AlbumArtist, "artist-0")
+				normtag.Set(tags.Tags, normtag.Album, fmt.Sprintf("album-%d", al))
+				normtag.Set(tags.Tags, normtag.Title, fmt.Sprintf("title-%02d", tr))
+			})
+		}
+	}
+	m.SetTrack("artist-0/album-3/track-05.flac", func(tags *mockfs.TagInfo) {
+		tags.Error = scanner.ErrReadingTags
+	})
+
+	_, err := m.ScanAndCleanErr()
+	require.ErrorIs(t, err, scanner.ErrReadingTags)
+
+	var albums []*db.Album
+	require.NoError(t, m.DB().Where("right_path LIKE ?", "album-%").Order("id").Find(&albums).Error)
+	require.Len(t, albums, 8)
+	for i, album := range albums {
+		assert.Equal(t, fmt.Sprintf("album-%d", i), album.RightPath) // albums are written in walk order
+	}
+
+	var tracks []*db.Track
+	require.NoError(t, m.DB().Preload("Album").Order("id").Find(&tracks).Error)
+	require.Len(t, tracks, 7*12) // the folder with the read error isn't written
+	for i, track := range tracks {
+		al := i / 12
+		if al >= 3 {
+			al++
+		}
+		assert.Equal(t, fmt.Sprintf("album-%d", al), track.Album.RightPath)
+		assert.Equal(t, fmt.Sprintf("track-%02d.flac", i%12), track.Filename) // and tracks in filename order
+	}
+}
+
 // https://github.com/sentriz/gonic/issues/402
 func TestRootNoClobberOnError(t *testing.T) {
 	t.Parallel()
@@ -1248,3 +1788,272 @@ func TestCreatedAtMatchesFileTime(t *testing.T) {
 		require.True(t, album.CreatedAt.Before(beforeScan), "album.CreatedAt %v should predate scan start %v (it should be the file's birth/mod time, not the scan time)", album.CreatedAt, beforeScan)
 	})
 }
+
+func TestMergeDiscs(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	addDisc := func(disc, album string) {
+		for _, track := range []string{"track-1.flac", "track-2.flac"} {
+			m.SetTrack(filepath.Join("artist-a", "album-a", disc, track), func(tags *mockfs.TagInfo) {
+				normtag.Set(tags.Tags, normtag.AlbumArtist, "artist-a")
+				normtag.Set(tags.Tags, normtag.Album, album)
+				normtag.Set(tags.Tags, normtag.Title, track)
+			})
+		}
+	}
+	addDisc("CD1", "album-a")
+	addDisc("CD2 - Bonus", "album-a")
+	addDisc("Scans", "album-a")
+
+	m.ScanAndClean()
+
+	findAlbum := func(name string) *db.Album {
+		var album db.Album
+		require.NoError(t, m.DB().Where("right_path=?", name).Find(&album).Error)
+		return &album
+	}
+	discNumbers := func(album *db.Album) []int {
+		var discs []int
+		require.NoError(t, m.DB().Model(db.Track{}).Where("album_id=?", album.ID).Pluck("DISTINCT tag_disc_number", &discs).Error)
+		return discs
+	}
+
+	cd1, cd2, scans := findAlbum("CD1"), findAlbum("CD2 - Bonus"), findAlbum("Scans")
+	require.Nil(t, cd1.DiscOfID)
+	require.NotNil(t, cd2.DiscOfID)
+	require.Equal(t, cd1.ID, *cd2.DiscOfID)
+	require.Nil(t, scans.DiscOfID) // not a disc folder
+
+	// no disc number tags, so they come from the folders
+	require.Equal(t, []int{1}, discNumbers(cd1))
+	require.Equal(t, []int{2}, discNumbers(cd2))
+
+	var discTitles []*db.AlbumDiscTitle
+	require.NoError(t, m.DB().Where("album_id=?", cd2.ID).Find(&discTitles).Error)
+	require.Len(t, discTitles, 1)
+	require.Equal(t, 2, discTitles[0].DiscNumber)
+	require.Equal(t, "Bonus", discTitles[0].Title)
+
+	// a different release now, so it's its own album again
+	addDisc("CD2 - Bonus", "album-b")
+	m.ScanAndClean()
+
+	require.Nil(t, findAlbum("CD2 - Bonus").DiscOfID)
+}
+
+func TestAudioProperties(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.SetTrack("artist-a/album-a/track-1.flac", func(tags *mockfs.TagInfo) {
+		tags.SampleRate = 96000
+		tags.BitDepth = 24
+	})
+	m.SetTrack("artist-a/album-a/track-2.mp3", func(tags *mockfs.TagInfo) {
+		tags.BitDepth = 0
+		tags.Channels = 1
+		tags.Codec = "mp3"
+	})
+
+	m.ScanAndClean()
+
+	var tracks []*db.Track
+	require.NoError(t, m.DB().Order("filename").Find(&tracks).Error)
+	require.Len(t, tracks, 2)
+
+	assert.Equal(t, 96000, tracks[0].SampleRate)
+	assert.Equal(t, 24, tracks[0].BitDepth)
+	assert.Equal(t, 2, tracks[0].Channels)
+	assert.Equal(t, "flac", tracks[0].Codec)
+
+	assert.Equal(t, 44100, tracks[1].SampleRate)
+	assert.Equal(t, 0, tracks[1].BitDepth)
+	assert.Equal(t, 1, tracks[1].Channels)
+	assert.Equal(t, "mp3", tracks[1].Codec)
+}
+
+func TestSortNamesAndMoods(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.SetTrack("artist-a/album-a/track-1.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Artists, "The Artist", "Other Artist")
+		normtag.Set(tags.Tags, "ARTISTSORT", "Artist, The", "Artist, Other")
+		normtag.Set(tags.Tags, normtag.AlbumArtist, "The Artist")
+		normtag.Set(tags.Tags, normtag.Album, "The Album")
+		normtag.Set(tags.Tags, "ALBUMSORT", "Album, The")
+		normtag.Set(tags.Tags, "TITLESORT", "Title, The")
+		normtag.Set(tags.Tags, "BPM", "128.4")
+		normtag.Set(tags.Tags, "MOOD", "Happy", "Chill")
+		normtag.Set(tags.Tags, "COMMENT", "a comment")
+	})
+
+	m.ScanAndClean()
+
+	var artists []*db.Artist
+	require.NoError(t, m.DB().Order("name").Find(&artists).Error)
+	require.Len(t, artists, 2)
+	assert.Equal(t, "Artist, Other", artists[0].SortName)
+	assert.Equal(t, "Artist, The", artists[1].SortName)
+	assert.Equal(t, "Artist, The", artists[1].IndexName())
+
+	var album db.Album
+	require.NoError(t, m.DB().Where("tag_title=?", "The Album").Find(&album).Error)
+	assert.Equal(t, "Album, The", album.TagTitleSort)
+
+	var track db.Track
+	require.NoError(t, m.DB().Preload("Moods").Find(&track).Error)
+	assert.Equal(t, "Title, The", track.TagTitleSort)
+	assert.Equal(t, 128, track.TagBPM)
+	assert.Equal(t, "a comment", track.TagComment)
+
+	var moods []string
+	for _, m := range track.Moods {
+		moods = append(moods, m.Mood)
+	}
+	assert.ElementsMatch(t, []string{"Happy", "Chill"}, moods)
+}
+
+func TestWorksAndMovements(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	for i, movement := range []string{"I. Allegro", "II. Adagio"} {
+		m.SetTrack(fmt.Sprintf("artist-a/album-a/track-%d.flac", i), func(tags *mockfs.TagInfo) {
+			normtag.Set(tags.Tags, normtag.Composer, "Composer")
+			normtag.Set(tags.Tags, "WORK", "Symphony No. 1")
+			normtag.Set(tags.Tags, "MOVEMENTNAME", movement)
+			normtag.Set(tags.Tags, "MOVEMENTNUMBER", fmt.Sprintf("%d/2", i+1))
+		})
+	}
+	// same name, another composer
+	m.SetTrack("artist-b/album-b/track-0.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.Composer, "Other Composer")
+		normtag.Set(tags.Tags, "WORK", "Symphony No. 1")
+	})
+
+	m.ScanAndClean()
+
+	var works []*db.Work
+	require.NoError(t, m.DB().Order("composer").Find(&works).Error)
+	require.Len(t, works, 2)
+	assert.Equal(t, "Composer", works[0].Composer)
+	assert.Equal(t, "Other Composer", works[1].Composer)
+
+	var tracks []*db.Track
+	require.NoError(t, m.DB().Where("work_id=?", works[0].ID).Order("tag_movement_number").Find(&tracks).Error)
+	require.Len(t, tracks, 2)
+	assert.Equal(t, "I. Allegro", tracks[0].TagMovementName)
+	assert.Equal(t, 1, tracks[0].TagMovementNumber)
+	assert.Equal(t, 2, tracks[0].TagMovementCount)
+	assert.Equal(t, "II. Adagio", tracks[1].TagMovementName)
+
+	// works with no tracks left are cleaned
+	m.RemoveAll("artist-b")
+	m.ScanAndClean()
+
+	require.NoError(t, m.DB().Find(&works).Error)
+	assert.Len(t, works, 1)
+}
+
+func TestAlbumImages(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.AddItems()
+	for _, name := range []string{"cover.jpg", "Back.jpg", "Booklet 02.jpg", "booklet 01.jpg", "cd.png", "obi.jpg"} {
+		m.AddCover(filepath.Join("artist-0", "album-0", name))
+	}
+	m.ScanAndClean()
+
+	var album db.Album
+	require.NoError(t, m.DB().Where("left_path=? AND right_path=?", "artist-0/", "album-0").Find(&album).Error)
+	require.Equal(t, "cover.jpg", album.Cover)
+
+	findImages := func() []*db.AlbumImage {
+		var images []*db.AlbumImage
+		require.NoError(t, m.DB().Where("album_id=?", album.ID).Order("id").Find(&images).Error)
+		return images
+	}
+	type image struct {
+		filename string
+		kind     db.AlbumImageKind
+		position int
+	}
+	imageInfo := func(images []*db.AlbumImage) []image {
+		var r []image
+		for _, i := range images {
+			r = append(r, image{i.Filename, i.Kind, i.Position})
+		}
+		return r
+	}
+
+	images := findImages()
+	assert.Equal(t, []image{
+		{"cover.jpg", db.AlbumImageFront, 0},
+		{"Back.jpg", db.AlbumImageBack, 0},
+		{"cd.png", db.AlbumImageDisc, 0},
+		{"booklet 01.jpg", db.AlbumImageBooklet, 0},
+		{"Booklet 02.jpg", db.AlbumImageBooklet, 1},
+		{"obi.jpg", db.AlbumImageOther, 0},
+	}, imageInfo(images))
+
+	// nothing changed, so the ids stay the same
+	m.ScanAndClean()
+	assert.Equal(t, images, findImages())
+
+	m.RemoveAll(filepath.Join("artist-0", "album-0", "booklet 01.jpg"))
+	m.ScanAndClean()
+	assert.Equal(t, []image{
+		{"cover.jpg", db.AlbumImageFront, 0},
+		{"Back.jpg", db.AlbumImageBack, 0},
+		{"cd.png", db.AlbumImageDisc, 0},
+		{"Booklet 02.jpg", db.AlbumImageBooklet, 0},
+		{"obi.jpg", db.AlbumImageOther, 0},
+	}, imageInfo(findImages()))
+}
+
+func TestArtistImageFolder(t *testing.T) {
+	t.Parallel()
+	m := mockfs.New(t)
+
+	m.AddItems()
+	m.AddCover("artist-0/artist.jpg")
+	m.ScanAndClean()
+
+	findArtist := func(name string) *db.Artist {
+		var artist db.Artist
+		require.NoError(t, m.DB().Where("name=?", name).Find(&artist).Error)
+		return &artist
+	}
+	var folder db.Album
+	require.NoError(t, m.DB().Where("left_path=? AND right_path=?", "", "artist-0").Find(&folder).Error)
+	require.Equal(t, "artist.jpg", folder.Cover)
+
+	artist := findArtist("artist-0")
+	require.NotNil(t, artist.ImageFolderID)
+	assert.Equal(t, folder.ID, *artist.ImageFolderID)
+	assert.Nil(t, findArtist("artist-1").ImageFolderID) // no image
+
+	var image db.AlbumImage
+	require.NoError(t, m.DB().Where("album_id=?", folder.ID).Find(&image).Error)
+	assert.Equal(t, db.AlbumImageArtist, image.Kind)
+
+	// someone else's album in the folder means it isn't only artist-0's any more
+	m.SetTrack("artist-0/album-x/track-0.flac", func(tags *mockfs.TagInfo) {
+		normtag.Set(tags.Tags, normtag.AlbumArtist, "artist-1")
+		normtag.Set(tags.Tags, normtag.Album, "album-x")
+	})
+	m.ScanAndClean()
+	assert.Nil(t, findArtist("artist-0").ImageFolderID)
+	assert.Nil(t, findArtist("artist-1").ImageFolderID)
+
+	m.RemoveAll("artist-0/album-x")
+	m.ScanAndClean()
+	assert.NotNil(t, findArtist("artist-0").ImageFolderID)
+
+	m.RemoveAll("artist-0/artist.jpg")
+	m.ScanAndClean()
+	assert.Nil(t, findArtist("artist-0").ImageFolderID)
+}
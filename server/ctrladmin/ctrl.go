@@ -48,12 +48,27 @@ type Controller struct {
 	scanner          *scanner.Scanner
 	podcasts         *podcast.Podcasts
 	lastfmClient     *lastfm.Client
+	genreTreePath    string
+	radioRecordings  bool
 	resolveProxyPath ProxyPathResolver
+
+	// the last dry run scan, kept around to download
+	dryRunMu      sync.Mutex
+	dryRunning    bool
+	dryRunReport  *scanner.Report
+	dryRunStarted time.Time
+	dryRunErr     error // why the last dry run failed, until it's shown
 }
 
 type ProxyPathResolver func(in string) string
 
-func New(dbc *db.DB, sessDB *gormstore.Store, scanner *scanner.Scanner, podcasts *podcast.Podcasts, lastfmClient *lastfm.Client, resolveProxyPath ProxyPathResolver) (*Controller, error) {
+// Options are the admin controller's optional settings
+type Options struct {
+	GenreTreePath   string // the -genre-tree file, which can be edited from the home page if set
+	RadioRecordings bool   // whether there's somewhere to save internet radio recordings, so they can be scheduled
+}
+
+func New(dbc *db.DB, sessDB *gormstore.Store, scanner *scanner.Scanner, podcasts *podcast.Podcasts, lastfmClient *lastfm.Client, resolveProxyPath ProxyPathResolver, opts Options) (*Controller, error) {
 	c := Controller{
 		ServeMux: http.NewServeMux(),
 
@@ -62,6 +77,8 @@ func New(dbc *db.DB, sessDB *gormstore.Store, scanner *scanner.Scanner, podcasts
 		scanner:          scanner,
 		podcasts:         podcasts,
 		lastfmClient:     lastfmClient,
+		genreTreePath:    opts.GenreTreePath,
+		radioRecordings:  opts.RadioRecordings,
 		resolveProxyPath: resolveProxyPath,
 	}
 
@@ -113,6 +130,13 @@ func New(dbc *db.DB, sessDB *gormstore.Store, scanner *scanner.Scanner, podcasts
 	c.Handle("POST /update_lastfm_api_key_do", adminChain(resp(c.ServeUpdateLastFMAPIKeyDo)))
 	c.Handle("POST /start_scan_inc_do", adminChain(resp(c.ServeStartScanIncDo)))
 	c.Handle("POST /start_scan_full_do", adminChain(resp(c.ServeStartScanFullDo)))
+	c.Handle("POST /start_scan_path_do", adminChain(resp(c.ServeStartScanPathDo)))
+	c.Handle("POST /start_dry_run_do", adminChain(resp(c.ServeStartDryRunDo)))
+	c.Handle("GET /dry_run_report", adminChain(respRaw(c.ServeDryRunReport)))
+	c.Handle("GET /library_problems", adminChain(resp(c.ServeLibraryProblems)))
+	c.Handle("GET /genres", adminChain(resp(c.ServeGenres)))
+	c.Handle("GET /genre_tree", adminChain(resp(c.ServeGenreTree)))
+	c.Handle("POST /update_genre_tree_do", adminChain(resp(c.ServeUpdateGenreTreeDo)))
 	c.Handle("POST /add_podcast_do", adminChain(resp(c.ServePodcastAddDo)))
 	c.Handle("POST /delete_podcast_do", adminChain(resp(c.ServePodcastDeleteDo)))
 	c.Handle("POST /download_podcast_do", adminChain(resp(c.ServePodcastDownloadDo)))
@@ -120,6 +144,10 @@ func New(dbc *db.DB, sessDB *gormstore.Store, scanner *scanner.Scanner, podcasts
 	c.Handle("POST /add_internet_radio_station_do", adminChain(resp(c.ServeInternetRadioStationAddDo)))
 	c.Handle("POST /delete_internet_radio_station_do", adminChain(resp(c.ServeInternetRadioStationDeleteDo)))
 	c.Handle("POST /update_internet_radio_station_do", adminChain(resp(c.ServeInternetRadioStationUpdateDo)))
+	c.Handle("POST /import_internet_radio_stations_do", adminChain(resp(c.ServeInternetRadioStationsImportDo)))
+	c.Handle("GET /export_internet_radio_stations", adminChain(respRaw(c.ServeInternetRadioStationsExport)))
+	c.Handle("POST /add_internet_radio_recording_do", adminChain(resp(c.ServeInternetRadioRecordingAddDo)))
+	c.Handle("POST /delete_internet_radio_recording_do", adminChain(resp(c.ServeInternetRadioRecordingDeleteDo)))
 
 	c.Handle("/", baseChain(resp(c.ServeNotFound)))
 
@@ -287,10 +315,15 @@ type templateData struct {
 	// home
 	Stats                      db.Stats
 	RequestRoot                string
-	RecentFolders              []*db.Album
+	RecentFolders              []*db.Album `structs:",omitnested"`
 	AllUsers                   []*db.User
 	LastScanTime               time.Time
 	IsScanning                 bool
+	ScanProgress               *scanner.Progress `structs:",omitnested"` // keep methods for the template
+	ScanProblemCount           int
+	DryRunning                 bool
+	DryRunChanges              int
+	DryRunTime                 time.Time
 	TranscodePreferences       []*db.TranscodePreference
 	TranscodeFormatPreferences []*db.TranscodeFormatPreference
 	TranscodeProfiles          map[string]transcode.Profile
@@ -301,13 +334,44 @@ type templateData struct {
 	DefaultListenBrainzURL string
 	SelectedUser           *db.User
 
-	Podcasts              []*db.Podcast
-	InternetRadioStations []*db.InternetRadioStation
+	Podcasts                []*db.Podcast
+	InternetRadioStations   []*db.InternetRadioStation
+	InternetRadioRecordings []*db.InternetRadioRecording
+	RadioRecordingsEnabled  bool
+
+	// library problems
+	ScanProblems      []*db.ScanProblem `structs:",omitnested"`
+	ScanProblemFilter scanProblemFilter
+	ScanProblemKinds  []db.ScanProblemKind
+
+	// genres
+	Genres []*genreReport `structs:",omitnested"`
+
+	// genre tree
+	GenreTreePath   string
+	GenreTree       string
+	GenreTreeCounts genreTreeCounts
 
 	// avatar
 	Avatar []byte
 }
 
+type scanProblemFilter struct {
+	Level, Kind, Query string
+	RootDir, Dir       string
+	AbsDir             string
+}
+
+type genreReport struct {
+	Name                   string
+	AlbumCount, TrackCount int
+	RawNames               []string `gorm:"-"` // the names in tags which were normalised to this one
+}
+
+type genreTreeCounts struct {
+	Genres, TopLevel int
+}
+
 func funcMap() template.FuncMap {
 	return template.FuncMap{
 		"str": func(in any) string {
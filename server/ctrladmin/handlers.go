@@ -3,13 +3,18 @@ package ctrladmin
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mmcdole/gofeed"
@@ -19,6 +24,8 @@ import (
 	"go.senan.xyz/gonic/handlerutil"
 	"go.senan.xyz/gonic/listenbrainz"
 	"go.senan.xyz/gonic/scanner"
+	"go.senan.xyz/gonic/stationlist"
+	"go.senan.xyz/gonic/texttree"
 	"go.senan.xyz/gonic/transcode"
 )
 
@@ -68,6 +75,24 @@ func (c *Controller) ServeHome(r *http.Request) *Response {
 	}
 
 	data.IsScanning = c.scanner.IsScanning()
+	if err := c.dbc.Model(db.ScanProblem{}).Count(&data.ScanProblemCount).Error; err != nil {
+		return &Response{code: 500, err: fmt.Sprintf("error counting scan problems: %v", err)}
+	}
+	var flashW []string
+	c.dryRunMu.Lock()
+	data.DryRunning = c.dryRunning
+	if c.dryRunReport != nil {
+		data.DryRunTime = c.dryRunStarted
+		data.DryRunChanges = len(c.dryRunReport.Items)
+	}
+	if c.dryRunErr != nil && user.IsAdmin {
+		flashW = append(flashW, fmt.Sprintf("dry run scan failed: %v", c.dryRunErr))
+		c.dryRunErr = nil
+	}
+	c.dryRunMu.Unlock()
+	if progress, ok := c.scanner.Progress(); ok {
+		data.ScanProgress = &progress
+	}
 	tStr, err := c.dbc.GetSetting(db.LastScanTime)
 	if err != nil {
 		return &Response{code: 500, err: fmt.Sprintf("error getting last scan time: %v", err)}
@@ -109,10 +134,17 @@ func (c *Controller) ServeHome(r *http.Request) *Response {
 	if err := c.dbc.Find(&data.InternetRadioStations).Error; err != nil {
 		return &Response{code: 500, err: fmt.Sprintf("error finding internet radio stations: %v", err)}
 	}
+	data.RadioRecordingsEnabled = c.radioRecordings
+	if c.radioRecordings {
+		if err := c.dbc.Preload("Station").Order("start_at").Find(&data.InternetRadioRecordings).Error; err != nil {
+			return &Response{code: 500, err: fmt.Sprintf("error finding internet radio recordings: %v", err)}
+		}
+	}
 
 	return &Response{
 		template: "home.tmpl",
 		data:     data,
+		flashW:   flashW,
 	}
 }
 
@@ -351,6 +383,140 @@ func (c *Controller) ServeCreateUserDo(r *http.Request) *Response {
 	return &Response{redirect: "/admin/home"}
 }
 
+func (c *Controller) ServeLibraryProblems(r *http.Request) *Response {
+	data := &templateData{}
+	data.ScanProblemFilter = scanProblemFilter{
+		Level:   r.URL.Query().Get("level"),
+		Kind:    r.URL.Query().Get("kind"),
+		Query:   r.URL.Query().Get("q"),
+		RootDir: r.URL.Query().Get("root"),
+		Dir:     r.URL.Query().Get("dir"),
+	}
+	if data.ScanProblemFilter.Dir != "" {
+		data.ScanProblemFilter.AbsDir = filepath.Join(data.ScanProblemFilter.RootDir, data.ScanProblemFilter.Dir)
+	}
+	data.ScanProblemKinds = []db.ScanProblemKind{
+		db.ScanProblemFolder, db.ScanProblemCover, db.ScanProblemReadTags, db.ScanProblemMissingTags, db.ScanProblemZeroLength,
+	}
+
+	q := c.dbc.Order("root_dir, dir, filename, level, kind")
+	if f := data.ScanProblemFilter; f.Level != "" {
+		q = q.Where("level=?", f.Level)
+	}
+	if f := data.ScanProblemFilter; f.Kind != "" {
+		q = q.Where("kind=?", f.Kind)
+	}
+	if f := data.ScanProblemFilter; f.Query != "" {
+		like := "%" + f.Query + "%"
+		q = q.Where("dir LIKE ? OR filename LIKE ? OR message LIKE ?", like, like, like)
+	}
+	if f := data.ScanProblemFilter; f.Dir != "" {
+		q = q.Where("root_dir=? AND dir=?", f.RootDir, f.Dir)
+	}
+	if err := q.Find(&data.ScanProblems).Error; err != nil {
+		return &Response{code: 500, err: fmt.Sprintf("error finding scan problems: %v", err)}
+	}
+
+	return &Response{
+		template: "library_problems.tmpl",
+		data:     data,
+	}
+}
+
+func (c *Controller) ServeGenres(_ *http.Request) *Response {
+	data := &templateData{}
+	err := c.dbc.
+		Select([]string{
+			"genres.name",
+			"(SELECT count(1) FROM album_genres WHERE genre_id=genres.id) album_count",
+			"(SELECT count(1) FROM track_genres WHERE genre_id=genres.id) track_count",
+		}).
+		Table("genres").
+		Order("genres.name COLLATE NOCASE").
+		Scan(&data.Genres).
+		Error
+	if err != nil {
+		return &Response{code: 500, err: fmt.Sprintf("error finding genres: %v", err)}
+	}
+
+	var rawNames []struct{ Name, GenreName string }
+	err = c.dbc.
+		Select("genre_raw_names.name, genres.name genre_name").
+		Table("genre_raw_names").
+		Joins("JOIN genres ON genres.id=genre_raw_names.genre_id").
+		Order("genre_raw_names.name COLLATE NOCASE").
+		Scan(&rawNames).
+		Error
+	if err != nil {
+		return &Response{code: 500, err: fmt.Sprintf("error finding genre raw names: %v", err)}
+	}
+	genreRawNames := map[string][]string{}
+	for _, raw := range rawNames {
+		genreRawNames[raw.GenreName] = append(genreRawNames[raw.GenreName], raw.Name)
+	}
+	for _, genre := range data.Genres {
+		genre.RawNames = genreRawNames[genre.Name]
+	}
+
+	return &Response{
+		template: "genres.tmpl",
+		data:     data,
+	}
+}
+
+func (c *Controller) ServeGenreTree(r *http.Request) *Response {
+	data := &templateData{GenreTreePath: c.genreTreePath}
+	if c.genreTreePath != "" {
+		tree, err := os.ReadFile(c.genreTreePath)
+		if err != nil {
+			return &Response{redirect: r.Referer(), flashW: []string{fmt.Sprintf("couldn't read genre tree: %v", err)}}
+		}
+		data.GenreTree = string(tree)
+	}
+	data.GenreTreeCounts = countGenreTree(c.scanner.GenreTree())
+	return &Response{
+		template: "genre_tree.tmpl",
+		data:     data,
+	}
+}
+
+func (c *Controller) ServeUpdateGenreTreeDo(r *http.Request) *Response {
+	if c.genreTreePath == "" {
+		return &Response{redirect: "/admin/genre_tree", flashW: []string{"no genre tree file is set"}}
+	}
+	text := strings.ReplaceAll(r.FormValue("tree"), "\r\n", "\n")
+	tree, err := texttree.ParseReader(strings.NewReader(text))
+	if err != nil {
+		// show the form again with the changes, so they can be fixed
+		return &Response{
+			template: "genre_tree.tmpl",
+			data: &templateData{
+				GenreTreePath:   c.genreTreePath,
+				GenreTree:       text,
+				GenreTreeCounts: countGenreTree(c.scanner.GenreTree()),
+			},
+			flashW: []string{fmt.Sprintf("invalid genre tree: %v", err)},
+		}
+	}
+	// not renamed into place, the file may be mounted on its own into a container
+	if err := os.WriteFile(c.genreTreePath, []byte(text), 0o600); err != nil {
+		return &Response{redirect: "/admin/genre_tree", flashW: []string{fmt.Sprintf("couldn't write genre tree: %v", err)}}
+	}
+	c.scanner.SetGenreTree(tree)
+	return &Response{
+		redirect: "/admin/genre_tree",
+		flashN:   []string{"genre tree saved. run a full scan to update the genres of existing tracks"},
+	}
+}
+
+func countGenreTree(tree map[string][]string) genreTreeCounts {
+	parents := texttree.Parents(tree)
+	return genreTreeCounts{
+		Genres:   len(tree),
+		TopLevel: len(tree) - len(parents),
+	}
+}
+
 func (c *Controller) ServeUpdateLastFMAPIKey(r *http.Request) *Response {
 	data := &templateData{}
 	var err error
@@ -392,6 +558,49 @@ func (c *Controller) ServeStartScanIncDo(_ *http.Request) *Response {
 	}
 }
 
+func (c *Controller) ServeStartScanPathDo(r *http.Request) *Response {
+	path := r.FormValue("path")
+	if err := c.scanner.CheckPaths([]string{path}); err != nil {
+		return &Response{redirect: r.Referer(), flashW: []string{fmt.Sprintf("can't scan path: %v", err)}}
+	}
+	defer doScan(c.scanner, scanner.ScanOptions{Paths: []string{path}})
+	return &Response{
+		redirect: r.Referer(),
+		flashN:   []string{fmt.Sprintf("scan of %q started. refresh for results", path)},
+	}
+}
+
+func (c *Controller) ServeStartDryRunDo(_ *http.Request) *Response {
+	c.dryRunMu.Lock()
+	defer c.dryRunMu.Unlock()
+	if c.dryRunning {
+		return &Response{redirect: "/admin/home", flashW: []string{"dry run already in progress"}}
+	}
+	c.dryRunning = true
+	started := time.Now()
+
+	go func() {
+		report, err := c.scanner.DryRun(scanner.ScanOptions{})
+		if err != nil {
+			log.Printf("error while dry run scanning: %v\n", err)
+		}
+
+		c.dryRunMu.Lock()
+		defer c.dryRunMu.Unlock()
+		c.dryRunning = false
+		if err != nil {
+			// keep the last report which worked, and say why there's no new one on the home page
+			c.dryRunErr = err
+			return
+		}
+		c.dryRunReport, c.dryRunStarted, c.dryRunErr = report, started, nil
+	}()
+	return &Response{
+		redirect: "/admin/home",
+		flashN:   []string{"dry run scan started. refresh for the report"},
+	}
+}
+
 func (c *Controller) ServeStartScanFullDo(_ *http.Request) *Response {
 	defer doScan(c.scanner, scanner.ScanOptions{IsFull: true})
 	return &Response{
@@ -592,6 +801,7 @@ func (c *Controller) ServeInternetRadioStationAddDo(r *http.Request) *Response {
 	station.StreamURL = streamURL
 	station.Name = name
 	station.HomepageURL = homepageURL
+	station.Proxy = r.FormValue("proxy") == "on"
 	if err := c.dbc.Save(&station).Error; err != nil {
 		return &Response{redirect: r.Referer(), flashW: []string{fmt.Sprintf("error saving station: %v", err)}}
 	}
@@ -642,6 +852,7 @@ func (c *Controller) ServeInternetRadioStationUpdateDo(r *http.Request) *Respons
 	station.StreamURL = streamURL
 	station.Name = name
 	station.HomepageURL = homepageURL
+	station.Proxy = r.FormValue("proxy") == "on"
 	if err := c.dbc.Save(&station).Error; err != nil {
 		return &Response{code: 500, err: "please provide a valid internet radio station id"}
 	}
@@ -671,6 +882,152 @@ func (c *Controller) ServeInternetRadioStationDeleteDo(r *http.Request) *Respons
 	}
 }
 
+func (c *Controller) ServeInternetRadioStationsImportDo(r *http.Request) *Response {
+	stations, skipped, err := getStationList(r)
+	if err != nil {
+		return &Response{redirect: "/admin/home", flashW: []string{fmt.Sprintf("error reading station list: %v", err)}}
+	}
+
+	var existing []*db.InternetRadioStation
+	if err := c.dbc.Find(&existing).Error; err != nil {
+		return &Response{code: 500, err: fmt.Sprintf("error finding internet radio stations: %v", err)}
+	}
+	seen := map[string]struct{}{}
+	for _, s := range existing {
+		seen[s.StreamURL] = struct{}{}
+	}
+
+	var added int
+	for _, s := range stations {
+		if _, err := url.ParseRequestURI(s.StreamURL); err != nil {
+			continue
+		}
+		if _, ok := seen[s.StreamURL]; ok {
+			continue
+		}
+		seen[s.StreamURL] = struct{}{}
+
+		station := db.InternetRadioStation{
+			StreamURL:   s.StreamURL,
+			Name:        cmp.Or(s.Name, s.StreamURL),
+			HomepageURL: s.HomepageURL,
+		}
+		if err := c.dbc.Save(&station).Error; err != nil {
+			return &Response{redirect: r.Referer(), flashW: []string{fmt.Sprintf("error saving station: %v", err)}}
+		}
+		added++
+	}
+
+	msg := fmt.Sprintf("imported %d new of %d stations", added, len(stations))
+	if len(skipped) > 0 {
+		var reasons []string
+		for _, err := range skipped {
+			reasons = append(reasons, err.Error())
+		}
+		msg = fmt.Sprintf("%s, skipped %d: %s", msg, len(skipped), strings.Join(reasons, "; "))
+		return &Response{redirect: "/admin/home", flashW: []string{msg}}
+	}
+	return &Response{
+		redirect: "/admin/home",
+		flashN:   []string{msg},
+	}
+}
+
+func (c *Controller) ServeInternetRadioRecordingAddDo(r *http.Request) *Response {
+	if !c.radioRecordings {
+		return &Response{redirect: "/admin/home", flashW: []string{"radio recordings are disabled, please set a radio recordings path"}}
+	}
+	stationID, err := strconv.Atoi(r.FormValue("stationID"))
+	if err != nil {
+		return &Response{redirect: "/admin/home", flashW: []string{"please provide a valid internet radio station"}}
+	}
+	startAt, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("startAt"), time.Local)
+	if err != nil {
+		return &Response{redirect: "/admin/home", flashW: []string{fmt.Sprintf("bad start time provided: %v", err)}}
+	}
+	durationMins, err := strconv.Atoi(r.FormValue("durationMins"))
+	if err != nil || durationMins <= 0 {
+		return &Response{redirect: "/admin/home", flashW: []string{"please provide a duration in minutes"}}
+	}
+
+	recurrence := db.InternetRadioRecurrence(r.FormValue("recurrence"))
+	switch recurrence {
+	case db.InternetRadioRecurrenceOnce, db.InternetRadioRecurrenceDaily, db.InternetRadioRecurrenceWeekly:
+	default:
+		return &Response{redirect: "/admin/home", flashW: []string{fmt.Sprintf("unknown recurrence %q", recurrence)}}
+	}
+
+	var station db.InternetRadioStation
+	if err := c.dbc.Where("id=?", stationID).First(&station).Error; err != nil {
+		return &Response{redirect: r.Referer(), flashW: []string{fmt.Sprintf("find station by id: %v", err)}}
+	}
+
+	recording := db.InternetRadioRecording{
+		StationID:    station.ID,
+		StartAt:      startAt,
+		DurationMins: durationMins,
+		Recurrence:   recurrence,
+		SplitOnTitle: r.FormValue("splitOnTitle") == "on",
+	}
+	if err := c.dbc.Save(&recording).Error; err != nil {
+		return &Response{redirect: r.Referer(), flashW: []string{fmt.Sprintf("error saving recording: %v", err)}}
+	}
+
+	return &Response{
+		redirect: "/admin/home",
+		flashN:   []string{fmt.Sprintf("recording of %q scheduled", station.Name)},
+	}
+}
+
+func (c *Controller) ServeInternetRadioRecordingDeleteDo(r *http.Request) *Response {
+	recordingID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		return &Response{code: 400, err: "please provide a valid internet radio recording id"}
+	}
+
+	if err := c.dbc.Where("id=?", recordingID).Delete(&db.InternetRadioRecording{}).Error; err != nil {
+		return &Response{redirect: r.Referer(), flashW: []string{fmt.Sprintf("deleting radio recording: %v", err)}}
+	}
+
+	return &Response{
+		redirect: "/admin/home",
+	}
+}
+
+// getStationList reads stations from either an uploaded list file or a list URL, following any nested lists. nested
+// lists which can't be read are skipped, with why in skipped
+func getStationList(r *http.Request) (stations []stationlist.Station, skipped []error, err error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, 1<<20) // cap upload at 1MB
+	err = r.ParseMultipartForm(1 << 20)              //nolint:gosec // body bounded by MaxBytesReader above
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	client := &http.Client{}
+
+	if listURL := r.FormValue("url"); listURL != "" {
+		if _, err := url.ParseRequestURI(listURL); err != nil {
+			return nil, nil, fmt.Errorf("bad list URL provided: %w", err)
+		}
+		return stationlist.Fetch(ctx, client, listURL)
+	}
+
+	file, header, err := r.FormFile("list")
+	if err != nil {
+		return nil, nil, fmt.Errorf("please provide a list file or URL: %w", err)
+	}
+	defer file.Close()
+
+	stations, err = stationlist.Parse(file, header.Filename, header.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+	stations, skipped = stationlist.Resolve(ctx, client, stations)
+	return stations, skipped, nil
+}
+
 func getAvatarFile(r *http.Request) ([]byte, error) {
 	r.Body = http.MaxBytesReader(nil, r.Body, 10<<20) // cap upload at 10MB
 	err := r.ParseMultipartForm(10 << 20)             //nolint:gosec // body bounded by MaxBytesReader above
@@ -2,9 +2,13 @@ package ctrladmin
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/gorilla/sessions"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/stationlist"
 )
 
 func (c *Controller) ServeLoginDo(w http.ResponseWriter, r *http.Request) {
@@ -44,3 +48,35 @@ func (c *Controller) ServeLogout(w http.ResponseWriter, r *http.Request) {
 	sessLogSave(session, w, r)
 	http.Redirect(w, r, c.resolveProxyPath("/admin/login"), http.StatusSeeOther)
 }
+
+func (c *Controller) ServeDryRunReport(w http.ResponseWriter, _ *http.Request) {
+	c.dryRunMu.Lock()
+	report, started := c.dryRunReport, c.dryRunStarted
+	c.dryRunMu.Unlock()
+	if report == nil {
+		http.Error(w, "no dry run report yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="gonic-dry-run-%s.txt"`, started.Format("2006-01-02-1504")))
+	if _, err := report.WriteTo(w); err != nil {
+		log.Printf("error writing dry run report: %v", err)
+	}
+}
+
+func (c *Controller) ServeInternetRadioStationsExport(w http.ResponseWriter, _ *http.Request) {
+	var stations []*db.InternetRadioStation
+	if err := c.dbc.Order("name").Find(&stations).Error; err != nil {
+		http.Error(w, fmt.Sprintf("error finding internet radio stations: %v", err), http.StatusInternalServerError)
+		return
+	}
+	list := make([]stationlist.Station, 0, len(stations))
+	for _, s := range stations {
+		list = append(list, stationlist.Station{Name: s.Name, StreamURL: s.StreamURL, HomepageURL: s.HomepageURL})
+	}
+	w.Header().Set("Content-Type", "audio/x-mpegurl")
+	w.Header().Set("Content-Disposition", `attachment; filename="stations.m3u"`)
+	if err := stationlist.WriteM3U(w, list); err != nil {
+		log.Printf("error writing stations: %v", err)
+	}
+}
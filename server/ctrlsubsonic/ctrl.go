@@ -10,11 +10,13 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os/exec"
 	"time"
 
 	"go.senan.xyz/gonic/cache"
 	"go.senan.xyz/gonic/db"
 	"go.senan.xyz/gonic/handlerutil"
+	"go.senan.xyz/gonic/icy"
 	"go.senan.xyz/gonic/infocache/albuminfocache"
 	"go.senan.xyz/gonic/infocache/artistinfocache"
 	"go.senan.xyz/gonic/jukebox"
@@ -60,6 +62,7 @@ type Controller struct {
 	podcastsPath    string
 	cacheAudioPath  string
 	coverCache      *cache.DirCache
+	coverWebP       bool
 	jukebox         *jukebox.Jukebox
 	playlistStore   *playlist.Store
 	scrobblers      []scrobble.Scrobbler
@@ -69,11 +72,23 @@ type Controller struct {
 	artistInfoCache *artistinfocache.ArtistInfoCache
 	albumInfoCache  *albuminfocache.AlbumInfoCache
 	tagReader       tags.Reader
+	radioTitles     *icy.Titles
 
 	resolveProxyPath ProxyPathResolver
 }
 
-func New(dbc *db.DB, scannr *scanner.Scanner, musicPaths []MusicPath, podcastsPath string, cacheAudioPath string, coverCache *cache.DirCache, jukebox *jukebox.Jukebox, playlistStore *playlist.Store, scrobblers []scrobble.Scrobbler, podcasts *podcast.Podcasts, transcoder transcode.Transcoder, lastFMClient *lastfm.Client, artistInfoCache *artistinfocache.ArtistInfoCache, albumInfoCache *albuminfocache.AlbumInfoCache, tagReader tags.Reader, resolveProxyPath ProxyPathResolver) (*Controller, error) {
+// Options are the subsonic controller's optional settings
+type Options struct {
+	CoverWebP bool // whether cover art can be sent as WebP to clients which ask for it. needs ffmpeg
+}
+
+func New(dbc *db.DB, scannr *scanner.Scanner, musicPaths []MusicPath, podcastsPath string, cacheAudioPath string, coverCache *cache.DirCache, jukebox *jukebox.Jukebox, playlistStore *playlist.Store, scrobblers []scrobble.Scrobbler, podcasts *podcast.Podcasts, transcoder transcode.Transcoder, lastFMClient *lastfm.Client, artistInfoCache *artistinfocache.ArtistInfoCache, albumInfoCache *albuminfocache.AlbumInfoCache, tagReader tags.Reader, resolveProxyPath ProxyPathResolver, opts Options) (*Controller, error) {
+	if opts.CoverWebP {
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			return nil, fmt.Errorf("ffmpeg is needed for webp covers: %w", err)
+		}
+	}
+
 	c := Controller{
 		ServeMux: http.NewServeMux(),
 
@@ -83,6 +98,7 @@ func New(dbc *db.DB, scannr *scanner.Scanner, musicPaths []MusicPath, podcastsPa
 		podcastsPath:    podcastsPath,
 		cacheAudioPath:  cacheAudioPath,
 		coverCache:      coverCache,
+		coverWebP:       opts.CoverWebP,
 		jukebox:         jukebox,
 		playlistStore:   playlistStore,
 		scrobblers:      scrobblers,
@@ -92,6 +108,7 @@ func New(dbc *db.DB, scannr *scanner.Scanner, musicPaths []MusicPath, podcastsPa
 		artistInfoCache: artistInfoCache,
 		albumInfoCache:  albumInfoCache,
 		tagReader:       tagReader,
+		radioTitles:     icy.NewTitles(),
 
 		resolveProxyPath: resolveProxyPath,
 	}
@@ -132,6 +149,7 @@ func New(dbc *db.DB, scannr *scanner.Scanner, musicPaths []MusicPath, podcastsPa
 	c.Handle("/getTopSongs", chain(resp(c.ServeGetTopSongs)))
 	c.Handle("/getSimilarSongs", chain(resp(c.ServeGetSimilarSongs)))
 	c.Handle("/getSimilarSongs2", chain(resp(c.ServeGetSimilarSongsTwo)))
+	c.Handle("/getRadio", chain(resp(c.ServeGetRadio)))
 	c.Handle("/getLyrics", chain(resp(c.ServeGetLyrics)))
 	c.Handle("/getLyricsBySongId", chain(resp(c.ServeGetLyricsBySongID)))
 
@@ -140,6 +158,7 @@ func New(dbc *db.DB, scannr *scanner.Scanner, musicPaths []MusicPath, podcastsPa
 	c.Handle("/stream", chainRaw(respRaw(c.ServeStream)))
 	c.Handle("/download", chainRaw(respRaw(c.ServeStream)))
 	c.Handle("/getAvatar", chainRaw(respRaw(c.ServeGetAvatar)))
+	c.Handle("/streamInternetRadioStation", chainRaw(respRaw(c.ServeStreamInternetRadioStation)))
 
 	// browse by tag
 	c.Handle("/getAlbum", chain(resp(c.ServeGetAlbum)))
@@ -150,6 +169,10 @@ func New(dbc *db.DB, scannr *scanner.Scanner, musicPaths []MusicPath, podcastsPa
 	c.Handle("/getStarred2", chain(resp(c.ServeGetStarredTwo)))
 	c.Handle("/getArtistInfo2", chain(resp(c.ServeGetArtistInfoTwo)))
 	c.Handle("/getAlbumInfo2", chain(resp(c.ServeGetAlbumInfoTwo)))
+	c.Handle("/getAlbumArtwork", chain(resp(c.ServeGetAlbumArtwork)))
+	c.Handle("/getLabels", chain(resp(c.ServeGetLabels)))
+	c.Handle("/getWorks", chain(resp(c.ServeGetWorks)))
+	c.Handle("/getWork", chain(resp(c.ServeGetWork)))
 
 	// browse by folder
 	c.Handle("/getIndexes", chain(resp(c.ServeGetIndexes)))
@@ -157,6 +180,7 @@ func New(dbc *db.DB, scannr *scanner.Scanner, musicPaths []MusicPath, podcastsPa
 	c.Handle("/getAlbumList", chain(resp(c.ServeGetAlbumList)))
 	c.Handle("/search2", chain(resp(c.ServeSearchTwo)))
 	c.Handle("/getGenres", chain(resp(c.ServeGetGenres)))
+	c.Handle("/getGenre", chain(resp(c.ServeGetGenre)))
 	c.Handle("/getArtistInfo", chain(resp(c.ServeGetArtistInfo)))
 	c.Handle("/getStarred", chain(resp(c.ServeGetStarred)))
 
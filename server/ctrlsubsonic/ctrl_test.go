@@ -26,11 +26,13 @@ import (
 
 	"go.senan.xyz/gonic"
 	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/icy"
 	"go.senan.xyz/gonic/infocache/albuminfocache"
 	"go.senan.xyz/gonic/infocache/artistinfocache"
 	"go.senan.xyz/gonic/mockfs"
 	playlistp "go.senan.xyz/gonic/playlist"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/params"
+	"go.senan.xyz/gonic/texttree"
 	"go.senan.xyz/gonic/transcode"
 )
 
@@ -85,6 +87,7 @@ func makeHTTPMock(query url.Values, user *db.User) (*httptest.ResponseRecorder,
 //	      track-2.flac          # track-only, never reaches album. Jazz
 //	    album-ab/               # multi-disc, folder cover, contributors
 //	      cover.png
+//	      back.jpg, booklet 01.jpg, Booklet 02.jpg
 //	      d1-track-0.flac       # plural contributor tags
 //	      d2-track-0.flac       # singular contributor tags
 //	    empty-album/            # zero tracks, inserted post-scan
@@ -109,6 +112,7 @@ type fixture struct {
 	artistB db.Artist
 	artistC db.Artist // unicode name
 	artistX db.Artist // only ever a track artist
+	compA   db.Artist // a composer, credited on tracks only
 
 	albumAA     db.Album
 	albumAB     db.Album
@@ -122,6 +126,8 @@ type fixture struct {
 
 	trackAB1 db.Track
 	trackVA0 db.Track
+
+	workAB db.Work
 }
 
 func newFixture(tb testing.TB) *fixture {
@@ -152,10 +158,20 @@ func newFixture(tb testing.TB) *fixture {
 			normtag.Set(info.Tags, normtag.ReplayGainTrackPeak, "0.95")
 			normtag.Set(info.Tags, normtag.ReplayGainAlbumGain, "-4.0 dB")
 			normtag.Set(info.Tags, normtag.ReplayGainAlbumPeak, "0.99")
+			if tr == 0 {
+				normtag.Set(info.Tags, "BPM", "128")
+				normtag.Set(info.Tags, "MOOD", "Happy", "Energetic")
+				normtag.Set(info.Tags, "COMMENT", "a comment")
+				normtag.Set(info.Tags, "TITLESORT", "title zero")
+				normtag.Set(info.Tags, "ALBUMSORT", "album aa, the")
+			}
 		})
 	}
 
 	m.AddCover("m-0/artist-a/album-ab/cover.png")
+	m.AddCover("m-0/artist-a/album-ab/back.jpg")
+	m.AddCover("m-0/artist-a/album-ab/booklet 01.jpg")
+	m.AddCover("m-0/artist-a/album-ab/Booklet 02.jpg")
 	// plural contributor tag forms, with and without credit-as
 	m.SetTrack("m-0/artist-a/album-ab/d1-track-0.flac", func(info *mockfs.TagInfo) {
 		normtag.Set(info.Tags, normtag.Artist, "artist-a")
@@ -180,6 +196,10 @@ func newFixture(tb testing.TB) *fixture {
 		normtag.Set(info.Tags, normtag.MusicBrainzRecordingID, "00000000-0000-0000-0000-ab00000000d1")
 		normtag.Set(info.Tags, normtag.ReleaseType, "EP")
 		normtag.Set(info.Tags, normtag.Label, "Sub Pop", "Domino")
+		normtag.Set(info.Tags, "WORK", "work-ab")
+		normtag.Set(info.Tags, "MUSICBRAINZ_WORKID", "00000000-0000-0000-0000-00000000a0ab")
+		normtag.Set(info.Tags, "MOVEMENTNAME", "I. Allegro")
+		normtag.Set(info.Tags, "MOVEMENTNUMBER", "1/2")
 	})
 	// singular contributor tag forms, with and without credit-as
 	m.SetTrack("m-0/artist-a/album-ab/d2-track-0.flac", func(info *mockfs.TagInfo) {
@@ -200,12 +220,18 @@ func newFixture(tb testing.TB) *fixture {
 		normtag.Set(info.Tags, normtag.Lyricist, "lyr-c")
 		normtag.Set(info.Tags, normtag.Conductor, "cond-c")
 		normtag.Set(info.Tags, normtag.Arranger, "arr-c")
+		normtag.Set(info.Tags, "WORK", "work-ab")
+		normtag.Set(info.Tags, "MUSICBRAINZ_WORKID", "00000000-0000-0000-0000-00000000a0ab")
+		normtag.Set(info.Tags, "MOVEMENT", "II. Adagio")
+		normtag.Set(info.Tags, "MOVEMENTNUMBER", "2")
+		normtag.Set(info.Tags, "MOVEMENTCOUNT", "2")
 	})
 
 	// singular ArtistCredit/AlbumArtistCredit (vs album-collab's plural form)
 	m.SetTrack("m-0/artist-b/album-ba/track-0.flac", func(info *mockfs.TagInfo) {
 		normtag.Set(info.Tags, normtag.Artist, "artist-b")
 		normtag.Set(info.Tags, normtag.ArtistCredit, "The Mighty B")
+		normtag.Set(info.Tags, "ARTISTSORT", "Mighty B, The")
 		normtag.Set(info.Tags, normtag.AlbumArtist, "artist-b")
 		normtag.Set(info.Tags, normtag.AlbumArtistCredit, "The Mighty B (LP)")
 		normtag.Set(info.Tags, normtag.Album, "album-ba")
@@ -215,6 +241,8 @@ func newFixture(tb testing.TB) *fixture {
 		normtag.Set(info.Tags, normtag.Genre, "Jazz")
 		normtag.Set(info.Tags, normtag.MusicBrainzReleaseID, "00000000-0000-0000-0000-0000000000ba")
 		normtag.Set(info.Tags, normtag.ReleaseType, "Single")
+		info.SampleRate = 96000
+		info.BitDepth = 24
 	})
 
 	// plural AlbumArtists/Artists with no credit-as (vs album-collab's credits)
@@ -295,6 +323,11 @@ func newFixture(tb testing.TB) *fixture {
 	m.ScanAndClean()
 	m.ResetDates()
 
+	// set after scanning so no genres are inherited, only the genre handlers see the hierarchy
+	genreTree, err := texttree.ParseReader(strings.NewReader("Popular\tRock\nPopular\tPop\nRock\tPunk\n"))
+	require.NoError(tb, err)
+	m.Scanner().SetGenreTree(genreTree)
+
 	dbc := m.DB()
 
 	admin, err := dbc.GetUserByName("admin")
@@ -310,6 +343,7 @@ func newFixture(tb testing.TB) *fixture {
 	dbc.Where("name=?", "artist-b").First(&f.artistB)
 	dbc.Where("name=?", "ärtist-c").First(&f.artistC)
 	dbc.Where("name=?", "artist-x").First(&f.artistX)
+	dbc.Where("name=?", "comp-a").First(&f.compA)
 
 	dbc.Where("right_path=? AND tag_title=?", "album-aa", "album-aa").First(&f.albumAA)
 	dbc.Where("right_path=? AND tag_title=?", "album-ab", "album-ab").First(&f.albumAB)
@@ -320,6 +354,8 @@ func newFixture(tb testing.TB) *fixture {
 	dbc.Where("right_path=? AND tag_title=?", "album-cross", "album-cross").First(&f.albumCross)
 	dbc.Where("right_path=? AND tag_title=?", "comp", "comp").First(&f.albumVA)
 
+	dbc.Where("name=?", "work-ab").First(&f.workAB)
+
 	dbc.
 		Joins("JOIN albums ON albums.id=tracks.album_id").
 		Where("tracks.filename=? AND albums.right_path=?", "d1-track-0.flac", "album-ab").
@@ -435,11 +471,13 @@ func newFixture(tb testing.TB) *fixture {
 
 	f.contr = &Controller{
 		dbc:              dbc,
+		scanner:          m.Scanner(),
 		musicPaths:       musicPaths,
 		transcoder:       transcode.NewFFmpegTranscoder(),
 		artistInfoCache:  artistinfocache.New(dbc, nil, nil),
 		albumInfoCache:   albuminfocache.New(dbc, nil, nil),
 		playlistStore:    playlistStore,
+		radioTitles:      icy.NewTitles(),
 		resolveProxyPath: func(in string) string { return in },
 	}
 	return f
@@ -1,11 +1,17 @@
 package ctrlsubsonic
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
 
 	"go.senan.xyz/gonic/db"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/params"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/spec"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/specid"
 )
 
 func (c *Controller) ServeGetBookmarks(r *http.Request) *spec.Response {
@@ -116,3 +122,103 @@ func (c *Controller) ServeDeleteBookmark(r *http.Request) *spec.Response {
 	}
 	return spec.NewResponse()
 }
+
+// tracks shorter than this are music, so we don't keep resume points for them. longer ones are likely audiobook
+// chapters or mixes
+const resumeMinTrackLength = 10 * time.Minute
+
+// past this fraction of the length the entry counts as finished
+const resumePlayedRatio = 0.9
+
+// updateResumePosition keeps a user's bookmark for a long track or podcast episode at positionMS, as reported by
+// a stream with a timeOffset or a scrobble. once past resumePlayedRatio the bookmark is removed, and podcast
+// episodes are marked played. the user's play queue position is kept in sync if it's on the same entry
+func updateResumePosition(dbc *db.DB, userID int, id specid.ID, positionMS int) error {
+	var lengthSecs int
+	switch id.Type {
+	case specid.Track:
+		var track db.Track
+		if err := dbc.Select("id, length").First(&track, id.Value).Error; err != nil {
+			return fmt.Errorf("find track: %w", err)
+		}
+		if time.Duration(track.Length)*time.Second < resumeMinTrackLength {
+			return nil
+		}
+		lengthSecs = track.Length
+	case specid.PodcastEpisode:
+		var pe db.PodcastEpisode
+		if err := dbc.Select("id, length").First(&pe, id.Value).Error; err != nil {
+			return fmt.Errorf("find podcast episode: %w", err)
+		}
+		lengthSecs = pe.Length
+	default:
+		return nil
+	}
+
+	if lengthSecs > 0 && float64(positionMS) >= float64(lengthSecs*1000)*resumePlayedRatio {
+		return finishResume(dbc, userID, id)
+	}
+
+	bookmark := &db.Bookmark{}
+	err := dbc.
+		FirstOrCreate(bookmark, db.Bookmark{
+			UserID:      userID,
+			EntryIDType: db.BookmarkEntry(id.Type),
+			EntryID:     id.Value,
+		}).
+		Error
+	if err != nil {
+		return fmt.Errorf("find bookmark: %w", err)
+	}
+	bookmark.Position = positionMS
+	if err := dbc.Save(bookmark).Error; err != nil {
+		return fmt.Errorf("save bookmark: %w", err)
+	}
+
+	err = dbc.
+		Model(db.PlayQueue{}).
+		Where("user_id=? AND current=?", userID, id.String()).
+		UpdateColumn("position", positionMS).
+		Error
+	if err != nil {
+		return fmt.Errorf("sync play queue: %w", err)
+	}
+	return nil
+}
+
+// resumeFromBookmark applies the position of the user's bookmark for id again, for a scrobble without a position.
+// clients send the submission scrobble halfway through or after 4 minutes, so it doesn't mean the end was reached. but
+// the bookmark can be past resumePlayedRatio if the length wasn't known when it was saved
+func resumeFromBookmark(dbc *db.DB, userID int, id specid.ID) error {
+	var bookmark db.Bookmark
+	err := dbc.
+		Where("user_id=? AND entry_id_type=? AND entry_id=?", userID, db.BookmarkEntry(id.Type), id.Value).
+		First(&bookmark).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("find bookmark: %w", err)
+	}
+	return updateResumePosition(dbc, userID, id, bookmark.Position)
+}
+
+// finishResume clears the resume point of an entry the user has finished
+func finishResume(dbc *db.DB, userID int, id specid.ID) error {
+	err := dbc.
+		Where("user_id=? AND entry_id_type=? AND entry_id=?", userID, db.BookmarkEntry(id.Type), id.Value).
+		Delete(&db.Bookmark{}).
+		Error
+	if err != nil {
+		return fmt.Errorf("delete bookmark: %w", err)
+	}
+	if id.Type != specid.PodcastEpisode {
+		return nil
+	}
+	played := db.PodcastEpisodePlayed{UserID: userID, PodcastEpisodeID: id.Value, PlayedAt: time.Now()}
+	if err := dbc.Save(&played).Error; err != nil {
+		return fmt.Errorf("save podcast episode played: %w", err)
+	}
+	return nil
+}
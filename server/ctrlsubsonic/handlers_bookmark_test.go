@@ -4,6 +4,12 @@ import (
 	"net/url"
 	"testing"
 	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/podcast"
 )
 
 func TestGetBookmarks(t *testing.T) {
@@ -58,3 +64,88 @@ func TestGetBookmarks(t *testing.T) {
 		query{url.Values{}, "alt_after_admin_delete", false},
 	)
 }
+
+func TestResumePosition(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	f.seq = true
+
+	contr := *f.contr
+	contr.podcasts = podcast.New(f.dbc, t.TempDir(), nil)
+
+	pod := db.Podcast{Title: "pod", URL: "https://example.invalid/feed"}
+	require.NoError(t, f.dbc.Save(&pod).Error)
+	publish1 := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	publish2 := time.Date(2021, 1, 8, 12, 0, 0, 0, time.UTC)
+	ep1 := db.PodcastEpisode{PodcastID: pod.ID, Title: "ep-1", PublishDate: &publish1, Length: 1000, Status: db.PodcastEpisodeStatusCompleted, Filename: "ep-1.mp3"}
+	ep2 := db.PodcastEpisode{PodcastID: pod.ID, Title: "ep-2", PublishDate: &publish2, Length: 1000, Status: db.PodcastEpisodeStatusCompleted, Filename: "ep-2.mp3"}
+	require.NoError(t, f.dbc.Save(&ep1).Error)
+	require.NoError(t, f.dbc.Save(&ep2).Error)
+
+	f.query(t, contr.ServeSavePlayQueue, f.admin, url.Values{
+		"id":      {ep1.SID().String(), ep2.SID().String()},
+		"current": {ep1.SID().String()},
+	})
+
+	// now playing with a position keeps a resume point, and the play queue in sync
+	f.query(t, contr.ServeScrobble, f.admin, url.Values{
+		"id":         {ep1.SID().String()},
+		"submission": {"false"},
+		"position":   {"400000"},
+	})
+	var queue db.PlayQueue
+	require.NoError(t, f.dbc.Where("user_id=?", f.admin.ID).First(&queue).Error)
+	require.Equal(t, 400000, queue.Position)
+
+	// a full scrobble is sent partway through, so without a position past the end threshold it doesn't mark as
+	// played, and the place to resume from is kept
+	f.query(t, contr.ServeScrobble, f.admin, url.Values{
+		"id":         {ep2.SID().String()},
+		"submission": {"false"},
+		"position":   {"500000"},
+	})
+	f.query(t, contr.ServeScrobble, f.admin, url.Values{
+		"id": {ep2.SID().String()},
+	})
+	var ep2Bookmark db.Bookmark
+	require.NoError(t, f.dbc.Where("user_id=? AND entry_id_type=? AND entry_id=?", f.admin.ID, db.BookmarkEntryPodcastEpisode, ep2.ID).First(&ep2Bookmark).Error)
+	require.Equal(t, 500000, ep2Bookmark.Position)
+	var played int
+	require.NoError(t, f.dbc.Model(db.PodcastEpisodePlayed{}).Where("user_id=? AND podcast_episode_id=?", f.admin.ID, ep2.ID).Count(&played).Error)
+	require.Zero(t, played)
+
+	// one with a position past it does
+	f.query(t, contr.ServeScrobble, f.admin, url.Values{
+		"id":       {ep2.SID().String()},
+		"position": {"950000"},
+	})
+
+	f.run(t, contr.ServeGetPodcasts, f.admin,
+		query{url.Values{}, "admin", false},
+	)
+	f.run(t, contr.ServeGetPodcasts, f.alt,
+		query{url.Values{}, "alt", false},
+	)
+
+	// past the end threshold is finished too, and the bookmark goes away
+	f.query(t, contr.ServeScrobble, f.admin, url.Values{
+		"id":       {ep1.SID().String()},
+		"position": {"950000"},
+	})
+	var bookmarks int
+	require.NoError(t, f.dbc.Model(db.Bookmark{}).Where("user_id=?", f.admin.ID).Count(&bookmarks).Error)
+	require.Zero(t, bookmarks)
+
+	f.run(t, contr.ServeGetNewestPodcasts, f.admin,
+		query{url.Values{}, "finished", false},
+	)
+
+	// short tracks are music, no resume points for those
+	f.query(t, contr.ServeScrobble, f.admin, url.Values{
+		"id":         {f.trackAB1.SID().String()},
+		"submission": {"false"},
+		"position":   {"1000"},
+	})
+	require.NoError(t, f.dbc.Model(db.Bookmark{}).Where("user_id=?", f.admin.ID).Count(&bookmarks).Error)
+	require.Zero(t, bookmarks)
+}
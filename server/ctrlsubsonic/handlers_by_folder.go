@@ -4,6 +4,7 @@ package ctrlsubsonic
 import (
 	"errors"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/google/uuid"
@@ -38,11 +39,30 @@ func (c *Controller) ServeGetIndexes(r *http.Request) *spec.Response {
 	if err != nil {
 		return spec.NewError(0, "error finding folders: %v", err)
 	}
+	// folders named after an artist are sorted by its sort name
+	var sortNames []*db.Artist
+	if err := c.dbc.
+		Select("name, sort_name").
+		Where("sort_name != ''").
+		Find(&sortNames).
+		Error; err != nil {
+		return spec.NewError(0, "error finding sort names: %v", err)
+	}
+	sortNameOf := make(map[string]string, len(sortNames))
+	for _, a := range sortNames {
+		sortNameOf[a.Name] = a.SortName
+	}
+	folderKey := func(folder *spec.AlbumRow) string {
+		return sortKey(folder.IndexRightPath(), sortNameOf[folder.RightPath])
+	}
+	slices.SortStableFunc(folders, func(a, b *spec.AlbumRow) int {
+		return compareSortKeys(folderKey(a), folderKey(b))
+	})
 	// [a-z#] -> 27
 	indexMap := make(map[string]*spec.Index, 27)
 	resp := make([]*spec.Index, 0, 27)
 	for _, folder := range folders {
-		key := lowerUDecOrHash(folder.IndexRightPath())
+		key := lowerUDecOrHash(folderKey(folder))
 		if _, ok := indexMap[key]; !ok {
 			indexMap[key] = &spec.Index{
 				Name:    key,
@@ -54,8 +74,9 @@ func (c *Controller) ServeGetIndexes(r *http.Request) *spec.Response {
 	}
 	sub := spec.NewResponse()
 	sub.Indexes = &spec.Indexes{
-		LastModified: 0,
-		Index:        resp,
+		LastModified:    0,
+		IgnoredArticles: ignoredArticles,
+		Index:           resp,
 	}
 	return sub
 }
@@ -152,6 +173,9 @@ func (c *Controller) ServeGetAlbumList(r *http.Request) *spec.Response {
 		q = q.Joins("JOIN album_genres ON album_genres.album_id=albums.id")
 		q = q.Joins("JOIN genres ON genres.id=album_genres.genre_id AND genres.name=?", genre)
 		q = q.Order("right_path")
+	case "byLabel", "byReleaseType":
+		// filtered by the label or releaseType parameters below
+		q = q.Order("right_path")
 	case "frequent":
 		q = q.Having("play_length > 0").Order("play_length DESC")
 	case "newest":
@@ -170,7 +194,7 @@ func (c *Controller) ServeGetAlbumList(r *http.Request) *spec.Response {
 		return spec.NewError(10, "unknown value %q for parameter 'type'", v)
 	}
 
-	q = q.Scopes(spec.WithAlbumRootDir(getMusicFolder(c.musicPaths, params)))
+	q = q.Scopes(spec.WithAlbumRootDir(getMusicFolder(c.musicPaths, params)), spec.WithAlbumTags(getAlbumTagFilter(params)))
 	var folders []*spec.AlbumRow
 	// TODO: think about removing this extra join to count number
 	// of children. it might make sense to store that in the db
@@ -66,6 +66,8 @@ func TestGetAlbumList(t *testing.T) {
 		query{url.Values{"type": {"highest"}, "size": {"50"}}, "highest_admin", false},
 		query{url.Values{"type": {"alphabeticalByArtist"}, "musicFolderId": {"0"}, "size": {"50"}}, "alpha_artist_folder_0", false},
 		query{url.Values{"type": {"alphabeticalByArtist"}, "musicFolderId": {"1"}, "size": {"50"}}, "alpha_artist_folder_1", false},
+		query{url.Values{"type": {"byLabel"}, "label": {"Sub Pop"}, "size": {"50"}}, "by_label_sub_pop", false},
+		query{url.Values{"type": {"byReleaseType"}, "releaseType": {"single"}, "size": {"50"}}, "by_release_type_single", false},
 		query{url.Values{"type": {"garbage"}}, "unknown_type", false},
 	)
 	f.run(t, f.contr.ServeGetAlbumList, f.alt,
@@ -22,29 +22,44 @@ import (
 	"go.senan.xyz/gonic/server/ctrlsubsonic/params"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/spec"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/specid"
+	"go.senan.xyz/gonic/texttree"
 )
 
 func (c *Controller) ServeGetArtists(r *http.Request) *spec.Response {
 	params := r.Context().Value(CtxParams).(params.Params)
 	user := r.Context().Value(CtxUser).(*db.User)
 	var artists []*spec.ArtistRow
-	q := c.dbc.
-		Scopes(spec.LoadArtistByTags(user.ID)).
-		Joins("JOIN album_credits ON album_credits.artist_id=artists.id AND album_credits.role=?", db.RoleAlbumArtist).
-		Order("artists.name COLLATE NOCASE")
-	if m := getMusicFolder(c.musicPaths, params); m != "" {
+	q := c.dbc.DB
+	switch role := params.GetOr("role", db.RoleAlbumArtist); role {
+	case db.RoleAlbumArtist:
 		q = q.
+			Scopes(spec.LoadArtistByTags(user.ID)).
+			Joins("JOIN album_credits ON album_credits.artist_id=artists.id AND album_credits.role=?", db.RoleAlbumArtist).
 			Joins("JOIN albums ON albums.id=album_credits.album_id").
-			Scopes(spec.WithAlbumRootDir(m))
+			Scopes(spec.WithoutDiscsOf)
+	default:
+		// other roles, like composer, are credited per track. count the albums they appear on
+		q = q.
+			Scopes(spec.ArtistWithRolesAndTrackAlbumCount, spec.ArtistWithUserData(user.ID)).
+			Preload("Info").
+			Joins("JOIN track_credits ON track_credits.artist_id=artists.id AND track_credits.role=?", role).
+			Joins("JOIN tracks ON tracks.id=track_credits.track_id").
+			Joins("JOIN albums ON albums.id=tracks.album_id")
 	}
+	q = q.
+		Scopes(spec.WithAlbumRootDir(getMusicFolder(c.musicPaths, params))).
+		Order("artists.name COLLATE NOCASE")
 	if err := q.Find(&artists).Error; err != nil {
 		return spec.NewError(10, "error finding artists: %v", err)
 	}
+	slices.SortStableFunc(artists, func(a, b *spec.ArtistRow) int {
+		return compareSortKeys(sortKey(a.IndexName(), a.SortName), sortKey(b.IndexName(), b.SortName))
+	})
 	// [a-z#] -> 27
 	indexMap := make(map[string]*spec.Index, 27)
 	resp := make([]*spec.Index, 0, 27)
 	for _, artist := range artists {
-		key := lowerUDecOrHash(artist.IndexName())
+		key := lowerUDecOrHash(sortKey(artist.IndexName(), artist.SortName))
 		if _, ok := indexMap[key]; !ok {
 			indexMap[key] = &spec.Index{
 				Name:    key,
@@ -56,7 +71,8 @@ func (c *Controller) ServeGetArtists(r *http.Request) *spec.Response {
 	}
 	sub := spec.NewResponse()
 	sub.Artists = &spec.Artists{
-		List: resp,
+		IgnoredArticles: ignoredArticles,
+		List:            resp,
 	}
 	return sub
 }
@@ -82,12 +98,13 @@ func (c *Controller) ServeGetArtist(r *http.Request) *spec.Response {
 
 	var appearances []*spec.AlbumRow
 	if err := c.dbc.
-		Scopes(spec.LoadAlbumByTags(user.ID)).
+		Scopes(spec.LoadAlbumByTags(user.ID), spec.WithoutDiscsOf).
 		Where(`albums.id IN (
 			SELECT album_id FROM album_credits WHERE artist_id=?
 			UNION
-			SELECT tracks.album_id FROM track_credits
+			SELECT coalesce(albums.disc_of_id, albums.id) FROM track_credits
 				JOIN tracks ON tracks.id=track_credits.track_id
+				JOIN albums ON albums.id=tracks.album_id
 				WHERE track_credits.artist_id=?
 		)`, artist.ID, artist.ID).
 		Order("albums.right_path").
@@ -117,6 +134,14 @@ func (c *Controller) ServeGetAlbum(r *http.Request) *spec.Response {
 		Scopes(spec.LoadAlbumByTags(user.ID)).
 		First(album, id.Value).
 		Error
+	if discOfID := album.DiscOfID; err == nil && discOfID != nil {
+		// a disc of another album, which stands for it by tags
+		album = &spec.AlbumRow{}
+		err = c.dbc.
+			Scopes(spec.LoadAlbumByTags(user.ID)).
+			First(album, *discOfID).
+			Error
+	}
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return spec.NewError(70, "couldn't find an album with that id")
 	}
@@ -124,10 +149,18 @@ func (c *Controller) ServeGetAlbum(r *http.Request) *spec.Response {
 		return spec.NewError(0, "find album: %v", err)
 	}
 
+	var discTitles []*db.AlbumDiscTitle
+	if err := c.dbc.
+		Where("album_id IN (SELECT id FROM albums WHERE disc_of_id=?)", album.ID).
+		Find(&discTitles).Error; err != nil {
+		return spec.NewError(0, "find disc titles: %v", err)
+	}
+	album.DiscTitles = append(album.DiscTitles, discTitles...)
+
 	var tracks []*spec.TrackRow
 	if err := c.dbc.
 		Scopes(spec.LoadTrackByTags(user.ID)).
-		Where("album_id=?", id.Value).
+		Where("album_id IN (SELECT id FROM albums WHERE id=? OR disc_of_id=?)", album.ID, album.ID).
 		Order("tracks.tag_disc_number, tracks.tag_track_number").
 		Find(&tracks).Error; err != nil {
 		return spec.NewError(0, "find album tracks: %v", err)
@@ -141,9 +174,14 @@ func (c *Controller) ServeGetAlbum(r *http.Request) *spec.Response {
 	transcodeMeta := streamGetTranscodeMeta(c.dbc, user.ID, client)
 
 	for i, track := range tracks {
-		sub.Album.Tracks[i] = spec.NewTrackByTags(client, track, &album.Album)
+		trackAlbum := &album.Album
+		if track.AlbumID != album.ID && track.Album != nil {
+			trackAlbum = track.Album // from another disc's folder
+		}
+		sub.Album.Tracks[i] = spec.NewTrackByTags(client, track, trackAlbum)
 		sub.Album.Tracks[i].TranscodeMeta = transcodeMeta
 	}
+	sub.Album.Works = spec.NewAlbumWorks(tracks)
 	return sub
 }
 
@@ -175,6 +213,9 @@ func (c *Controller) ServeGetAlbumListTwo(r *http.Request) *spec.Response {
 		q = q.Joins("JOIN album_genres ON album_genres.album_id=albums.id")
 		q = q.Joins("JOIN genres ON genres.id=album_genres.genre_id AND genres.name=?", genre)
 		q = q.Order("albums.tag_title")
+	case "byLabel", "byReleaseType":
+		// filtered by the label or releaseType parameters below
+		q = q.Order("albums.tag_title")
 	case "frequent":
 		q = q.Having("play_length > 0").Order("play_length DESC")
 	case "newest":
@@ -192,7 +233,7 @@ func (c *Controller) ServeGetAlbumListTwo(r *http.Request) *spec.Response {
 	default:
 		return spec.NewError(10, "unknown value %q for parameter 'type'", listType)
 	}
-	q = q.Scopes(spec.WithAlbumRootDir(getMusicFolder(c.musicPaths, params)))
+	q = q.Scopes(spec.WithoutDiscsOf, spec.WithAlbumRootDir(getMusicFolder(c.musicPaths, params)), spec.WithAlbumAudio(getAudioFilter(params)), spec.WithAlbumTags(getAlbumTagFilter(params)))
 	var albums []*spec.AlbumRow
 	// TODO: think about removing this extra join to count number
 	// of children. it might make sense to store that in the db
@@ -235,6 +276,7 @@ func (c *Controller) ServeSearchThree(r *http.Request) *spec.Response {
 	results := &spec.SearchResultThree{}
 
 	musicFolder := getMusicFolder(c.musicPaths, params)
+	audioFilter := getAudioFilter(params)
 
 	// search artists
 	var artists []*spec.ArtistRow
@@ -250,7 +292,7 @@ func (c *Controller) ServeSearchThree(r *http.Request) *spec.Response {
 	q = q.
 		Joins("JOIN album_credits ON album_credits.artist_id=artists.id AND album_credits.role=?", db.RoleAlbumArtist).
 		Joins("JOIN albums ON albums.id=album_credits.album_id").
-		Scopes(spec.WithAlbumRootDir(musicFolder)).
+		Scopes(spec.WithoutDiscsOf, spec.WithAlbumRootDir(musicFolder)).
 		Offset(params.GetOrInt("artistOffset", 0)).
 		Limit(params.GetOrInt("artistCount", 20))
 	if err := q.Find(&artists).Error; err != nil {
@@ -263,7 +305,7 @@ func (c *Controller) ServeSearchThree(r *http.Request) *spec.Response {
 	// search albums
 	var albums []*spec.AlbumRow
 	q = c.dbc.
-		Scopes(spec.LoadAlbumByTags(user.ID), spec.WithAlbumRootDir(musicFolder))
+		Scopes(spec.LoadAlbumByTags(user.ID), spec.WithoutDiscsOf, spec.WithAlbumRootDir(musicFolder), spec.WithAlbumAudio(audioFilter))
 	switch {
 	case isUUID:
 		q = q.Where(`albums.tag_brainz_id = ?`, query)
@@ -284,7 +326,7 @@ func (c *Controller) ServeSearchThree(r *http.Request) *spec.Response {
 	// search tracks
 	var tracks []*spec.TrackRow
 	q = c.dbc.
-		Scopes(spec.LoadTrackByTags(user.ID))
+		Scopes(spec.LoadTrackByTags(user.ID), spec.WithTrackAudio(audioFilter))
 	switch {
 	case isUUID:
 		q = q.Where(`tracks.tag_brainz_id = ?`, query)
@@ -340,6 +382,14 @@ func (c *Controller) ServeGetArtistInfoTwo(r *http.Request) *spec.Response {
 	sub := spec.NewResponse()
 	sub.ArtistInfoTwo = &spec.ArtistInfo{}
 
+	// a local image is served through getCoverArt, and doesn't need last.fm
+	if artist.ImageFolderID != nil {
+		sub.ArtistInfoTwo.SmallImageURL = c.genArtistCoverURL(r, &artist, 64)
+		sub.ArtistInfoTwo.MediumImageURL = c.genArtistCoverURL(r, &artist, 126)
+		sub.ArtistInfoTwo.LargeImageURL = c.genArtistCoverURL(r, &artist, 256)
+		sub.ArtistInfoTwo.ArtistImageURL = sub.ArtistInfoTwo.LargeImageURL
+	}
+
 	info, err := c.artistInfoCache.GetOrLookup(r.Context(), artist.ID)
 	if err != nil {
 		log.Printf("error fetching artist info from lastfm: %v", err)
@@ -358,7 +408,7 @@ func (c *Controller) ServeGetArtistInfoTwo(r *http.Request) *spec.Response {
 	sub.ArtistInfoTwo.MediumImageURL = c.genArtistCoverURL(r, &artist, 126)
 	sub.ArtistInfoTwo.LargeImageURL = c.genArtistCoverURL(r, &artist, 256)
 
-	if info.ImageURL != "" {
+	if info.ImageURL != "" && artist.ImageFolderID == nil {
 		sub.ArtistInfoTwo.SmallImageURL = info.ImageURL
 		sub.ArtistInfoTwo.MediumImageURL = info.ImageURL
 		sub.ArtistInfoTwo.LargeImageURL = info.ImageURL
@@ -462,16 +512,282 @@ func (c *Controller) ServeGetGenres(_ *http.Request) *spec.Response {
 	if err != nil {
 		return spec.NewError(0, "error finding genres: %v", err)
 	}
+	parents := texttree.Parents(c.scanner.GenreTree())
 	sub := spec.NewResponse()
 	sub.Genres = &spec.Genres{
 		List: make([]*spec.Genre, len(genres)),
 	}
 	for i, genre := range genres {
 		sub.Genres.List[i] = spec.NewGenre(genre)
+		sub.Genres.List[i].Parent = parents[genre.Name]
+	}
+	return sub
+}
+
+// ServeGetGenre shows a genre with its parent and subgenres from the -genre-tree file. genres only in the tree file
+// can be looked up too, so that clients can navigate through parents which aren't tagged on any track
+func (c *Controller) ServeGetGenre(r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
+	name, err := params.Get("name")
+	if err != nil {
+		return spec.NewError(10, "please provide a `name` parameter")
+	}
+
+	tree := c.scanner.GenreTree()
+	var genre spec.GenreRow
+	err = c.dbc.
+		Scopes(spec.GenreWithCounts).
+		Where("genres.name=?", name).
+		First(&genre).
+		Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if _, ok := tree[name]; !ok {
+			return spec.NewError(70, "couldn't find a genre with that name")
+		}
+		genre = spec.GenreRow{Genre: db.Genre{Name: name}}
+	case err != nil:
+		return spec.NewError(0, "find genre: %v", err)
+	}
+
+	parents := texttree.Parents(tree)
+	var childNames []string
+	for _, desc := range tree[name] {
+		if parents[desc] == name {
+			childNames = append(childNames, desc)
+		}
+	}
+	var subgenres []*spec.GenreRow
+	if len(childNames) > 0 {
+		// subgenres without any albums or tracks are left out, they'd be dead ends for clients
+		err := c.dbc.
+			Scopes(spec.GenreWithCounts).
+			Where("genres.name IN (?)", childNames).
+			Order("genres.name").
+			Find(&subgenres).
+			Error
+		if err != nil {
+			return spec.NewError(0, "find subgenres: %v", err)
+		}
+	}
+
+	sub := spec.NewResponse()
+	sub.Genre = &spec.GenreDetail{
+		Name:       genre.Name,
+		SongCount:  genre.TrackCount,
+		AlbumCount: genre.AlbumCount,
+		Parent:     parents[name],
+		Subgenres:  make([]*spec.Genre, 0, len(subgenres)),
+	}
+	if genre.AlbumCount > 0 {
+		sub.Genre.CoverID = genre.SID()
+	}
+	for _, subgenre := range subgenres {
+		g := spec.NewGenre(subgenre)
+		g.Parent = name
+		sub.Genre.Subgenres = append(sub.Genre.Subgenres, g)
 	}
 	return sub
 }
 
+// ServeGetAlbumArtwork lists all the images in an album's folder, and in its other disc folders and the folder above
+// them for multi disc releases, with the kind of each, like front, back, or booklet
+func (c *Controller) ServeGetAlbumArtwork(r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
+	id, err := params.GetID("id")
+	if err != nil || id.Type != specid.Album {
+		return spec.NewError(10, "please provide a valid album id")
+	}
+
+	var album db.Album
+	err = c.dbc.
+		Select("id, parent_id").
+		First(&album, id.Value).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return spec.NewError(70, "couldn't find an album with that id")
+	}
+	if err != nil {
+		return spec.NewError(0, "find album: %v", err)
+	}
+
+	// the album's other disc folders, and the folder above them which often has the release's artwork
+	var discs int
+	if err := c.dbc.Model(db.Album{}).Where("disc_of_id=?", album.ID).Count(&discs).Error; err != nil {
+		return spec.NewError(0, "count discs: %v", err)
+	}
+	folders := c.dbc.
+		Model(db.Album{}).
+		Where("id=? OR disc_of_id=?", album.ID, album.ID)
+	if discs > 0 {
+		folders = folders.Or("id=?", album.ParentID)
+	}
+	var folderIDs []int
+	if err := folders.Pluck("id", &folderIDs).Error; err != nil {
+		return spec.NewError(0, "find album folders: %v", err)
+	}
+
+	var images []*db.AlbumImage
+	err = c.dbc.
+		Where("album_id IN (?)", folderIDs).
+		Order("album_id, id").
+		Find(&images).
+		Error
+	if err != nil {
+		return spec.NewError(0, "find album images: %v", err)
+	}
+
+	sub := spec.NewResponse()
+	sub.AlbumArtwork = &spec.AlbumArtwork{
+		ID:      &id,
+		Artwork: make([]*spec.AlbumImage, 0, len(images)),
+	}
+	for _, i := range images {
+		sub.AlbumArtwork.Artwork = append(sub.AlbumArtwork.Artwork, spec.NewAlbumImage(i))
+	}
+	return sub
+}
+
+// ServeGetLabels lists the record labels of albums, for browsing with getAlbumList2's byLabel type
+func (c *Controller) ServeGetLabels(r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
+	var labels []*spec.Label
+	err := c.dbc.
+		Select("album_labels.label name, count(DISTINCT albums.id) album_count").
+		Table("album_labels").
+		Joins("JOIN albums ON albums.id=album_labels.album_id").
+		Scopes(spec.WithoutDiscsOf, spec.WithAlbumRootDir(getMusicFolder(c.musicPaths, params))).
+		Group("album_labels.label COLLATE NOCASE").
+		Order("album_labels.label COLLATE NOCASE").
+		Scan(&labels).
+		Error
+	if err != nil {
+		return spec.NewError(0, "error finding labels: %v", err)
+	}
+	sub := spec.NewResponse()
+	sub.Labels = &spec.Labels{List: labels}
+	return sub
+}
+
+func (c *Controller) ServeGetWorks(r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
+	q := c.dbc.
+		Scopes(spec.WorkWithCounts, spec.WithAlbumRootDir(getMusicFolder(c.musicPaths, params))).
+		Order("works.name COLLATE NOCASE")
+	if artistID, err := params.GetID("artistId"); err == nil {
+		// the works of a composer, across all their performances
+		q = q.Where("works.id IN (SELECT tracks.work_id FROM tracks JOIN track_credits ON track_credits.track_id=tracks.id WHERE track_credits.artist_id=? AND track_credits.role=?)",
+			artistID.Value, db.RoleComposer)
+	}
+	var works []*spec.WorkRow
+	if err := q.Find(&works).Error; err != nil {
+		return spec.NewError(0, "error finding works: %v", err)
+	}
+	composers, err := workComposers(c.dbc, works)
+	if err != nil {
+		return spec.NewError(0, "error finding work composers: %v", err)
+	}
+	sub := spec.NewResponse()
+	sub.Works = &spec.Works{
+		List: make([]*spec.Work, len(works)),
+	}
+	for i, work := range works {
+		sub.Works.List[i] = spec.NewWorkByTags(work, composers[work.ID])
+	}
+	return sub
+}
+
+func (c *Controller) ServeGetWork(r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
+	user := r.Context().Value(CtxUser).(*db.User)
+	id, err := params.GetID("id")
+	if err != nil || id.Type != specid.Work {
+		return spec.NewError(10, "please provide a work `id` parameter")
+	}
+	var work spec.WorkRow
+	if err := c.dbc.
+		Scopes(spec.WorkWithCounts).
+		Where("works.id=?", id.Value).
+		First(&work).
+		Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return spec.NewError(70, "couldn't find a work with that id")
+		}
+		return spec.NewError(0, "find work: %v", err)
+	}
+	composers, err := workComposers(c.dbc, []*spec.WorkRow{&work})
+	if err != nil {
+		return spec.NewError(0, "find work composers: %v", err)
+	}
+
+	var albums []*spec.AlbumRow
+	if err := c.dbc.
+		Scopes(spec.LoadAlbumByTags(user.ID), spec.WithoutDiscsOf).
+		Where(`albums.id IN (
+			SELECT coalesce(albums.disc_of_id, albums.id) FROM tracks
+				JOIN albums ON albums.id=tracks.album_id
+				WHERE tracks.work_id=?
+		)`, work.ID).
+		Order("albums.right_path").
+		Find(&albums).Error; err != nil {
+		return spec.NewError(0, "find work albums: %v", err)
+	}
+
+	var tracks []*spec.TrackRow
+	if err := c.dbc.
+		Scopes(spec.LoadTrackByTags(user.ID)).
+		Joins("JOIN albums ON albums.id=tracks.album_id").
+		Where("tracks.work_id=?", work.ID).
+		Order("albums.right_path, tracks.tag_disc_number, tracks.tag_track_number").
+		Find(&tracks).Error; err != nil {
+		return spec.NewError(0, "find work tracks: %v", err)
+	}
+
+	client := params.GetOr("c", "")
+	transcodeMeta := streamGetTranscodeMeta(c.dbc, user.ID, client)
+
+	sub := spec.NewResponse()
+	sub.Work = spec.NewWorkByTags(&work, composers[work.ID])
+	sub.Work.Albums = make([]*spec.Album, len(albums))
+	for i, album := range albums {
+		sub.Work.Albums[i] = spec.NewAlbumByTags(album, album.Credits)
+	}
+	sub.Work.Tracks = make([]*spec.TrackChild, len(tracks))
+	for i, track := range tracks {
+		sub.Work.Tracks[i] = spec.NewTrackByTags(client, track, track.Album)
+		sub.Work.Tracks[i].TranscodeMeta = transcodeMeta
+	}
+	return sub
+}
+
+// workComposers finds the artists credited as composer on the tracks of each work
+func workComposers(dbc *db.DB, works []*spec.WorkRow) (map[int][]*db.Artist, error) {
+	ids := make([]int, 0, len(works))
+	for _, w := range works {
+		ids = append(ids, w.ID)
+	}
+	var rows []*struct {
+		WorkID int
+		db.Artist
+	}
+	if err := dbc.
+		Select("DISTINCT tracks.work_id, artists.*").
+		Table("artists").
+		Joins("JOIN track_credits ON track_credits.artist_id=artists.id AND track_credits.role=?", db.RoleComposer).
+		Joins("JOIN tracks ON tracks.id=track_credits.track_id").
+		Where("tracks.work_id IN (?)", ids).
+		Order("artists.name").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	ret := make(map[int][]*db.Artist, len(works))
+	for _, r := range rows {
+		artist := r.Artist
+		ret[r.WorkID] = append(ret[r.WorkID], &artist)
+	}
+	return ret, nil
+}
+
 func (c *Controller) ServeGetSongsByGenre(r *http.Request) *spec.Response {
 	params := r.Context().Value(CtxParams).(params.Params)
 	user := r.Context().Value(CtxUser).(*db.User)
@@ -522,6 +838,7 @@ func (c *Controller) ServeGetStarredTwo(r *http.Request) *spec.Response {
 		Where("artist_stars.user_id=?", user.ID).
 		Joins("JOIN album_credits ON album_credits.artist_id=artists.id AND album_credits.role=?", db.RoleAlbumArtist).
 		Joins("JOIN albums ON albums.id=album_credits.album_id").
+		Scopes(spec.WithoutDiscsOf).
 		Order("artist_stars.star_date DESC")
 	if err := q.Find(&artists).Error; err != nil {
 		return spec.NewError(0, "find artists: %v", err)
@@ -715,12 +1032,12 @@ func getSimilarSongsFromTrack(c *Controller, id specid.ID, params params.Params,
 
 	similarTracks, err := c.lastFMClient.TrackGetSimilarTracks(track.TagTrackArtist, track.TagTitle)
 	if err != nil {
-		log.Printf("error fetching similar songs from lastfm: %v", err)
-		return nil, spec.NewResponse()
+		log.Printf("error fetching similar songs from lastfm, using local radio: %v", err)
+		return getSimilarSongsFromRadio(c, id, params, user, count)
 	}
 
 	if len(similarTracks.Tracks) == 0 {
-		return nil, spec.NewError(70, "no similar songs found for track: %v", track.TagTitle)
+		return getSimilarSongsFromRadio(c, id, params, user, count)
 	}
 
 	titleArtistPairs := make([][]any, 0, len(similarTracks.Tracks))
@@ -740,7 +1057,7 @@ func getSimilarSongsFromTrack(c *Controller, id specid.ID, params params.Params,
 		return nil, spec.NewError(0, "error finding tracks: %v", err)
 	}
 	if len(tracks) == 0 {
-		return nil, spec.NewError(70, "no similar song could be match with collection in database: %v", track.TagTitle)
+		return getSimilarSongsFromRadio(c, id, params, user, count)
 	}
 
 	trackChildren := make([]*spec.TrackChild, len(tracks))
@@ -770,11 +1087,11 @@ func getSimilarSongsFromArtist(c *Controller, id specid.ID, params params.Params
 
 	similarArtists, err := c.lastFMClient.ArtistGetSimilar(artist.Name)
 	if err != nil {
-		log.Printf("error fetching artist info from lastfm: %v", err)
-		return nil, spec.NewResponse()
+		log.Printf("error fetching artist info from lastfm, using local radio: %v", err)
+		return getSimilarSongsFromRadio(c, id, params, user, count)
 	}
 	if len(similarArtists.Artists) == 0 {
-		return nil, spec.NewError(0, "no similar artist found for: %v", artist.Name)
+		return getSimilarSongsFromRadio(c, id, params, user, count)
 	}
 
 	artistNames := make([]string, len(similarArtists.Artists))
@@ -797,7 +1114,7 @@ func getSimilarSongsFromArtist(c *Controller, id specid.ID, params params.Params
 		return nil, spec.NewError(0, "error finding tracks: %v", err)
 	}
 	if len(tracks) == 0 {
-		return nil, spec.NewError(70, "no similar song could be match with collection in database: %v", artist.Name)
+		return getSimilarSongsFromRadio(c, id, params, user, count)
 	}
 
 	trackChildren := make([]*spec.TrackChild, len(tracks))
@@ -842,7 +1159,7 @@ func getSimilarSongsFromAlbum(c *Controller, id specid.ID, params params.Params,
 	}
 
 	if len(similarTracks.Tracks) == 0 {
-		return nil, spec.NewError(0, "no similar songs found for album: %v", album.TagTitle)
+		return getSimilarSongsFromRadio(c, id, params, user, count)
 	}
 
 	titleArtistPairs := make([][]any, 0, len(similarTracks.Tracks))
@@ -862,7 +1179,7 @@ func getSimilarSongsFromAlbum(c *Controller, id specid.ID, params params.Params,
 		return nil, spec.NewError(0, "error finding tracks: %v", err)
 	}
 	if len(tracks) == 0 {
-		return nil, spec.NewError(70, "no similar songs could be matched with collection in database: %v", album.TagTitle)
+		return getSimilarSongsFromRadio(c, id, params, user, count)
 	}
 
 	trackChildren := make([]*spec.TrackChild, len(tracks))
@@ -12,6 +12,7 @@ func TestGetArtists(t *testing.T) {
 		query{url.Values{}, "no_args", false},
 		query{url.Values{"musicFolderId": {"0"}}, "music_folder_0", false},
 		query{url.Values{"musicFolderId": {"1"}}, "music_folder_1", false},
+		query{url.Values{"role": {"composer"}}, "role_composer", false},
 	)
 }
 
@@ -64,6 +65,10 @@ func TestGetAlbumListTwo(t *testing.T) {
 		// composes correctly after the type-specific joins
 		query{url.Values{"type": {"alphabeticalByArtist"}, "musicFolderId": {"0"}, "size": {"50"}}, "alpha_artist_folder_0", false},
 		query{url.Values{"type": {"alphabeticalByArtist"}, "musicFolderId": {"1"}, "size": {"50"}}, "alpha_artist_folder_1", false},
+		query{url.Values{"type": {"alphabeticalByName"}, "minBitDepth": {"24"}, "size": {"50"}}, "alpha_name_hi_res", false},
+		query{url.Values{"type": {"byLabel"}, "label": {"domino"}, "size": {"50"}}, "by_label_domino", false},
+		query{url.Values{"type": {"byReleaseType"}, "releaseType": {"ep", "single"}, "size": {"50"}}, "by_release_type_ep_single", false},
+		query{url.Values{"type": {"alphabeticalByName"}, "excludeReleaseType": {"single"}, "size": {"50"}}, "alpha_name_no_singles", false},
 		query{url.Values{"type": {"garbage"}}, "unknown_type", false},
 	)
 	// alt has divergent stars/ratings -- different output proves user_id scoping
@@ -84,6 +89,7 @@ func TestSearchThree(t *testing.T) {
 		// UUID query takes the tag_brainz_id branch instead of fuzzy LIKE
 		query{url.Values{"query": {"00000000-0000-0000-0000-0000000000aa"}}, "q_uuid_album", false},
 		query{url.Values{"query": {"album"}, "musicFolderId": {"1"}}, "q_album_folder_1", false},
+		query{url.Values{"query": {"\"\""}, "minSamplingRate": {"96000"}}, "q_empty_all_hi_res", false},
 	)
 }
 
@@ -108,6 +114,54 @@ func TestGetGenres(t *testing.T) {
 	)
 }
 
+func TestGetGenre(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	f.run(t, f.contr.ServeGetGenre, f.admin,
+		query{url.Values{"name": {"Popular"}}, "popular", false},
+		query{url.Values{"name": {"Rock"}}, "rock", false},
+		query{url.Values{"name": {"Jazz"}}, "jazz", false},
+		query{url.Values{"name": {"Not A Genre"}}, "missing", false},
+	)
+}
+
+func TestGetAlbumArtwork(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	f.run(t, f.contr.ServeGetAlbumArtwork, f.admin,
+		query{url.Values{"id": {f.albumAB.SID().String()}}, "album_ab", false},
+		query{url.Values{"id": {f.albumAA.SID().String()}}, "album_aa_none", false},
+		query{url.Values{"id": {"al-9999"}}, "missing", false},
+	)
+}
+
+func TestGetLabels(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	f.run(t, f.contr.ServeGetLabels, f.admin,
+		query{url.Values{}, "all", false},
+	)
+}
+
+func TestGetWorks(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	f.run(t, f.contr.ServeGetWorks, f.admin,
+		query{url.Values{}, "all", false},
+		query{url.Values{"artistId": {f.compA.SID().String()}}, "composer_a", false},
+		query{url.Values{"artistId": {f.artistB.SID().String()}}, "artist_b_none", false},
+	)
+}
+
+func TestGetWork(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	f.run(t, f.contr.ServeGetWork, f.admin,
+		query{url.Values{"id": {f.workAB.SID().String()}}, "work_ab", false},
+		query{url.Values{"id": {"wk-999"}}, "not_found", false},
+	)
+}
+
 func TestGetSongsByGenre(t *testing.T) {
 	t.Parallel()
 	f := newFixture(t)
@@ -47,6 +47,9 @@ func (c *Controller) ServeGetOpenSubsonicExtensions(_ *http.Request) *spec.Respo
 		{Name: "transcodeOffset", Versions: []int{1}},
 		{Name: "formPost", Versions: []int{1}},
 		{Name: "songLyrics", Versions: []int{1}},
+		{Name: "albumTagFilters", Versions: []int{1}},
+		{Name: "genreTree", Versions: []int{1}},
+		{Name: "albumArtwork", Versions: []int{1}},
 	}
 	return sub
 }
@@ -62,6 +65,9 @@ func (c *Controller) ServeScrobble(r *http.Request) *spec.Response {
 
 	optStamp := params.GetOrTime("time", time.Now())
 	optSubmission := params.GetOrBool("submission", true)
+	// gonic extension: clients can report how far (in ms) into a partial play they got, for resuming later
+	optPosition, positionErr := params.GetInt("position")
+	hasPosition := positionErr == nil
 
 	var scrobbleTrack scrobble.Track
 
@@ -105,6 +111,17 @@ func (c *Controller) ServeScrobble(r *http.Request) *spec.Response {
 		return spec.NewError(0, "can't scrobble type %s", id.Type)
 	}
 
+	switch {
+	case hasPosition:
+		if err := updateResumePosition(c.dbc, user.ID, id, optPosition); err != nil {
+			return spec.NewError(0, "error updating resume position: %v", err)
+		}
+	case optSubmission:
+		if err := resumeFromBookmark(c.dbc, user.ID, id); err != nil {
+			return spec.NewError(0, "error updating resume position: %v", err)
+		}
+	}
+
 	if scrobbleTrack.Track == "" {
 		return spec.NewResponse()
 	}
@@ -152,8 +169,35 @@ func (c *Controller) ServeStartScan(r *http.Request) *spec.Response {
 	if !user.IsAdmin {
 		return spec.NewError(50, "user not admin")
 	}
+	params := r.Context().Value(CtxParams).(params.Params)
+
+	// gonic extension: limit the scan to some folders, by path or by folder/track id
+	var opts scanner.ScanOptions
+	opts.Paths = params.GetOrList("path", nil)
+	for _, id := range params.GetOrIDList("id", nil) {
+		switch id.Type {
+		case specid.Album:
+			var album db.Album
+			if err := c.dbc.First(&album, id.Value).Error; err != nil {
+				return spec.NewError(70, "folder with id %q not found", id)
+			}
+			opts.Paths = append(opts.Paths, album.AbsPath())
+		case specid.Track:
+			var track db.Track
+			if err := c.dbc.Preload("Album").First(&track, id.Value).Error; err != nil {
+				return spec.NewError(70, "track with id %q not found", id)
+			}
+			opts.Paths = append(opts.Paths, track.AbsPath())
+		default:
+			return spec.NewError(10, "can't scan id %q, please provide a folder or track id", id)
+		}
+	}
+	if err := c.scanner.CheckPaths(opts.Paths); err != nil {
+		return spec.NewError(10, "invalid scan path: %v", err)
+	}
+
 	go func() {
-		if _, err := c.scanner.ScanAndClean(scanner.ScanOptions{}); err != nil {
+		if _, err := c.scanner.ScanAndClean(opts); err != nil {
 			log.Printf("error while scanning: %v\n", err)
 		}
 	}()
@@ -171,6 +215,20 @@ func (c *Controller) ServeGetScanStatus(_ *http.Request) *spec.Response {
 		Scanning: c.scanner.IsScanning(),
 		Count:    trackCount,
 	}
+	if progress, ok := c.scanner.Progress(); ok {
+		sub.ScanStatus.FolderCount = progress.DirsVisited
+		sub.ScanStatus.FolderTotal = progress.DirsTotal
+		sub.ScanStatus.TracksNew = progress.TracksNew
+		sub.ScanStatus.TracksUpdated = progress.TracksUpdated
+		sub.ScanStatus.TracksRemoved = progress.TracksRemoved
+		sub.ScanStatus.Errors = progress.Errors
+		sub.ScanStatus.CurrentPath = progress.CurrentPath
+		sub.ScanStatus.ElapsedSecs = int(progress.Elapsed().Seconds())
+		sub.ScanStatus.ETASecs = int(progress.ETA().Seconds())
+		if !progress.Finished.IsZero() {
+			sub.ScanStatus.LastScan = &progress.Finished
+		}
+	}
 	return sub
 }
 
@@ -790,6 +848,51 @@ func getMusicFolder(musicPaths []MusicPath, p params.Params) string {
 	return musicPaths[idx].Path
 }
 
+// getAudioFilter reads the optional audio property filters, like minBitDepth=24 for hi-res only
+func getAudioFilter(p params.Params) spec.AudioFilter {
+	return spec.AudioFilter{
+		MinSampleRate: p.GetOrInt("minSamplingRate", 0),
+		MinBitDepth:   p.GetOrInt("minBitDepth", 0),
+		Channels:      p.GetOrInt("channelCount", 0),
+		Codec:         strings.ToLower(p.GetOr("codec", "")),
+	}
+}
+
+// getAlbumTagFilter reads the optional album tag filters, like excludeReleaseType=single to hide singles
+func getAlbumTagFilter(p params.Params) spec.AlbumTagFilter {
+	f := spec.AlbumTagFilter{
+		Label:               p.GetOr("label", ""),
+		ReleaseTypes:        p.GetOrList("releaseType", nil),
+		ExcludeReleaseTypes: p.GetOrList("excludeReleaseType", nil),
+		Version:             p.GetOr("version", ""),
+	}
+	if compilation, err := p.GetBool("compilation"); err == nil {
+		f.Compilation = &compilation
+	}
+	return f
+}
+
+// ignoredArticles are skipped at the start of names with no sort name of their own, when sorting and indexing
+const ignoredArticles = "The El La Los Las Le Les"
+
+// sortKey is what a name is sorted and indexed by. its sort name if it has one, otherwise the name without any ignored
+// article in front, so "The Beatles" goes under B
+func sortKey(name, sortName string) string {
+	if sortName != "" {
+		return sortName
+	}
+	for _, article := range strings.Fields(ignoredArticles) {
+		if len(name) > len(article)+1 && strings.EqualFold(name[:len(article)+1], article+" ") {
+			return name[len(article)+1:]
+		}
+	}
+	return name
+}
+
+func compareSortKeys(a, b string) int {
+	return cmp.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
 func lowerUDecOrHash(in string) string {
 	inRunes := []rune(in)
 	if len(inRunes) == 0 {
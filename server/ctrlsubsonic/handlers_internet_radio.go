@@ -5,11 +5,13 @@ import (
 	"net/url"
 
 	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/handlerutil"
+	"go.senan.xyz/gonic/icy"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/params"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/spec"
 )
 
-func (c *Controller) ServeGetInternetRadioStations(_ *http.Request) *spec.Response {
+func (c *Controller) ServeGetInternetRadioStations(r *http.Request) *spec.Response {
 	var stations []*db.InternetRadioStation
 	if err := c.dbc.Find(&stations).Error; err != nil {
 		return spec.NewError(0, "find stations: %v", err)
@@ -20,10 +22,36 @@ func (c *Controller) ServeGetInternetRadioStations(_ *http.Request) *spec.Respon
 	}
 	for i, station := range stations {
 		sub.InternetRadioStations.List[i] = spec.NewInternetRadioStation(station)
+		if station.Proxy {
+			sub.InternetRadioStations.List[i].StreamURL = c.genInternetRadioStationProxyURL(r, station)
+		}
+		if np, ok := c.radioTitles.Get(station.ID); ok {
+			artist, title := icy.SplitTitle(np.StreamTitle)
+			sub.InternetRadioStations.List[i].NowPlaying = &spec.InternetRadioStationPlayed{
+				StreamTitle: np.StreamTitle,
+				Artist:      artist,
+				Title:       title,
+				Changed:     spec.Time{Time: np.Changed},
+			}
+		}
 	}
 	return sub
 }
 
+// genInternetRadioStationProxyURL points clients at the proxy instead of the station. like cover art urls, it carries the
+// caller's own auth params so that clients which only know how to play a plain url still work
+func (c *Controller) genInternetRadioStationProxyURL(r *http.Request, station *db.InternetRadioStation) string {
+	streamURL, _ := url.Parse(handlerutil.BaseURL(r))
+	streamURL.Path = c.resolveProxyPath("/rest/streamInternetRadioStation")
+
+	query := r.URL.Query()
+	query.Del("f")
+	query.Set("id", station.SID().String())
+	streamURL.RawQuery = query.Encode()
+
+	return streamURL.String()
+}
+
 func (c *Controller) ServeCreateInternetRadioStation(r *http.Request) *spec.Response {
 	user := r.Context().Value(CtxUser).(*db.User)
 	if !user.IsAdmin {
@@ -54,6 +82,7 @@ func (c *Controller) ServeCreateInternetRadioStation(r *http.Request) *spec.Resp
 	station.StreamURL = streamURL
 	station.Name = name
 	station.HomepageURL = homepageURL
+	station.Proxy = params.GetOrBool("proxy", false)
 
 	if err := c.dbc.Save(&station).Error; err != nil {
 		return spec.NewError(0, "save station: %v", err)
@@ -99,6 +128,7 @@ func (c *Controller) ServeUpdateInternetRadioStation(r *http.Request) *spec.Resp
 	station.StreamURL = streamURL
 	station.Name = name
 	station.HomepageURL = homepageURL
+	station.Proxy = params.GetOrBool("proxy", station.Proxy)
 
 	if err := c.dbc.Save(&station).Error; err != nil {
 		return spec.NewError(0, "save station: %v", err)
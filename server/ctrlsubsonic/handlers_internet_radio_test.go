@@ -1,8 +1,17 @@
 package ctrlsubsonic
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/icy"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/spec"
 )
 
 const (
@@ -104,3 +113,63 @@ func TestInternetRadio(t *testing.T) {
 	)
 	get("after_delete_station2")
 }
+
+func TestInternetRadioProxy(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+
+	// a stub station sending 4 bytes of audio between each ICY metadata block
+	station := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(icy.RequestHeader) != "1" {
+			http.Error(w, "expected icy metadata request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("icy-metaint", "4")
+		meta := "StreamTitle='Artist A - Song A';"
+		block := make([]byte, 1+32)
+		block[0] = 2
+		copy(block[1:], meta)
+		_, _ = w.Write([]byte("abcd"))
+		_, _ = w.Write(block)
+		_, _ = w.Write([]byte("efgh"))
+	}))
+	t.Cleanup(station.Close)
+
+	require.NoError(t, f.dbc.Save(&db.InternetRadioStation{Name: "direct", StreamURL: station.URL}).Error)
+	proxied := db.InternetRadioStation{Name: "proxied", StreamURL: station.URL, Proxy: true}
+	require.NoError(t, f.dbc.Save(&proxied).Error)
+
+	stream := func(id string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr, req := makeHTTPMock(url.Values{"id": {id}}, f.admin)
+		respRaw(f.contr.ServeStreamInternetRadioStation).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := stream("ir-1")
+	require.Contains(t, rr.Body.String(), "is not proxied")
+
+	rr = stream(proxied.SID().String())
+	require.Equal(t, "abcdefgh", rr.Body.String())
+	require.Equal(t, "audio/mpeg", rr.Header().Get("Content-Type"))
+
+	var resp struct {
+		Response spec.Response `json:"subsonic-response"`
+	}
+	body := f.query(t, f.contr.ServeGetInternetRadioStations, f.admin, url.Values{})
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	stations := resp.Response.InternetRadioStations.List
+	require.Len(t, stations, 2)
+
+	require.Equal(t, station.URL, stations[0].StreamURL)
+	require.Nil(t, stations[0].NowPlaying)
+
+	require.True(t, stations[1].Proxy)
+	require.Contains(t, stations[1].StreamURL, "/rest/streamInternetRadioStation")
+	require.Contains(t, stations[1].StreamURL, "id=ir-2")
+	require.NotNil(t, stations[1].NowPlaying)
+	require.Equal(t, "Artist A - Song A", stations[1].NowPlaying.StreamTitle)
+	require.Equal(t, "Artist A", stations[1].NowPlaying.Artist)
+	require.Equal(t, "Song A", stations[1].NowPlaying.Title)
+}
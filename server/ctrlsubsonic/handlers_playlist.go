@@ -223,6 +223,7 @@ func playlistRender(c *Controller, params paramsp.Params, playlist *playlistp.Pl
 
 	resp := &spec.Playlist{
 		ID:        playlistID,
+		CoverID:   playlistID,
 		Name:      playlist.Name,
 		Comment:   playlist.Comment,
 		Created:   playlist.UpdatedAt,
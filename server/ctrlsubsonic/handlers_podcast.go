@@ -1,6 +1,7 @@
 package ctrlsubsonic
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/mmcdole/gofeed"
@@ -13,6 +14,7 @@ import (
 
 func (c *Controller) ServeGetPodcasts(r *http.Request) *spec.Response {
 	params := r.Context().Value(CtxParams).(params.Params)
+	user := r.Context().Value(CtxUser).(*db.User)
 	isIncludeEpisodes := params.GetOrBool("includeEpisodes", true)
 	id := params.GetOrID("id", specid.ID{})
 	podcasts, err := c.podcasts.GetPodcastOrAll(id.Value, isIncludeEpisodes)
@@ -21,15 +23,21 @@ func (c *Controller) ServeGetPodcasts(r *http.Request) *spec.Response {
 	}
 	sub := spec.NewResponse()
 	sub.Podcasts = &spec.Podcasts{}
+	var episodes []*spec.PodcastEpisode
 	for _, podcast := range podcasts {
 		channel := spec.NewPodcastChannel(podcast)
 		sub.Podcasts.List = append(sub.Podcasts.List, channel)
+		episodes = append(episodes, channel.Episode...)
+	}
+	if err := fillPodcastEpisodeUserState(c.dbc, user.ID, episodes); err != nil {
+		return spec.NewError(0, "failed to find played episodes: %s", err)
 	}
 	return sub
 }
 
 func (c *Controller) ServeGetNewestPodcasts(r *http.Request) *spec.Response {
 	params := r.Context().Value(CtxParams).(params.Params)
+	user := r.Context().Value(CtxUser).(*db.User)
 	count := params.GetOrInt("count", 10)
 	episodes, err := c.podcasts.GetNewestPodcastEpisodes(count)
 	if err != nil {
@@ -40,6 +48,9 @@ func (c *Controller) ServeGetNewestPodcasts(r *http.Request) *spec.Response {
 	for _, episode := range episodes {
 		sub.NewestPodcasts.List = append(sub.NewestPodcasts.List, spec.NewPodcastEpisode(episode))
 	}
+	if err := fillPodcastEpisodeUserState(c.dbc, user.ID, sub.NewestPodcasts.List); err != nil {
+		return spec.NewError(0, "failed to find played episodes: %s", err)
+	}
 	return sub
 }
 
@@ -119,3 +130,41 @@ func (c *Controller) ServeDeletePodcastEpisode(r *http.Request) *spec.Response {
 	}
 	return spec.NewResponse()
 }
+
+// fillPodcastEpisodeUserState sets whether the user has played each episode, and where they're up to if not
+func fillPodcastEpisodeUserState(dbc *db.DB, userID int, episodes []*spec.PodcastEpisode) error {
+	if len(episodes) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(episodes))
+	for _, pe := range episodes {
+		ids = append(ids, pe.ID.Value)
+	}
+
+	var played []*db.PodcastEpisodePlayed
+	if err := dbc.Where("user_id=? AND podcast_episode_id IN (?)", userID, ids).Find(&played).Error; err != nil {
+		return fmt.Errorf("find played: %w", err)
+	}
+	var bookmarks []*db.Bookmark
+	err := dbc.
+		Where("user_id=? AND entry_id_type=? AND entry_id IN (?)", userID, db.BookmarkEntryPodcastEpisode, ids).
+		Find(&bookmarks).
+		Error
+	if err != nil {
+		return fmt.Errorf("find bookmarks: %w", err)
+	}
+
+	playedIDs := map[int]struct{}{}
+	for _, p := range played {
+		playedIDs[p.PodcastEpisodeID] = struct{}{}
+	}
+	positions := map[int]int{}
+	for _, b := range bookmarks {
+		positions[b.EntryID] = b.Position
+	}
+	for _, pe := range episodes {
+		_, pe.Played = playedIDs[pe.ID.Value]
+		pe.BookmarkPosition = positions[pe.ID.Value]
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+package ctrlsubsonic
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"go.senan.xyz/gonic/db"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/params"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/spec"
+	"go.senan.xyz/gonic/server/ctrlsubsonic/specid"
+)
+
+// weights for how a candidate track relates to the radio seed. a track can match
+// on more than one, in which case the weights are summed
+const (
+	radioWeightGenre          = 2.0
+	radioWeightGenreInherited = 1.0 // matched through the -genre-tree hierarchy
+	radioWeightArtist         = 3.0
+	radioWeightRelatedArtist  = 2.0
+)
+
+// tracks the user played this recently are skipped so that repeated calls keep
+// moving through the library instead of returning what's already been heard
+const radioRecentlyPlayed = 6 * time.Hour
+
+var errRadioSeedNotFound = errors.New("radio seed not found")
+
+// radioSeed is what a radio station is built from. the seed tracks themselves
+// are never returned
+type radioSeed struct {
+	trackIDs  []int
+	genreIDs  []int
+	artistIDs []int
+}
+
+// ServeGetRadio returns an endless, non-repeating queue of tracks related to a
+// track, album, artist, or genre using only local data. clients can pass the
+// ids they've already queued with `exclude` to keep pulling new tracks.
+func (c *Controller) ServeGetRadio(r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
+	user := r.Context().Value(CtxUser).(*db.User)
+	count := params.GetOrInt("count", 10)
+
+	var seed radioSeed
+	var err error
+	if genre, gerr := params.Get("genre"); gerr == nil {
+		seed, err = radioSeedFromGenre(c.dbc, genre)
+	} else if id, ierr := params.GetID("id"); ierr == nil {
+		seed, err = radioSeedFromID(c.dbc, id)
+	} else {
+		return spec.NewError(10, "please provide a track, album, or artist `id`, or a `genre` parameter")
+	}
+	if errors.Is(err, errRadioSeedNotFound) {
+		return spec.NewError(70, "couldn't find a radio seed with that id or genre")
+	}
+	if err != nil {
+		return spec.NewError(0, "find radio seed: %v", err)
+	}
+
+	var exclude []int
+	for _, id := range params.GetOrIDList("exclude", nil) {
+		if id.Type == specid.Track {
+			exclude = append(exclude, id.Value)
+		}
+	}
+
+	tracks, err := radioTracks(c.dbc, user, seed, exclude, getMusicFolder(c.musicPaths, params), count)
+	if err != nil {
+		return spec.NewError(0, "build radio: %v", err)
+	}
+
+	client := params.GetOr("c", "")
+	transcodeMeta := streamGetTranscodeMeta(c.dbc, user.ID, client)
+
+	sub := spec.NewResponse()
+	sub.Radio = &spec.Radio{
+		Tracks: make([]*spec.TrackChild, len(tracks)),
+	}
+	for i, track := range tracks {
+		sub.Radio.Tracks[i] = spec.NewTrackByTags(client, track, track.Album)
+		sub.Radio.Tracks[i].TranscodeMeta = transcodeMeta
+	}
+	return sub
+}
+
+// getSimilarSongsFromRadio is used by getSimilarSongs and getSimilarSongs2 when last.fm can't help,
+// for example when there is no api key set
+func getSimilarSongsFromRadio(c *Controller, id specid.ID, params params.Params, user *db.User, count int) ([]*spec.TrackChild, *spec.Response) {
+	seed, err := radioSeedFromID(c.dbc, id)
+	if errors.Is(err, errRadioSeedNotFound) {
+		return nil, spec.NewError(70, "couldn't find an item with that id")
+	}
+	if err != nil {
+		return nil, spec.NewError(0, "find radio seed: %v", err)
+	}
+	tracks, err := radioTracks(c.dbc, user, seed, nil, getMusicFolder(c.musicPaths, params), count)
+	if err != nil {
+		return nil, spec.NewError(0, "build radio: %v", err)
+	}
+
+	client := params.GetOr("c", "")
+	transcodeMeta := streamGetTranscodeMeta(c.dbc, user.ID, client)
+
+	trackChildren := make([]*spec.TrackChild, len(tracks))
+	for i, track := range tracks {
+		trackChildren[i] = spec.NewTrackByTags(client, track, track.Album)
+		trackChildren[i].TranscodeMeta = transcodeMeta
+	}
+	return trackChildren, nil
+}
+
+func radioSeedFromID(dbc *db.DB, id specid.ID) (radioSeed, error) {
+	var seed radioSeed
+	switch id.Type {
+	case specid.Track:
+		var track db.Track
+		if err := dbc.Where("id=?", id.Value).First(&track).Error; err != nil {
+			return seed, radioSeedErr(err)
+		}
+		seed.trackIDs = []int{track.ID}
+	case specid.Album:
+		var album db.Album
+		if err := dbc.Where("id=?", id.Value).First(&album).Error; err != nil {
+			return seed, radioSeedErr(err)
+		}
+		if err := dbc.Model(db.Track{}).Where("album_id=?", album.ID).Pluck("id", &seed.trackIDs).Error; err != nil {
+			return seed, fmt.Errorf("find album tracks: %w", err)
+		}
+		if err := dbc.Model(db.AlbumCredit{}).Where("album_id=?", album.ID).Pluck("DISTINCT artist_id", &seed.artistIDs).Error; err != nil {
+			return seed, fmt.Errorf("find album credits: %w", err)
+		}
+	case specid.Artist:
+		var artist db.Artist
+		if err := dbc.Where("id=?", id.Value).First(&artist).Error; err != nil {
+			return seed, radioSeedErr(err)
+		}
+		seed.artistIDs = []int{artist.ID}
+		err := dbc.
+			Model(db.TrackGenre{}).
+			Joins("JOIN track_credits ON track_credits.track_id=track_genres.track_id").
+			Where("track_credits.artist_id=?", artist.ID).
+			Pluck("DISTINCT track_genres.genre_id", &seed.genreIDs).
+			Error
+		if err != nil {
+			return seed, fmt.Errorf("find artist genres: %w", err)
+		}
+		return seed, nil
+	default:
+		return seed, fmt.Errorf("unsupported radio seed type %q", id.Type)
+	}
+
+	if err := dbc.Model(db.TrackGenre{}).Where("track_id IN (?)", defaultIDs(seed.trackIDs)).Pluck("DISTINCT genre_id", &seed.genreIDs).Error; err != nil {
+		return seed, fmt.Errorf("find track genres: %w", err)
+	}
+	var trackArtistIDs []int
+	if err := dbc.Model(db.TrackCredit{}).Where("track_id IN (?)", defaultIDs(seed.trackIDs)).Pluck("DISTINCT artist_id", &trackArtistIDs).Error; err != nil {
+		return seed, fmt.Errorf("find track credits: %w", err)
+	}
+	seed.artistIDs = uniqueInts(slices.Concat(seed.artistIDs, trackArtistIDs))
+	return seed, nil
+}
+
+func radioSeedFromGenre(dbc *db.DB, name string) (radioSeed, error) {
+	var genre db.Genre
+	if err := dbc.Where("name=?", name).First(&genre).Error; err != nil {
+		return radioSeed{}, radioSeedErr(err)
+	}
+	return radioSeed{genreIDs: []int{genre.ID}}, nil
+}
+
+func radioSeedErr(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errRadioSeedNotFound
+	}
+	return err
+}
+
+// radioRelatedArtistIDs finds artists in the library that the cached musicbrainz artist info relates to the seed artists
+func radioRelatedArtistIDs(dbc *db.DB, artistIDs []int) ([]int, error) {
+	if len(artistIDs) == 0 {
+		return nil, nil
+	}
+	var infos []*db.ArtistInfo
+	if err := dbc.Where("id IN (?)", artistIDs).Find(&infos).Error; err != nil {
+		return nil, fmt.Errorf("find artist infos: %w", err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.GetMusicBrainzRelatedArtists()...)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	var ids []int
+	if err := dbc.Model(db.Artist{}).Where("name IN (?) AND id NOT IN (?)", names, artistIDs).Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("find related artists: %w", err)
+	}
+	return ids, nil
+}
+
+// radioTracks scores every track related to the seed, then picks count of them at random weighted by that score and the user's
+// plays and ratings. if the library runs out of related tracks the rest is filled with random ones so the radio doesn't stop
+func radioTracks(dbc *db.DB, user *db.User, seed radioSeed, exclude []int, musicFolder string, count int) ([]*spec.TrackRow, error) {
+	relatedArtistIDs, err := radioRelatedArtistIDs(dbc, seed.artistIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := map[int]float64{}
+
+	type genreMatch struct {
+		TrackID   int
+		Inherited bool
+	}
+	var genreMatches []genreMatch
+	err = dbc.
+		Table("track_genres").
+		Select("track_genres.track_id, track_genres.inherited").
+		Scopes(radioInMusicFolder("track_genres", musicFolder)).
+		Where("track_genres.genre_id IN (?)", defaultIDs(seed.genreIDs)).
+		Scan(&genreMatches).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("find genre matches: %w", err)
+	}
+	for _, m := range genreMatches {
+		if m.Inherited {
+			scores[m.TrackID] += radioWeightGenreInherited
+			continue
+		}
+		scores[m.TrackID] += radioWeightGenre
+	}
+
+	artistMatches := []struct {
+		weight    float64
+		artistIDs []int
+	}{
+		{radioWeightArtist, seed.artistIDs},
+		{radioWeightRelatedArtist, relatedArtistIDs},
+	}
+	for _, m := range artistMatches {
+		var trackIDs []int
+		err := dbc.
+			Table("track_credits").
+			Scopes(radioInMusicFolder("track_credits", musicFolder)).
+			Where("track_credits.artist_id IN (?)", defaultIDs(m.artistIDs)).
+			Pluck("DISTINCT track_credits.track_id", &trackIDs).
+			Error
+		if err != nil {
+			return nil, fmt.Errorf("find artist matches: %w", err)
+		}
+		for _, id := range trackIDs {
+			scores[id] += m.weight
+		}
+	}
+
+	var recentlyPlayed []int
+	err = dbc.
+		Model(db.TrackPlay{}).
+		Where("user_id=? AND time>?", user.ID, time.Now().Add(-radioRecentlyPlayed)).
+		Pluck("track_id", &recentlyPlayed).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("find recent plays: %w", err)
+	}
+	skip := uniqueInts(slices.Concat(seed.trackIDs, exclude, recentlyPlayed))
+	for _, id := range skip {
+		delete(scores, id)
+	}
+
+	if err := radioApplyUserWeights(dbc, user, scores); err != nil {
+		return nil, err
+	}
+
+	// weighted random sampling without replacement, see Efraimidis and Spirakis
+	keys := make(map[int]float64, len(scores))
+	ids := make([]int, 0, len(scores))
+	for id, score := range scores {
+		keys[id] = math.Pow(rand.Float64(), 1/score) //nolint:gosec
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b int) int { return cmp.Compare(keys[b], keys[a]) })
+	if len(ids) > count {
+		ids = ids[:count]
+	}
+
+	if len(ids) < count {
+		var fill []int
+		err := dbc.
+			Model(db.Track{}).
+			Scopes(radioInMusicFolder("tracks", musicFolder)).
+			Where("tracks.id NOT IN (?)", defaultIDs(slices.Concat(skip, ids))).
+			Order(gorm.Expr("random()")).
+			Limit(count-len(ids)).
+			Pluck("tracks.id", &fill).
+			Error
+		if err != nil {
+			return nil, fmt.Errorf("find random tracks: %w", err)
+		}
+		ids = append(ids, fill...)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var tracks []*spec.TrackRow
+	err = dbc.
+		Scopes(spec.LoadTrackByTags(user.ID)).
+		Where("tracks.id IN (?)", ids).
+		Find(&tracks).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("find tracks: %w", err)
+	}
+	slices.SortFunc(tracks, func(a, b *spec.TrackRow) int {
+		return slices.Index(ids, a.ID) - slices.Index(ids, b.ID)
+	})
+	return tracks, nil
+}
+
+// radioApplyUserWeights makes tracks the user likes more likely to come up. stars and high ratings boost a track,
+// low ratings bury it, and plays give a small boost which tails off
+func radioApplyUserWeights(dbc *db.DB, user *db.User, scores map[int]float64) error {
+	var ratings []*db.TrackRating
+	if err := dbc.Where("user_id=?", user.ID).Find(&ratings).Error; err != nil {
+		return fmt.Errorf("find ratings: %w", err)
+	}
+	for _, rating := range ratings {
+		if _, ok := scores[rating.TrackID]; ok {
+			scores[rating.TrackID] *= float64(rating.Rating) / 3
+		}
+	}
+	var stars []*db.TrackStar
+	if err := dbc.Where("user_id=?", user.ID).Find(&stars).Error; err != nil {
+		return fmt.Errorf("find stars: %w", err)
+	}
+	for _, star := range stars {
+		if _, ok := scores[star.TrackID]; ok {
+			scores[star.TrackID] *= 1.5
+		}
+	}
+	var plays []*db.TrackPlay
+	if err := dbc.Where("user_id=?", user.ID).Find(&plays).Error; err != nil {
+		return fmt.Errorf("find plays: %w", err)
+	}
+	for _, play := range plays {
+		if _, ok := scores[play.TrackID]; ok {
+			scores[play.TrackID] *= 1 + math.Log1p(play.Count)/4
+		}
+	}
+	return nil
+}
+
+// radioInMusicFolder limits a query on a table with a track_id (or on tracks itself) to a music folder
+func radioInMusicFolder(table string, musicFolder string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if musicFolder == "" {
+			return db
+		}
+		if table != "tracks" {
+			db = db.Joins(fmt.Sprintf("JOIN tracks ON tracks.id=%s.track_id", table))
+		}
+		return db.
+			Joins("JOIN albums ON albums.id=tracks.album_id").
+			Where("albums.root_dir=?", musicFolder)
+	}
+}
+
+// defaultIDs avoids an empty IN () list, which matches nothing anyway
+func defaultIDs(ids []int) []int {
+	if len(ids) == 0 {
+		return []int{0}
+	}
+	return ids
+}
+
+func uniqueInts(in []int) []int {
+	slices.Sort(in)
+	return slices.Compact(in)
+}
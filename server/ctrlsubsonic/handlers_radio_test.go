@@ -0,0 +1,37 @@
+package ctrlsubsonic
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.senan.xyz/gonic/db"
+)
+
+func TestGetRadio(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+
+	var trackBA, trackAA2 db.Track
+	f.dbc.Where("tag_title=?", "track-ba").First(&trackBA)
+	f.dbc.Where("tag_title=?", "title-2").First(&trackAA2)
+
+	// cached musicbrainz relations are used without reaching out
+	require.NoError(t, f.dbc.Save(&db.ArtistInfo{
+		ID:                        f.artistB.ID,
+		MusicBrainzRelatedArtists: "ärtist-c;artist-not-in-db",
+		UpdatedAt:                 time.Now(),
+	}).Error)
+
+	// every related track is returned when count covers them all, so the lists can be compared as sets
+	f.run(t, f.contr.ServeGetRadio, f.admin,
+		query{url.Values{"genre": {"Jazz"}, "count": {"3"}}, "genre_jazz", true},
+		query{url.Values{"genre": {"Jazz"}, "count": {"2"}, "exclude": {trackAA2.SID().String()}}, "genre_jazz_exclude", true},
+		// artist-b credits, jazz, and the related ärtist-c
+		query{url.Values{"id": {trackBA.SID().String()}, "count": {"5"}}, "track_ba", true},
+		query{url.Values{"genre": {"Not A Genre"}}, "genre_missing", false},
+		query{url.Values{}, "no_seed", false},
+	)
+}
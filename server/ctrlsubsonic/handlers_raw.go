@@ -2,15 +2,24 @@ package ctrlsubsonic
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"io/fs"
+	"iter"
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -19,8 +28,10 @@ import (
 	"github.com/jinzhu/gorm"
 	"go.senan.xyz/wrtag/coverparse"
 
+	"go.senan.xyz/gonic"
 	"go.senan.xyz/gonic/db"
 	"go.senan.xyz/gonic/fileutil"
+	"go.senan.xyz/gonic/icy"
 	"go.senan.xyz/gonic/infocache/artistinfocache"
 	"go.senan.xyz/gonic/playlist"
 	"go.senan.xyz/gonic/server/ctrlsubsonic/params"
@@ -76,65 +87,295 @@ func (c *Controller) ServeGetCoverArt(w http.ResponseWriter, r *http.Request) *s
 		}
 	}
 
+	webp := false
+	if c.coverWebP {
+		webp = coverWantsWebP(r, params.GetOr("format", ""))
+		w.Header().Set("Vary", "Accept")
+	}
+
 	c.coverCache.RLock()
 	defer c.coverCache.RUnlock()
 
-	// cached cover could exist for any supported format
-	cachePath, err := findCachedCover(c.coverCache.Path(), id.String(), size)
-	if err != nil && !os.IsNotExist(err) {
-		log.Printf("error checking cache: %v", err)
-		return nil
+	cachePath, err := c.cachedCover(r.Context(), id, size, webp)
+	switch {
+	case errors.Is(err, errCoverSource):
+		return spec.NewError(70, "couldn't find cover %q: %v", id, err)
+	case err != nil:
+		return spec.NewError(0, "cover %q: %v", id, err)
+	}
+
+	etag, err := fileETag(cachePath)
+	if err != nil {
+		return spec.NewError(0, "cover %q: %v", id, err)
 	}
 
-	serve := func(p string) {
-		w.Header().Set("Cache-Control", "public, max-age=1209600")
-		http.ServeFile(w, r, p) //nolint:gosec // p is contained to the cover cache dir via fileutil.SafeJoin
+	// with the etag set, ServeFile answers If-None-Match with a 304
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=1209600")
+	http.ServeFile(w, r, cachePath) //nolint:gosec // cachePath is contained to the cover cache dir via fileutil.SafeJoin
+	return nil
+}
+
+// errCoverSource is returned by cachedCover when there's no image to make the cover from
+var errCoverSource = errors.New("no source image")
+
+// cachedCover returns the path of the cover for id in the cache, scaled to fit size, and in WebP if webp is set or in
+// the format of the original if not. it's made and saved to the cache if it isn't there already. callers must hold
+// the cover cache's read lock
+func (c *Controller) cachedCover(ctx context.Context, id specid.ID, size int, webp bool) (string, error) {
+	key, err := c.coverCacheKey(id)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errCoverSource, err)
+	}
+	findCached := func(size int) (string, error) {
+		if !webp {
+			// cached cover could exist for any supported format
+			return findCachedCover(c.coverCache.Path(), key, size)
+		}
+		cachePath, err := fileutil.SafeJoin(c.coverCache.Path(), coverCacheFilename(key, size, "webp"))
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(cachePath); err != nil {
+			return "", err
+		}
+		return cachePath, nil
+	}
+	touch := func(p string) string {
+		_ = os.Chtimes(p, time.Now(), time.Time{}) // touch for LRU eviction, keeping the modified time for the etag
+		return p
 	}
 
+	cachePath, err := findCached(size)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("checking cache: %w", err)
+	}
 	if cachePath != "" {
-		_ = os.Chtimes(cachePath, time.Now(), time.Now()) // touch for LRU eviction
-		serve(cachePath)
-		return nil
+		return touch(cachePath), nil
 	}
 
-	reader, err := coverFor(c.dbc, c.artistInfoCache, c.playlistStore, c.tagReader, id)
+	reader, err := c.coverSource(id)
 	if err != nil {
-		return spec.NewError(70, "couldn't find cover %q: %v", id, err)
+		return "", fmt.Errorf("%w: %w", errCoverSource, err)
 	}
 	defer reader.Close()
 
 	img, format, err := image.Decode(reader)
 	if err != nil {
-		return spec.NewError(0, "decode for cover %q: %v", id, err)
+		return "", fmt.Errorf("decode: %w", err)
 	}
 
 	// don't upscale
 	minSize := min(size, max(img.Bounds().Dx(), img.Bounds().Dy()))
 
-	cachePath, err = fileutil.SafeJoin(c.coverCache.Path(), coverCacheFilename(id.String(), minSize, format))
-	if err != nil {
-		return spec.NewError(0, "bad cover id %q: %v", id, err)
-	}
-
 	if minSize != size {
 		// we down sized, check cache again
-		if _, err := os.Stat(cachePath); err == nil {
-			_ = os.Chtimes(cachePath, time.Now(), time.Now()) // touch for LRU eviction
-			serve(cachePath)
-			return nil
+		cachePath, err = findCached(minSize)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("checking cache: %w", err)
 		}
+		if cachePath != "" {
+			return touch(cachePath), nil
+		}
+	}
+
+	if webp {
+		format = "webp"
+	}
+	cachePath, err = fileutil.SafeJoin(c.coverCache.Path(), coverCacheFilename(key, minSize, format))
+	if err != nil {
+		return "", fmt.Errorf("bad cover id: %w", err)
 	}
 
 	resized := imaging.Fit(img, minSize, minSize, imaging.Lanczos)
 
-	if err := imaging.Save(resized, cachePath); err != nil {
-		return spec.NewError(0, "saving cover %q: %v", id, err)
+	save := func() error { return imaging.Save(resized, cachePath) }
+	if webp {
+		save = func() error { return saveWebP(ctx, resized, cachePath) }
+	}
+	if err := save(); err != nil {
+		return "", fmt.Errorf("saving: %w", err)
+	}
+	if err := removeOldCovers(c.coverCache.Path(), id, key); err != nil {
+		log.Printf("error removing old covers of %q: %v", id, err)
+	}
+	return cachePath, nil
+}
+
+// coverCacheKey is the name covers for id are cached under. collages change along with what they're made from, so
+// they're versioned by the playlist's modified time, or for genres the time of the last scan of any kind
+func (c *Controller) coverCacheKey(id specid.ID) (string, error) {
+	switch id.Type {
+	case specid.Playlist:
+		modTime, err := c.playlistStore.ModTime(playlistIDDecode(id))
+		if err != nil {
+			return "", fmt.Errorf("stat playlist: %w", err)
+		}
+		return fmt.Sprintf("%s-%d", id, modTime.UnixNano()), nil
+	case specid.Genre:
+		scanTime, err := c.dbc.GetSetting(db.LastAnyScanTime)
+		if err != nil {
+			return "", fmt.Errorf("get scan time: %w", err)
+		}
+		return fmt.Sprintf("%s-%s", id, cmp.Or(scanTime, "0")), nil
+	default:
+		return id.String(), nil
+	}
+}
+
+// removeOldCovers removes the cached covers of earlier versions of id, once one for key has been made
+func removeOldCovers(cacheDir string, id specid.ID, key string) error {
+	if key == id.String() {
+		return nil // not versioned
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		version, ok := strings.CutPrefix(entry.Name(), id.String()+"-")
+		if !ok || strings.HasPrefix(entry.Name(), key+"-") || !coverVersionExpr.MatchString(version) {
+			continue // another id which starts with this one has more parts, like "pl-abc-def-1-600.jpg"
+		}
+		if err := os.Remove(filepath.Join(cacheDir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// coverVersionExpr matches what follows the id in the name of a versioned cached cover, like "1760000000-600.jpg"
+var coverVersionExpr = regexp.MustCompile(`^\d+-\d+\.\w+$`)
+
+// coverSource opens the image a cover is made from. playlists without an image of their own, and genres, get a
+// collage of their albums
+func (c *Controller) coverSource(id specid.ID) (io.ReadCloser, error) {
+	switch id.Type {
+	case specid.Playlist:
+		reader, err := coverForPlaylist(c.playlistStore, id)
+		if errors.Is(err, errCoverEmpty) {
+			return c.coverForPlaylistCollage(id)
+		}
+		return reader, err
+	case specid.Genre:
+		return coverForGenreCollage(c.dbc, c.tagReader, id.Value)
+	default:
+		return coverFor(c.dbc, c.artistInfoCache, c.playlistStore, c.tagReader, id)
+	}
+}
+
+// WarmCoverCache makes the covers of every album at each of sizes, so the first time a client shows a big grid of
+// albums doesn't have to wait for them all to be scaled. covers which are already cached are skipped
+func (c *Controller) WarmCoverCache(ctx context.Context, sizes []int) error {
+	start := time.Now()
+	var albums []*db.Album
+	err := c.dbc.
+		Select("id, cover, embedded_cover_track_id").
+		Where("cover != '' OR embedded_cover_track_id IS NOT NULL").
+		Order("id").
+		Find(&albums).
+		Error
+	if err != nil {
+		return fmt.Errorf("find albums: %w", err)
+	}
+
+	formats := []bool{false}
+	if c.coverWebP {
+		formats = append(formats, true)
 	}
 
-	serve(cachePath)
+	var numErr int
+	for _, album := range albums {
+		id := album.SID()
+		if album.Cover == "" {
+			id = album.EmbeddedCoverTrackSID()
+		}
+		for _, size := range sizes {
+			for _, webp := range formats {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				// lock per cover so ejecting the cache isn't held up for the whole run
+				c.coverCache.RLock()
+				_, err := c.cachedCover(ctx, *id, size, webp)
+				c.coverCache.RUnlock()
+				if err != nil {
+					numErr++
+				}
+			}
+		}
+	}
+	log.Printf("finished warming covers in %s, %d albums (%d err)", time.Since(start).Round(time.Millisecond), len(albums), numErr)
 	return nil
 }
 
+// coverWantsWebP is whether the client asked for WebP, with the format param or else with its Accept header
+func coverWantsWebP(r *http.Request, format string) bool {
+	if format != "" {
+		return strings.EqualFold(format, "webp")
+	}
+	return acceptsMediaType(r.Header.Get("Accept"), "image/webp")
+}
+
+// acceptsMediaType is whether an Accept header lists the media type without a zero q value. wildcards aren't
+// counted, since every client accepts the original format
+func acceptsMediaType(accept string, mediaType string) bool {
+	for part := range strings.SplitSeq(accept, ",") {
+		mt, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(mt), mediaType) {
+			continue
+		}
+		for param := range strings.SplitSeq(params, ";") {
+			k, v, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(k) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// saveWebP encodes the image with ffmpeg, since there's no WebP encoder in the standard library. it's written to a
+// temporary file first so a failed encode never leaves a partial cover in the cache
+func saveWebP(ctx context.Context, img image.Image, path string) error {
+	var buff bytes.Buffer
+	if err := png.Encode(&buff, img); err != nil {
+		return fmt.Errorf("encode png: %w", err)
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp: %w", err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-v", "0", "-f", "png_pipe", "-i", "pipe:0", "-c:v", "libwebp", "-quality", "80", "-f", "webp", "pipe:1")
+	cmd.Stdin = &buff
+	cmd.Stdout = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("run ffmpeg: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	return os.Rename(out.Name(), path)
+}
+
+// fileETag is a strong ETag for a cached cover from its name, size, and modified time. the LRU touch only changes the
+// access time, so it stays the same until the cover is ejected and made again
+func fileETag(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%s-%x-%x"`, filepath.Base(path), info.Size(), info.ModTime().UnixNano()), nil
+}
+
 func coverCacheFilename(idStr string, size int, format string) string {
 	return fmt.Sprintf("%s-%d.%s", idStr, size, format)
 }
@@ -163,7 +404,9 @@ func coverFor(dbc *db.DB, artistInfoCache *artistinfocache.ArtistInfoCache, play
 	case specid.Album:
 		return coverForAlbum(dbc, id.Value)
 	case specid.Artist:
-		return coverForArtist(artistInfoCache, id.Value)
+		return coverForArtist(dbc, artistInfoCache, id.Value)
+	case specid.AlbumImage:
+		return coverForAlbumImage(dbc, id.Value)
 	case specid.Podcast:
 		return coverForPodcast(dbc, id.Value)
 	case specid.PodcastEpisode:
@@ -192,7 +435,42 @@ func coverForAlbum(dbc *db.DB, id int) (*os.File, error) {
 	return os.Open(filepath.Join(folder.RootDir, folder.LeftPath, folder.RightPath, folder.Cover))
 }
 
-func coverForArtist(artistInfoCache *artistinfocache.ArtistInfoCache, id int) (io.ReadCloser, error) {
+func coverForAlbumImage(dbc *db.DB, id int) (*os.File, error) {
+	var albumImage db.AlbumImage
+	err := dbc.
+		Preload("Album").
+		First(&albumImage, id).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("select album image: %w", err)
+	}
+	return os.Open(albumImage.AbsPath())
+}
+
+// coverForArtist prefers an image from the artist's own folder, falling back to the one from last.fm
+func coverForArtist(dbc *db.DB, artistInfoCache *artistinfocache.ArtistInfoCache, id int) (io.ReadCloser, error) {
+	var artist db.Artist
+	if err := dbc.Select("id, image_folder_id").First(&artist, id).Error; err != nil {
+		return nil, fmt.Errorf("select artist: %w", err)
+	}
+	if artist.ImageFolderID != nil {
+		var albumImage db.AlbumImage
+		err := dbc.
+			Preload("Album").
+			Where("album_id=? AND kind=?", *artist.ImageFolderID, db.AlbumImageArtist).
+			Order("position").
+			First(&albumImage).
+			Error
+		switch {
+		case err == nil:
+			return os.Open(albumImage.AbsPath())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return coverForAlbum(dbc, *artist.ImageFolderID)
+		default:
+			return nil, fmt.Errorf("select artist image: %w", err)
+		}
+	}
+
 	info, err := artistInfoCache.Get(context.Background(), id)
 	if err != nil {
 		return nil, fmt.Errorf("get artist info from cache: %w", err)
@@ -295,6 +573,115 @@ func coverForPlaylist(playlistStore *playlist.Store, id specid.ID) (*os.File, er
 	return os.Open(filepath.Join(playlistDir, cover)) //nolint:gosec // playlistDir validated via SafeJoin above
 }
 
+// collageTiles is the number of album covers along each side of a collage
+const collageTiles = 2
+
+// coverForCollage makes a grid of the covers of the first albums with one, in the order albumIDs gives them. if
+// there aren't enough albums to fill the grid, the first album's cover is used alone
+func coverForCollage(dbc *db.DB, tagReader tags.Reader, albumIDs iter.Seq[int]) (io.ReadCloser, error) {
+	var covers []image.Image
+	for albumID := range albumIDs {
+		var album db.Album
+		err := dbc.
+			Select("id, root_dir, left_path, right_path, cover, embedded_cover_track_id").
+			Where("cover != '' OR embedded_cover_track_id IS NOT NULL").
+			Find(&album, albumID).
+			Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("find album: %w", err)
+		}
+
+		var reader io.ReadCloser
+		if album.Cover != "" {
+			reader, err = coverForAlbum(dbc, album.ID)
+		} else {
+			reader, err = coverForTrack(dbc, tagReader, *album.EmbeddedCoverTrackID)
+		}
+		if err != nil {
+			continue
+		}
+		img, _, err := image.Decode(reader)
+		reader.Close()
+		if err != nil {
+			continue
+		}
+
+		covers = append(covers, img)
+		if len(covers) == collageTiles*collageTiles {
+			break
+		}
+	}
+	if len(covers) == 0 {
+		return nil, errCoverEmpty
+	}
+
+	var collage image.Image = covers[0]
+	if len(covers) == collageTiles*collageTiles {
+		tileSize := coverDefaultSize / collageTiles
+		canvas := imaging.New(tileSize*collageTiles, tileSize*collageTiles, color.Black)
+		for i, cover := range covers {
+			tile := imaging.Fill(cover, tileSize, tileSize, imaging.Center, imaging.Lanczos)
+			canvas = imaging.Paste(canvas, tile, image.Pt(i%collageTiles*tileSize, i/collageTiles*tileSize))
+		}
+		collage = canvas
+	}
+
+	var buff bytes.Buffer
+	if err := jpeg.Encode(&buff, collage, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, fmt.Errorf("encode collage: %w", err)
+	}
+	return io.NopCloser(&buff), nil
+}
+
+func (c *Controller) coverForPlaylistCollage(id specid.ID) (io.ReadCloser, error) {
+	pl, err := c.playlistStore.Read(playlistIDDecode(id))
+	if err != nil {
+		return nil, fmt.Errorf("read playlist: %w", err)
+	}
+	albumIDs := func(yield func(int) bool) {
+		seen := map[int]struct{}{}
+		for _, path := range pl.Items {
+			trackID, err := specidpaths.Lookup(c.dbc, MusicPaths(c.musicPaths), c.podcastsPath, path)
+			if err != nil || trackID.Type != specid.Track {
+				continue
+			}
+			var track db.Track
+			if err := c.dbc.Select("id, album_id").First(&track, trackID.Value).Error; err != nil {
+				continue
+			}
+			if _, ok := seen[track.AlbumID]; ok {
+				continue
+			}
+			seen[track.AlbumID] = struct{}{}
+			if !yield(track.AlbumID) {
+				return
+			}
+		}
+	}
+	return coverForCollage(c.dbc, c.tagReader, albumIDs)
+}
+
+// coverForGenreCollage uses the genre's albums by title, those tagged with it before those which inherit it from the
+// genre tree
+func coverForGenreCollage(dbc *db.DB, tagReader tags.Reader, genreID int) (io.ReadCloser, error) {
+	var albumIDs []int
+	err := dbc.
+		Model(db.Album{}).
+		Joins("JOIN album_genres ON album_genres.album_id=albums.id").
+		Where("album_genres.genre_id=? AND (albums.cover != '' OR albums.embedded_cover_track_id IS NOT NULL)", genreID).
+		Order("album_genres.inherited, albums.tag_title, albums.id").
+		Limit(collageTiles*collageTiles*2). // a few spare in case some covers can't be read
+		Pluck("albums.id", &albumIDs).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("find genre albums: %w", err)
+	}
+	return coverForCollage(dbc, tagReader, slices.Values(albumIDs))
+}
+
 func (c *Controller) ServeStream(w http.ResponseWriter, r *http.Request) *spec.Response {
 	params := r.Context().Value(CtxParams).(params.Params)
 	user := r.Context().Value(CtxUser).(*db.User)
@@ -319,6 +706,13 @@ func (c *Controller) ServeStream(w http.ResponseWriter, r *http.Request) *spec.R
 	timeOffset, _ := params.GetInt("timeOffset")
 	estimateLength := params.GetOrBool("estimateContentLength", false)
 
+	// a client seeking into a long track or episode is a good hint of where to resume from next time
+	if timeOffset > 0 {
+		if err := updateResumePosition(c.dbc, user.ID, id, timeOffset*1000); err != nil {
+			log.Printf("error updating resume position: %v", err)
+		}
+	}
+
 	if format == "raw" || urlPath == "/download" {
 		http.ServeFile(w, r, file.AbsPath()) //nolint:gosec // path is from db, populated by scanner
 		return nil
@@ -391,6 +785,96 @@ func (c *Controller) ServeStream(w http.ResponseWriter, r *http.Request) *spec.R
 	return nil
 }
 
+// ServeStreamInternetRadioStation relays a station's stream for stations which have proxying enabled, so that clients
+// never connect to the station themselves. the ICY StreamTitle is stripped from the audio and remembered for
+// getInternetRadioStations. the stream is only transcoded if the client asks with `format` or `maxBitRate`
+func (c *Controller) ServeStreamInternetRadioStation(w http.ResponseWriter, r *http.Request) *spec.Response {
+	params := r.Context().Value(CtxParams).(params.Params)
+	user := r.Context().Value(CtxUser).(*db.User)
+	id, err := params.GetID("id")
+	if err != nil || id.Type != specid.InternetRadioStation {
+		return spec.NewError(10, "please provide an internet radio station `id` parameter")
+	}
+
+	var station db.InternetRadioStation
+	if err := c.dbc.Where("id=?", id.Value).First(&station).Error; err != nil {
+		return spec.NewError(70, "id not found: %v", err)
+	}
+	if !station.Proxy {
+		return spec.NewError(70, "station %q is not proxied", station.Name)
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, station.StreamURL, nil)
+	if err != nil {
+		return spec.NewError(0, "create station request: %v", err)
+	}
+	req.Header.Set(icy.RequestHeader, "1")
+	req.Header.Set("User-Agent", gonic.Name)
+	resp, err := radioProxyClient.Do(req)
+	if err != nil {
+		return spec.NewError(0, "connect to station: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return spec.NewError(0, "connect to station: %s", resp.Status)
+	}
+
+	stream := icy.NewReader(resp.Body, icy.MetaInt(resp.Header), func(title string) {
+		c.radioTitles.Set(station.ID, title)
+	})
+
+	maxBitRate, _ := params.GetInt("maxBitRate")
+	format, _ := params.Get("format")
+	if (format != "" && format != "raw") || maxBitRate > 0 {
+		client, _ := params.Get("c")
+		profile, clientChose, ok, err := streamBaseProfile(c.dbc, user.ID, client, format, maxBitRate)
+		if err != nil {
+			return spec.NewError(0, "couldn't pick profile: %v", err)
+		}
+		st, canStream := c.transcoder.(transcode.StreamTranscoder)
+		if ok && canStream {
+			if maxBitRate > 0 && (clientChose || int(profile.BitRate()) > maxBitRate) {
+				profile = transcode.WithBitrate(profile, transcode.BitRate(maxBitRate))
+			}
+			log.Printf("transcoding station %q to %q at bitrate %d", station.Name, profile.MIME(), profile.BitRate())
+			w.Header().Set("Content-Type", profile.MIME())
+			if err := st.TranscodeStream(r.Context(), profile, stream, w); err != nil && !errors.Is(err, transcode.ErrFFmpegKilled) && !errors.Is(err, context.Canceled) {
+				log.Printf("error transcoding station %q: %v", station.Name, err)
+			}
+			return nil
+		}
+	}
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	if _, err := io.Copy(flushWriter{w}, stream); err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("error relaying station %q: %v", station.Name, err)
+	}
+	return nil
+}
+
+// radioProxyClient has no overall timeout since the response body is never ending
+//
+//nolint:gochecknoglobals
+var radioProxyClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 15 * time.Second,
+	},
+}
+
+// flushWriter flushes after every write so that live audio isn't held in a buffer
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
 func (c *Controller) ServeGetAvatar(w http.ResponseWriter, r *http.Request) *spec.Response {
 	params := r.Context().Value(CtxParams).(params.Params)
 	user := r.Context().Value(CtxUser).(*db.User)
@@ -1,11 +1,22 @@
 package ctrlsubsonic
 
 import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.senan.xyz/gonic/cache"
+	"go.senan.xyz/gonic/db"
 	"go.senan.xyz/gonic/playlist"
 )
 
@@ -119,6 +130,293 @@ func TestCoverForPlaylist(t *testing.T) {
 	})
 }
 
+func TestCoverWantsWebP(t *testing.T) {
+	t.Parallel()
+
+	tcases := []struct {
+		accept string
+		format string
+		want   bool
+	}{
+		{"", "", false},
+		{"image/webp,*/*", "", true},
+		{"image/avif, image/webp;q=0.8, */*;q=0.5", "", true},
+		{"IMAGE/WEBP", "", true},
+		{"image/webp;q=0", "", false},
+		{"image/*", "", false},
+		{"image/webp", "jpeg", false},
+		{"", "webp", true},
+	}
+	for _, tc := range tcases {
+		r, _ := http.NewRequest("", "", nil)
+		r.Header.Set("Accept", tc.accept)
+		require.Equal(t, tc.want, coverWantsWebP(r, tc.format), "accept %q format %q", tc.accept, tc.format)
+	}
+}
+
+func TestGetCoverArtETag(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	f.contr.coverCache = cache.New(t.TempDir(), 0)
+
+	coverPath := filepath.Join(f.m.TmpDir(), "m-0", "artist-a", "album-ab", "cover.png")
+	cover, err := os.Create(coverPath)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(cover, image.NewRGBA(image.Rect(0, 0, 16, 16))))
+	require.NoError(t, cover.Close())
+
+	get := func(ifNoneMatch string) *http.Response {
+		rr, req := makeHTTPMock(url.Values{"id": {f.albumAB.SID().String()}, "size": {"8"}}, f.admin)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		respRaw(f.contr.ServeGetCoverArt).ServeHTTP(rr, req)
+		return rr.Result()
+	}
+
+	first := get("")
+	require.Equal(t, http.StatusOK, first.StatusCode)
+	require.Equal(t, "image/png", first.Header.Get("Content-Type"))
+	etag := first.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// served from the cache the second time, with the same etag
+	second := get(etag)
+	require.Equal(t, http.StatusNotModified, second.StatusCode)
+	require.Equal(t, etag, second.Header.Get("ETag"))
+
+	require.Equal(t, http.StatusOK, get(`"stale"`).StatusCode)
+}
+
+func TestGetCoverArtWebP(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("no ffmpeg")
+	}
+	f := newFixture(t)
+	f.contr.coverCache = cache.New(t.TempDir(), 0)
+	f.contr.coverWebP = true
+
+	coverPath := filepath.Join(f.m.TmpDir(), "m-0", "artist-a", "album-ab", "cover.png")
+	cover, err := os.Create(coverPath)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(cover, image.NewRGBA(image.Rect(0, 0, 16, 16))))
+	require.NoError(t, cover.Close())
+
+	get := func(accept, format string) *http.Response {
+		params := url.Values{"id": {f.albumAB.SID().String()}, "size": {"8"}}
+		if format != "" {
+			params.Set("format", format)
+		}
+		rr, req := makeHTTPMock(params, f.admin)
+		req.Header.Set("Accept", accept)
+		respRaw(f.contr.ServeGetCoverArt).ServeHTTP(rr, req)
+		return rr.Result()
+	}
+
+	tcases := []struct {
+		accept, format string
+		contentType    string
+	}{
+		{"", "", "image/png"},
+		{"image/webp,*/*", "", "image/webp"},
+		{"", "webp", "image/webp"},
+		{"image/webp,*/*", "png", "image/png"},
+	}
+	for _, tc := range tcases {
+		resp := get(tc.accept, tc.format)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, tc.contentType, resp.Header.Get("Content-Type"), "accept %q format %q", tc.accept, tc.format)
+		require.Equal(t, "Accept", resp.Header.Get("Vary"))
+	}
+
+	// both formats are kept in the cache side by side
+	cached, err := filepath.Glob(filepath.Join(f.contr.coverCache.Path(), f.albumAB.SID().String()+"-8.*"))
+	require.NoError(t, err)
+	require.Len(t, cached, 2)
+}
+
+func TestSaveWebP(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("no ffmpeg")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cover.webp")
+	require.NoError(t, saveWebP(t.Context(), image.NewRGBA(image.Rect(0, 0, 16, 16)), path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "RIFF", string(data[:4]))
+	require.Equal(t, "WEBP", string(data[8:12]))
+
+	// a failed encode doesn't leave anything behind
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	failedPath := filepath.Join(dir, "failed.webp")
+	require.Error(t, saveWebP(ctx, image.NewRGBA(image.Rect(0, 0, 16, 16)), failedPath))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestWarmCoverCache(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	f.contr.coverCache = cache.New(t.TempDir(), 0)
+
+	coverPath := filepath.Join(f.m.TmpDir(), "m-0", "artist-a", "album-ab", "cover.png")
+	cover, err := os.Create(coverPath)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(cover, image.NewRGBA(image.Rect(0, 0, 16, 16))))
+	require.NoError(t, cover.Close())
+
+	// covers which can't be read are counted as errors, and don't stop the rest
+	require.NoError(t, f.contr.WarmCoverCache(t.Context(), []int{8, 4}))
+
+	var infos []os.FileInfo
+	for _, size := range []int{8, 4} {
+		info, err := os.Stat(filepath.Join(f.contr.coverCache.Path(), coverCacheFilename(f.albumAB.SID().String(), size, "png")))
+		require.NoError(t, err)
+		infos = append(infos, info)
+	}
+
+	// warming again leaves the cached covers as they were
+	require.NoError(t, f.contr.WarmCoverCache(t.Context(), []int{8, 4}))
+	for i, size := range []int{8, 4} {
+		info, err := os.Stat(filepath.Join(f.contr.coverCache.Path(), coverCacheFilename(f.albumAB.SID().String(), size, "png")))
+		require.NoError(t, err)
+		require.Equal(t, infos[i].ModTime(), info.ModTime())
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	require.ErrorIs(t, f.contr.WarmCoverCache(ctx, []int{8}), context.Canceled)
+}
+
+func TestCoverForCollage(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+
+	colours := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {255, 255, 0, 255}}
+	albums := []*db.Album{&f.albumAA, &f.albumAB, &f.albumBA, &f.albumCollab}
+	var albumIDs []int
+	for i, album := range albums {
+		img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+		for x := range 16 {
+			for y := range 16 {
+				img.Set(x, y, colours[i])
+			}
+		}
+		cover, err := os.Create(filepath.Join(album.AbsPath(), "cover.png"))
+		require.NoError(t, err)
+		require.NoError(t, png.Encode(cover, img))
+		require.NoError(t, cover.Close())
+		require.NoError(t, f.dbc.Model(album).Update("cover", "cover.png").Error)
+		albumIDs = append(albumIDs, album.ID)
+	}
+
+	decode := func(ids ...int) image.Image {
+		reader, err := coverForCollage(f.dbc, f.m.TagReader(), slices.Values(ids))
+		require.NoError(t, err)
+		defer reader.Close()
+		img, _, err := image.Decode(reader)
+		require.NoError(t, err)
+		return img
+	}
+	near := func(t *testing.T, want color.RGBA, got color.Color) {
+		r, g, b, _ := got.RGBA()
+		require.InDelta(t, want.R, r>>8, 8)
+		require.InDelta(t, want.G, g>>8, 8)
+		require.InDelta(t, want.B, b>>8, 8)
+	}
+
+	// albums without a cover are skipped, and the first four with one fill the grid in order
+	collage := decode(append([]int{f.albumVA.ID, f.albumCa.ID}, albumIDs...)...)
+	require.Equal(t, image.Rect(0, 0, coverDefaultSize, coverDefaultSize), collage.Bounds())
+	tile := coverDefaultSize / collageTiles
+	for i, colour := range colours {
+		near(t, colour, collage.At(i%collageTiles*tile+tile/2, i/collageTiles*tile+tile/2))
+	}
+
+	// not enough for a grid, so the first cover alone
+	single := decode(albumIDs[1], albumIDs[2])
+	require.Equal(t, image.Rect(0, 0, 16, 16), single.Bounds())
+	near(t, colours[1], single.At(8, 8))
+
+	_, err := coverForCollage(f.dbc, f.m.TagReader(), slices.Values([]int{f.albumCa.ID}))
+	require.ErrorIs(t, err, errCoverEmpty)
+}
+
+func TestGetCoverArtPlaylistCollageEdited(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	cacheDir := t.TempDir()
+	f.contr.coverCache = cache.New(cacheDir, 0)
+
+	colours := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}}
+	albums := []*db.Album{&f.albumAA, &f.albumAB}
+	for i, album := range albums {
+		img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+		for x := range 16 {
+			for y := range 16 {
+				img.Set(x, y, colours[i])
+			}
+		}
+		cover, err := os.Create(filepath.Join(album.AbsPath(), "cover.png"))
+		require.NoError(t, err)
+		require.NoError(t, png.Encode(cover, img))
+		require.NoError(t, cover.Close())
+		require.NoError(t, f.dbc.Model(album).Update("cover", "cover.png").Error)
+	}
+
+	var trackAB db.Track
+	require.NoError(t, f.dbc.Where("album_id=?", f.albumAB.ID).First(&trackAB).Error)
+
+	relPath := filepath.Join("1", "collage.m3u")
+	writePlaylist := func(modTime time.Time, items ...string) {
+		require.NoError(t, f.contr.playlistStore.Write(relPath, &playlist.Playlist{UserID: f.admin.ID, Name: "collage", Items: items}))
+		require.NoError(t, os.Chtimes(filepath.Join(f.contr.playlistStore.BasePath(), relPath), time.Time{}, modTime))
+	}
+	getColour := func() color.Color {
+		rr, req := makeHTTPMock(url.Values{"id": {playlistIDEncode(relPath).String()}}, f.admin)
+		respRaw(f.contr.ServeGetCoverArt).ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		img, _, err := image.Decode(rr.Body)
+		require.NoError(t, err)
+		return img.At(8, 8)
+	}
+	cached := func() []string {
+		entries, err := os.ReadDir(cacheDir)
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+	near := func(want color.RGBA, got color.Color) {
+		r, g, b, _ := got.RGBA()
+		require.InDelta(t, want.R, r>>8, 8)
+		require.InDelta(t, want.G, g>>8, 8)
+		require.InDelta(t, want.B, b>>8, 8)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	writePlaylist(start, filepath.Join(f.albumAA.AbsPath(), "track-0.flac"))
+	near(colours[0], getColour())
+	before := cached()
+	require.Len(t, before, 1)
+
+	// edited, so a new collage is made and the old one is gone
+	writePlaylist(start.Add(time.Minute), filepath.Join(f.albumAB.AbsPath(), trackAB.Filename))
+	near(colours[1], getColour())
+	after := cached()
+	require.Len(t, after, 1)
+	require.NotEqual(t, before, after)
+}
+
 func touch(path string) error {
 	f, err := os.Create(path)
 	if err != nil {
@@ -19,6 +19,7 @@ func LoadTrackByFolder(userID int) func(*gorm.DB) *gorm.DB {
 			Preload("Album").
 			Preload("Genres").
 			Preload("ISRCs").
+			Preload("Moods").
 			Preload("Play", "user_id=?", userID)
 	}
 }
@@ -83,6 +84,7 @@ func NewTCAlbumByFolder(f *AlbumRow) *TrackChild {
 		Contributors:  []*Contributor{},
 		Genres:        []*GenreRef{},
 		ISRC:          []string{},
+		Moods:         []string{},
 	}
 	if f.AlbumStar != nil {
 		trCh.Starred = &f.AlbumStar.StarDate
@@ -110,6 +112,7 @@ func NewTCTrackByFolder(t *TrackRow, parent *db.Album) *TrackChild {
 		Contributors:    []*Contributor{},
 		Genres:          []*GenreRef{},
 		ISRC:            []string{},
+		Moods:           []string{},
 		DisplayArtist:   cmp.Or(t.TagTrackArtistCredit, t.TagTrackArtist),
 		DisplayComposer: cmp.Or(t.TagComposerCredit, t.TagComposer),
 		Title:           cmp.Or(t.TagTitle, t.Filename),
@@ -121,8 +124,14 @@ func NewTCTrackByFolder(t *TrackRow, parent *db.Album) *TrackChild {
 			t.Filename,
 		),
 		ParentID:      parent.SID(),
+		BPM:           t.TagBPM,
+		Comment:       t.TagComment,
+		SortName:      t.TagTitleSort,
 		Duration:      t.Length,
 		Bitrate:       t.Bitrate,
+		SamplingRate:  t.SampleRate,
+		BitDepth:      t.BitDepth,
+		ChannelCount:  t.Channels,
 		IsDir:         false,
 		Type:          TypeMusic,
 		MediaType:     MediaTypeSong,
@@ -167,6 +176,9 @@ func NewTCTrackByFolder(t *TrackRow, parent *db.Album) *TrackChild {
 	for _, trI := range t.ISRCs {
 		trCh.ISRC = append(trCh.ISRC, trI.ISRC)
 	}
+	for _, m := range t.Moods {
+		trCh.Moods = append(trCh.Moods, m.Mood)
+	}
 	trackArtists := filterTrackCreditsByRole(t.Credits, db.RoleArtist)
 	sort.Slice(trackArtists, func(i, j int) bool {
 		return trackArtists[i].ArtistID < trackArtists[j].ArtistID
@@ -213,6 +225,7 @@ func NewTCPodcastEpisode(pe *db.PodcastEpisode) *TrackChild {
 		AlbumArtists: []*ArtistRef{},
 		Contributors: []*Contributor{},
 		ISRC:         []string{},
+		Moods:        []string{},
 		Genres:       []*GenreRef{},
 	}
 	if pe.Podcast != nil {
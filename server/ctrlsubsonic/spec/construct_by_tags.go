@@ -15,7 +15,7 @@ import (
 func LoadAlbumByTags(userID int) func(*gorm.DB) *gorm.DB {
 	return func(q *gorm.DB) *gorm.DB {
 		return q.
-			Scopes(AlbumWithUserPlay(userID), AlbumWithAlbumArtistCredits, AlbumWithUserData(userID)).
+			Scopes(AlbumWithDiscsUserPlay(userID), AlbumWithAlbumArtistCredits, AlbumWithUserData(userID)).
 			Preload("Genres").
 			Preload("Labels").
 			Preload("DiscTitles")
@@ -30,6 +30,8 @@ func LoadTrackByTags(userID int) func(*gorm.DB) *gorm.DB {
 			Preload("Credits.Artist").
 			Preload("Genres").
 			Preload("ISRCs").
+			Preload("Moods").
+			Preload("Work").
 			Preload("Play", "user_id=?", userID)
 	}
 }
@@ -61,6 +63,7 @@ func NewAlbumByTags(a *AlbumRow, credits []*db.AlbumCredit) *Album {
 		ReleaseTypes:  formatReleaseTypes(a.TagReleaseType),
 		MusicBrainzID: a.TagBrainzID,
 		Version:       a.TagVersion,
+		SortName:      a.TagTitleSort,
 		RecordLabels:  []*RecordLabel{},
 		DiscTitles:    []*DiscTitle{},
 	}
@@ -129,11 +132,22 @@ func NewTrackByTags(client string, t *TrackRow, album *db.Album) *TrackChild {
 		Contributors:       []*Contributor{},
 		DisplayComposer:    cmp.Or(t.TagComposerCredit, t.TagComposer),
 		Bitrate:            t.Bitrate,
+		SamplingRate:       t.SampleRate,
+		BitDepth:           t.BitDepth,
+		ChannelCount:       t.Channels,
 		ContentType:        t.MIME(),
 		CreatedAt:          t.CreatedAt,
 		Duration:           t.Length,
 		Genres:             []*GenreRef{},
 		ISRC:               []string{},
+		BPM:                t.TagBPM,
+		Comment:            t.TagComment,
+		Moods:              []string{},
+		SortName:           t.TagTitleSort,
+		WorkID:             t.WorkSID(),
+		MovementName:       t.TagMovementName,
+		MovementNumber:     t.TagMovementNumber,
+		MovementCount:      t.TagMovementCount,
 		ParentID:           t.AlbumSID(),
 		Path:               filepath.Join(album.LeftPath, album.RightPath, t.Filename),
 		Size:               t.Size,
@@ -149,6 +163,10 @@ func NewTrackByTags(client string, t *TrackRow, album *db.Album) *TrackChild {
 		Year:               t.TagYear,
 	}
 
+	if album.DiscOfID != nil {
+		ret.AlbumID = album.DiscOfSID()
+	}
+
 	switch {
 	case t.HasEmbeddedCover:
 		ret.CoverID = t.SID()
@@ -198,6 +216,12 @@ func NewTrackByTags(client string, t *TrackRow, album *db.Album) *TrackChild {
 	for _, trI := range t.ISRCs {
 		ret.ISRC = append(ret.ISRC, trI.ISRC)
 	}
+	for _, m := range t.Moods {
+		ret.Moods = append(ret.Moods, m.Mood)
+	}
+	if t.Work != nil {
+		ret.Work = t.Work.Name
+	}
 	for _, c := range albumArtists {
 		if c.Artist == nil {
 			continue
@@ -256,10 +280,14 @@ func NewArtistByTags(a *ArtistRow) *Artist {
 		Name:          a.Name,
 		AlbumCount:    a.AlbumCount,
 		MusicBrainzID: a.MusicBrainzID,
+		SortName:      a.SortName,
 		Roles:         roles,
 		Albums:        []*Album{},
 		AverageRating: a.AverageRating,
 	}
+	if a.ImageFolderID != nil {
+		r.CoverID = a.SID()
+	}
 	if a.Info != nil {
 		r.Disambiguation = a.Info.MusicBrainzDisambiguation
 		if a.Info.ImageURL != "" {
@@ -275,6 +303,48 @@ func NewArtistByTags(a *ArtistRow) *Artist {
 	return r
 }
 
+func NewWorkByTags(w *WorkRow, composers []*db.Artist) *Work {
+	ret := &Work{
+		ID:            w.SID(),
+		Name:          w.Name,
+		Composer:      w.Composer,
+		Composers:     []*ArtistRef{},
+		MusicBrainzID: w.MusicBrainzID,
+		AlbumCount:    w.AlbumCount,
+		TrackCount:    w.TrackCount,
+	}
+	for _, a := range composers {
+		ret.Composers = append(ret.Composers, &ArtistRef{ID: a.SID(), Name: a.Name})
+	}
+	return ret
+}
+
+// NewAlbumWorks lists the works of an album's tracks, in the order they first come, so clients can group the tracks
+// under them
+func NewAlbumWorks(tracks []*TrackRow) []*Work {
+	var ret []*Work
+	byID := map[int]*Work{}
+	for _, t := range tracks {
+		if t.Work == nil {
+			continue
+		}
+		w, ok := byID[t.Work.ID]
+		if !ok {
+			w = &Work{
+				ID:            t.Work.SID(),
+				Name:          t.Work.Name,
+				Composer:      t.Work.Composer,
+				MusicBrainzID: t.Work.MusicBrainzID,
+				AlbumCount:    1,
+			}
+			byID[t.Work.ID] = w
+			ret = append(ret, w)
+		}
+		w.TrackCount++
+	}
+	return ret
+}
+
 func filterAlbumCreditsByRole(credits []*db.AlbumCredit, role string) []*db.AlbumCredit {
 	out := make([]*db.AlbumCredit, 0, len(credits))
 	for _, c := range credits {
@@ -296,9 +366,23 @@ func filterTrackCreditsByRole(credits []*db.TrackCredit, role string) []*db.Trac
 }
 
 func NewGenre(g *GenreRow) *Genre {
-	return &Genre{
+	ret := &Genre{
 		Name:       g.Name,
 		AlbumCount: g.AlbumCount,
 		SongCount:  g.TrackCount,
 	}
+	if g.AlbumCount > 0 {
+		ret.CoverID = g.SID()
+	}
+	return ret
+}
+
+func NewAlbumImage(i *db.AlbumImage) *AlbumImage {
+	return &AlbumImage{
+		ID:       i.SID(),
+		CoverID:  i.SID(),
+		Kind:     string(i.Kind),
+		Position: i.Position,
+		Name:     i.Filename,
+	}
 }
@@ -8,6 +8,7 @@ func NewInternetRadioStation(irs *db.InternetRadioStation) *InternetRadioStation
 		Name:        irs.Name,
 		StreamURL:   irs.StreamURL,
 		HomepageURL: irs.HomepageURL,
+		Proxy:       irs.Proxy,
 	}
 }
 
@@ -55,6 +55,14 @@ func ArtistWithRolesAndAlbumCount(q *gorm.DB) *gorm.DB {
 		Group("artists.id")
 }
 
+// ArtistWithRolesAndTrackAlbumCount is ArtistWithRolesAndAlbumCount for artists found through their track credits, with
+// tracks and albums joined
+func ArtistWithRolesAndTrackAlbumCount(q *gorm.DB) *gorm.DB {
+	return q.
+		Select([]string{"artists.*", "count(DISTINCT coalesce(albums.disc_of_id, albums.id)) album_count", artistAverageRatingColumn, artistRolesColumn}).
+		Group("artists.id")
+}
+
 func ArtistWithUserData(userID int) func(*gorm.DB) *gorm.DB {
 	return func(q *gorm.DB) *gorm.DB {
 		return q.
@@ -79,6 +87,18 @@ func (AlbumRow) TableName() string { return "albums" }
 const albumAverageRatingColumn = `(SELECT cast(coalesce(avg(rating), 0)*100 AS INT)/100.0 FROM album_ratings WHERE album_id=albums.id) average_rating`
 
 func AlbumWithUserPlay(userID int) func(*gorm.DB) *gorm.DB {
+	return albumWithUserPlay(userID, "tracks.album_id=albums.id", "t.album_id")
+}
+
+// AlbumWithDiscsUserPlay is like AlbumWithUserPlay, but counts the tracks and plays of the other discs an album stands
+// for too. see db.Album.DiscOfID
+func AlbumWithDiscsUserPlay(userID int) func(*gorm.DB) *gorm.DB {
+	return albumWithUserPlay(userID,
+		"tracks.album_id IN (SELECT id FROM albums discs WHERE discs.id=albums.id OR discs.disc_of_id=albums.id)",
+		"(SELECT coalesce(discs.disc_of_id, discs.id) FROM albums discs WHERE discs.id=t.album_id)")
+}
+
+func albumWithUserPlay(userID int, tracksOn, playsAlbumID string) func(*gorm.DB) *gorm.DB {
 	return func(q *gorm.DB) *gorm.DB {
 		return q.
 			Select([]string{
@@ -90,16 +110,16 @@ func AlbumWithUserPlay(userID int) func(*gorm.DB) *gorm.DB {
 				"album_plays.play_time play_time",
 				albumAverageRatingColumn,
 			}).
-			Joins("LEFT JOIN tracks ON tracks.album_id=albums.id").
+			Joins("LEFT JOIN tracks ON "+tracksOn).
 			Joins(`LEFT JOIN (
-				SELECT t.album_id,
+				SELECT `+playsAlbumID+` album_id,
 					sum(track_plays.count) play_count,
 					sum(track_plays.length) play_length,
 					max(track_plays.time) play_time
 				FROM track_plays
 				JOIN tracks t ON t.id=track_plays.track_id
 				WHERE track_plays.user_id=?
-				GROUP BY t.album_id
+				GROUP BY 1
 			) album_plays ON album_plays.album_id=albums.id`, userID).
 			Group("albums.id")
 	}
@@ -180,8 +200,124 @@ func GenreWithCounts(q *gorm.DB) *gorm.DB {
 		Group("genres.id")
 }
 
+// Work
+
+type WorkRow struct {
+	db.Work
+	AlbumCount int
+	TrackCount int
+}
+
+func (WorkRow) TableName() string { return "works" }
+
+func WorkWithCounts(q *gorm.DB) *gorm.DB {
+	return q.
+		Select([]string{"works.*", "count(DISTINCT coalesce(albums.disc_of_id, albums.id)) album_count", "count(DISTINCT tracks.id) track_count"}).
+		Joins("JOIN tracks ON tracks.work_id=works.id").
+		Joins("JOIN albums ON albums.id=tracks.album_id").
+		Group("works.id")
+}
+
 // Shared
 
+// WithoutDiscsOf leaves out the albums that are discs of another, which stands for them when browsing by tags
+func WithoutDiscsOf(q *gorm.DB) *gorm.DB {
+	return q.Where("albums.disc_of_id IS NULL")
+}
+
+// AudioFilter picks tracks by their audio properties. zero values match anything
+type AudioFilter struct {
+	MinSampleRate int
+	MinBitDepth   int
+	Channels      int
+	Codec         string
+}
+
+func (f AudioFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if f.MinSampleRate > 0 {
+		conds, args = append(conds, "tracks.sample_rate>=?"), append(args, f.MinSampleRate)
+	}
+	if f.MinBitDepth > 0 {
+		conds, args = append(conds, "tracks.bit_depth>=?"), append(args, f.MinBitDepth)
+	}
+	if f.Channels > 0 {
+		conds, args = append(conds, "tracks.channels=?"), append(args, f.Channels)
+	}
+	if f.Codec != "" {
+		conds, args = append(conds, "tracks.codec=?"), append(args, f.Codec)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// WithTrackAudio keeps the tracks that match f
+func WithTrackAudio(f AudioFilter) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		cond, args := f.where()
+		if cond == "" {
+			return q
+		}
+		return q.Where(cond, args...)
+	}
+}
+
+// WithAlbumAudio keeps the albums with a track that matches f, including the tracks of their other discs
+func WithAlbumAudio(f AudioFilter) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		cond, args := f.where()
+		if cond == "" {
+			return q
+		}
+		return q.Where("EXISTS (SELECT 1 FROM tracks JOIN albums discs ON discs.id=tracks.album_id WHERE (discs.id=albums.id OR discs.disc_of_id=albums.id) AND "+cond+")", args...)
+	}
+}
+
+// AlbumTagFilter picks albums by their label, release type, version, and compilation tags. zero values match anything
+type AlbumTagFilter struct {
+	Label               string
+	ReleaseTypes        []string // any of
+	ExcludeReleaseTypes []string // none of, like single to hide singles
+	Version             string
+	Compilation         *bool
+}
+
+// albumReleaseTypeCond matches albums with a release type, which is one of the comma separated values in the tag.
+// compilation matches the compilation flag too
+const albumReleaseTypeCond = `((', ' || lower(coalesce(albums.tag_release_type, '')) || ', ') LIKE ? OR (? AND coalesce(albums.tag_compilation, 0)))`
+
+func albumReleaseTypeArgs(releaseType string) []any {
+	releaseType = strings.ToLower(strings.TrimSpace(releaseType))
+	return []any{"%, " + releaseType + ", %", releaseType == "compilation"}
+}
+
+// WithAlbumTags keeps the albums that match f
+func WithAlbumTags(f AlbumTagFilter) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		if f.Label != "" {
+			q = q.Where("albums.id IN (SELECT album_id FROM album_labels WHERE label=? COLLATE NOCASE)", f.Label)
+		}
+		if len(f.ReleaseTypes) > 0 {
+			var conds []string
+			var args []any
+			for _, rt := range f.ReleaseTypes {
+				conds, args = append(conds, albumReleaseTypeCond), append(args, albumReleaseTypeArgs(rt)...)
+			}
+			q = q.Where("("+strings.Join(conds, " OR ")+")", args...)
+		}
+		for _, rt := range f.ExcludeReleaseTypes {
+			q = q.Where("NOT "+albumReleaseTypeCond, albumReleaseTypeArgs(rt)...)
+		}
+		if f.Version != "" {
+			q = q.Where("albums.tag_version=? COLLATE NOCASE", f.Version)
+		}
+		if f.Compilation != nil {
+			q = q.Where("coalesce(albums.tag_compilation, 0)=?", *f.Compilation)
+		}
+		return q
+	}
+}
+
 func WithAlbumRootDir(rootDir string) func(*gorm.DB) *gorm.DB {
 	return func(q *gorm.DB) *gorm.DB {
 		if rootDir == "" {
@@ -90,6 +90,8 @@ type Response struct {
 	ArtistInfoTwo         *ArtistInfo            `xml:"artistInfo2"           json:"artistInfo2,omitempty"`
 	AlbumInfo             *AlbumInfo             `xml:"albumInfo"             json:"albumInfo,omitempty"`
 	Genres                *Genres                `xml:"genres"                json:"genres,omitempty"`
+	Genre                 *GenreDetail           `xml:"genre"                 json:"genre,omitempty"`
+	AlbumArtwork          *AlbumArtwork          `xml:"albumArtwork"          json:"albumArtwork,omitempty"`
 	PlayQueue             *PlayQueue             `xml:"playQueue"             json:"playQueue,omitempty"`
 	JukeboxStatus         *JukeboxStatus         `xml:"jukeboxStatus"         json:"jukeboxStatus,omitempty"`
 	JukeboxPlaylist       *JukeboxPlaylist       `xml:"jukeboxPlaylist"       json:"jukeboxPlaylist,omitempty"`
@@ -101,9 +103,13 @@ type Response struct {
 	TopSongs              *TopSongs              `xml:"topSongs"              json:"topSongs,omitempty"`
 	SimilarSongs          *SimilarSongs          `xml:"similarSongs"          json:"similarSongs,omitempty"`
 	SimilarSongsTwo       *SimilarSongsTwo       `xml:"similarSongs2"         json:"similarSongs2,omitempty"`
+	Radio                 *Radio                 `xml:"radio"                 json:"radio,omitempty"`
 	InternetRadioStations *InternetRadioStations `xml:"internetRadioStations" json:"internetRadioStations,omitempty"`
 	Lyrics                *Lyrics                `xml:"lyrics"                json:"lyrics,omitempty"`
 	LyricsList            *LyricsList            `xml:"lyricsList"            json:"lyricsList,omitempty"`
+	Works                 *Works                 `xml:"works"                 json:"works,omitempty"`
+	Work                  *Work                  `xml:"work"                  json:"work,omitempty"`
+	Labels                *Labels                `xml:"labels"                json:"labels,omitempty"`
 }
 
 func NewResponse() *Response {
@@ -202,12 +208,14 @@ type Album struct {
 	Year       int           `xml:"year,attr,omitempty"    json:"year,omitempty"`
 	Tracks     []*TrackChild `xml:"song,omitempty"         json:"song,omitempty"`
 
-	IsCompilation bool           `xml:"isCompilation"      json:"isCompilation"`
-	ReleaseTypes  []string       `xml:"releaseTypes"       json:"releaseTypes"`
-	RecordLabels  []*RecordLabel `xml:"recordLabels"       json:"recordLabels"`
-	DiscTitles    []*DiscTitle   `xml:"discTitles"         json:"discTitles"`
-	MusicBrainzID string         `xml:"musicBrainzId,attr" json:"musicBrainzId"`
-	Version       string         `xml:"version,attr"       json:"version"`
+	IsCompilation bool           `xml:"isCompilation"           json:"isCompilation"`
+	ReleaseTypes  []string       `xml:"releaseTypes"            json:"releaseTypes"`
+	RecordLabels  []*RecordLabel `xml:"recordLabels"            json:"recordLabels"`
+	DiscTitles    []*DiscTitle   `xml:"discTitles"              json:"discTitles"`
+	MusicBrainzID string         `xml:"musicBrainzId,attr"      json:"musicBrainzId"`
+	Version       string         `xml:"version,attr"            json:"version"`
+	SortName      string         `xml:"sortName,attr,omitempty" json:"sortName,omitempty"`
+	Works         []*Work        `xml:"works"                   json:"works,omitempty"`
 
 	// star / rating
 	Starred       *time.Time `xml:"starred,attr,omitempty"         json:"starred,omitempty"`
@@ -274,8 +282,23 @@ type TrackChild struct {
 	MediaType   string      `xml:"mediaType,attr"             json:"mediaType"`
 	Year        int         `xml:"year,attr,omitempty"        json:"year,omitempty"`
 
+	SamplingRate int `xml:"samplingRate,attr,omitempty" json:"samplingRate,omitempty"`
+	BitDepth     int `xml:"bitDepth,attr,omitempty"     json:"bitDepth,omitempty"`
+	ChannelCount int `xml:"channelCount,attr,omitempty" json:"channelCount,omitempty"`
+
 	MusicBrainzID string   `xml:"musicBrainzId,attr"        json:"musicBrainzId"`
 	ISRC          []string `xml:"isrc,attr"                 json:"isrc"`
+	BPM           int      `xml:"bpm,attr,omitempty"        json:"bpm,omitempty"`
+	Comment       string   `xml:"comment,attr,omitempty"    json:"comment,omitempty"`
+	Moods         []string `xml:"moods"                     json:"moods"`
+	SortName      string   `xml:"sortName,attr,omitempty"   json:"sortName,omitempty"`
+
+	// classical
+	WorkID         *specid.ID `xml:"workId,attr,omitempty"         json:"workId,omitempty"`
+	Work           string     `xml:"work,attr,omitempty"           json:"work,omitempty"`
+	MovementName   string     `xml:"movementName,attr,omitempty"   json:"movementName,omitempty"`
+	MovementNumber int        `xml:"movementNumber,attr,omitempty" json:"movementNumber,omitempty"`
+	MovementCount  int        `xml:"movementCount,attr,omitempty"  json:"movementCount,omitempty"`
 
 	// star / rating
 	Starred       *time.Time `xml:"starred,attr,omitempty"         json:"starred,omitempty"`
@@ -290,6 +313,23 @@ type TrackChild struct {
 	TranscodeMeta
 }
 
+// Work is a composition, with the albums and tracks that are performances of it
+type Work struct {
+	ID            *specid.ID    `xml:"id,attr"                 json:"id"`
+	Name          string        `xml:"name,attr"               json:"name"`
+	Composer      string        `xml:"composer,attr,omitempty" json:"composer,omitempty"`
+	Composers     []*ArtistRef  `xml:"composers"               json:"composers,omitempty"`
+	MusicBrainzID string        `xml:"musicBrainzId,attr"      json:"musicBrainzId"`
+	AlbumCount    int           `xml:"albumCount,attr"         json:"albumCount"`
+	TrackCount    int           `xml:"songCount,attr"          json:"songCount"`
+	Albums        []*Album      `xml:"album,omitempty"         json:"album,omitempty"`
+	Tracks        []*TrackChild `xml:"song,omitempty"          json:"song,omitempty"`
+}
+
+type Works struct {
+	List []*Work `xml:"work" json:"work"`
+}
+
 type Artists struct {
 	IgnoredArticles string   `xml:"ignoredArticles,attr" json:"ignoredArticles"`
 	List            []*Index `xml:"index"                json:"index"`
@@ -301,6 +341,7 @@ type Artist struct {
 	CoverID        *specid.ID `xml:"coverArt,attr,omitempty"     json:"coverArt,omitempty"`
 	AlbumCount     int        `xml:"albumCount,attr"             json:"albumCount"`
 	MusicBrainzID  string     `xml:"musicBrainzId,attr"          json:"musicBrainzId"`
+	SortName       string     `xml:"sortName,attr,omitempty"     json:"sortName,omitempty"`
 	Disambiguation string     `xml:"disambiguation,attr"         json:"disambiguation"`
 	Roles          []string   `xml:"roles"                       json:"roles"`
 	Albums         []*Album   `xml:"album,omitempty"             json:"album,omitempty"`
@@ -347,6 +388,18 @@ type Licence struct {
 type ScanStatus struct {
 	Scanning bool `xml:"scanning,attr"        json:"scanning"`
 	Count    int  `xml:"count,attr,omitempty" json:"count,omitempty"`
+
+	// gonic extensions, about the running or last scan
+	FolderCount   int        `xml:"folderCount,attr,omitempty"   json:"folderCount,omitempty"`
+	FolderTotal   int        `xml:"folderTotal,attr,omitempty"   json:"folderTotal,omitempty"`
+	TracksNew     int        `xml:"tracksNew,attr,omitempty"     json:"tracksNew,omitempty"`
+	TracksUpdated int        `xml:"tracksUpdated,attr,omitempty" json:"tracksUpdated,omitempty"`
+	TracksRemoved int        `xml:"tracksRemoved,attr,omitempty" json:"tracksRemoved,omitempty"`
+	Errors        int        `xml:"errors,attr,omitempty"        json:"errors,omitempty"`
+	CurrentPath   string     `xml:"currentPath,attr,omitempty"   json:"currentPath,omitempty"`
+	ElapsedSecs   int        `xml:"elapsedSecs,attr,omitempty"   json:"elapsedSecs,omitempty"`
+	ETASecs       int        `xml:"etaSecs,attr,omitempty"       json:"etaSecs,omitempty"`
+	LastScan      *time.Time `xml:"lastScan,attr,omitempty"      json:"lastScan,omitempty"`
 }
 
 type SearchResultTwo struct {
@@ -385,6 +438,7 @@ type Playlists struct {
 
 type Playlist struct {
 	ID        specid.ID     `xml:"id,attr"         json:"id"`
+	CoverID   specid.ID     `xml:"coverArt,attr"   json:"coverArt"` // a collage of its albums if there's no image next to it
 	Name      string        `xml:"name,attr"       json:"name"`
 	Comment   string        `xml:"comment,attr"    json:"comment"`
 	Owner     string        `xml:"owner,attr"      json:"owner"`
@@ -413,14 +467,49 @@ type AlbumInfo struct {
 	LastFMURL     string `xml:"lastFmUrl"     json:"lastFmUrl"`
 }
 
+type Labels struct {
+	List []*Label `xml:"label" json:"label"`
+}
+
+type Label struct {
+	Name       string `xml:"name,attr"       json:"name"`
+	AlbumCount int    `xml:"albumCount,attr" json:"albumCount"`
+}
+
 type Genres struct {
 	List []*Genre `xml:"genre" json:"genre"`
 }
 
 type Genre struct {
-	Name       string `xml:",chardata"       json:"value"`
-	SongCount  int    `xml:"songCount,attr"  json:"songCount"`
-	AlbumCount int    `xml:"albumCount,attr" json:"albumCount"`
+	Name       string     `xml:",chardata"               json:"value"`
+	SongCount  int        `xml:"songCount,attr"          json:"songCount"`
+	AlbumCount int        `xml:"albumCount,attr"         json:"albumCount"`
+	Parent     string     `xml:"parent,attr,omitempty"   json:"parent,omitempty"`   // gonic extension, from the -genre-tree file
+	CoverID    *specid.ID `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"` // gonic extension, a collage of the genre's albums
+}
+
+// GenreDetail is a genre with its place in the -genre-tree hierarchy
+type GenreDetail struct {
+	Name       string     `xml:"name,attr"               json:"name"`
+	SongCount  int        `xml:"songCount,attr"          json:"songCount"`
+	AlbumCount int        `xml:"albumCount,attr"         json:"albumCount"`
+	Parent     string     `xml:"parent,attr,omitempty"   json:"parent,omitempty"`
+	CoverID    *specid.ID `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	Subgenres  []*Genre   `xml:"subgenre"                json:"subgenre"`
+}
+
+// AlbumArtwork is every image found in an album's folders, each of which can be passed to getCoverArt
+type AlbumArtwork struct {
+	ID      *specid.ID    `xml:"id,attr" json:"id"`
+	Artwork []*AlbumImage `xml:"artwork" json:"artwork"`
+}
+
+type AlbumImage struct {
+	ID       *specid.ID `xml:"id,attr"       json:"id"`
+	CoverID  *specid.ID `xml:"coverArt,attr" json:"coverArt"`
+	Kind     string     `xml:"kind,attr"     json:"kind"`
+	Position int        `xml:"position,attr" json:"position"`
+	Name     string     `xml:"name,attr"     json:"name"`
 }
 
 type PlayQueue struct {
@@ -484,6 +573,10 @@ type PodcastEpisode struct {
 	Path        string     `xml:"path,attr"                json:"path"`
 	Album       string     `xml:"album,attr"               json:"album"`
 	Artist      string     `xml:"artist,attr"              json:"artist"`
+
+	// per user
+	Played           bool `xml:"played,attr,omitempty"           json:"played,omitempty"`
+	BookmarkPosition int  `xml:"bookmarkPosition,attr,omitempty" json:"bookmarkPosition,omitempty"`
 }
 
 type Bookmarks struct {
@@ -523,15 +616,29 @@ type SimilarSongsTwo struct {
 	Tracks []*TrackChild `xml:"song,omitempty" json:"song,omitempty"`
 }
 
+type Radio struct {
+	Tracks []*TrackChild `xml:"song" json:"song"`
+}
+
 type InternetRadioStations struct {
 	List []*InternetRadioStation `xml:"internetRadioStation" json:"internetRadioStation,omitempty"`
 }
 
 type InternetRadioStation struct {
-	ID          *specid.ID `xml:"id,attr"          json:"id"`
-	Name        string     `xml:"name,attr"        json:"name"`
-	StreamURL   string     `xml:"streamUrl,attr"   json:"streamUrl"`
-	HomepageURL string     `xml:"homePageUrl,attr" json:"homePageUrl"`
+	ID          *specid.ID                  `xml:"id,attr"               json:"id"`
+	Name        string                      `xml:"name,attr"             json:"name"`
+	StreamURL   string                      `xml:"streamUrl,attr"        json:"streamUrl"`
+	HomepageURL string                      `xml:"homePageUrl,attr"      json:"homePageUrl"`
+	Proxy       bool                        `xml:"proxy,attr,omitempty"  json:"proxy,omitempty"`
+	NowPlaying  *InternetRadioStationPlayed `xml:"nowPlaying,omitempty"  json:"nowPlaying,omitempty"`
+}
+
+// InternetRadioStationPlayed is the last ICY StreamTitle seen while proxying a station
+type InternetRadioStationPlayed struct {
+	StreamTitle string `xml:"streamTitle,attr"      json:"streamTitle"`
+	Artist      string `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	Title       string `xml:"title,attr"            json:"title"`
+	Changed     Time   `xml:"changed,attr"          json:"changed"`
 }
 
 type Lyrics struct {
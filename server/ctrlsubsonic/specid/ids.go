@@ -28,6 +28,9 @@ const (
 	PodcastEpisode       IDT = "pe"
 	InternetRadioStation IDT = "ir"
 	Playlist             IDT = "pl"
+	Work                 IDT = "wk"
+	AlbumImage           IDT = "ai"
+	Genre                IDT = "gn"
 	separator                = "-"
 )
 
@@ -67,6 +70,12 @@ func New(in string) (ID, error) {
 		return ID{Type: PodcastEpisode, Value: val}, nil
 	case InternetRadioStation:
 		return ID{Type: InternetRadioStation, Value: val}, nil
+	case Work:
+		return ID{Type: Work, Value: val}, nil
+	case AlbumImage:
+		return ID{Type: AlbumImage, Value: val}, nil
+	case Genre:
+		return ID{Type: Genre, Value: val}, nil
 	default:
 		return ID{}, fmt.Errorf("%q: %w", partType, ErrBadPrefix)
 	}
@@ -18,6 +18,7 @@ func TestParseID(t *testing.T) {
 		{param: "ar-2", expType: Artist, expValue: 2},
 		{param: "tr-43", expType: Track, expValue: 43},
 		{param: "al-3", expType: Album, expValue: 3},
+		{param: "wk-7", expType: Work, expValue: 7},
 		{param: "xx-1", expErr: ErrBadPrefix},
 		{param: "1", expErr: ErrBadSeparator},
 		{param: "al-howdy", expErr: ErrNotAnInt},
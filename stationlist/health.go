@@ -0,0 +1,37 @@
+package stationlist
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.senan.xyz/gonic/db"
+)
+
+// CheckAll checks every station and saves whether it was reachable, and its content type
+func CheckAll(ctx context.Context, dbc *db.DB, client *http.Client) error {
+	var stations []*db.InternetRadioStation
+	if err := dbc.Find(&stations).Error; err != nil {
+		return fmt.Errorf("find stations: %w", err)
+	}
+	for _, station := range stations {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		contentType, err := Check(ctx, client, station.StreamURL)
+		update := map[string]any{
+			"health_checked_at":   time.Now(),
+			"health_ok":           err == nil,
+			"health_content_type": contentType,
+			"health_error":        "",
+		}
+		if err != nil {
+			update["health_error"] = err.Error()
+		}
+		if err := dbc.Model(station).UpdateColumns(update).Error; err != nil {
+			return fmt.Errorf("save station health: %w", err)
+		}
+	}
+	return nil
+}
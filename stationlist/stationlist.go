@@ -0,0 +1,313 @@
+// Package stationlist reads and writes lists of internet radio stations in the playlist formats stations are
+// usually published in (M3U, PLS, and XSPF), and checks whether stations are reachable.
+package stationlist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.senan.xyz/gonic/icy"
+)
+
+var ErrUnknownFormat = errors.New("unknown station list format")
+
+// how many levels of playlists pointing at other playlists to follow
+const maxResolveDepth = 3
+
+// don't read more than this from a list, real ones are a few KB at most
+const maxListSize = 1 << 20
+
+type Station struct {
+	Name        string
+	StreamURL   string
+	HomepageURL string
+}
+
+type Format string
+
+const (
+	FormatM3U  Format = "m3u"
+	FormatPLS  Format = "pls"
+	FormatXSPF Format = "xspf"
+)
+
+// DetectFormat guesses the format of a list from its file name or URL, its content type, and finally the start
+// of its contents
+func DetectFormat(name, contentType string, head []byte) (Format, bool) {
+	if u, err := url.Parse(name); err == nil {
+		name = u.Path
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".m3u", ".m3u8":
+		return FormatM3U, true
+	case ".pls":
+		return FormatPLS, true
+	case ".xspf":
+		return FormatXSPF, true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch strings.ToLower(mediaType) {
+	case "audio/x-mpegurl", "audio/mpegurl", "application/x-mpegurl", "application/vnd.apple.mpegurl":
+		return FormatM3U, true
+	case "audio/x-scpls", "audio/scpls":
+		return FormatPLS, true
+	case "application/xspf+xml":
+		return FormatXSPF, true
+	}
+	head = bytes.TrimSpace(head)
+	switch {
+	case bytes.HasPrefix(head, []byte("#EXTM3U")):
+		return FormatM3U, true
+	case bytes.HasPrefix(bytes.ToLower(head), []byte("[playlist]")):
+		return FormatPLS, true
+	case bytes.HasPrefix(head, []byte("<?xml")) && bytes.Contains(head, []byte("xspf")):
+		return FormatXSPF, true
+	}
+	return "", false
+}
+
+// Parse reads a station list in any supported format. name and contentType are used as hints to the format
+func Parse(r io.Reader, name, contentType string) ([]Station, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxListSize))
+	if err != nil {
+		return nil, fmt.Errorf("read list: %w", err)
+	}
+	format, ok := DetectFormat(name, contentType, data)
+	if !ok {
+		return nil, ErrUnknownFormat
+	}
+	switch format {
+	case FormatM3U:
+		return ParseM3U(bytes.NewReader(data))
+	case FormatPLS:
+		return ParsePLS(bytes.NewReader(data))
+	default:
+		return ParseXSPF(bytes.NewReader(data))
+	}
+}
+
+// ParseM3U reads plain or extended M3U. #EXTINF titles are used as station names
+func ParseM3U(r io.Reader) ([]Station, error) {
+	var stations []Station
+	var name string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			if _, title, ok := strings.Cut(line, ","); ok {
+				name = strings.TrimSpace(title)
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			stations = append(stations, Station{Name: name, StreamURL: line})
+			name = ""
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan m3u: %w", err)
+	}
+	return stations, nil
+}
+
+// ParsePLS reads a PLS list, which is an ini file with numbered FileN and TitleN keys
+func ParsePLS(r io.Reader) ([]Station, error) {
+	byNum := map[int]*Station{}
+	var order []int
+	get := func(n int) *Station {
+		if s, ok := byNum[n]; ok {
+			return s
+		}
+		byNum[n] = &Station{}
+		order = append(order, n)
+		return byNum[n]
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch {
+		case strings.HasPrefix(key, "file"):
+			if n, err := strconv.Atoi(key[len("file"):]); err == nil {
+				get(n).StreamURL = value
+			}
+		case strings.HasPrefix(key, "title"):
+			if n, err := strconv.Atoi(key[len("title"):]); err == nil {
+				get(n).Name = value
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan pls: %w", err)
+	}
+
+	var stations []Station
+	for _, n := range order {
+		if s := byNum[n]; s.StreamURL != "" {
+			stations = append(stations, *s)
+		}
+	}
+	return stations, nil
+}
+
+type xspfPlaylist struct {
+	Tracks []struct {
+		Location []string `xml:"location"`
+		Title    string   `xml:"title"`
+		Info     string   `xml:"info"`
+	} `xml:"trackList>track"`
+}
+
+// ParseXSPF reads an XSPF list. each track's first location is the stream, and its info link is the homepage
+func ParseXSPF(r io.Reader) ([]Station, error) {
+	var playlist xspfPlaylist
+	if err := xml.NewDecoder(r).Decode(&playlist); err != nil {
+		return nil, fmt.Errorf("decode xspf: %w", err)
+	}
+	var stations []Station
+	for _, track := range playlist.Tracks {
+		if len(track.Location) == 0 {
+			continue
+		}
+		stations = append(stations, Station{
+			Name:        strings.TrimSpace(track.Title),
+			StreamURL:   strings.TrimSpace(track.Location[0]),
+			HomepageURL: strings.TrimSpace(track.Info),
+		})
+	}
+	return stations, nil
+}
+
+// WriteM3U writes stations as an extended M3U list
+func WriteM3U(w io.Writer, stations []Station) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	for _, s := range stations {
+		fmt.Fprintf(bw, "#EXTINF:-1,%s\n", strings.ReplaceAll(s.Name, "\n", " "))
+		fmt.Fprintln(bw, s.StreamURL)
+	}
+	return bw.Flush()
+}
+
+// Resolve replaces any stations whose stream URL is itself a station list with the stations in that list, since
+// lots of stations publish a .pls or .m3u that points at the actual stream. names from the outer list win. stations
+// whose list can't be fetched are skipped, with why in skipped, since public lists often have some dead entries
+func Resolve(ctx context.Context, client *http.Client, stations []Station) (resolved []Station, skipped []error) {
+	return resolve(ctx, client, stations, 0)
+}
+
+func resolve(ctx context.Context, client *http.Client, stations []Station, depth int) ([]Station, []error) {
+	var resolved []Station
+	var skipped []error
+	for _, s := range stations {
+		if !isListURL(s.StreamURL) || depth >= maxResolveDepth {
+			resolved = append(resolved, s)
+			continue
+		}
+		nested, err := fetch(ctx, client, s.StreamURL)
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("fetch nested list %q: %w", s.StreamURL, err))
+			continue
+		}
+		nested, nestedSkipped := resolve(ctx, client, nested, depth+1)
+		skipped = append(skipped, nestedSkipped...)
+		if len(nested) == 0 {
+			continue
+		}
+		// a nested list is normally a few mirrors of the same stream, just take the first
+		first := nested[0]
+		if s.Name != "" {
+			first.Name = s.Name
+		}
+		if s.HomepageURL != "" {
+			first.HomepageURL = s.HomepageURL
+		}
+		resolved = append(resolved, first)
+	}
+	return resolved, skipped
+}
+
+// HLS playlists are .m3u8 too, but they're a stream not a list of stations
+func isListURL(streamURL string) bool {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".m3u", ".pls", ".xspf":
+		return true
+	}
+	return false
+}
+
+// Fetch downloads and parses a station list, resolving nested lists. see Resolve for skipped
+func Fetch(ctx context.Context, client *http.Client, listURL string) (stations []Station, skipped []error, err error) {
+	stations, err = fetch(ctx, client, listURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	stations, skipped = Resolve(ctx, client, stations)
+	return stations, skipped, nil
+}
+
+func fetch(ctx context.Context, client *http.Client, listURL string) ([]Station, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get list: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("get list: unexpected status %d", resp.StatusCode)
+	}
+
+	stations, err := Parse(resp.Body, listURL, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	// relative entries are relative to the list they're in
+	base := resp.Request.URL
+	for i := range stations {
+		if ref, err := url.Parse(stations[i].StreamURL); err == nil {
+			stations[i].StreamURL = base.ResolveReference(ref).String()
+		}
+	}
+	return stations, nil
+}
+
+// Check connects to a stream and returns its content type. the body isn't read past the headers
+func Check(ctx context.Context, client *http.Client, streamURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set(icy.RequestHeader, "1")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("get stream: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Content-Type"), nil
+}
@@ -0,0 +1,162 @@
+package stationlist_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.senan.xyz/gonic/stationlist"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tcases := []struct {
+		name        string
+		contentType string
+		list        string
+		expected    []stationlist.Station
+	}{
+		{
+			name: "stations.m3u",
+			list: "#EXTM3U\n#EXTINF:-1,Station A\nhttp://a.example/stream\n\nhttp://b.example/stream\n",
+			expected: []stationlist.Station{
+				{Name: "Station A", StreamURL: "http://a.example/stream"},
+				{StreamURL: "http://b.example/stream"},
+			},
+		},
+		{
+			name:        "listen",
+			contentType: "audio/x-scpls",
+			list:        "[playlist]\nNumberOfEntries=2\nFile1=http://a.example/stream\nTitle1=Station A\nLength1=-1\nFile2=http://b.example/stream\nVersion=2\n",
+			expected: []stationlist.Station{
+				{Name: "Station A", StreamURL: "http://a.example/stream"},
+				{StreamURL: "http://b.example/stream"},
+			},
+		},
+		{
+			name: "stations.xspf",
+			list: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <trackList>
+    <track><location>http://a.example/stream</location><title>Station A</title><info>http://a.example/</info></track>
+    <track><title>No Location</title></track>
+  </trackList>
+</playlist>`,
+			expected: []stationlist.Station{
+				{Name: "Station A", StreamURL: "http://a.example/stream", HomepageURL: "http://a.example/"},
+			},
+		},
+		{
+			// no hints, sniffed from the contents
+			name: "",
+			list: "[Playlist]\nFile1=http://a.example/stream\n",
+			expected: []stationlist.Station{
+				{StreamURL: "http://a.example/stream"},
+			},
+		},
+	}
+
+	for _, tc := range tcases {
+		stations, err := stationlist.Parse(strings.NewReader(tc.list), tc.name, tc.contentType)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, stations)
+	}
+
+	_, err := stationlist.Parse(strings.NewReader("just some text"), "", "")
+	assert.ErrorIs(t, err, stationlist.ErrUnknownFormat)
+}
+
+func TestWriteM3URoundTrip(t *testing.T) {
+	t.Parallel()
+
+	stations := []stationlist.Station{
+		{Name: "Station A", StreamURL: "http://a.example/stream"},
+		{Name: "Station B", StreamURL: "http://b.example/stream"},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, stationlist.WriteM3U(&buf, stations))
+	assert.Equal(t, "#EXTM3U\n#EXTINF:-1,Station A\nhttp://a.example/stream\n#EXTINF:-1,Station B\nhttp://b.example/stream\n", buf.String())
+
+	parsed, err := stationlist.Parse(&buf, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, stations, parsed)
+}
+
+func TestFetchNested(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stations.m3u", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("#EXTM3U\n#EXTINF:-1,Station A\n/a/listen.pls\n#EXTINF:-1,Station B\nhttp://b.example/stream\n#EXTINF:-1,Station C\nhttp://c.example/live.m3u8\n"))
+	})
+	mux.HandleFunc("/a/listen.pls", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("[playlist]\nFile1=mirror.m3u\nTitle1=Inner Name\n"))
+	})
+	mux.HandleFunc("/a/mirror.m3u", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("http://a.example/stream\nhttp://a2.example/stream\n"))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	stations, skipped, err := stationlist.Fetch(t.Context(), srv.Client(), srv.URL+"/stations.m3u")
+	require.NoError(t, err)
+	assert.Empty(t, skipped)
+	assert.Equal(t, []stationlist.Station{
+		{Name: "Station A", StreamURL: "http://a.example/stream"},
+		{Name: "Station B", StreamURL: "http://b.example/stream"},
+		{Name: "Station C", StreamURL: "http://c.example/live.m3u8"}, // hls, left alone
+	}, stations)
+}
+
+func TestFetchNestedDead(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stations.m3u", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("#EXTM3U\n#EXTINF:-1,Station A\n/a/listen.pls\n#EXTINF:-1,Station B\nhttp://b.example/stream\n"))
+	})
+	srv := httptest.NewServer(mux) // so /a/listen.pls is a 404
+	t.Cleanup(srv.Close)
+
+	// the dead entry is skipped, and the rest are still there
+	stations, skipped, err := stationlist.Fetch(t.Context(), srv.Client(), srv.URL+"/stations.m3u")
+	require.NoError(t, err)
+	assert.Equal(t, []stationlist.Station{
+		{Name: "Station B", StreamURL: "http://b.example/stream"},
+	}, stations)
+	require.Len(t, skipped, 1)
+	assert.ErrorContains(t, skipped[0], "/a/listen.pls")
+	assert.ErrorContains(t, skipped[0], "404")
+
+	// the list itself being dead is still an error
+	_, _, err = stationlist.Fetch(t.Context(), srv.Client(), srv.URL+"/missing.m3u")
+	require.Error(t, err)
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		_, _ = w.Write([]byte("audio"))
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	contentType, err := stationlist.Check(t.Context(), srv.Client(), srv.URL+"/ok")
+	require.NoError(t, err)
+	assert.Equal(t, "audio/mpeg", contentType)
+
+	_, err = stationlist.Check(t.Context(), srv.Client(), srv.URL+"/gone")
+	assert.Error(t, err)
+}
@@ -0,0 +1,219 @@
+package tags_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	gotaglib "go.senan.xyz/taglib"
+	"go.senan.xyz/wrtag/tags/normtag"
+
+	"go.senan.xyz/gonic/tags"
+	"go.senan.xyz/gonic/tags/ffprobe"
+	"go.senan.xyz/gonic/tags/native"
+	"go.senan.xyz/gonic/tags/taglib"
+)
+
+// all the readers should agree with taglib, the default, on the fixtures. most are tagged with taglib first so the
+// other readers see how it writes each format, the rest are read as they are
+func TestReaderConformance(t *testing.T) {
+	t.Parallel()
+
+	readers := map[string]tags.Reader{
+		"native": native.Reader{},
+	}
+	if _, err := exec.LookPath("ffprobe"); err == nil {
+		readers["ffprobe"] = ffprobe.Reader{}
+	}
+
+	var cover bytes.Buffer
+	require.NoError(t, png.Encode(&cover, image.NewGray(image.Rect(0, 0, 8, 8))))
+
+	fixtures := []struct {
+		name     string
+		write    bool
+		codec    string
+		bitDepth uint
+	}{
+		{"5s.flac", true, "flac", 16},
+		{"eg.mp3", true, "mp3", 0},
+		{"id3v23.mp3", false, "mp3", 0},
+		{"eg.ogg", true, "vorbis", 0},
+		{"eg.opus", true, "opus", 0},
+		{"eg.m4a", true, "aac", 0},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), fixture.name)
+			copyFile(t, filepath.Join("testdata", fixture.name), path)
+			if fixture.write {
+				require.NoError(t, gotaglib.WriteTags(path, fullTags, gotaglib.Clear))
+				require.NoError(t, gotaglib.WriteImage(path, cover.Bytes()))
+			}
+
+			wantProps, wantTags, err := taglib.Reader{}.Read(path)
+			require.NoError(t, err)
+			wantCover, err := taglib.Reader{}.ReadCover(path)
+			require.NoError(t, err)
+			require.NotEmpty(t, wantTags)
+			require.True(t, wantProps.HasCover)
+			require.Equal(t, fixture.codec, wantProps.Codec)
+			require.Equal(t, fixture.bitDepth, wantProps.BitDepth)
+			require.NotZero(t, wantProps.SampleRate)
+			require.NotZero(t, wantProps.Channels)
+
+			for name, reader := range readers {
+				t.Run(name, func(t *testing.T) {
+					require.True(t, reader.CanRead(path))
+
+					props, tgs, err := reader.Read(path)
+					require.NoError(t, err)
+					require.Equal(t, wantProps.HasCover, props.HasCover)
+					require.Equal(t, wantProps.SampleRate, props.SampleRate)
+					require.Equal(t, wantProps.Channels, props.Channels)
+					require.Equal(t, wantProps.BitDepth, props.BitDepth)
+					require.Equal(t, wantProps.Codec, props.Codec)
+
+					// ffprobe only has seconds and its own names for some keys, so just check the basics
+					if name == "ffprobe" {
+						require.InDelta(t, wantProps.Length.Seconds(), props.Length.Seconds(), 1)
+						for _, k := range []string{normtag.Title, normtag.Album, normtag.AlbumArtist} {
+							require.Equal(t, normtag.Get(wantTags, k), normtag.Get(tgs, k), k)
+						}
+						return
+					}
+
+					require.Equal(t, wantTags, tgs)
+					require.Equal(t, wantProps.Length, props.Length)
+					require.Equal(t, wantProps.Bitrate, props.Bitrate)
+
+					gotCover, err := reader.ReadCover(path)
+					require.NoError(t, err)
+					require.Equal(t, wantCover, gotCover)
+				})
+			}
+		})
+	}
+}
+
+//nolint:gochecknoglobals
+var fullTags = map[string][]string{
+	"TITLE":                      {"Title"},
+	"ARTIST":                     {"Artist A", "Artist B"},
+	"ARTISTS":                    {"Artist A", "Artist B"},
+	"ALBUMARTIST":                {"Album Artist"},
+	"ALBUM":                      {"Album"},
+	"ALBUMSORT":                  {"Album, The"},
+	"TRACKNUMBER":                {"3/12"},
+	"DISCNUMBER":                 {"1/2"},
+	"DATE":                       {"2021-03-04"},
+	"ORIGINALDATE":               {"1999"},
+	"GENRE":                      {"Rock", "Jazz"},
+	"COMPOSER":                   {"Composer"},
+	"LABEL":                      {"Label"},
+	"RELEASETYPE":                {"album"},
+	"ISRC":                       {"ISRC1"},
+	"BPM":                        {"120"},
+	"COMPILATION":                {"1"},
+	"COMMENT":                    {"a comment"},
+	"LYRICS":                     {"la la"},
+	"MUSICBRAINZ_TRACKID":        {"recording-id"},
+	"MUSICBRAINZ_RELEASETRACKID": {"release-track-id"},
+	"MUSICBRAINZ_ALBUMID":        {"release-id"},
+	"MUSICBRAINZ_ARTISTID":       {"artist-id"},
+	"MUSICBRAINZ_ALBUMARTISTID":  {"album-artist-id"},
+	"REPLAYGAIN_TRACK_GAIN":      {"-6.5 dB"},
+	"REPLAYGAIN_TRACK_PEAK":      {"0.9"},
+	"CUSTOM KEY":                 {"custom"},
+}
+
+func copyFile(t *testing.T, src, dest string) {
+	t.Helper()
+	b, err := os.ReadFile(src)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dest, b, 0o644))
+}
+
+// ratings written by the taglib writer, or the native one for MP3s, can be read back, without losing any other tags or
+// the audio
+func TestRatingWriter(t *testing.T) {
+	t.Parallel()
+
+	writers := map[string]tags.RatingWriter{"taglib": taglib.Writer{}, "native": native.Writer{}}
+	for _, name := range []string{"5s.flac", "eg.mp3", "id3v23.mp3", "eg.ogg", "eg.m4a"} {
+		for writerName, w := range writers {
+			if !w.CanWriteRating(name) {
+				continue
+			}
+			t.Run(writerName+"/"+name, func(t *testing.T) {
+				t.Parallel()
+				testRatingWriter(t, w, name)
+			})
+		}
+	}
+}
+
+func testRatingWriter(t *testing.T, w tags.RatingWriter, name string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	copyFile(t, filepath.Join("testdata", name), path)
+	beforeProps, beforeTags, err := native.Reader{}.Read(path)
+	require.NoError(t, err)
+
+	require.NoError(t, w.WriteRating(path, tags.Rating{Email: "alice", Stars: 4, Loved: true, Primary: true, FMPS: true}))
+	require.NoError(t, w.WriteRating(path, tags.Rating{Email: "bob", Stars: 2}))
+
+	props, trags, err := native.Reader{}.Read(path)
+	require.NoError(t, err)
+	require.Equal(t, beforeProps.Length, props.Length)
+	require.Equal(t, normtag.Get(beforeTags, normtag.Title), normtag.Get(trags, normtag.Title))
+	require.Equal(t, "1", normtag.Get(trags, tags.KeyLoved))
+	require.Equal(t, "0.8", normtag.Get(trags, tags.KeyFMPSRating))
+
+	if filepath.Ext(name) == ".mp3" {
+		popm, err := native.ReadPopularimeters(path)
+		require.NoError(t, err)
+		require.Equal(t, map[string]byte{"alice": 196, "bob": 64}, popm)
+
+		// and given with the tags, by both readers
+		require.Equal(t, byte(196), tags.POPM(trags, "alice"))
+		_, taglibTags, err := taglib.Reader{}.Read(path)
+		require.NoError(t, err)
+		require.Equal(t, byte(64), tags.POPM(taglibTags, "bob"))
+	} else {
+		require.Equal(t, 4, tags.ParseRating(normtag.Get(trags, tags.KeyRating)))
+	}
+
+	// and cleared
+	require.NoError(t, w.WriteRating(path, tags.Rating{Email: "alice", Primary: true, FMPS: true}))
+	_, trags, err = native.Reader{}.Read(path)
+	require.NoError(t, err)
+	require.Empty(t, normtag.Get(trags, tags.KeyLoved))
+	require.Empty(t, normtag.Get(trags, tags.KeyRating))
+	require.Empty(t, normtag.Get(trags, tags.KeyFMPSRating))
+	if filepath.Ext(name) == ".mp3" {
+		popm, err := native.ReadPopularimeters(path)
+		require.NoError(t, err)
+		require.Equal(t, map[string]byte{"bob": 64}, popm)
+	}
+}
+
+func TestRatingScales(t *testing.T) {
+	t.Parallel()
+
+	for stars := range 6 {
+		require.Equal(t, stars, tags.POPMToStars(tags.StarsToPOPM(stars)))
+		require.Equal(t, stars, tags.ParseFMPSRating(tags.FormatFMPSRating(stars)))
+	}
+	require.Equal(t, 3, tags.ParseRating("3"))
+	require.Equal(t, 4, tags.ParseRating("80"))
+	require.Equal(t, 0, tags.ParseRating(""))
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"go.senan.xyz/gonic/tags"
+	"go.senan.xyz/gonic/tags/native"
 )
 
 var _ tags.Reader = Reader{}
@@ -25,14 +26,19 @@ func (Reader) CanRead(absPath string) bool {
 }
 
 func (Reader) Read(absPath string) (tags.Properties, tags.Tags, error) {
-	out, err := exec.Command("ffprobe", "-hide_banner", "-v", "0", "-i", absPath, "-show_entries", "format:stream=codec_type", "-of", "json").Output()
+	out, err := exec.Command("ffprobe", "-hide_banner", "-v", "0", "-i", absPath, "-show_entries", "format:stream=codec_type,codec_name,sample_rate,channels,bits_per_raw_sample,bits_per_sample", "-of", "json").Output()
 	if err != nil {
 		return tags.Properties{}, nil, fmt.Errorf("output: %w", err)
 	}
 
 	var d struct {
 		Streams []struct {
-			CodecType string `json:"codec_type"`
+			CodecType        string `json:"codec_type"`
+			CodecName        string `json:"codec_name"`
+			SampleRate       string `json:"sample_rate"`
+			Channels         uint   `json:"channels"`
+			BitsPerRawSample string `json:"bits_per_raw_sample"`
+			BitsPerSample    uint   `json:"bits_per_sample"`
 		} `json:"streams"`
 		Format struct {
 			Duration string            `json:"duration"`
@@ -56,18 +62,36 @@ func (Reader) Read(absPath string) (tags.Properties, tags.Tags, error) {
 		tgs[k] = strings.Split(vs, ";")
 	}
 
-	var hasCover bool
-	for _, s := range d.Streams {
-		if s.CodecType == "video" {
-			hasCover = true
-			break
-		}
+	if (native.Writer{}).CanWriteRating(absPath) {
+		popm, _ := native.ReadPopularimeters(absPath) // a broken tag just has no ratings
+		tags.AddPOPM(tgs, popm)
 	}
 
 	props := tags.Properties{
-		Length:   time.Duration(durationSecs) * time.Second,
-		Bitrate:  uint(bitRateBitsPerSec / 1000),
-		HasCover: hasCover,
+		Length:  time.Duration(durationSecs) * time.Second,
+		Bitrate: uint(bitRateBitsPerSec / 1000),
+	}
+	var haveAudio bool
+	for _, s := range d.Streams {
+		switch s.CodecType {
+		case "video":
+			props.HasCover = true
+		case "audio":
+			if haveAudio {
+				continue
+			}
+			haveAudio = true
+			sampleRate, _ := strconv.Atoi(s.SampleRate)
+			props.SampleRate = uint(sampleRate)
+			props.Channels = s.Channels
+			props.Codec = s.CodecName
+			// flac and alac have it raw, pcm as the sample size. lossy codecs have neither
+			if bitDepth, _ := strconv.Atoi(s.BitsPerRawSample); bitDepth > 0 {
+				props.BitDepth = uint(bitDepth)
+			} else {
+				props.BitDepth = s.BitsPerSample
+			}
+		}
 	}
 
 	return props, tgs, nil
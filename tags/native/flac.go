@@ -0,0 +1,81 @@
+package native
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+// https://xiph.org/flac/format.html#metadata_block
+func readFLAC(f *file, r io.ReaderAt, start, size int64, withCover bool) error {
+	offset := start + 4 // "fLaC"
+
+	var sampleRate uint32
+	var samples int64
+	for {
+		var header [4]byte
+		if _, err := r.ReadAt(header[:], offset); err != nil {
+			return fmt.Errorf("read block header: %w", errInvalid)
+		}
+		last := header[0]&0x80 != 0
+		typ := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		offset += 4
+
+		switch typ {
+		case flacStreamInfo, flacVorbisComment, flacPicture:
+			if offset+length > size {
+				return fmt.Errorf("block past end of file: %w", errInvalid)
+			}
+			if typ == flacPicture && !withCover {
+				f.addCover(nil)
+				break
+			}
+			block := make([]byte, length)
+			if _, err := r.ReadAt(block, offset); err != nil {
+				return fmt.Errorf("read block: %w", err)
+			}
+			switch typ {
+			case flacStreamInfo:
+				if len(block) < 18 {
+					return fmt.Errorf("stream info: %w", errInvalid)
+				}
+				// 20 bits of sample rate, 3 of channels minus one, 5 of bits per sample minus one, 36 of samples
+				v := binary.BigEndian.Uint64(block[10:18])
+				sampleRate = uint32(v >> 44)
+				samples = int64(v & (1<<36 - 1))
+				f.channels = uint(v>>41&0x07) + 1
+				f.bitDepth = uint(v>>36&0x1f) + 1
+			case flacVorbisComment:
+				if err := readVorbisComment(f, block, withCover); err != nil {
+					return fmt.Errorf("vorbis comment: %w", err)
+				}
+			case flacPicture:
+				data, err := readPictureBlock(block)
+				if err != nil {
+					return fmt.Errorf("picture: %w", err)
+				}
+				f.addCover(data)
+			}
+		}
+
+		offset += length
+		if last {
+			break
+		}
+	}
+
+	f.codec = "flac"
+	f.sampleRate = uint(sampleRate)
+
+	ms := samplesMs(samples, sampleRate)
+	f.length = msDuration(ms)
+	f.bitrate = bitrate(size-offset-id3v1Size(r, size), ms)
+	return nil
+}
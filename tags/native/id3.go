@@ -0,0 +1,602 @@
+package native
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// frame ids to keys, the same as taglib's
+//
+//nolint:gochecknoglobals
+var id3FrameKeys = map[string]string{
+	"TALB": "ALBUM",
+	"TBPM": "BPM",
+	"TCOM": "COMPOSER",
+	"TCON": "GENRE",
+	"TCOP": "COPYRIGHT",
+	"TDEN": "ENCODINGTIME",
+	"TDLY": "PLAYLISTDELAY",
+	"TDOR": "ORIGINALDATE",
+	"TDRC": "DATE",
+	"TDRL": "RELEASEDATE",
+	"TDTG": "TAGGINGDATE",
+	"TENC": "ENCODEDBY",
+	"TEXT": "LYRICIST",
+	"TFLT": "FILETYPE",
+	"TIT1": "WORK",
+	"TIT2": "TITLE",
+	"TIT3": "SUBTITLE",
+	"TKEY": "INITIALKEY",
+	"TLAN": "LANGUAGE",
+	"TLEN": "LENGTH",
+	"TMED": "MEDIA",
+	"TMOO": "MOOD",
+	"TOAL": "ORIGINALALBUM",
+	"TOFN": "ORIGINALFILENAME",
+	"TOLY": "ORIGINALLYRICIST",
+	"TOPE": "ORIGINALARTIST",
+	"TOWN": "OWNER",
+	"TPE1": "ARTIST",
+	"TPE2": "ALBUMARTIST",
+	"TPE3": "CONDUCTOR",
+	"TPE4": "REMIXER",
+	"TPOS": "DISCNUMBER",
+	"TPRO": "PRODUCEDNOTICE",
+	"TPUB": "LABEL",
+	"TRCK": "TRACKNUMBER",
+	"TRSN": "RADIOSTATION",
+	"TRSO": "RADIOSTATIONOWNER",
+	"TSOA": "ALBUMSORT",
+	"TSOC": "COMPOSERSORT",
+	"TSOP": "ARTISTSORT",
+	"TSOT": "TITLESORT",
+	"TSO2": "ALBUMARTISTSORT",
+	"TSRC": "ISRC",
+	"TSSE": "ENCODING",
+	"TSST": "DISCSUBTITLE",
+	"TCMP": "COMPILATION",
+	"MVNM": "MOVEMENTNAME",
+	"MVIN": "MOVEMENTNUMBER",
+	"GRP1": "GROUPING",
+	"WCOP": "COPYRIGHTURL",
+	"WOAF": "FILEWEBPAGE",
+	"WOAR": "ARTISTWEBPAGE",
+	"WOAS": "AUDIOSOURCEWEBPAGE",
+	"WORS": "RADIOSTATIONWEBPAGE",
+	"WPAY": "PAYMENTWEBPAGE",
+	"WPUB": "PUBLISHERWEBPAGE",
+}
+
+// TXXX descriptions to keys, where they're not just the uppercased description
+//
+//nolint:gochecknoglobals
+var id3UserTextKeys = map[string]string{
+	"MUSICBRAINZ ALBUM ID":              "MUSICBRAINZ_ALBUMID",
+	"MUSICBRAINZ ARTIST ID":             "MUSICBRAINZ_ARTISTID",
+	"MUSICBRAINZ ALBUM ARTIST ID":       "MUSICBRAINZ_ALBUMARTISTID",
+	"MUSICBRAINZ ALBUM RELEASE COUNTRY": "RELEASECOUNTRY",
+	"MUSICBRAINZ ALBUM STATUS":          "RELEASESTATUS",
+	"MUSICBRAINZ ALBUM TYPE":            "RELEASETYPE",
+	"MUSICBRAINZ RELEASE GROUP ID":      "MUSICBRAINZ_RELEASEGROUPID",
+	"MUSICBRAINZ RELEASE TRACK ID":      "MUSICBRAINZ_RELEASETRACKID",
+	"MUSICBRAINZ WORK ID":               "MUSICBRAINZ_WORKID",
+	"ACOUSTID ID":                       "ACOUSTID_ID",
+	"ACOUSTID FINGERPRINT":              "ACOUSTID_FINGERPRINT",
+	"MUSICIP PUID":                      "MUSICIP_PUID",
+}
+
+// TIPL roles to keys
+//
+//nolint:gochecknoglobals
+var id3InvolvedPeopleKeys = map[string]string{
+	"ARRANGER": "ARRANGER",
+	"ENGINEER": "ENGINEER",
+	"PRODUCER": "PRODUCER",
+	"DJ-MIX":   "DJMIXER",
+	"MIX":      "MIXER",
+}
+
+// ID3v2.2 frame ids to their later versions
+//
+//nolint:gochecknoglobals
+var id3v22FrameIDs = map[string]string{
+	"BUF": "RBUF", "CNT": "PCNT", "COM": "COMM", "CRA": "AENC", "ETC": "ETCO", "GEO": "GEOB", "IPL": "TIPL",
+	"MCI": "MCDI", "MLL": "MLLT", "PIC": "APIC", "POP": "POPM", "REV": "RVRB", "SLT": "SYLT", "STC": "SYTC",
+	"TAL": "TALB", "TBP": "TBPM", "TCM": "TCOM", "TCO": "TCON", "TCP": "TCMP", "TCR": "TCOP", "TDA": "TDAT",
+	"TDY": "TDLY", "TEN": "TENC", "TFT": "TFLT", "TIM": "TIME", "TKE": "TKEY", "TLA": "TLAN", "TLE": "TLEN",
+	"TMT": "TMED", "TOA": "TOPE", "TOF": "TOFN", "TOL": "TOLY", "TOR": "TORY", "TOT": "TOAL", "TP1": "TPE1",
+	"TP2": "TPE2", "TP3": "TPE3", "TP4": "TPE4", "TPA": "TPOS", "TPB": "TPUB", "TRC": "TSRC", "TRD": "TRDA",
+	"TRK": "TRCK", "TS2": "TSO2", "TSA": "TSOA", "TSC": "TSOC", "TSI": "TSIZ", "TSP": "TSOP", "TSS": "TSSE",
+	"TST": "TSOT", "TT1": "TIT1", "TT2": "TIT2", "TT3": "TIT3", "TXT": "TEXT", "TXX": "TXXX", "TYE": "TYER",
+	"UFI": "UFID", "ULT": "USLT", "WAF": "WOAF", "WAR": "WOAR", "WAS": "WOAS", "WCM": "WCOM", "WCP": "WCOP",
+	"WPB": "WPUB", "WXX": "WXXX",
+}
+
+const (
+	id3EncodingLatin1 = iota
+	id3EncodingUTF16
+	id3EncodingUTF16BE
+	id3EncodingUTF8
+)
+
+// readID3v2 reads the ID3v2 tag at the start of r, returning its size including the header and any footer, or 0
+// if there isn't one
+//
+// https://id3.org/id3v2.4.0-structure, https://id3.org/id3v2.3.0, https://id3.org/id3v2-00
+func readID3v2(f *file, r io.ReaderAt, withCover bool) (int64, error) {
+	var header [10]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil || !bytes.HasPrefix(header[:], []byte("ID3")) {
+		return 0, nil //nolint:nilerr // no tag
+	}
+	version := header[3]
+	flags := header[5]
+	size := int64(syncsafe(header[6:10]))
+	total := size + 10
+	if flags&0x10 != 0 {
+		total += 10 // footer
+	}
+
+	b := make([]byte, size)
+	if _, err := r.ReadAt(b, 10); err != nil {
+		return 0, fmt.Errorf("read tag: %w", errInvalid)
+	}
+	if version < 4 && flags&0x80 != 0 {
+		b = unsync(b)
+	}
+	if flags&0x40 != 0 && version >= 3 {
+		// extended header
+		if len(b) < 4 {
+			return 0, fmt.Errorf("extended header: %w", errInvalid)
+		}
+		n := int(binary.BigEndian.Uint32(b)) + 4
+		if version == 4 {
+			n = int(syncsafe(b[:4]))
+		}
+		if n > len(b) || n < 0 {
+			return 0, fmt.Errorf("extended header: %w", errInvalid)
+		}
+		b = b[n:]
+	}
+
+	var dates id3Dates
+frames:
+	for len(b) > 0 {
+		var id string
+		var frameSize int
+		var formatFlags byte
+		switch version {
+		case 2:
+			if len(b) < 6 {
+				break frames
+			}
+			id = id3v22FrameIDs[string(b[:3])]
+			frameSize = int(b[3])<<16 | int(b[4])<<8 | int(b[5])
+			b = b[6:]
+		case 3, 4:
+			if len(b) < 10 {
+				break frames
+			}
+			id = string(b[:4])
+			frameSize = int(binary.BigEndian.Uint32(b[4:8]))
+			if version == 4 {
+				frameSize = int(syncsafe(b[4:8]))
+			}
+			formatFlags = b[9]
+			b = b[10:]
+		default:
+			return total, nil // unknown version, but the audio can still be read after it
+		}
+		if id == "" && frameSize == 0 || frameSize > len(b) {
+			break frames // padding, or broken
+		}
+		data := b[:frameSize]
+		b = b[frameSize:]
+		if id == "" {
+			continue
+		}
+
+		data, ok := id3FrameData(version, formatFlags, flags&0x80 != 0, data)
+		if !ok {
+			continue
+		}
+		readID3Frame(f, &dates, version, id, data, withCover)
+	}
+	dates.add(f)
+	return total, nil
+}
+
+// id3FrameData undoes what the frame flags say was done to the frame, or returns false if it can't be read
+func id3FrameData(version, formatFlags byte, tagUnsync bool, data []byte) ([]byte, bool) {
+	var compressed bool
+	var skipN int
+	switch version {
+	case 3:
+		if formatFlags&0x40 != 0 {
+			return nil, false // encrypted
+		}
+		if formatFlags&0x80 != 0 {
+			compressed = true
+			skipN += 4 // decompressed size
+		}
+		if formatFlags&0x20 != 0 {
+			skipN++ // group
+		}
+	case 4:
+		if formatFlags&0x04 != 0 {
+			return nil, false // encrypted
+		}
+		if formatFlags&0x40 != 0 {
+			skipN++ // group
+		}
+		if formatFlags&0x01 != 0 {
+			skipN += 4 // data length
+		}
+		compressed = formatFlags&0x08 != 0
+	}
+	data, ok := skip(data, skipN)
+	if !ok {
+		return nil, false
+	}
+	if version == 4 && (formatFlags&0x02 != 0 || tagUnsync) {
+		data = unsync(data)
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, false
+		}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+func readID3Frame(f *file, dates *id3Dates, version byte, id string, data []byte, withCover bool) {
+	switch {
+	case id == "TXXX":
+		values := id3Text(data)
+		if len(values) < 2 {
+			return
+		}
+		desc := strings.ToUpper(values[0])
+		if k, ok := id3UserTextKeys[desc]; ok {
+			desc = k
+		}
+		f.add(desc, values[1:]...)
+
+	case id == "TCON":
+		f.add("GENRE", id3Genres(id3Text(data))...)
+
+	case id == "TIPL", id == "IPLS":
+		values := id3Text(data)
+		for i := 0; i+1 < len(values); i += 2 {
+			if k, ok := id3InvolvedPeopleKeys[strings.ToUpper(values[i])]; ok {
+				f.add(k, values[i+1])
+			}
+		}
+
+	case id == "TMCL":
+		values := id3Text(data)
+		for i := 0; i+1 < len(values); i += 2 {
+			f.add("PERFORMER:"+strings.ToUpper(values[i]), values[i+1])
+		}
+
+	case id == "TYER", id == "TDAT", id == "TIME", id == "TORY":
+		// ID3v2.3 dates, put together after all the frames are read
+		if values := id3Text(data); len(values) > 0 {
+			dates.set(id, values[0])
+		}
+
+	case id == "COMM", id == "USLT":
+		// encoding, language, description, text
+		if len(data) < 4 {
+			return
+		}
+		values := id3Strings(data[0], data[4:])
+		if len(values) < 2 {
+			return
+		}
+		k := "COMMENT"
+		if id == "USLT" {
+			k = "LYRICS"
+		}
+		if desc := strings.ToUpper(values[0]); desc != "" && desc != k {
+			k += ":" + desc
+		}
+		f.add(k, values[1])
+
+	case id == "UFID":
+		owner, identifier, ok := bytes.Cut(data, []byte{0})
+		if ok && string(owner) == "http://musicbrainz.org" {
+			f.add("MUSICBRAINZ_TRACKID", string(identifier))
+		}
+
+	case id == "WXXX":
+		if len(data) < 1 {
+			return
+		}
+		desc, url := id3CutString(data[0], data[1:])
+		k := "URL"
+		if desc != "" {
+			k += ":" + strings.ToUpper(desc)
+		}
+		f.add(k, latin1(url))
+
+	case id == "POPM":
+		// email, rating, and an optional play counter
+		email, rest, ok := bytes.Cut(data, []byte{0})
+		if !ok || len(rest) < 1 {
+			return
+		}
+		if f.popularimeters == nil {
+			f.popularimeters = map[string]byte{}
+		}
+		f.popularimeters[latin1(email)] = rest[0]
+
+	case id == "APIC":
+		var picture []byte
+		if withCover {
+			picture = id3Picture(version, data)
+		}
+		f.addCover(picture)
+
+	case id[0] == 'W':
+		if k, ok := id3FrameKeys[id]; ok {
+			f.add(k, latin1(bytes.TrimRight(data, "\x00")))
+		}
+
+	default:
+		if k, ok := id3FrameKeys[id]; ok {
+			f.add(k, id3Text(data)...)
+		}
+	}
+}
+
+// id3Picture returns the image data of an APIC or ID3v2.2 PIC frame
+func id3Picture(version byte, data []byte) []byte {
+	if len(data) < 1 {
+		return nil
+	}
+	enc := data[0]
+	data = data[1:]
+	if version == 2 {
+		data, _ = skip(data, 3) // image format
+	} else {
+		_, data, _ = bytes.Cut(data, []byte{0}) // mime type
+	}
+	data, ok := skip(data, 1) // picture type
+	if !ok {
+		return nil
+	}
+	_, data = id3CutString(enc, data) // description
+	return data
+}
+
+// id3Text returns the strings in a text frame. ID3v2.4 frames can have many, split by nulls
+func id3Text(data []byte) []string {
+	if len(data) < 1 {
+		return nil
+	}
+	return id3Strings(data[0], data[1:])
+}
+
+func id3Strings(enc byte, data []byte) []string {
+	var values []string
+	for len(data) > 0 {
+		var v string
+		v, data = id3CutString(enc, data)
+		values = append(values, v)
+	}
+	// a single trailing terminator doesn't mean an empty value after it
+	for len(values) > 1 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+	return values
+}
+
+// id3CutString decodes the string at the start of data, returning it and the rest after its terminator
+func id3CutString(enc byte, data []byte) (string, []byte) {
+	switch enc {
+	case id3EncodingUTF16, id3EncodingUTF16BE:
+		end := len(data) &^ 1
+		rest := []byte(nil)
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				end, rest = i, data[i+2:]
+				break
+			}
+		}
+		return decodeUTF16(data[:end], enc == id3EncodingUTF16BE), rest
+	default:
+		s, rest, _ := bytes.Cut(data, []byte{0})
+		if enc == id3EncodingLatin1 {
+			return latin1(s), rest
+		}
+		return string(s), rest
+	}
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	if len(b) >= 2 {
+		switch {
+		case b[0] == 0xff && b[1] == 0xfe:
+			order, b = binary.LittleEndian, b[2:]
+		case b[0] == 0xfe && b[1] == 0xff:
+			order, b = binary.BigEndian, b[2:]
+		}
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, order.Uint16(b[i:]))
+	}
+	return string(utf16.Decode(u))
+}
+
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// id3Genres resolves ID3v1 genre numbers in TCON values, like "17" or "(17)Rock"
+func id3Genres(values []string) []string {
+	var genres []string
+	for _, v := range values {
+		if n, err := strconv.Atoi(v); err == nil {
+			if n >= 0 && n < len(id3v1Genres) {
+				genres = append(genres, id3v1Genres[n])
+			}
+			continue
+		}
+		var last string
+		for strings.HasPrefix(v, "(") && !strings.HasPrefix(v, "((") {
+			ref, rest, ok := strings.Cut(v[1:], ")")
+			if !ok {
+				break
+			}
+			v = rest
+			switch n, err := strconv.Atoi(ref); {
+			case err == nil && n >= 0 && n < len(id3v1Genres):
+				last = id3v1Genres[n]
+			case ref == "RX":
+				last = "Remix"
+			case ref == "CR":
+				last = "Cover"
+			default:
+				continue
+			}
+			genres = append(genres, last)
+		}
+		v = strings.TrimPrefix(v, "(")
+		if v != "" && v != last {
+			genres = append(genres, v)
+		}
+	}
+	return genres
+}
+
+// id3Dates puts ID3v2.3's separate year, day and month, and time frames together like ID3v2.4's dates
+type id3Dates struct {
+	year, dayMonth, hourMinute, originalYear string
+}
+
+func (d *id3Dates) set(id, v string) {
+	switch id {
+	case "TYER":
+		d.year = v
+	case "TDAT":
+		d.dayMonth = v
+	case "TIME":
+		d.hourMinute = v
+	case "TORY":
+		d.originalYear = v
+	}
+}
+
+func (d *id3Dates) add(f *file) {
+	if d.year != "" && f.tags["DATE"] == nil {
+		date := d.year
+		if len(d.dayMonth) == 4 {
+			date += "-" + d.dayMonth[2:4] + "-" + d.dayMonth[0:2]
+			if len(d.hourMinute) == 4 {
+				date += "T" + d.hourMinute[0:2] + ":" + d.hourMinute[2:4]
+			}
+		}
+		f.add("DATE", date)
+	}
+	if d.originalYear != "" && f.tags["ORIGINALDATE"] == nil {
+		f.add("ORIGINALDATE", d.originalYear)
+	}
+}
+
+// readID3v1 reads the ID3v1 tag at the end of the file, if there is one
+//
+// https://id3.org/ID3v1
+func readID3v1(f *file, r io.ReaderAt, size int64) {
+	if id3v1Size(r, size) == 0 {
+		return
+	}
+	var b [128]byte
+	if _, err := r.ReadAt(b[:], size-128); err != nil {
+		return
+	}
+	field := func(b []byte) string {
+		b, _, _ = bytes.Cut(b, []byte{0})
+		return strings.TrimSpace(latin1(b))
+	}
+	f.add("TITLE", field(b[3:33]))
+	f.add("ARTIST", field(b[33:63]))
+	f.add("ALBUM", field(b[63:93]))
+	f.add("DATE", field(b[93:97]))
+	if b[125] == 0 && b[126] != 0 {
+		// ID3v1.1, with a track number at the end of the comment
+		f.add("COMMENT", field(b[97:125]))
+		f.add("TRACKNUMBER", strconv.Itoa(int(b[126])))
+	} else {
+		f.add("COMMENT", field(b[97:127]))
+	}
+	if int(b[127]) < len(id3v1Genres) {
+		f.add("GENRE", id3v1Genres[b[127]])
+	}
+}
+
+// id3v1Size is the size of the ID3v1 tag at the end of the file, or 0 if there isn't one
+func id3v1Size(r io.ReaderAt, size int64) int64 {
+	if size < 128 {
+		return 0
+	}
+	var magic [3]byte
+	if _, err := r.ReadAt(magic[:], size-128); err != nil || string(magic[:]) != "TAG" {
+		return 0
+	}
+	return 128
+}
+
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+// unsync undoes unsynchronisation, where 0xff 0x00 was written for each 0xff
+func unsync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xff, 0x00}, []byte{0xff})
+}
+
+//nolint:gochecknoglobals
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop", "Jazz", "Metal", "New Age",
+	"Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz-Funk", "Fusion",
+	"Trance", "Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"Alternative Rock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle", "Native American",
+	"Cabaret", "New Wave", "Psychedelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal", "Acid Punk", "Acid Jazz",
+	"Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock", "Folk", "Folk Rock", "National Folk", "Swing",
+	"Fast Fusion", "Bebop", "Latin", "Revival", "Celtic", "Bluegrass", "Avantgarde", "Gothic Rock",
+	"Progressive Rock", "Psychedelic Rock", "Symphonic Rock", "Slow Rock", "Big Band", "Chorus", "Easy Listening",
+	"Acoustic", "Humour", "Speech", "Chanson", "Opera", "Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus",
+	"Porn Groove", "Satire", "Slow Jam", "Club", "Tango", "Samba", "Folklore", "Ballad", "Power Ballad",
+	"Rhythmic Soul", "Freestyle", "Duet", "Punk Rock", "Drum Solo", "A Cappella", "Euro-House", "Dance Hall", "Goa",
+	"Drum & Bass", "Club-House", "Hardcore Techno", "Terror", "Indie", "Britpop", "Worldbeat", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover", "Contemporary Christian", "Christian Rock",
+	"Merengue", "Salsa", "Thrash Metal", "Anime", "JPop", "Synthpop", "Abstract", "Art Rock", "Baroque", "Bhangra",
+	"Big Beat", "Breakbeat", "Chillout", "Downtempo", "Dub", "EBM", "Eclectic", "Electro", "Electroclash", "Emo",
+	"Experimental", "Garage", "Global", "IDM", "Illbient", "Industro-Goth", "Jam Band", "Krautrock", "Leftfield",
+	"Lounge", "Math Rock", "New Romantic", "Nu-Breakz", "Post-Punk", "Post-Rock", "Psytrance", "Shoegaze",
+	"Space Rock", "Trop Rock", "World Music", "Neoclassical", "Audiobook", "Audio Theatre", "Neue Deutsche Welle",
+	"Podcast", "Indie Rock", "G-Funk", "Dubstep", "Garage Rock", "Psybient",
+}
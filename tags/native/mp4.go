@@ -0,0 +1,435 @@
+package native
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ilst item names to keys, the same as taglib's
+//
+//nolint:gochecknoglobals
+var mp4ItemKeys = map[string]string{
+	"\xa9nam": "TITLE",
+	"\xa9ART": "ARTIST",
+	"\xa9alb": "ALBUM",
+	"\xa9cmt": "COMMENT",
+	"\xa9gen": "GENRE",
+	"\xa9day": "DATE",
+	"\xa9wrt": "COMPOSER",
+	"\xa9grp": "GROUPING",
+	"aART":    "ALBUMARTIST",
+	"trkn":    "TRACKNUMBER",
+	"disk":    "DISCNUMBER",
+	"cpil":    "COMPILATION",
+	"tmpo":    "BPM",
+	"cprt":    "COPYRIGHT",
+	"\xa9lyr": "LYRICS",
+	"\xa9too": "ENCODEDBY",
+	"soal":    "ALBUMSORT",
+	"soaa":    "ALBUMARTISTSORT",
+	"soar":    "ARTISTSORT",
+	"sonm":    "TITLESORT",
+	"soco":    "COMPOSERSORT",
+	"sosn":    "SHOWSORT",
+	"shwm":    "SHOWWORKMOVEMENT",
+	"pgap":    "GAPLESSPLAYBACK",
+	"pcst":    "PODCAST",
+	"catg":    "PODCASTCATEGORY",
+	"desc":    "PODCASTDESC",
+	"egid":    "PODCASTID",
+	"purl":    "PODCASTURL",
+	"tves":    "TVEPISODE",
+	"tven":    "TVEPISODEID",
+	"tvnn":    "TVNETWORK",
+	"tvsn":    "TVSEASON",
+	"tvsh":    "TVSHOW",
+	"\xa9wrk": "WORK",
+	"\xa9mvn": "MOVEMENTNAME",
+	"\xa9mvi": "MOVEMENTNUMBER",
+	"\xa9mvc": "MOVEMENTCOUNT",
+	"ownr":    "OWNER",
+}
+
+// freeform item names to keys, where they're not just the uppercased name
+//
+//nolint:gochecknoglobals
+var mp4FreeformKeys = map[string]string{
+	"MUSICBRAINZ TRACK ID":              "MUSICBRAINZ_TRACKID",
+	"MUSICBRAINZ ARTIST ID":             "MUSICBRAINZ_ARTISTID",
+	"MUSICBRAINZ ALBUM ID":              "MUSICBRAINZ_ALBUMID",
+	"MUSICBRAINZ ALBUM ARTIST ID":       "MUSICBRAINZ_ALBUMARTISTID",
+	"MUSICBRAINZ RELEASE GROUP ID":      "MUSICBRAINZ_RELEASEGROUPID",
+	"MUSICBRAINZ RELEASE TRACK ID":      "MUSICBRAINZ_RELEASETRACKID",
+	"MUSICBRAINZ WORK ID":               "MUSICBRAINZ_WORKID",
+	"MUSICBRAINZ ALBUM RELEASE COUNTRY": "RELEASECOUNTRY",
+	"MUSICBRAINZ ALBUM STATUS":          "RELEASESTATUS",
+	"MUSICBRAINZ ALBUM TYPE":            "RELEASETYPE",
+}
+
+const (
+	mp4TypeImplicit = 0
+	mp4TypeUTF8     = 1
+	mp4TypeJPEG     = 13
+	mp4TypePNG      = 14
+	mp4TypeInt      = 21
+	mp4TypeBMP      = 27
+)
+
+// mp4Box is a box (or atom) header, and where its contents are
+type mp4Box struct {
+	typ        string
+	start, end int64 // of the contents, after the header
+}
+
+// mp4Boxes reads the headers of the boxes between start and end
+//
+// https://developer.apple.com/documentation/quicktime-file-format
+func mp4Boxes(r io.ReaderAt, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for offset := start; offset+8 <= end; {
+		var header [16]byte
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("read box header: %w", errInvalid)
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0: // to the end
+			size = end - offset
+		case 1: // 64 bit size after the type
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("read box size: %w", errInvalid)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16])) //nolint:gosec // checked below
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return nil, fmt.Errorf("box %q size: %w", header[4:8], errInvalid)
+		}
+		boxes = append(boxes, mp4Box{typ: string(header[4:8]), start: offset + headerSize, end: offset + size})
+		offset += size
+	}
+	return boxes, nil
+}
+
+// mp4Path finds the first box at the end of path, starting from the boxes between start and end
+func mp4Path(r io.ReaderAt, start, end int64, path ...string) (mp4Box, bool) {
+	boxes, err := mp4Boxes(r, start, end)
+	if err != nil {
+		return mp4Box{}, false
+	}
+	for _, box := range boxes {
+		if box.typ != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return box, true
+		}
+		if found, ok := mp4Path(r, box.start, box.end, path[1:]...); ok {
+			return found, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+func (box mp4Box) read(r io.ReaderAt) ([]byte, error) {
+	b := make([]byte, box.end-box.start)
+	if _, err := r.ReadAt(b, box.start); err != nil {
+		return nil, fmt.Errorf("read box %q: %w", box.typ, err)
+	}
+	return b, nil
+}
+
+func readMP4(f *file, r io.ReaderAt, size int64, withCover bool) error {
+	moov, ok := mp4Path(r, 0, size, "moov")
+	if !ok {
+		return fmt.Errorf("no moov box: %w", errInvalid)
+	}
+	if err := readMP4Audio(f, r, size, moov); err != nil {
+		return fmt.Errorf("audio: %w", err)
+	}
+
+	meta, ok := mp4Path(r, moov.start, moov.end, "udta", "meta")
+	if !ok {
+		return nil
+	}
+	// meta is a full box with a version and flags first, except in some older files where it goes straight to hdlr
+	var peek [8]byte
+	if _, err := r.ReadAt(peek[:], meta.start); err != nil {
+		return fmt.Errorf("read meta: %w", errInvalid)
+	}
+	if string(peek[4:8]) != "hdlr" {
+		meta.start += 4
+	}
+	ilst, ok := mp4Path(r, meta.start, meta.end, "ilst")
+	if !ok {
+		return nil
+	}
+	items, err := mp4Boxes(r, ilst.start, ilst.end)
+	if err != nil {
+		return fmt.Errorf("ilst: %w", err)
+	}
+	for _, item := range items {
+		if item.typ == "covr" && !withCover {
+			f.addCover(nil)
+			continue
+		}
+		b, err := item.read(r)
+		if err != nil {
+			return err
+		}
+		readMP4Item(f, item.typ, b)
+	}
+	return nil
+}
+
+// readMP4Audio reads the length and bitrate of the first sound track
+func readMP4Audio(f *file, r io.ReaderAt, size int64, moov mp4Box) error {
+	traks, err := mp4Boxes(r, moov.start, moov.end)
+	if err != nil {
+		return err
+	}
+	for _, trak := range traks {
+		if trak.typ != "trak" {
+			continue
+		}
+		hdlr, ok := mp4Path(r, trak.start, trak.end, "mdia", "hdlr")
+		if !ok {
+			continue
+		}
+		b, err := hdlr.read(r)
+		if err != nil {
+			return err
+		}
+		if len(b) < 12 || string(b[8:12]) != "soun" {
+			continue
+		}
+
+		mdhd, ok := mp4Path(r, trak.start, trak.end, "mdia", "mdhd")
+		if !ok {
+			return fmt.Errorf("no mdhd box: %w", errInvalid)
+		}
+		if b, err = mdhd.read(r); err != nil {
+			return err
+		}
+		var timescale uint32
+		var duration uint64
+		switch {
+		case len(b) >= 32 && b[0] == 1:
+			timescale = binary.BigEndian.Uint32(b[20:24])
+			duration = binary.BigEndian.Uint64(b[24:32])
+		case len(b) >= 20:
+			timescale = binary.BigEndian.Uint32(b[12:16])
+			duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+		default:
+			return fmt.Errorf("mdhd: %w", errInvalid)
+		}
+		ms := samplesMs(int64(duration), timescale) //nolint:gosec // a track won't be that long
+		f.length = msDuration(ms)
+
+		// the average bitrate from the decoder config if there is one, otherwise work it out from the size of the media
+		if stsd, ok := mp4Path(r, trak.start, trak.end, "mdia", "minf", "stbl", "stsd"); ok {
+			if b, err = stsd.read(r); err != nil {
+				return err
+			}
+			readMP4SampleEntry(f, b)
+			if avg := esdsAvgBitrate(b); avg > 0 {
+				f.bitrate = uint((float64(avg)+500)/1000 + 0.5)
+				return nil
+			}
+		}
+		boxes, err := mp4Boxes(r, 0, size)
+		if err != nil {
+			return err
+		}
+		var mediaSize int64
+		for _, box := range boxes {
+			if box.typ == "mdat" {
+				mediaSize += box.end - box.start
+			}
+		}
+		f.bitrate = bitrate(mediaSize, ms)
+		return nil
+	}
+	return nil
+}
+
+// readMP4SampleEntry reads the codec, channels, sample rate, and bit depth from the first audio sample entry in an
+// stsd box. ALAC has its real sample rate and bit depth in its own config box, after the entry
+//
+// https://developer.apple.com/documentation/quicktime-file-format/sound_sample_descriptions
+func readMP4SampleEntry(f *file, stsd []byte) {
+	// version and flags, entry count, then the entry's size, type, reserved, and data reference index
+	if len(stsd) < 44 {
+		return
+	}
+	entry := stsd[8:]
+	switch typ := string(entry[4:8]); typ {
+	case "mp4a":
+		f.codec = "aac"
+	case "alac", "fLaC", "Opus":
+		f.codec = strings.ToLower(typ)
+	default:
+		f.codec = typ
+	}
+	f.channels = uint(binary.BigEndian.Uint16(entry[24:26]))
+	f.sampleRate = uint(binary.BigEndian.Uint32(entry[32:36]) >> 16) // 16.16 fixed point
+	if f.codec == "alac" {
+		f.bitDepth = uint(binary.BigEndian.Uint16(entry[26:28]))
+		// https://github.com/macosforge/alac/blob/master/ALACMagicCookieDescription.txt
+		if i := bytes.Index(entry[36:], []byte("alac")); i >= 0 {
+			if config := entry[36+i+4:]; len(config) >= 28 {
+				f.bitDepth = uint(config[9])
+				f.channels = uint(config[13])
+				f.sampleRate = uint(binary.BigEndian.Uint32(config[24:28]))
+			}
+		}
+	}
+}
+
+// esdsAvgBitrate finds the average bitrate in an mp4a sample entry's elementary stream descriptor, or 0
+//
+// https://wiki.multimedia.cx/index.php/ISO/IEC_14496-1
+func esdsAvgBitrate(stsd []byte) uint32 {
+	i := bytes.Index(stsd, []byte("esds"))
+	if i < 0 {
+		return 0
+	}
+	b, ok := skip(stsd, i+4+4) // type, version and flags
+	if !ok {
+		return 0
+	}
+	descriptor := func(tag byte) bool {
+		if len(b) < 1 || b[0] != tag {
+			return false
+		}
+		b = b[1:]
+		for n := 0; n < 4 && len(b) > 0; n++ { // length, up to 4 bytes of 7 bits
+			more := b[0]&0x80 != 0
+			b = b[1:]
+			if !more {
+				break
+			}
+		}
+		return true
+	}
+	if !descriptor(0x03) || len(b) < 3 {
+		return 0
+	}
+	flags := b[2]
+	b = b[3:] // ES id, flags
+	if flags&0x80 != 0 {
+		b, _ = skip(b, 2) // depends on ES id
+	}
+	if flags&0x40 != 0 && len(b) > 0 {
+		b, _ = skip(b, 1+int(b[0])) // URL
+	}
+	if flags&0x20 != 0 {
+		b, _ = skip(b, 2) // OCR ES id
+	}
+	if !descriptor(0x04) || len(b) < 13 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b[9:13]) // after object type, stream type, buffer size, max bitrate
+}
+
+// readMP4Item reads the data boxes of an ilst item
+func readMP4Item(f *file, name string, b []byte) {
+	var freeformName string
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b[:4]))
+		if size < 8 || size > len(b) {
+			return
+		}
+		typ, contents := string(b[4:8]), b[8:size]
+		b = b[size:]
+
+		switch typ {
+		case "name":
+			if len(contents) >= 4 {
+				freeformName = string(contents[4:])
+			}
+		case "data":
+			if len(contents) < 8 {
+				continue
+			}
+			dataType := binary.BigEndian.Uint32(contents[:4]) & 0xffffff
+			readMP4Data(f, name, freeformName, dataType, contents[8:])
+		}
+	}
+}
+
+func readMP4Data(f *file, name, freeformName string, dataType uint32, v []byte) {
+	switch name {
+	case "covr":
+		if dataType == mp4TypeJPEG || dataType == mp4TypePNG || dataType == mp4TypeBMP || dataType == mp4TypeImplicit {
+			f.addCover(v)
+		}
+		return
+	case "trkn", "disk":
+		if len(v) < 6 {
+			return
+		}
+		n, total := binary.BigEndian.Uint16(v[2:4]), binary.BigEndian.Uint16(v[4:6])
+		if n == 0 {
+			return
+		}
+		s := strconv.Itoa(int(n))
+		if total > 0 {
+			s += "/" + strconv.Itoa(int(total))
+		}
+		f.add(mp4ItemKeys[name], s)
+		return
+	case "gnre":
+		if len(v) >= 2 {
+			if n := int(binary.BigEndian.Uint16(v)); n > 0 && n <= len(id3v1Genres) {
+				f.add("GENRE", id3v1Genres[n-1])
+			}
+		}
+		return
+	}
+
+	var k string
+	switch name {
+	case "----":
+		if freeformName == "" {
+			return
+		}
+		k = strings.ToUpper(freeformName)
+		if mapped, ok := mp4FreeformKeys[k]; ok {
+			k = mapped
+		}
+	default:
+		var ok bool
+		if k, ok = mp4ItemKeys[name]; !ok {
+			return
+		}
+	}
+
+	switch dataType {
+	case mp4TypeUTF8:
+		f.add(k, string(v))
+	case mp4TypeInt, mp4TypeImplicit:
+		var n int64
+		switch len(v) {
+		case 1:
+			n = int64(int8(v[0])) //nolint:gosec // signed in the spec
+		case 2:
+			n = int64(int16(binary.BigEndian.Uint16(v))) //nolint:gosec // signed in the spec
+		case 4:
+			n = int64(int32(binary.BigEndian.Uint32(v))) //nolint:gosec // signed in the spec
+		case 8:
+			n = int64(binary.BigEndian.Uint64(v)) //nolint:gosec // signed in the spec
+		default:
+			if dataType == mp4TypeImplicit {
+				f.add(k, string(v))
+			}
+			return
+		}
+		f.add(k, strconv.FormatInt(n, 10))
+	}
+}
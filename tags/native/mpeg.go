@@ -0,0 +1,215 @@
+package native
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+func readMP3(f *file, r io.ReaderAt, size int64, withCover bool) error {
+	start, err := readID3v2(f, r, withCover)
+	if err != nil {
+		return fmt.Errorf("id3v2: %w", err)
+	}
+	if len(f.tags) == 0 {
+		readID3v1(f, r, size)
+	}
+	end := size - id3v1Size(r, size)
+
+	first, offset, ok := firstMPEGFrame(r, start, end)
+	if !ok {
+		return nil // tags but no audio, or nothing we understand
+	}
+
+	f.codec = "mp3"
+	f.sampleRate = uint(first.sampleRate)
+	f.channels = first.channels
+
+	// a Xing, Info, or VBRI header in the first frame has the frame count and size, for VBR files especially
+	frame := make([]byte, min(int64(first.length), end-offset))
+	if _, err := r.ReadAt(frame, offset); err != nil {
+		return fmt.Errorf("read first frame: %w", err)
+	}
+	if frames, streamLength, ok := vbrHeader(frame); ok {
+		ms := float64(first.samples) * 1000 / float64(first.sampleRate) * float64(frames)
+		f.length = msDuration(ms)
+		f.bitrate = bitrate(streamLength, ms)
+		return nil
+	}
+
+	// otherwise assume constant bitrate, and that the stream goes on to the last frame
+	f.bitrate = first.bitrate
+	last, ok := lastMPEGFrame(r, first, offset, end)
+	if !ok {
+		return nil
+	}
+	streamLength := last - offset + int64(first.length)
+	f.length = msDuration(float64(streamLength) * 8 / float64(first.bitrate))
+	return nil
+}
+
+//nolint:gochecknoglobals
+var (
+	mpegBitrates = [2][3][16]uint{
+		{ // MPEG-1, layers I to III
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{ // MPEG-2 and 2.5
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	mpegSampleRates = [3][3]uint32{
+		{44100, 48000, 32000}, // MPEG-1
+		{22050, 24000, 16000}, // MPEG-2
+		{11025, 12000, 8000},  // MPEG-2.5
+	}
+)
+
+// mpegHeader is the parts of an MPEG audio frame header we need
+//
+// http://www.mp3-tech.org/programmer/frame_header.html
+type mpegHeader struct {
+	version    byte // 0 for MPEG-1, 1 for MPEG-2, 2 for MPEG-2.5
+	layer      byte // 1 to 3
+	bitrate    uint // kbit/s
+	sampleRate uint32
+	channels   uint
+	samples    int // per frame
+	length     int // bytes, including the header
+}
+
+func isMPEGSync(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xff && b[1] != 0xff && b[1]&0xe0 == 0xe0
+}
+
+func parseMPEGHeader(b []byte) (mpegHeader, bool) {
+	if len(b) < 4 || !isMPEGSync(b) {
+		return mpegHeader{}, false
+	}
+	var h mpegHeader
+	switch (b[1] >> 3) & 0x03 {
+	case 0:
+		h.version = 2
+	case 2:
+		h.version = 1
+	case 3:
+		h.version = 0
+	default:
+		return mpegHeader{}, false
+	}
+	switch (b[1] >> 1) & 0x03 {
+	case 1:
+		h.layer = 3
+	case 2:
+		h.layer = 2
+	case 3:
+		h.layer = 1
+	default:
+		return mpegHeader{}, false
+	}
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := (b[2] >> 2) & 0x03
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return mpegHeader{}, false // free format isn't supported
+	}
+	h.bitrate = mpegBitrates[min(h.version, 1)][h.layer-1][bitrateIndex]
+	h.sampleRate = mpegSampleRates[h.version][sampleRateIndex]
+	padding := int((b[2] >> 1) & 0x01)
+	h.channels = 2
+	if b[3]>>6 == 3 {
+		h.channels = 1
+	}
+
+	switch {
+	case h.layer == 1:
+		h.samples = 384
+		h.length = (12*int(h.bitrate)*1000/int(h.sampleRate) + padding) * 4
+	case h.layer == 3 && h.version > 0:
+		h.samples = 576
+		h.length = 72*int(h.bitrate)*1000/int(h.sampleRate) + padding
+	default:
+		h.samples = 1152
+		h.length = 144*int(h.bitrate)*1000/int(h.sampleRate) + padding
+	}
+	return h, true
+}
+
+// firstMPEGFrame finds the first frame header from start, checking the next frame follows it to not be fooled by
+// junk that happens to look like a header
+func firstMPEGFrame(r io.ReaderAt, start, end int64) (mpegHeader, int64, bool) {
+	const window = 64 * 1024
+	buf := make([]byte, min(window, max(0, end-start)))
+	n, _ := r.ReadAt(buf, start)
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		h, ok := parseMPEGHeader(buf[i:])
+		if !ok {
+			continue
+		}
+		next := i + h.length
+		if next+4 <= len(buf) {
+			if nh, ok := parseMPEGHeader(buf[next:]); !ok || !nh.sameStream(h) {
+				continue
+			}
+		}
+		return h, start + int64(i), true
+	}
+	return mpegHeader{}, 0, false
+}
+
+// lastMPEGFrame finds the offset of the last frame header in the stream, searching back from end
+func lastMPEGFrame(r io.ReaderAt, first mpegHeader, firstOffset, end int64) (int64, bool) {
+	const window = 64 * 1024
+	start := max(firstOffset, end-window)
+	buf := make([]byte, end-start)
+	if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+		return 0, false
+	}
+	for i := len(buf) - 4; i >= 0; i-- {
+		if h, ok := parseMPEGHeader(buf[i:]); ok && h.sameStream(first) {
+			return start + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+func (h mpegHeader) sameStream(o mpegHeader) bool {
+	return h.version == o.version && h.layer == o.layer && h.sampleRate == o.sampleRate
+}
+
+// vbrHeader reads the number of frames and bytes in the stream from a Xing, Info, or VBRI header in the first frame
+//
+// https://www.codeproject.com/Articles/8295/MPEG-Audio-Frame-Header#XINGHeader
+func vbrHeader(frame []byte) (int64, int64, bool) {
+	i := bytes.Index(frame, []byte("Xing"))
+	if i < 0 {
+		i = bytes.Index(frame, []byte("Info"))
+	}
+	if i >= 0 {
+		b := frame[i+4:]
+		if len(b) < 12 {
+			return 0, 0, false
+		}
+		const flagFrames, flagBytes = 0x01, 0x02
+		flags := binary.BigEndian.Uint32(b)
+		if flags&flagFrames == 0 || flags&flagBytes == 0 {
+			return 0, 0, false
+		}
+		frames := int64(binary.BigEndian.Uint32(b[4:]))
+		size := int64(binary.BigEndian.Uint32(b[8:]))
+		return frames, size, frames > 0 && size > 0
+	}
+	// VBRI is always 32 bytes after the header
+	if len(frame) >= 36+18 && bytes.Equal(frame[36:40], []byte("VBRI")) {
+		b := frame[36:]
+		size := int64(binary.BigEndian.Uint32(b[10:]))
+		frames := int64(binary.BigEndian.Uint32(b[14:]))
+		return frames, size, frames > 0 && size > 0
+	}
+	return 0, 0, false
+}
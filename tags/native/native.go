@@ -0,0 +1,159 @@
+// Package native reads tags and audio properties in plain Go, without taglib or ffprobe. it supports FLAC, MP3 (ID3v2.2
+// to 2.4, and ID3v1), Ogg Vorbis and Opus, and MP4/M4A. tags use the same keys as the taglib reader
+package native
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.senan.xyz/gonic/tags"
+)
+
+var _ tags.Reader = Reader{}
+
+type Reader struct{}
+
+func (Reader) CanRead(absPath string) bool {
+	switch ext := strings.ToLower(filepath.Ext(absPath)); ext {
+	case ".mp3", ".flac", ".ogg", ".oga", ".opus", ".m4a", ".m4b", ".mp4":
+		return true
+	}
+	return false
+}
+
+func (Reader) Read(absPath string) (tags.Properties, tags.Tags, error) {
+	f, err := read(absPath, false)
+	if err != nil {
+		return tags.Properties{}, nil, err
+	}
+	props := tags.Properties{
+		Length:     f.length,
+		Bitrate:    f.bitrate,
+		HasCover:   f.hasCover,
+		SampleRate: f.sampleRate,
+		BitDepth:   f.bitDepth,
+		Channels:   f.channels,
+		Codec:      f.codec,
+	}
+	tags.AddPOPM(f.tags, f.popularimeters)
+	return props, f.tags, nil
+}
+
+func (Reader) ReadCover(absPath string) ([]byte, error) {
+	f, err := read(absPath, true)
+	if err != nil {
+		return nil, err
+	}
+	return f.cover, nil
+}
+
+var errInvalid = errors.New("invalid file")
+
+// file is what's read from any of the formats
+type file struct {
+	tags     tags.Tags
+	length   time.Duration
+	bitrate  uint // kbit/s
+	hasCover bool
+	cover    []byte // the first picture, only read if asked for
+
+	sampleRate uint
+	bitDepth   uint
+	channels   uint
+	codec      string
+
+	popularimeters map[string]byte // ID3 POPM ratings by email
+}
+
+func (f *file) add(k string, vs ...string) {
+	if f.tags == nil {
+		f.tags = tags.Tags{}
+	}
+	for _, v := range vs {
+		if v == "" {
+			continue
+		}
+		f.tags[k] = append(f.tags[k], v)
+	}
+}
+
+func (f *file) addCover(data []byte) {
+	if !f.hasCover {
+		f.cover = data
+	}
+	f.hasCover = true
+}
+
+func read(absPath string, withCover bool) (*file, error) {
+	r, err := os.Open(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer r.Close()
+
+	info, err := r.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat: %w", err)
+	}
+	size := info.Size()
+
+	// some files have an ID3v2 tag in front of something that isn't MP3
+	var id3Size int64
+	var magic [12]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return nil, fmt.Errorf("read magic: %w", errInvalid)
+	}
+	if bytes.HasPrefix(magic[:], []byte("ID3")) {
+		id3Size = int64(syncsafe(magic[6:10])) + 10
+		if _, err := r.ReadAt(magic[:], id3Size); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("read magic: %w", err)
+		}
+	}
+
+	f := &file{}
+	switch {
+	case bytes.HasPrefix(magic[:], []byte("fLaC")):
+		err = readFLAC(f, r, id3Size, size, withCover)
+	case bytes.HasPrefix(magic[:], []byte("OggS")):
+		err = readOgg(f, r, size, withCover)
+	case bytes.Equal(magic[4:8], []byte("ftyp")):
+		err = readMP4(f, r, size, withCover)
+	case id3Size > 0 || isMPEGSync(magic[:]):
+		err = readMP3(f, r, size, withCover)
+	default:
+		err = tags.ErrUnsupported
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %q: %w", filepath.Base(absPath), err)
+	}
+	if f.tags == nil {
+		f.tags = tags.Tags{}
+	}
+	return f, nil
+}
+
+// bitrate is the average bitrate in kbit/s of streamLength bytes of audio over ms milliseconds
+func bitrate(streamLength int64, ms float64) uint {
+	if streamLength <= 0 || ms <= 0 {
+		return 0
+	}
+	return uint(float64(streamLength)*8/ms + 0.5)
+}
+
+// samplesMs is the length in milliseconds of n samples at rate
+func samplesMs(n int64, rate uint32) float64 {
+	if n <= 0 || rate == 0 {
+		return 0
+	}
+	return float64(n) * 1000 / float64(rate)
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms+0.5) * time.Millisecond
+}
@@ -0,0 +1,157 @@
+package native
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"go.senan.xyz/gonic/tags"
+)
+
+const oggPageHeaderSize = 27
+
+// https://xiph.org/ogg/doc/framing.html
+func readOgg(f *file, r io.ReaderAt, size int64, withCover bool) error {
+	// vorbis has three header packets, opus has two. the first is enough to tell which
+	packets, err := oggPackets(r, size, 3)
+	if err != nil {
+		return err
+	}
+
+	var headers int
+	var ms float64
+	switch first := packets[0]; {
+	case bytes.HasPrefix(first, []byte("\x01vorbis")):
+		// https://xiph.org/vorbis/doc/Vorbis_I_spec.html#x1-630004.2.2
+		if len(first) < 28 {
+			return fmt.Errorf("vorbis identification header: %w", errInvalid)
+		}
+		sampleRate := binary.LittleEndian.Uint32(first[12:16])
+		f.codec, f.sampleRate, f.channels = "vorbis", uint(sampleRate), uint(first[11])
+		nominalBitrate := int32(binary.LittleEndian.Uint32(first[20:24])) //nolint:gosec // signed in the spec
+		if !bytes.HasPrefix(packets[1], []byte("\x03vorbis")) {
+			return fmt.Errorf("vorbis comment header: %w", errInvalid)
+		}
+		if err := readVorbisComment(f, packets[1][7:], withCover); err != nil {
+			return fmt.Errorf("vorbis comment: %w", err)
+		}
+		headers = 3
+		if frames := oggLastGranule(r, size); frames > 0 {
+			ms = samplesMs(frames, sampleRate)
+		}
+		if ms == 0 && nominalBitrate > 0 {
+			f.bitrate = uint(float64(nominalBitrate)/1000 + 0.5)
+		}
+
+	case bytes.HasPrefix(first, []byte("OpusHead")):
+		// https://www.rfc-editor.org/rfc/rfc7845#section-5.1
+		if len(first) < 19 {
+			return fmt.Errorf("opus identification header: %w", errInvalid)
+		}
+		preSkip := int64(binary.LittleEndian.Uint16(first[10:12]))
+		f.codec, f.sampleRate, f.channels = "opus", 48000, uint(first[9]) // decoded at 48kHz, whatever the input was
+		if !bytes.HasPrefix(packets[1], []byte("OpusTags")) {
+			return fmt.Errorf("opus comment header: %w", errInvalid)
+		}
+		if err := readVorbisComment(f, packets[1][8:], withCover); err != nil {
+			return fmt.Errorf("opus comment: %w", err)
+		}
+		headers = 2
+		if frames := oggLastGranule(r, size) - preSkip; frames > 0 {
+			ms = samplesMs(frames, 48000) // opus granules are always 48kHz
+		}
+
+	default:
+		return tags.ErrUnsupported
+	}
+
+	if len(packets) < headers {
+		return fmt.Errorf("too few header packets: %w", errInvalid)
+	}
+	if ms > 0 {
+		streamLength := size
+		for _, p := range packets[:headers] {
+			streamLength -= int64(len(p))
+		}
+		f.length = msDuration(ms)
+		f.bitrate = bitrate(streamLength, ms)
+	}
+	return nil
+}
+
+// oggPackets returns up to the first n packets of the first logical stream, fewer if the stream ends before
+func oggPackets(r io.ReaderAt, size int64, n int) ([][]byte, error) {
+	var packets [][]byte
+	var packet []byte
+	var serial uint32
+	var offset int64
+	for first := true; len(packets) < n && offset < size; first = false {
+		var header [oggPageHeaderSize + 255]byte
+		if _, err := r.ReadAt(header[:oggPageHeaderSize], offset); err != nil || !bytes.Equal(header[:4], []byte("OggS")) {
+			return nil, fmt.Errorf("read page header: %w", errInvalid)
+		}
+		nsegs := int(header[26])
+		if _, err := r.ReadAt(header[oggPageHeaderSize:oggPageHeaderSize+nsegs], offset+oggPageHeaderSize); err != nil {
+			return nil, fmt.Errorf("read segment table: %w", errInvalid)
+		}
+		pageSerial := binary.LittleEndian.Uint32(header[14:18])
+		if first {
+			serial = pageSerial
+		}
+
+		var pageSize int
+		for _, seg := range header[oggPageHeaderSize : oggPageHeaderSize+nsegs] {
+			pageSize += int(seg)
+		}
+		dataOffset := offset + oggPageHeaderSize + int64(nsegs)
+		offset = dataOffset + int64(pageSize)
+		if pageSerial != serial {
+			continue
+		}
+
+		data := make([]byte, pageSize)
+		if _, err := r.ReadAt(data, dataOffset); err != nil {
+			return nil, fmt.Errorf("read page: %w", errInvalid)
+		}
+		for _, seg := range header[oggPageHeaderSize : oggPageHeaderSize+nsegs] {
+			packet = append(packet, data[:seg]...)
+			data = data[seg:]
+			if seg < 255 {
+				packets = append(packets, packet)
+				packet = nil
+				if len(packets) == n {
+					break
+				}
+			}
+		}
+	}
+	if len(packets) < 2 {
+		return nil, fmt.Errorf("too few packets: %w", errInvalid)
+	}
+	return packets, nil
+}
+
+// oggLastGranule is the granule position of the last page, which is the number of samples in the stream
+func oggLastGranule(r io.ReaderAt, size int64) int64 {
+	const window = 64 * 1024
+	for end := size; end > 0; end -= window - oggPageHeaderSize {
+		start := max(0, end-window)
+		buf := make([]byte, end-start)
+		if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+			return 0
+		}
+		for i := bytes.LastIndex(buf, []byte("OggS")); i >= 0; i = bytes.LastIndex(buf[:i], []byte("OggS")) {
+			if len(buf)-i < oggPageHeaderSize {
+				continue
+			}
+			if granule := int64(binary.LittleEndian.Uint64(buf[i+6 : i+14])); granule >= 0 { //nolint:gosec // signed in the spec
+				return granule
+			}
+		}
+		if start == 0 {
+			break
+		}
+	}
+	return 0
+}
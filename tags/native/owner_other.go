@@ -0,0 +1,13 @@
+//go:build !unix
+
+package native
+
+import (
+	"io/fs"
+	"os"
+)
+
+// chownLike does nothing where files have no owner to keep
+func chownLike(*os.File, fs.FileInfo) error {
+	return nil
+}
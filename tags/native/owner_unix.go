@@ -0,0 +1,17 @@
+//go:build unix
+
+package native
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// chownLike gives f the owner and group of the file info is from, which a new file made to replace it won't have
+func chownLike(f *os.File, info fs.FileInfo) error {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return f.Chown(int(stat.Uid), int(stat.Gid))
+	}
+	return nil
+}
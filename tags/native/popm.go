@@ -0,0 +1,260 @@
+package native
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.senan.xyz/gonic/tags"
+)
+
+var _ tags.RatingWriter = Writer{}
+
+// Writer writes ratings into MP3s only, as ID3 POPM frames, and for the primary user TXXX LOVED and FMPS_RATING frames.
+// the taglib package's Writer does other formats too
+type Writer struct{}
+
+func (Writer) CanWriteRating(absPath string) bool {
+	return strings.EqualFold(filepath.Ext(absPath), ".mp3")
+}
+
+func (Writer) WriteRating(absPath string, r tags.Rating) error {
+	return editID3(absPath, func(version byte, frames []id3Frame) []id3Frame {
+		frames = setPopularimeter(version, frames, r.Email, tags.StarsToPOPM(r.Stars))
+		if !r.Primary {
+			return frames
+		}
+		var loved, fmps string
+		if r.Loved {
+			loved = "1"
+		}
+		frames = setUserText(version, frames, tags.KeyLoved, loved)
+		if r.FMPS {
+			if r.Stars > 0 {
+				fmps = tags.FormatFMPSRating(r.Stars)
+			}
+			frames = setUserText(version, frames, tags.KeyFMPSRating, fmps)
+		}
+		return frames
+	})
+}
+
+// ReadPopularimeters returns the ID3 POPM ratings in a file by email, which taglib doesn't show as tags. only the
+// ID3v2 tag at the start of the file is read, so it's cheap to do alongside another reader
+func ReadPopularimeters(absPath string) (map[string]byte, error) {
+	r, err := os.Open(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer r.Close()
+
+	var f file
+	if _, err := readID3v2(&f, r, false); err != nil {
+		return nil, err
+	}
+	return f.popularimeters, nil
+}
+
+// WritePopularimeter sets email's ID3 POPM rating in an MP3, or removes it if rating is 0. other frames are kept as
+// they are
+func WritePopularimeter(absPath, email string, rating byte) error {
+	return editID3(absPath, func(version byte, frames []id3Frame) []id3Frame {
+		return setPopularimeter(version, frames, email, rating)
+	})
+}
+
+// id3Frame is a whole ID3v2 frame, header and all
+type id3Frame []byte
+
+func newID3Frame(version byte, id string, data []byte) id3Frame {
+	return append(id3FrameHeader(version, id, len(data)), data...)
+}
+
+func (fr id3Frame) id() string   { return string(fr[:4]) }
+func (fr id3Frame) data() []byte { return fr[10:] }
+
+// setPopularimeter sets email's POPM frame to rating, keeping its play counter, or removes it if rating is 0
+func setPopularimeter(version byte, frames []id3Frame, email string, rating byte) []id3Frame {
+	var counter []byte
+	frames = slices.DeleteFunc(frames, func(fr id3Frame) bool {
+		if fr.id() != "POPM" || fr[9] != 0 {
+			return false // another frame, or one that's compressed or encrypted
+		}
+		e, rest, ok := bytes.Cut(fr.data(), []byte{0})
+		if !ok || latin1(e) != email {
+			return false
+		}
+		if len(rest) > 1 {
+			counter = rest[1:]
+		}
+		return true
+	})
+	if rating == 0 {
+		return frames
+	}
+	return append(frames, newID3Frame(version, "POPM", append(append([]byte(email), 0, rating), counter...)))
+}
+
+// setUserText sets the TXXX frame described by key, matched ignoring case, to value, or removes it if value is empty
+func setUserText(version byte, frames []id3Frame, key, value string) []id3Frame {
+	frames = slices.DeleteFunc(frames, func(fr id3Frame) bool {
+		if fr.id() != "TXXX" || fr[9] != 0 || len(fr.data()) == 0 {
+			return false
+		}
+		desc, _ := id3CutString(fr.data()[0], fr.data()[1:])
+		return strings.EqualFold(desc, key)
+	})
+	if value == "" {
+		return frames
+	}
+	enc := byte(id3EncodingLatin1) // the values are ASCII, which is Latin-1 too, and ID3v2.3 has no UTF-8
+	return append(frames, newID3Frame(version, "TXXX", append(append(append([]byte{enc}, key...), 0), value...)))
+}
+
+func joinFrames(frames []id3Frame) []byte {
+	var b []byte
+	for _, fr := range frames {
+		b = append(b, fr...)
+	}
+	return b
+}
+
+// id3Padding is left after the frames when a tag has to grow, so the next few writes can happen in place
+const id3Padding = 1024
+
+// editID3 changes the frames of an MP3's ID3v2 tag with edit, adding a tag if there isn't one. the tag is rewritten in
+// place if it has room, else the whole file is rewritten. if edit changes nothing, the file isn't written to
+func editID3(absPath string, edit func(version byte, frames []id3Frame) []id3Frame) error {
+	f, err := os.OpenFile(absPath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	version := byte(4)
+	var oldSize int64
+	var frames []id3Frame
+
+	var header [10]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return fmt.Errorf("read header: %w", errInvalid)
+	}
+	if bytes.HasPrefix(header[:], []byte("ID3")) {
+		version = header[3]
+		if version != 3 && version != 4 {
+			return fmt.Errorf("ID3v2.%d: %w", version, tags.ErrUnsupported)
+		}
+		if header[5]&0xd0 != 0 {
+			return fmt.Errorf("unsynchronised, extended, or footed tag: %w", tags.ErrUnsupported)
+		}
+		size := int64(syncsafe(header[6:10]))
+		b := make([]byte, size)
+		if _, err := f.ReadAt(b, 10); err != nil {
+			return fmt.Errorf("read tag: %w", errInvalid)
+		}
+		oldSize = size + 10
+
+		for len(b) >= 10 && b[0] != 0 {
+			frameSize := int(binary.BigEndian.Uint32(b[4:8]))
+			if version == 4 {
+				frameSize = int(syncsafe(b[4:8]))
+			}
+			if frameSize > len(b)-10 {
+				return fmt.Errorf("frame size: %w", errInvalid)
+			}
+			frames = append(frames, id3Frame(b[:10+frameSize]))
+			b = b[10+frameSize:]
+		}
+	}
+
+	oldFrames := joinFrames(frames)
+	newFrames := joinFrames(edit(version, frames))
+	if bytes.Equal(oldFrames, newFrames) {
+		return nil
+	}
+
+	if oldSize > 0 && int64(len(newFrames)) <= oldSize-10 {
+		tag := make([]byte, oldSize)
+		copy(tag, id3Header(version, int(oldSize-10)))
+		copy(tag[10:], newFrames)
+		if _, err := f.WriteAt(tag, 0); err != nil {
+			return fmt.Errorf("write tag: %w", err)
+		}
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("sync: %w", err)
+		}
+		return nil
+	}
+
+	tag := make([]byte, 10+len(newFrames)+id3Padding)
+	copy(tag, id3Header(version, len(newFrames)+id3Padding))
+	copy(tag[10:], newFrames)
+	return rewriteFile(f, absPath, tag, oldSize)
+}
+
+// rewriteFile replaces the first n bytes of f with head, writing to a new file next to it which is then moved over it.
+// the new file gets the old one's mode, owner, and group, and is synced before the move so a crash can't leave it empty
+func rewriteFile(f *os.File, absPath string, head []byte, n int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(absPath), "."+filepath.Base(absPath)+".*")
+	if err != nil {
+		return fmt.Errorf("create temp: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // gone after the rename
+	defer tmp.Close()
+
+	if _, err := tmp.Write(head); err != nil {
+		return fmt.Errorf("write tag: %w", err)
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(f, n, info.Size()-n)); err != nil {
+		return fmt.Errorf("copy audio: %w", err)
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return fmt.Errorf("chmod: %w", err)
+	}
+	if err := chownLike(tmp, info); err != nil {
+		return fmt.Errorf("chown: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("sync temp: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), absPath); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+	if dir, err := os.Open(filepath.Dir(absPath)); err == nil {
+		_ = dir.Sync() // so the rename is kept too. not every filesystem can
+		dir.Close()
+	}
+	return nil
+}
+
+func id3Header(version byte, size int) []byte {
+	h := []byte{'I', 'D', '3', version, 0, 0, 0, 0, 0, 0}
+	putSyncsafe(h[6:], uint32(size))
+	return h
+}
+
+func id3FrameHeader(version byte, id string, size int) []byte {
+	h := append([]byte(id), 0, 0, 0, 0, 0, 0)
+	if version == 4 {
+		putSyncsafe(h[4:], uint32(size))
+	} else {
+		binary.BigEndian.PutUint32(h[4:], uint32(size))
+	}
+	return h
+}
+
+func putSyncsafe(b []byte, v uint32) {
+	b[0], b[1], b[2], b[3] = byte(v>>21)&0x7f, byte(v>>14)&0x7f, byte(v>>7)&0x7f, byte(v)&0x7f
+}
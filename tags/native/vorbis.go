@@ -0,0 +1,106 @@
+package native
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// readVorbisComment reads a vorbis comment block, as found in FLAC, Ogg Vorbis, and Opus files. keys are uppercased
+// like taglib does. pictures stored as METADATA_BLOCK_PICTURE are covers rather than tags
+func readVorbisComment(f *file, b []byte, withCover bool) error {
+	vendorLen, b, ok := cutUint32LE(b)
+	if !ok || uint64(len(b)) < uint64(vendorLen) {
+		return fmt.Errorf("vendor: %w", errInvalid)
+	}
+	b = b[vendorLen:]
+
+	count, b, ok := cutUint32LE(b)
+	if !ok {
+		return fmt.Errorf("comment count: %w", errInvalid)
+	}
+	for range count {
+		var n uint32
+		if n, b, ok = cutUint32LE(b); !ok || uint64(len(b)) < uint64(n) {
+			return fmt.Errorf("comment: %w", errInvalid)
+		}
+		comment := string(b[:n])
+		b = b[n:]
+
+		k, v, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+		switch k = strings.ToUpper(k); k {
+		case "METADATA_BLOCK_PICTURE":
+			var data []byte
+			if withCover {
+				raw, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					continue
+				}
+				if data, err = readPictureBlock(raw); err != nil {
+					continue
+				}
+			}
+			f.addCover(data)
+		case "COVERART":
+			// the old unofficial way, just the base64 image
+			var data []byte
+			if withCover {
+				data, _ = base64.StdEncoding.DecodeString(v)
+			}
+			f.addCover(data)
+		default:
+			f.add(k, v)
+		}
+	}
+	return nil
+}
+
+// readPictureBlock returns the image data from a FLAC picture block, also used base64 encoded in Ogg comments
+func readPictureBlock(b []byte) ([]byte, error) {
+	b, ok := skip(b, 4) // picture type
+	if !ok {
+		return nil, errInvalid
+	}
+	for range 2 { // mime type, description
+		var n uint32
+		if n, b, ok = cutUint32BE(b); !ok {
+			return nil, errInvalid
+		}
+		if b, ok = skip(b, int(n)); !ok {
+			return nil, errInvalid
+		}
+	}
+	if b, ok = skip(b, 16); !ok { // width, height, depth, colours
+		return nil, errInvalid
+	}
+	n, b, ok := cutUint32BE(b)
+	if !ok || uint64(len(b)) < uint64(n) {
+		return nil, errInvalid
+	}
+	return b[:n], nil
+}
+
+func cutUint32LE(b []byte) (uint32, []byte, bool) {
+	if len(b) < 4 {
+		return 0, b, false
+	}
+	return binary.LittleEndian.Uint32(b), b[4:], true
+}
+
+func cutUint32BE(b []byte) (uint32, []byte, bool) {
+	if len(b) < 4 {
+		return 0, b, false
+	}
+	return binary.BigEndian.Uint32(b), b[4:], true
+}
+
+func skip(b []byte, n int) ([]byte, bool) {
+	if n < 0 || len(b) < n {
+		return b, false
+	}
+	return b[n:], true
+}
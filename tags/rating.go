@@ -0,0 +1,104 @@
+package tags
+
+import (
+	"math"
+	"strconv"
+)
+
+// tag keys that ratings are kept in, besides ID3 POPM frames
+const (
+	KeyRating     = "RATING"      // 1 to 5, though some players write 0 to 100
+	KeyFMPSRating = "FMPS_RATING" // 0.0 to 1.0
+	KeyLoved      = "LOVED"       // 1 if starred
+)
+
+// KeyPOPMPrefix and an email is the key readers give that user's ID3 POPM rating under, from 0 to 255, like
+// "POPM:alice@example.com". POPM frames aren't tags to taglib or ffprobe, so the readers add these themselves
+const KeyPOPMPrefix = "POPM:"
+
+// AddPOPM adds ID3 POPM ratings by email to t
+func AddPOPM(t Tags, popm map[string]byte) {
+	for email, rating := range popm {
+		t[KeyPOPMPrefix+email] = []string{strconv.Itoa(int(rating))}
+	}
+}
+
+// POPM is email's ID3 POPM rating in t, or 0 if there isn't one
+func POPM(t Tags, email string) byte {
+	vs := t[KeyPOPMPrefix+email]
+	if len(vs) == 0 {
+		return 0
+	}
+	rating, _ := strconv.ParseUint(vs[0], 10, 8)
+	return byte(rating)
+}
+
+// RatingWriter writes a user's rating and star into a file's tags
+type RatingWriter interface {
+	CanWriteRating(absPath string) bool
+	WriteRating(absPath string, r Rating) error
+}
+
+// Rating is what's kept in a file for one user. there can be an ID3 POPM frame per user, told apart by Email. the
+// other tags only have room for one user's, so are only written if Primary
+type Rating struct {
+	Email   string
+	Stars   int // 1 to 5, or 0 for none
+	Loved   bool
+	Primary bool
+	FMPS    bool // also write FMPS_RATING
+}
+
+// the values Windows Media Player writes for 1 to 5 stars, which most others follow
+//
+//nolint:gochecknoglobals
+var popmStars = [...]byte{0, 1, 64, 128, 196, 255}
+
+// StarsToPOPM converts 0 to 5 stars to an ID3 POPM rating
+func StarsToPOPM(stars int) byte {
+	return popmStars[min(max(stars, 0), 5)]
+}
+
+// POPMToStars converts an ID3 POPM rating to 0 to 5 stars
+func POPMToStars(b byte) int {
+	switch {
+	case b == 0:
+		return 0
+	case b < 32:
+		return 1
+	case b < 96:
+		return 2
+	case b < 160:
+		return 3
+	case b < 224:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// ParseRating reads a RATING tag as 0 to 5 stars. values over 5 are taken to be out of 100
+func ParseRating(in string) int {
+	f, err := strconv.ParseFloat(in, 64)
+	if err != nil || f <= 0 {
+		return 0
+	}
+	if f > 5 {
+		f /= 20
+	}
+	return min(int(math.Round(f)), 5)
+}
+
+// ParseFMPSRating reads an FMPS_RATING tag as 0 to 5 stars
+func ParseFMPSRating(in string) int {
+	f, err := strconv.ParseFloat(in, 64)
+	if err != nil || f <= 0 {
+		return 0
+	}
+	return min(int(math.Round(f*5)), 5)
+}
+
+// FormatFMPSRating is the FMPS_RATING tag for 0 to 5 stars
+func FormatFMPSRating(stars int) string {
+	return strconv.FormatFloat(float64(stars)/5, 'f', 1, 64)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"go.senan.xyz/gonic/tags"
+	"go.senan.xyz/gonic/tags/native"
 	"go.senan.xyz/taglib"
 )
 
@@ -32,9 +33,105 @@ func (Reader) Read(absPath string) (tags.Properties, tags.Tags, error) {
 		return tags.Properties{}, nil, fmt.Errorf("read tags: %w", err)
 	}
 
-	return tags.Properties{Length: tp.Length, Bitrate: tp.Bitrate, HasCover: len(tp.Images) > 0}, tag, nil
+	if (native.Writer{}).CanWriteRating(absPath) {
+		popm, _ := native.ReadPopularimeters(absPath) // a broken tag just has no ratings
+		tags.AddPOPM(tag, popm)
+	}
+
+	props := tags.Properties{
+		Length:     tp.Length,
+		Bitrate:    tp.Bitrate,
+		HasCover:   len(tp.Images) > 0,
+		SampleRate: tp.SampleRate,
+		Channels:   tp.Channels,
+	}
+
+	// taglib doesn't tell us the codec or bit depth. the codec mostly follows from the extension, and the bit depth
+	// from the bitrate for uncompressed audio only
+	props.Codec = codecForExt(absPath, tp.Bitrate)
+	if props.Codec == "pcm" && tp.SampleRate > 0 && tp.Channels > 0 {
+		perSample := tp.SampleRate * tp.Channels
+		props.BitDepth = (tp.Bitrate*1000 + perSample/2) / perSample // the bitrate is rounded to kbit/s
+		if props.BitDepth > 8 {
+			props.Codec = fmt.Sprintf("pcm_s%dle", props.BitDepth)
+		}
+	}
+
+	return props, tag, nil
+}
+
+// codecForExt is the codec of a file with absPath's extension, named as ffprobe names them. MP4 files hold either AAC
+// or ALAC, which are told apart by bitrate, since lossy AAC doesn't go over 320 kbit/s
+func codecForExt(absPath string, bitrate uint) string {
+	switch ext := strings.ToLower(filepath.Ext(absPath)); ext {
+	case ".mp3":
+		return "mp3"
+	case ".flac":
+		return "flac"
+	case ".aac":
+		return "aac"
+	case ".m4a", ".m4b":
+		if bitrate > 400 {
+			return "alac"
+		}
+		return "aac"
+	case ".ogg":
+		return "vorbis"
+	case ".opus":
+		return "opus"
+	case ".wma":
+		return "wmav2"
+	case ".wav":
+		return "pcm"
+	case ".wv":
+		return "wavpack"
+	case ".ape":
+		return "ape"
+	}
+	return ""
 }
 
 func (Reader) ReadCover(absPath string) ([]byte, error) {
 	return taglib.ReadImage(absPath)
 }
+
+var _ tags.RatingWriter = Writer{}
+
+// Writer writes ratings as ID3 POPM frames in MP3s, and RATING tags in other formats. FMPS_RATING and LOVED are
+// written as TXXX frames, Vorbis comments, or iTunes freeform atoms, as taglib maps them
+type Writer struct{}
+
+func (Writer) CanWriteRating(absPath string) bool {
+	return Reader{}.CanRead(absPath)
+}
+
+func (Writer) WriteRating(absPath string, r tags.Rating) error {
+	isMP3 := (native.Writer{}).CanWriteRating(absPath)
+	if r.Primary {
+		set := map[string][]string{tags.KeyLoved: nil}
+		if r.Loved {
+			set[tags.KeyLoved] = []string{"1"}
+		}
+		if !isMP3 {
+			set[tags.KeyRating] = nil
+			if r.Stars > 0 {
+				set[tags.KeyRating] = []string{fmt.Sprint(r.Stars)}
+			}
+		}
+		if r.FMPS {
+			set[tags.KeyFMPSRating] = nil
+			if r.Stars > 0 {
+				set[tags.KeyFMPSRating] = []string{tags.FormatFMPSRating(r.Stars)}
+			}
+		}
+		if err := taglib.WriteTags(absPath, set, 0); err != nil {
+			return fmt.Errorf("write tags: %w", err)
+		}
+	}
+	if isMP3 {
+		if err := native.WritePopularimeter(absPath, r.Email, tags.StarsToPOPM(r.Stars)); err != nil {
+			return fmt.Errorf("write popm: %w", err)
+		}
+	}
+	return nil
+}
@@ -23,9 +23,13 @@ type Reader interface {
 type Tags = map[string][]string
 
 type Properties struct {
-	Length   time.Duration
-	Bitrate  uint
-	HasCover bool
+	Length     time.Duration
+	Bitrate    uint
+	HasCover   bool
+	SampleRate uint // Hz
+	BitDepth   uint // bits per sample, or 0 for lossy codecs
+	Channels   uint
+	Codec      string // like "flac", "mp3", or "aac", as ffprobe names them
 }
 
 //nolint:gochecknoglobals
@@ -34,12 +38,14 @@ var (
 		MultiKey: []string{normtag.Artists}, Key: []string{normtag.Artist},
 		MultiKeyCredit: []string{normtag.ArtistsCredit}, KeyCredit: []string{normtag.ArtistCredit},
 		KeyMusicBrainzID: []string{normtag.MusicBrainzArtistID},
+		KeySort:          []string{"ARTISTSORT"},
 		Fallback:         "Unknown Artist",
 	}
 	AlbumArtist = &Spec{
 		MultiKey: []string{normtag.AlbumArtists}, Key: []string{normtag.AlbumArtist, normtag.Artist},
 		MultiKeyCredit: []string{normtag.AlbumArtistsCredit}, KeyCredit: []string{normtag.AlbumArtistCredit},
 		KeyMusicBrainzID: []string{normtag.MusicBrainzAlbumArtistID, normtag.MusicBrainzArtistID},
+		KeySort:          []string{"ALBUMARTISTSORT"},
 		Fallback:         "Unknown Artist",
 	}
 	Genre = &Spec{
@@ -58,6 +64,7 @@ var (
 		MultiKey: []string{normtag.Composers}, Key: []string{normtag.Composer},
 		MultiKeyCredit: []string{normtag.ComposersCredit}, KeyCredit: []string{normtag.ComposerCredit},
 		KeyMusicBrainzID: []string{normtag.MusicBrainzComposerID},
+		KeySort:          []string{"COMPOSERSORT"},
 	}
 	Lyricist = &Spec{
 		MultiKey: []string{normtag.Lyricists}, Key: []string{normtag.Lyricist},
@@ -84,9 +91,32 @@ var (
 		Key:      []string{normtag.Album},
 		Fallback: "Unknown Album",
 	}
+	AlbumSort = &Spec{
+		Key: []string{"ALBUMSORT"},
+	}
 	TrackTitle = &Spec{
 		Key: []string{normtag.Title},
 	}
+	TrackSort = &Spec{
+		Key: []string{"TITLESORT"},
+	}
+	Work = &Spec{
+		Key:              []string{"WORK"},
+		KeyMusicBrainzID: []string{"MUSICBRAINZ_WORKID"},
+	}
+	MovementName = &Spec{
+		Key: []string{"MOVEMENTNAME", "MOVEMENT"},
+	}
+	BPM = &Spec{
+		Key:   []string{"BPM"},
+		Valid: func(v string) bool { return ParseInt(v) > 0 },
+	}
+	Mood = &Spec{
+		MultiKey: []string{"MOODS"}, Key: []string{"MOOD"},
+	}
+	Comment = &Spec{
+		Key: []string{"COMMENT", "DESCRIPTION"},
+	}
 	Year = &Spec{
 		Key:   []string{normtag.OriginalDate, normtag.Date},
 		Valid: func(v string) bool { return !ParseDate(v).IsZero() },
@@ -97,6 +127,7 @@ type Spec struct {
 	MultiKey, Key             []string
 	MultiKeyCredit, KeyCredit []string
 	KeyMusicBrainzID          []string
+	KeySort                   []string
 	Fallback                  string
 	Valid                     func(string) bool
 }
@@ -115,7 +146,7 @@ type MultiValueSetting struct {
 }
 
 func ReadValues(t Tags, spec *Spec, settings map[*Spec]MultiValueSetting) []string {
-	values, _, _ := readMulti(t, spec, settings)
+	values, _, _, _ := readMulti(t, spec, settings)
 	return values
 }
 
@@ -123,7 +154,7 @@ func ReadCredits(t Tags, spec *Spec, settings map[*Spec]MultiValueSetting) []Cre
 	return pairCredits(readMulti(t, spec, settings))
 }
 
-func readMulti(t Tags, spec *Spec, settings map[*Spec]MultiValueSetting) (values, valuesCredit, valuesMusicBrainzID []string) {
+func readMulti(t Tags, spec *Spec, settings map[*Spec]MultiValueSetting) (values, valuesCredit, valuesMusicBrainzID, valuesSort []string) {
 	setting, ok := settings[spec]
 	if !ok {
 		setting = MultiValueSetting{Mode: Multi}
@@ -136,8 +167,9 @@ func readMulti(t Tags, spec *Spec, settings map[*Spec]MultiValueSetting) (values
 
 	valuesCredit = read(t, spec.MultiKeyCredit, spec.KeyCredit, setting, nil)
 	valuesMusicBrainzID = read(t, nil, spec.KeyMusicBrainzID, setting, nil)
+	valuesSort = read(t, nil, spec.KeySort, setting, nil)
 
-	return values, valuesCredit, valuesMusicBrainzID
+	return values, valuesCredit, valuesMusicBrainzID, valuesSort
 }
 
 func Read(t Tags, spec *Spec) (value, valueCredit string) {
@@ -204,9 +236,10 @@ func read(t Tags, multiKey, key []string, setting MultiValueSetting, valid func(
 type Credited struct {
 	Value, ValueCredit string
 	MusicBrainzID      string
+	Sort               string
 }
 
-func pairCredits(values, valuesCredit, valuesMusicBrainzID []string) []Credited {
+func pairCredits(values, valuesCredit, valuesMusicBrainzID, valuesSort []string) []Credited {
 	out := make([]Credited, 0, len(values))
 	for i, v := range values {
 		if v == "" {
@@ -220,6 +253,9 @@ func pairCredits(values, valuesCredit, valuesMusicBrainzID []string) []Credited
 		if len(valuesMusicBrainzID) == len(values) {
 			e.MusicBrainzID = valuesMusicBrainzID[i]
 		}
+		if len(valuesSort) == len(values) {
+			e.Sort = valuesSort[i]
+		}
 		out = append(out, e)
 	}
 	return out
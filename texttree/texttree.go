@@ -96,3 +96,20 @@ func collectDescendants(name string, children map[string][]string) []string {
 	}
 	return result
 }
+
+// Parents maps each name in a tree from ParseReader to its direct parent. names at the top of the tree have no entry
+func Parents(tree map[string][]string) map[string]string {
+	parents := map[string]string{}
+	for name, descendants := range tree {
+		for _, desc := range descendants {
+			if desc == name {
+				continue
+			}
+			// the closest ancestor is the one with the fewest descendants, since each name has only one parent
+			if cur, ok := parents[desc]; !ok || len(tree[name]) < len(tree[cur]) {
+				parents[desc] = name
+			}
+		}
+	}
+	return parents
+}
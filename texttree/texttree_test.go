@@ -43,3 +43,17 @@ func TestParseReaderDuplicateChild(t *testing.T) {
 	_, err := texttree.ParseReader(strings.NewReader("a\tb\nc\tb\n"))
 	assert.Error(t, err)
 }
+
+func TestParents(t *testing.T) {
+	t.Parallel()
+
+	tree, err := texttree.ParseReader(strings.NewReader("electronic\tedm\nedm\ttechno\nedm\thouse\nrock\tpunk\n")) //nolint:dupword
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"edm":    "electronic",
+		"techno": "edm",
+		"house":  "edm",
+		"punk":   "rock",
+	}, texttree.Parents(tree))
+}
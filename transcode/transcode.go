@@ -18,6 +18,11 @@ type Transcoder interface {
 	Transcode(ctx context.Context, profile Profile, in string, out io.Writer) error
 }
 
+// StreamTranscoder can also transcode from a reader, for live input with no file to read
+type StreamTranscoder interface {
+	TranscodeStream(ctx context.Context, profile Profile, in io.Reader, out io.Writer) error
+}
+
 var UserProfiles = map[string]Profile{
 	"mp3":          MP3,
 	"mp3_320":      MP3320,
@@ -87,7 +92,10 @@ func EstimateSize(p Profile, d time.Duration) int64 {
 	return int64(d.Seconds() * bytesPerSec * (100 + headroomPct) / 100)
 }
 
-var ErrNoProfileParts = fmt.Errorf("not enough profile parts")
+var (
+	ErrNoProfileParts     = fmt.Errorf("not enough profile parts")
+	ErrNoStreamTranscoder = fmt.Errorf("transcoder can't read from a stream")
+)
 
 func parseProfile(profile Profile, in string) (string, []string, error) {
 	parts, err := shlex.Split(profile.exec)
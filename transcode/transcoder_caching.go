@@ -22,6 +22,7 @@ type CachingTranscoder struct {
 }
 
 var _ Transcoder = (*CachingTranscoder)(nil)
+var _ StreamTranscoder = (*CachingTranscoder)(nil)
 
 func NewCachingTranscoder(t Transcoder, c *cache.DirCache) *CachingTranscoder {
 	return &CachingTranscoder{transcoder: t, cache: c}
@@ -70,6 +71,15 @@ func (t *CachingTranscoder) Transcode(ctx context.Context, profile Profile, in s
 	return nil
 }
 
+// TranscodeStream is never cached, since live input is different every time
+func (t *CachingTranscoder) TranscodeStream(ctx context.Context, profile Profile, in io.Reader, out io.Writer) error {
+	st, ok := t.transcoder.(StreamTranscoder)
+	if !ok {
+		return ErrNoStreamTranscoder
+	}
+	return st.TranscodeStream(ctx, profile, in, out)
+}
+
 func (t *CachingTranscoder) CachedPath(profile Profile, in string) (string, func(), error) {
 	if profile.Seek() > 0 {
 		return "", nil, nil
@@ -11,6 +11,7 @@ import (
 type FFmpegTranscoder struct{}
 
 var _ Transcoder = (*FFmpegTranscoder)(nil)
+var _ StreamTranscoder = (*FFmpegTranscoder)(nil)
 
 func NewFFmpegTranscoder() *FFmpegTranscoder {
 	return &FFmpegTranscoder{}
@@ -22,12 +23,22 @@ var (
 )
 
 func (*FFmpegTranscoder) Transcode(ctx context.Context, profile Profile, in string, out io.Writer) error {
+	return runFFmpeg(ctx, profile, in, nil, out)
+}
+
+// TranscodeStream reads the input from stdin, for sources that aren't files such as internet radio
+func (*FFmpegTranscoder) TranscodeStream(ctx context.Context, profile Profile, in io.Reader, out io.Writer) error {
+	return runFFmpeg(ctx, profile, "pipe:0", in, out)
+}
+
+func runFFmpeg(ctx context.Context, profile Profile, in string, stdin io.Reader, out io.Writer) error {
 	name, args, err := parseProfile(profile, in)
 	if err != nil {
 		return fmt.Errorf("split command: %w", err)
 	}
 
 	cmd := exec.CommandContext(ctx, name, args...) //nolint:gosec // profile commands are hardcoded, args passed separately (no shell)
+	cmd.Stdin = stdin
 	cmd.Stdout = out
 
 	if err := cmd.Start(); err != nil {
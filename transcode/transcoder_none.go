@@ -10,6 +10,7 @@ import (
 type NoneTranscoder struct{}
 
 var _ Transcoder = (*NoneTranscoder)(nil)
+var _ StreamTranscoder = (*NoneTranscoder)(nil)
 
 func NewNoneTranscoder() *NoneTranscoder {
 	return &NoneTranscoder{}
@@ -26,3 +27,10 @@ func (*NoneTranscoder) Transcode(_ context.Context, _ Profile, in string, out io
 	}
 	return nil
 }
+
+func (*NoneTranscoder) TranscodeStream(_ context.Context, _ Profile, in io.Reader, out io.Writer) error {
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("copy stream: %w", err)
+	}
+	return nil
+}